@@ -0,0 +1,169 @@
+// Package backendtest provides an in-memory plumber.BackupChecker for tests
+// that need backup checks without a storage service.
+//
+// Like s3test, the package is not internal so that test suites outside this
+// module can use it. It depends only on the public plumber package, so every
+// type in its API can be named outside this module.
+package backendtest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/plumber"
+)
+
+// Backend is a fake backend holding check results and snapshot files per
+// {namespace}/{pvc}. PVCs without a result have no backup. Besides
+// plumber.BackupChecker, it lists repositories, snapshot files and
+// repository files the way pvc-plumber's storage backends do, and is safe
+// for concurrent use.
+type Backend struct {
+	mu      sync.Mutex
+	results map[plumber.Repository]plumber.CheckResult
+	files   map[plumber.Repository][]plumber.SnapshotFile
+	layout  map[plumber.Repository][]plumber.RepositoryFile
+	errs    map[plumber.Repository]error
+	calls   map[plumber.Repository]int
+	delay   time.Duration
+}
+
+func New() *Backend {
+	return &Backend{
+		results: make(map[plumber.Repository]plumber.CheckResult),
+		files:   make(map[plumber.Repository][]plumber.SnapshotFile),
+		layout:  make(map[plumber.Repository][]plumber.RepositoryFile),
+		errs:    make(map[plumber.Repository]error),
+		calls:   make(map[plumber.Repository]int),
+	}
+}
+
+// AddRepository records a valid restic repository for namespace/pvc with a
+// snapshot file for each of times. Each snapshot adds one 1 MiB pack, written
+// at the snapshot's time.
+func (b *Backend) AddRepository(namespace, pvc string, times ...time.Time) {
+	repo := plumber.Repository{Namespace: namespace, PVC: pvc}
+	files := make([]plumber.SnapshotFile, 0, len(times))
+	layout := []plumber.RepositoryFile{
+		{Path: "config", Size: 155},
+		{Path: "keys/" + snapshotName(len(times)), Size: 460},
+	}
+	for i, t := range times {
+		files = append(files, plumber.SnapshotFile{Name: snapshotName(i), ModTime: t})
+		layout = append(layout,
+			plumber.RepositoryFile{Path: "data/00/" + snapshotName(i), Size: 1 << 20, ModTime: t},
+			plumber.RepositoryFile{Path: "index/" + snapshotName(i), Size: 1024, ModTime: t},
+			plumber.RepositoryFile{Path: "snapshots/" + snapshotName(i), Size: 256, ModTime: t})
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.results[repo] = plumber.CheckResult{Exists: true, KeyCount: 4, RepoType: plumber.RepoTypeRestic}
+	b.files[repo] = files
+	b.layout[repo] = layout
+}
+
+// SetRepositoryFiles replaces the files listed for namespace/pvc.
+func (b *Backend) SetRepositoryFiles(namespace, pvc string, files []plumber.RepositoryFile) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.layout[plumber.Repository{Namespace: namespace, PVC: pvc}] = files
+}
+
+// SetResult makes checks of namespace/pvc return result.
+func (b *Backend) SetResult(namespace, pvc string, result plumber.CheckResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.results[plumber.Repository{Namespace: namespace, PVC: pvc}] = result
+}
+
+// Fail makes checks and file listings of namespace/pvc fail with err,
+// classified as a real backend would.
+func (b *Backend) Fail(namespace, pvc string, err error) {
+	b.SetResult(namespace, pvc, plumber.Failure(err))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errs[plumber.Repository{Namespace: namespace, PVC: pvc}] = err
+}
+
+// SetDelay makes every check wait d, or until its context is done.
+func (b *Backend) SetDelay(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.delay = d
+}
+
+// Calls returns the number of checks of namespace/pvc.
+func (b *Backend) Calls(namespace, pvc string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls[plumber.Repository{Namespace: namespace, PVC: pvc}]
+}
+
+func (b *Backend) CheckBackupExists(ctx context.Context, namespace, pvc string) plumber.CheckResult {
+	repo := plumber.Repository{Namespace: namespace, PVC: pvc}
+	b.mu.Lock()
+	b.calls[repo]++
+	result, delay := b.results[repo], b.delay
+	b.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return plumber.Failure(ctx.Err())
+		case <-timer.C:
+		}
+	}
+	return result
+}
+
+// ListRepositories returns every repository with a result, sorted.
+func (b *Backend) ListRepositories(ctx context.Context) ([]plumber.Repository, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	repos := make([]plumber.Repository, 0, len(b.results))
+	for repo := range b.results {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].Namespace != repos[j].Namespace {
+			return repos[i].Namespace < repos[j].Namespace
+		}
+		return repos[i].PVC < repos[j].PVC
+	})
+	return repos, nil
+}
+
+func (b *Backend) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]plumber.SnapshotFile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	repo := plumber.Repository{Namespace: namespace, PVC: pvc}
+	if err := b.errs[repo]; err != nil {
+		return nil, err
+	}
+	return append([]plumber.SnapshotFile(nil), b.files[repo]...), nil
+}
+
+func (b *Backend) ListRepositoryFiles(ctx context.Context, namespace, pvc string) ([]plumber.RepositoryFile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	repo := plumber.Repository{Namespace: namespace, PVC: pvc}
+	if err := b.errs[repo]; err != nil {
+		return nil, err
+	}
+	return append([]plumber.RepositoryFile(nil), b.layout[repo]...), nil
+}
+
+// snapshotName returns a 64-character hex ID like restic's.
+func snapshotName(i int) string {
+	const hex = "0123456789abcdef"
+	name := make([]byte, 64)
+	for j := range name {
+		name[j] = hex[(i+j)%16]
+	}
+	return string(name)
+}
@@ -0,0 +1,34 @@
+package backendtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/plumber"
+)
+
+func TestFail(t *testing.T) {
+	b := New()
+	b.AddRepository("karakeep", "data-pvc", time.Now())
+	errDown := errors.New("connection reset")
+	b.Fail("karakeep", "data-pvc", errDown)
+	ctx := context.Background()
+
+	if result := b.CheckBackupExists(ctx, "karakeep", "data-pvc"); result.Error == "" || result.ErrorCode != plumber.CodeBackendError {
+		t.Errorf("CheckBackupExists() = %+v, want the injected failure", result)
+	}
+	if files, err := b.ListSnapshotFiles(ctx, "karakeep", "data-pvc"); files != nil || !errors.Is(err, errDown) {
+		t.Errorf("ListSnapshotFiles() = %v, %v; want the injected error", files, err)
+	}
+	if files, err := b.ListRepositoryFiles(ctx, "karakeep", "data-pvc"); files != nil || !errors.Is(err, errDown) {
+		t.Errorf("ListRepositoryFiles() = %v, %v; want the injected error", files, err)
+	}
+
+	// Other repositories are unaffected.
+	b.AddRepository("karakeep", "meili", time.Now())
+	if files, err := b.ListSnapshotFiles(ctx, "karakeep", "meili"); len(files) != 1 || err != nil {
+		t.Errorf("ListSnapshotFiles() = %v, %v; want one snapshot", files, err)
+	}
+}
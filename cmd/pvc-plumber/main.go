@@ -2,20 +2,50 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/mitchross/pvc-plumber/internal/admission"
+	"github.com/mitchross/pvc-plumber/internal/audit"
+	"github.com/mitchross/pvc-plumber/internal/azure"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/checker"
 	"github.com/mitchross/pvc-plumber/internal/config"
+	"github.com/mitchross/pvc-plumber/internal/controller"
+	"github.com/mitchross/pvc-plumber/internal/filesystem"
+	"github.com/mitchross/pvc-plumber/internal/freshness"
+	"github.com/mitchross/pvc-plumber/internal/gcs"
 	"github.com/mitchross/pvc-plumber/internal/handler"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kyverno"
+	"github.com/mitchross/pvc-plumber/internal/orphans"
+	"github.com/mitchross/pvc-plumber/internal/otlp"
+	"github.com/mitchross/pvc-plumber/internal/protection"
+	"github.com/mitchross/pvc-plumber/internal/ratelimit"
+	"github.com/mitchross/pvc-plumber/internal/restic"
+	"github.com/mitchross/pvc-plumber/internal/restserver"
 	"github.com/mitchross/pvc-plumber/internal/s3"
+	"github.com/mitchross/pvc-plumber/internal/stats"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+	"github.com/mitchross/pvc-plumber/internal/volsync"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		os.Exit(runReport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "kyverno-policy" {
+		os.Exit(runKyvernoPolicy(os.Args[2:]))
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -44,48 +74,275 @@ func main() {
 	slog.SetDefault(logger)
 
 	logger.Info("starting pvc-plumber",
+		"backend", cfg.Backend,
+		"fs_root", cfg.FSRoot,
 		"s3_endpoint", cfg.S3Endpoint,
 		"s3_bucket", cfg.S3Bucket,
 		"http_timeout", cfg.HTTPTimeout,
 		"port", cfg.Port,
-		"log_level", cfg.LogLevel)
+		"log_level", cfg.LogLevel,
+		"controller_enabled", cfg.ControllerEnabled,
+		"freshness_enabled", cfg.FreshnessEnabled,
+		"stats_enabled", cfg.StatsEnabled,
+		"webhook_enabled", cfg.WebhookEnabled,
+		"capacity_guard", cfg.CapacityGuard,
+		"orphan_cleanup_enabled", cfg.OrphanCleanupEnabled,
+		"orphan_cleanup_delete", cfg.OrphanCleanupDelete,
+		"otlp_endpoint", cfg.OTLPEndpoint,
+		"audit_log", cfg.AuditLog,
+		"rate_limit_rps", cfg.RateLimitRPS,
+		"max_concurrent_lookups", cfg.MaxConcurrentLookups)
 
-	// Create S3 client
-	httpClient := &http.Client{
-		Timeout: cfg.HTTPTimeout,
+	// Create the storage backend
+	b, err := newBackend(cfg)
+	if err != nil {
+		logger.Error("failed to create backend", "backend", cfg.Backend, "error", err)
+		os.Exit(1)
+	}
+
+	// Create Kubernetes client when a feature needs the API server
+	var kubeClient *kube.Client
+	if cfg.ControllerEnabled || cfg.RestorePlanApply || cfg.ReportEnabled || cfg.OrphanCleanupEnabled {
+		kubeClient, err = kube.NewInClusterClient()
+		if err != nil {
+			logger.Error("failed to create kubernetes client", "error", err)
+			os.Exit(1)
+		}
 	}
-	s3Client := s3.NewClient(cfg.S3Endpoint, cfg.S3Bucket, httpClient)
+
+	planner := volsync.NewPlanner(volsync.Options{
+		NameTemplate:             cfg.VolSyncDestinationName,
+		RepositorySecretTemplate: cfg.VolSyncRepositorySecret,
+		CopyMethod:               cfg.VolSyncCopyMethod,
+		StorageClassName:         cfg.VolSyncStorageClass,
+		VolumeSnapshotClassName:  cfg.VolSyncSnapshotClass,
+		Capacity:                 cfg.VolSyncCapacity,
+	}, kubeClient)
+
+	guard := ratelimit.New(ratelimit.Options{
+		Rate:          cfg.RateLimitRPS,
+		Burst:         cfg.RateLimitBurst,
+		Key:           cfg.RateLimitKey,
+		MaxConcurrent: cfg.MaxConcurrentLookups,
+		MaxQueue:      cfg.LookupQueueSize,
+		QueueTimeout:  cfg.LookupQueueTimeout,
+	})
 
 	// Create handlers
-	h := handler.New(s3Client, logger)
+	opts := []handler.Option{
+		handler.WithRestorePlanner(planner),
+		handler.WithKyverno(kyverno.NewResponder(kyverno.Options{
+			DestinationTemplate:      cfg.VolSyncDestinationName,
+			RepositorySecretTemplate: cfg.VolSyncRepositorySecret,
+		})),
+	}
+	checked, checkMetrics := newChecker(cfg, b, guard, logger)
+	for _, m := range checkMetrics {
+		opts = append(opts, handler.WithMetrics(m))
+	}
+	var snapshotLister *restic.Lister
+	if cfg.ResticPasswordFile != "" {
+		storage, ok := b.(restic.Storage)
+		if !ok {
+			logger.Error("backend cannot read repository files", "backend", cfg.Backend)
+			os.Exit(1)
+		}
+		snapshotLister = restic.NewLister(storage, cfg.ResticPasswordFile)
+		opts = append(opts, handler.WithSnapshotLister(snapshotLister))
+	}
+	var scanner *freshness.Scanner
+	if cfg.FreshnessEnabled {
+		source, ok := scanSource(b, checked)
+		if !ok {
+			logger.Error("backend cannot inventory repositories for freshness monitoring", "backend", cfg.Backend)
+			os.Exit(1)
+		}
+		scanner = freshness.New(source, freshness.SLO{
+			MaxAge:     cfg.FreshnessMaxAge,
+			Namespaces: cfg.FreshnessNamespaceMaxAge,
+		}, cfg.FreshnessInterval, logger)
+		opts = append(opts, handler.WithFreshness(scanner))
+	}
+	if cfg.ReportEnabled {
+		inventory, ok := b.(backend.Inventory)
+		if !ok {
+			logger.Error("backend cannot inventory repositories for protection reports", "backend", cfg.Backend)
+			os.Exit(1)
+		}
+		opts = append(opts, handler.WithProtectionReport(protection.NewReporter(kubeClient, inventory)))
+	}
+	var collector *stats.Collector
+	if cfg.StatsEnabled {
+		lister, ok := b.(backend.RepositoryFileLister)
+		if !ok {
+			logger.Error("backend cannot list repository files for statistics", "backend", cfg.Backend)
+			os.Exit(1)
+		}
+		collector = stats.New(lister, cfg.StatsCacheTTL)
+		opts = append(opts, handler.WithStats(collector, cfg.ExistsIncludeSize))
+	}
+	if cfg.WebhookEnabled {
+		opts = append(opts, handler.WithAdmission(newWebhook(cfg, b, checked, snapshotLister, collector, logger)))
+	}
+	var cleaner *orphans.Cleaner
+	if cfg.OrphanCleanupEnabled {
+		source, ok := scanSource(b, checked)
+		inventory, isInventory := b.(backend.Inventory)
+		if !ok || !isInventory {
+			logger.Error("backend cannot inventory repositories for orphan cleanup", "backend", cfg.Backend)
+			os.Exit(1)
+		}
+		var deleter orphans.Deleter
+		var audit io.Writer
+		if cfg.OrphanCleanupDelete {
+			if deleter, ok = b.(orphans.Deleter); !ok {
+				logger.Error("backend cannot delete repositories", "backend", cfg.Backend)
+				os.Exit(1)
+			}
+			auditFile, err := os.OpenFile(cfg.OrphanAuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+			if err != nil {
+				logger.Error("failed to open audit log", "path", cfg.OrphanAuditLog, "error", err)
+				os.Exit(1)
+			}
+			defer func() { _ = auditFile.Close() }()
+			audit = auditFile
+		}
+		cleaner = orphans.New(protection.NewReporter(kubeClient, inventory), source, deleter, orphans.Options{
+			GracePeriod:     cfg.OrphanGracePeriod,
+			StateFile:       cfg.OrphanStateFile,
+			Rules:           cfg.OrphanCleanupRules,
+			Delete:          cfg.OrphanCleanupDelete,
+			DeleteInterval:  cfg.OrphanDeleteInterval,
+			MaxRepositories: cfg.OrphanDeleteMaxRepos,
+		}, audit, logger)
+		opts = append(opts, handler.WithOrphanCleaner(cleaner))
+	}
+	if cfg.AuditLog != "" {
+		var w io.Writer = os.Stdout
+		if cfg.AuditLog != "stdout" {
+			file, err := audit.OpenRotatingFile(cfg.AuditLog, cfg.AuditLogMaxSize, cfg.AuditLogMaxBackups, logger)
+			if err != nil {
+				logger.Error("failed to open audit log", "error", err)
+				os.Exit(1)
+			}
+			defer func() { _ = file.Close() }()
+			w = file
+		}
+		opts = append(opts, handler.WithAudit(audit.New(w, cfg.Backend, backendLocation(cfg), logger)))
+	}
+	opts = append(opts, handler.WithRateLimit(guard))
+	tracer := trace.NewTracer(nil, 1)
+	var spanExporter *otlp.Exporter
+	if cfg.OTLPEndpoint != "" {
+		spanExporter = otlp.New(cfg.OTLPEndpoint, otlp.Options{
+			ServiceName: cfg.OTLPServiceName,
+			BatchSize:   cfg.TraceBatchSize,
+			Interval:    cfg.TraceExportPeriod,
+		}, &http.Client{Timeout: 10 * time.Second}, logger)
+		tracer = trace.NewTracer(spanExporter, cfg.TraceSampleRatio)
+		opts = append(opts, handler.WithTraceExporter(spanExporter))
+	}
+	h := handler.New(checked, logger, opts...)
 
 	// Setup HTTP server
+	// Routes that query the backend share the concurrency cap.
 	mux := http.NewServeMux()
-	mux.HandleFunc("/exists/", h.HandleExists)
-	mux.HandleFunc("/healthz", h.HandleHealthz)
-	mux.HandleFunc("/readyz", h.HandleReadyz)
-	mux.HandleFunc("/metrics", h.HandleMetrics)
+	h.Register(mux, handler.Routes{
+		Limited:           guard.Limit,
+		Lookup:            func(next http.Handler) http.Handler { return guard.Limit(guard.Gate(next)) },
+		Admission:         guard.Gate,
+		ApplyRestorePlans: cfg.RestorePlanApply,
+	})
 
 	server := &http.Server{
 		Addr:    ":" + cfg.Port,
-		Handler: mux,
+		Handler: tracer.Middleware(mux),
+	}
+	if cfg.TLSCertFile != "" {
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: newCertificateLoader(cfg.TLSCertFile, cfg.TLSKeyFile).get,
+		}
 	}
 
 	// Start server in a goroutine
 	go func() {
-		logger.Info("server starting", "addr", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("server starting", "addr", server.Addr, "tls", server.TLSConfig != nil)
+		serve := server.ListenAndServe
+		if server.TLSConfig != nil {
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			logger.Error("server error", "error", err)
 			os.Exit(1)
 		}
 	}()
 
+	// Start the PVC controller if enabled
+	controllerCtx, stopController := context.WithCancel(context.Background())
+	defer stopController()
+	controllerDone := make(chan struct{})
+	if cfg.ControllerEnabled {
+		c := controller.New(kubeClient, checked, cfg.ControllerNamespace, cfg.ControllerResync, logger)
+		go func() {
+			defer close(controllerDone)
+			_ = c.Run(controllerCtx)
+		}()
+	} else {
+		close(controllerDone)
+	}
+
+	// Start the backup freshness scanner if enabled
+	scannerCtx, stopScanner := context.WithCancel(context.Background())
+	defer stopScanner()
+	scannerDone := make(chan struct{})
+	if scanner != nil {
+		go func() {
+			defer close(scannerDone)
+			scanner.Run(scannerCtx)
+		}()
+	} else {
+		close(scannerDone)
+	}
+
+	// Start orphan cleanup if enabled
+	cleanerCtx, stopCleaner := context.WithCancel(context.Background())
+	defer stopCleaner()
+	cleanerDone := make(chan struct{})
+	if cleaner != nil {
+		go func() {
+			defer close(cleanerDone)
+			cleaner.Run(cleanerCtx, cfg.OrphanCleanupInterval)
+		}()
+	} else {
+		close(cleanerDone)
+	}
+
+	// Start the span exporter if tracing is configured
+	exporterCtx, stopExporter := context.WithCancel(context.Background())
+	defer stopExporter()
+	exporterDone := make(chan struct{})
+	if spanExporter != nil {
+		go func() {
+			defer close(exporterDone)
+			spanExporter.Run(exporterCtx)
+		}()
+	} else {
+		close(exporterDone)
+	}
+
 	// Wait for interrupt signal for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	logger.Info("shutting down server")
+	stopController()
+	stopScanner()
+	stopCleaner()
+	<-controllerDone
+	<-scannerDone
+	<-cleanerDone
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -96,5 +353,138 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Flush the spans of the last requests
+	stopExporter()
+	<-exporterDone
+
 	logger.Info("server stopped")
 }
+
+// backendLocation describes where cfg's backend keeps repositories, for
+// audit records.
+func backendLocation(cfg *config.Config) string {
+	switch cfg.Backend {
+	case config.BackendFilesystem:
+		return cfg.FSRoot
+	case config.BackendRest:
+		return cfg.RestURL
+	case config.BackendAzure:
+		endpoint := cfg.AzureEndpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.AzureAccount)
+		}
+		return strings.TrimSuffix(endpoint, "/") + "/" + cfg.AzureContainer
+	case config.BackendGCS:
+		return "gs://" + cfg.GCSBucket
+	default:
+		return strings.TrimSuffix(cfg.S3Endpoint, "/") + "/" + cfg.S3Bucket
+	}
+}
+
+// newChecker assembles the middleware that backup checks pass through on the
+// way to b, and returns the metrics it exposes. Features that need more of
+// the backend than CheckBackupExists use b directly. The guard's concurrency
+// cap is innermost, so that checks from the controller and the scans share
+// it with HTTP lookups and cache hits never wait for a slot.
+func newChecker(cfg *config.Config, b backend.Backend, guard *ratelimit.Guard, logger *slog.Logger) (backend.Backend, []handler.MetricsWriter) {
+	metrics := checker.NewMetrics()
+	middleware := []checker.Middleware{checker.Logging(logger)}
+	writers := []handler.MetricsWriter{metrics}
+	if cfg.CheckCacheTTL > 0 {
+		cache := checker.NewCache(cfg.CheckCacheTTL, cfg.CheckCacheSize)
+		middleware = append(middleware, cache.Middleware)
+		writers = append(writers, cache)
+	}
+	middleware = append(middleware, metrics.Middleware)
+	if cfg.FallbackS3Endpoint != "" {
+		replica := s3.NewClient(cfg.FallbackS3Endpoint, cfg.FallbackS3Bucket, &http.Client{Timeout: cfg.HTTPTimeout},
+			s3Options(cfg.FallbackS3AccessKeyID, cfg.FallbackS3SecretAccessKey, cfg.FallbackS3Region)...)
+		middleware = append(middleware, checker.Fallback(replica, logger))
+	}
+	if cfg.CheckRetries > 0 {
+		middleware = append(middleware, checker.Retry(cfg.CheckRetries, cfg.CheckRetryBackoff))
+	}
+	middleware = append(middleware, guard.Middleware)
+	return checker.Chain(b, middleware...), writers
+}
+
+// source is what the freshness scanner and orphan cleanup read: backup
+// checks go through the checker chain, and listings go to the backend.
+type source struct {
+	backend.Backend
+	backend.Inventory
+	backend.SnapshotFileLister
+}
+
+// scanSource returns the source of background scans, or false if b cannot
+// inventory repositories and list their snapshots.
+func scanSource(b, checked backend.Backend) (*source, bool) {
+	inventory, ok := b.(backend.Inventory)
+	files, isLister := b.(backend.SnapshotFileLister)
+	if !ok || !isLister {
+		return nil, false
+	}
+	return &source{Backend: checked, Inventory: inventory, SnapshotFileLister: files}, true
+}
+
+// newWebhook creates the admission webhook. Restores are described and
+// sized from decrypted snapshots when a password file is configured, and
+// otherwise from what the backend can list.
+func newWebhook(cfg *config.Config, b, checked backend.Backend, snapshots *restic.Lister, collector *stats.Collector, logger *slog.Logger) *admission.Webhook {
+	var metadata backend.SnapshotLister
+	if snapshots != nil {
+		metadata = snapshots
+	}
+	files, _ := b.(backend.SnapshotFileLister)
+
+	var sizer admission.Sizer
+	if cfg.CapacityGuard != admission.CapacityOff {
+		if lister, ok := b.(backend.RepositoryFileLister); ok && collector == nil {
+			collector = stats.New(lister, cfg.StatsCacheTTL)
+		}
+		if metadata == nil && collector == nil {
+			logger.Warn("backend cannot size restores, capacity guard disabled", "backend", cfg.Backend)
+		} else {
+			sizer = admission.NewEstimator(collector)
+		}
+	}
+	return admission.New(checked, metadata, sizer, admission.NewSnapshots(files), admission.Options{
+		DestinationTemplate: cfg.VolSyncDestinationName,
+		Capacity:            cfg.CapacityGuard,
+		Headroom:            cfg.CapacityHeadroom,
+	}, logger)
+}
+
+// newBackend creates the storage backend selected by cfg.Backend.
+func newBackend(cfg *config.Config) (backend.Backend, error) {
+	httpClient := &http.Client{
+		Timeout: cfg.HTTPTimeout,
+	}
+	switch cfg.Backend {
+	case config.BackendFilesystem:
+		return filesystem.New(cfg.FSRoot), nil
+	case config.BackendRest:
+		return restserver.NewClient(cfg.RestURL, cfg.RestUsername, cfg.RestPassword, httpClient), nil
+	case config.BackendAzure:
+		return azure.NewClient(cfg.AzureEndpoint, cfg.AzureAccount, cfg.AzureContainer,
+			cfg.AzureAccountKey, cfg.AzureSASToken, httpClient)
+	case config.BackendGCS:
+		return gcs.NewClient(cfg.GCSEndpoint, cfg.GCSBucket, cfg.GCSCredentialsFile, httpClient)
+	default:
+		return s3.NewClient(cfg.S3Endpoint, cfg.S3Bucket, httpClient,
+			s3Options(cfg.S3AccessKeyID, cfg.S3SecretAccessKey, cfg.S3Region)...), nil
+	}
+}
+
+// s3Options signs S3 requests when an access key is configured, and leaves
+// them anonymous otherwise.
+func s3Options(accessKeyID, secretAccessKey, region string) []s3.Option {
+	if accessKeyID == "" {
+		return nil
+	}
+	return []s3.Option{s3.WithCredentials(s3.Credentials{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Region:          region,
+	})}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mitchross/pvc-plumber/internal/config"
+	"github.com/mitchross/pvc-plumber/internal/kyverno"
+	"github.com/mitchross/pvc-plumber/internal/yaml"
+)
+
+// runKyvernoPolicy implements "pvc-plumber kyverno-policy": it prints a
+// Kyverno ClusterPolicy for the configured VolSync settings. Run it with the
+// service's environment so that the policy matches the running service.
+func runKyvernoPolicy(args []string) int {
+	flags := flag.NewFlagSet("kyverno-policy", flag.ContinueOnError)
+	name := flags.String("name", "pvc-plumber-restore", "name of the ClusterPolicy")
+	url := flags.String("url", "http://pvc-plumber.kube-system.svc.cluster.local:8080", "pvc-plumber URL as seen from Kyverno")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 2
+	}
+	policy, err := kyverno.Policy(kyverno.PolicyOptions{
+		Name:                    *name,
+		ServiceURL:              *url,
+		CopyMethod:              cfg.VolSyncCopyMethod,
+		StorageClassName:        cfg.VolSyncStorageClass,
+		VolumeSnapshotClassName: cfg.VolSyncSnapshotClass,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render policy: %v\n", err)
+		return 2
+	}
+	out, err := yaml.Marshal(policy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode policy: %v\n", err)
+		return 2
+	}
+	_, _ = os.Stdout.Write(out)
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/config"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/protection"
+)
+
+// runReport implements "pvc-plumber report": it prints unprotected PVCs,
+// orphaned backups and likely name mismatches, and exits 1 when any PVC is
+// unprotected so it can gate scripts.
+func runReport(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	namespace := flags.String("namespace", "", "only report on this namespace")
+	output := flags.String("o", "text", "output format: text or json")
+	timeout := flags.Duration("timeout", time.Minute, "time limit for the report")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "invalid output format %q\n", *output)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 2
+	}
+	b, err := newBackend(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create backend: %v\n", err)
+		return 2
+	}
+	inventory, ok := b.(backend.Inventory)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Backend %s cannot list repositories\n", cfg.Backend)
+		return 2
+	}
+	kubeClient, err := kube.NewInClusterClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create kubernetes client: %v\n", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report, err := protection.NewReporter(kubeClient, inventory).Report(ctx, *namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build report: %v\n", err)
+		return 2
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		writeReport(os.Stdout, report)
+	}
+	if len(report.Unprotected) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func writeReport(w io.Writer, report *protection.Report) {
+	fmt.Fprintf(w, "%d PVCs, %d backup repositories\n", report.PVCs, report.Repositories)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	section := func(title string, repos []backend.Repository) {
+		fmt.Fprintf(tw, "\n%s (%d)\n", title, len(repos))
+		if len(repos) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "NAMESPACE\tPVC\n")
+		for _, repo := range repos {
+			fmt.Fprintf(tw, "%s\t%s\n", repo.Namespace, repo.PVC)
+		}
+	}
+	section("PVCs without backups", report.Unprotected)
+	section("Backups without PVCs", report.Orphans)
+
+	fmt.Fprintf(tw, "\nLikely name mismatches (%d)\n", len(report.Mismatches))
+	if len(report.Mismatches) > 0 {
+		fmt.Fprintf(tw, "PVC\tBACKUP\tREASON\n")
+		for _, m := range report.Mismatches {
+			fmt.Fprintf(tw, "%s/%s\t%s/%s\t%s\n", m.PVC.Namespace, m.PVC.PVC, m.Backup.Namespace, m.Backup.PVC, m.Reason)
+		}
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificateLoader serves a key pair from files and reloads it when either
+// file changes, so that certificates rotated by cert-manager in a mounted
+// Secret are picked up without a restart.
+type certificateLoader struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func newCertificateLoader(certFile, keyFile string) *certificateLoader {
+	return &certificateLoader{certFile: certFile, keyFile: keyFile}
+}
+
+// get is a tls.Config GetCertificate callback. If a reload fails, the
+// previous certificate is kept.
+func (l *certificateLoader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{l.certFile, l.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return l.current(err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cert != nil && modTimes == l.modTimes {
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	l.cert, l.modTimes = &cert, modTimes
+	return l.cert, nil
+}
+
+func (l *certificateLoader) current(err error) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cert != nil {
+		return l.cert, nil
+	}
+	return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+}
@@ -1,3 +1,10 @@
 module github.com/mitchross/pvc-plumber
 
 go 1.22
+
+require (
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/crypto v0.31.0
+)
+
+require golang.org/x/sys v0.28.0 // indirect
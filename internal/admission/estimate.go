@@ -0,0 +1,66 @@
+package admission
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mitchross/pvc-plumber/internal/stats"
+)
+
+// Sources of size estimates.
+const (
+	SourceSnapshot   = "snapshot metadata"
+	SourceRepository = "repository size"
+)
+
+// ErrNoEstimate is returned when no source knows the size of a backup.
+var ErrNoEstimate = errors.New("no size estimate available")
+
+// Estimate is the expected size of a restored volume.
+type Estimate struct {
+	Bytes  int64
+	Source string
+}
+
+// Sizer estimates how much data restoring namespace/pvc writes. listing is
+// nil when restic metadata cannot be read.
+type Sizer interface {
+	RestoreSize(ctx context.Context, namespace, pvc string, listing *Listing) (Estimate, error)
+}
+
+// Estimator sizes restores from the summary of the latest restic snapshot,
+// which counts the backed up bytes, or else from the repository's total
+// size. The repository is compressed and deduplicated across snapshots, so
+// its size is only a rough estimate.
+type Estimator struct {
+	stats *stats.Collector
+}
+
+// NewEstimator returns an Estimator. collector may be nil.
+func NewEstimator(collector *stats.Collector) *Estimator {
+	return &Estimator{stats: collector}
+}
+
+func (e *Estimator) RestoreSize(ctx context.Context, namespace, pvc string, listing *Listing) (Estimate, error) {
+	err := ErrNoEstimate
+	if listing != nil {
+		// Older restic versions do not write summaries.
+		if latest := listing.latest(); latest != nil && latest.Summary != nil {
+			return Estimate{Bytes: latest.Summary.TotalBytesProcessed, Source: SourceSnapshot}, nil
+		}
+		if listing.Err != nil {
+			err = listing.Err
+		}
+	}
+	if e.stats != nil {
+		s, statsErr := e.stats.Get(ctx, namespace, pvc)
+		if statsErr != nil {
+			if errors.Is(err, ErrNoEstimate) {
+				return Estimate{}, statsErr
+			}
+			return Estimate{}, errors.Join(err, statsErr)
+		}
+		return Estimate{Bytes: s.TotalBytes, Source: SourceRepository}, nil
+	}
+	return Estimate{}, err
+}
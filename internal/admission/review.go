@@ -0,0 +1,59 @@
+package admission
+
+import (
+	"encoding/json"
+
+	"github.com/mitchross/pvc-plumber/internal/kube"
+)
+
+// APIVersion is the only AdmissionReview version served.
+const APIVersion = "admission.k8s.io/v1"
+
+const (
+	OperationCreate = "CREATE"
+
+	patchTypeJSONPatch = "JSONPatch"
+)
+
+type GroupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// Review is an AdmissionReview. The API server sends the Request and
+// expects the Response back with the same UID.
+type Review struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Request    *Request  `json:"request,omitempty"`
+	Response   *Response `json:"response,omitempty"`
+}
+
+type Request struct {
+	UID       string           `json:"uid"`
+	Kind      GroupVersionKind `json:"kind"`
+	Namespace string           `json:"namespace,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Operation string           `json:"operation"`
+	Object    json.RawMessage  `json:"object,omitempty"`
+	DryRun    *bool            `json:"dryRun,omitempty"`
+}
+
+type Response struct {
+	UID     string       `json:"uid"`
+	Allowed bool         `json:"allowed"`
+	Status  *kube.Status `json:"status,omitempty"`
+	// Patch is a JSON patch, base64-encoded by encoding/json as the API
+	// server expects.
+	Patch     []byte   `json:"patch,omitempty"`
+	PatchType string   `json:"patchType,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// patchOp is one RFC 6902 JSON patch operation.
+type patchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
@@ -0,0 +1,73 @@
+package admission
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/restic"
+)
+
+// Listing is the restic snapshot list of one repository, oldest first,
+// fetched once per review so that describing and sizing a restore share
+// one decrypting listing. Err is set when the listing failed.
+type Listing struct {
+	Snapshots []restic.Snapshot
+	Err       error
+}
+
+// latest returns the newest snapshot in l, or nil when there is none.
+func (l *Listing) latest() *restic.Snapshot {
+	if l.Err != nil || len(l.Snapshots) == 0 {
+		return nil
+	}
+	return &l.Snapshots[len(l.Snapshots)-1]
+}
+
+// SnapshotFinder finds the snapshot a restore of namespace/pvc starts from.
+// listing is nil when restic metadata cannot be read. It returns nil when
+// the repository has no snapshots.
+type SnapshotFinder interface {
+	LatestSnapshot(ctx context.Context, namespace, pvc string, listing *Listing) (*backend.SnapshotRef, error)
+}
+
+// Snapshots finds the latest snapshot from decrypted restic metadata, or
+// else from the modification times of the snapshot files, as /exists does.
+type Snapshots struct {
+	files backend.SnapshotFileLister
+}
+
+// NewSnapshots returns a Snapshots. files may be nil.
+func NewSnapshots(files backend.SnapshotFileLister) *Snapshots {
+	return &Snapshots{files: files}
+}
+
+func (s *Snapshots) LatestSnapshot(ctx context.Context, namespace, pvc string, listing *Listing) (*backend.SnapshotRef, error) {
+	if listing != nil {
+		if errors.Is(listing.Err, restic.ErrNotFound) {
+			return nil, nil
+		}
+		if listing.Err != nil {
+			return nil, listing.Err
+		}
+		latest := listing.latest()
+		if latest == nil {
+			return nil, nil
+		}
+		return &backend.SnapshotRef{ID: latest.ID, Time: latest.Time, Source: backend.SnapshotSourceMetadata}, nil
+	}
+	if s.files == nil {
+		return nil, nil
+	}
+	files, err := s.files.ListSnapshotFiles(ctx, namespace, pvc)
+	if err != nil {
+		return nil, err
+	}
+	var latest *backend.SnapshotRef
+	for _, f := range files {
+		if latest == nil || f.ModTime.After(latest.Time) {
+			latest = &backend.SnapshotRef{ID: f.Name, Time: f.ModTime, Source: backend.SnapshotSourceListing}
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,274 @@
+// Package admission implements a mutating admission webhook that points new
+// PVCs with a backup at the VolSync ReplicationDestination restoring them,
+// and guards against restoring into a volume too small for the backup.
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/controller"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/volsync"
+)
+
+// Capacity guard modes.
+const (
+	CapacityOff   = "off"
+	CapacityWarn  = "warn"
+	CapacityPatch = "patch"
+)
+
+type Options struct {
+	// DestinationTemplate names the ReplicationDestination that restores
+	// a PVC. It accepts {namespace} and {pvc}.
+	DestinationTemplate string
+	// Capacity is CapacityOff, CapacityWarn or CapacityPatch.
+	Capacity string
+	// Headroom is the fraction added to a backup's estimated size to get
+	// the smallest storage request it fits in.
+	Headroom float64
+}
+
+// Webhook reviews PVC creations. It never rejects a request: failed checks
+// leave the PVC unchanged, as /exists fails open. Every decision is
+// explained in a warning, which kubectl shows to the user.
+type Webhook struct {
+	checker   backend.Backend
+	metadata  backend.SnapshotLister
+	sizer     Sizer
+	snapshots SnapshotFinder
+	opts      Options
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+// New returns a Webhook. metadata lists the restic snapshots that sizer and
+// snapshots share, once per review. Any of metadata, sizer and snapshots may
+// be nil: without sizer the capacity guard is off, and without snapshots
+// warnings leave the snapshot out.
+func New(checker backend.Backend, metadata backend.SnapshotLister, sizer Sizer, snapshots SnapshotFinder, opts Options, logger *slog.Logger) *Webhook {
+	if opts.DestinationTemplate == "" {
+		opts.DestinationTemplate = "{pvc}-dst"
+	}
+	if opts.Capacity == "" {
+		opts.Capacity = CapacityWarn
+	}
+	return &Webhook{checker: checker, metadata: metadata, sizer: sizer, snapshots: snapshots, opts: opts, logger: logger, now: time.Now}
+}
+
+// Review answers req. The backup check result is returned for auditing, or
+// nil when the request needed no check.
+func (wh *Webhook) Review(ctx context.Context, req *Request) (*Response, *backend.CheckResult) {
+	resp := &Response{UID: req.UID, Allowed: true}
+	if req.Operation != OperationCreate || req.Kind.Group != "" || req.Kind.Kind != "PersistentVolumeClaim" {
+		return resp, nil
+	}
+
+	var pvc kube.PersistentVolumeClaim
+	if err := json.Unmarshal(req.Object, &pvc); err != nil {
+		wh.logger.Warn("failed to decode PVC in admission request", "uid", req.UID, "error", err)
+		resp.Warnings = []string{"pvc-plumber: could not read the PVC; not restoring"}
+		return resp, nil
+	}
+	// Claims named by generateName have no backup to look up, and claims
+	// with a data source already say where their data comes from.
+	namespace, name := req.Namespace, pvc.Metadata.Name
+	switch {
+	case name == "":
+		resp.Warnings = []string{"pvc-plumber: PVCs named by generateName are not restored"}
+		return resp, nil
+	case pvc.Spec.DataSource != nil || pvc.Spec.DataSourceRef != nil:
+		resp.Warnings = []string{"pvc-plumber: the PVC already has a data source; not restoring"}
+		return resp, nil
+	}
+
+	result := wh.checker.CheckBackupExists(ctx, namespace, name)
+	if result.Error != "" {
+		// Leave the claim unannotated so that the controller retries it.
+		wh.logger.Warn("backup check failed during admission", "namespace", namespace, "pvc", name, "error", result.Error)
+		code := result.ErrorCode
+		if code == "" {
+			code = backend.CodeBackendError
+		}
+		resp.Warnings = []string{fmt.Sprintf("pvc-plumber: backup check failed (%s); provisioning an empty volume", code)}
+		return resp, &result
+	}
+
+	var ops []patchOp
+	ops = append(ops, annotate(&pvc, map[string]string{
+		controller.AnnotationBackupExists: fmt.Sprintf("%t", result.Exists),
+		controller.AnnotationCheckedAt:    wh.now().UTC().Format(time.RFC3339),
+	})...)
+	switch {
+	case !result.Exists:
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf(
+			"pvc-plumber: no backup found for %s/%s; provisioning an empty volume", namespace, name))
+	case result.RepoType != backend.RepoTypeRestic:
+		// The ReplicationDestination uses the restic mover, which would
+		// fail and leave the claim Pending.
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf(
+			"pvc-plumber: the backup of %s/%s is a %s repository, which the VolSync restic mover "+
+				"cannot restore; provisioning an empty volume",
+			namespace, name, result.RepoType))
+	default:
+		group := volsync.Group
+		destination := volsync.ExpandTemplate(wh.opts.DestinationTemplate, namespace, name)
+		ops = append(ops, patchOp{Op: "add", Path: "/spec/dataSourceRef", Value: kube.TypedObjectReference{
+			APIGroup: &group,
+			Kind:     volsync.Kind,
+			Name:     destination,
+		}})
+		listing := wh.listSnapshots(ctx, namespace, name)
+		resp.Warnings = append(resp.Warnings, wh.describeRestore(ctx, namespace, name, destination, listing))
+		op, warning := wh.guardCapacity(ctx, &pvc, namespace, name, listing)
+		if op != nil {
+			ops = append(ops, *op)
+		}
+		if warning != "" {
+			resp.Warnings = append(resp.Warnings, warning)
+		}
+	}
+
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		wh.logger.Error("failed to encode admission patch", "namespace", namespace, "pvc", name, "error", err)
+		return resp, &result
+	}
+	resp.Patch, resp.PatchType = patch, patchTypeJSONPatch
+	return resp, &result
+}
+
+// listSnapshots lists the restic snapshots of namespace/pvc, or returns nil
+// when there is no metadata lister. Listing decrypts every snapshot, so it
+// is done once for describeRestore and guardCapacity.
+func (wh *Webhook) listSnapshots(ctx context.Context, namespace, name string) *Listing {
+	if wh.metadata == nil {
+		return nil
+	}
+	snapshots, err := wh.metadata.Snapshots(ctx, namespace, name)
+	return &Listing{Snapshots: snapshots, Err: err}
+}
+
+// describeRestore explains where the restore of namespace/pvc comes from.
+func (wh *Webhook) describeRestore(ctx context.Context, namespace, name, destination string, listing *Listing) string {
+	var ref *backend.SnapshotRef
+	if wh.snapshots != nil {
+		var err error
+		if ref, err = wh.snapshots.LatestSnapshot(ctx, namespace, name, listing); err != nil {
+			wh.logger.Warn("failed to find latest snapshot", "namespace", namespace, "pvc", name, "error", err)
+		}
+	}
+	if ref == nil {
+		return fmt.Sprintf("pvc-plumber: restoring from backup via ReplicationDestination %s", destination)
+	}
+	return fmt.Sprintf("pvc-plumber: restoring from snapshot %s taken %s via ReplicationDestination %s",
+		shortID(ref.ID), formatAge(wh.now().Sub(ref.Time)), destination)
+}
+
+// shortID abbreviates a snapshot ID as restic does.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// formatAge formats d in its largest whole unit, such as "3h ago".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
+
+// guardCapacity compares the claim's storage request with the estimated
+// size of its backup plus headroom. When the request is too small it
+// returns a warning and, in patch mode, the operation raising the request.
+func (wh *Webhook) guardCapacity(ctx context.Context, pvc *kube.PersistentVolumeClaim, namespace, name string, listing *Listing) (*patchOp, string) {
+	if wh.opts.Capacity == CapacityOff || wh.sizer == nil {
+		return nil, ""
+	}
+	// Claims without a storage request fail validation anyway.
+	requested := pvc.Spec.Resources.Requests["storage"]
+	if requested == "" {
+		return nil, ""
+	}
+	requestedBytes, err := kube.ParseQuantity(requested)
+	if err != nil {
+		wh.logger.Warn("cannot parse storage request", "namespace", namespace, "pvc", name, "error", err)
+		return nil, ""
+	}
+	estimate, err := wh.sizer.RestoreSize(ctx, namespace, name, listing)
+	if err != nil {
+		wh.logger.Warn("failed to estimate restore size", "namespace", namespace, "pvc", name, "error", err)
+		return nil, ""
+	}
+
+	needed := int64(float64(estimate.Bytes) * (1 + wh.opts.Headroom))
+	if requestedBytes >= needed {
+		return nil, ""
+	}
+	wh.logger.Info("storage request is smaller than the backup",
+		"namespace", namespace, "pvc", name, "requested", requested,
+		"estimate_bytes", estimate.Bytes, "source", estimate.Source, "mode", wh.opts.Capacity)
+
+	backup := fmt.Sprintf("the backup holds about %s (%s)", formatBytes(estimate.Bytes), estimate.Source)
+	// Repository totals are compressed, deduplicated and span every
+	// snapshot, so they are too rough to resize a volume by.
+	if wh.opts.Capacity != CapacityPatch || estimate.Source != SourceSnapshot {
+		return nil, fmt.Sprintf(
+			"pvc-plumber: storage request %s may be too small to restore into: %s", requested, backup)
+	}
+	size := kube.FormatGi(needed)
+	return &patchOp{Op: "add", Path: "/spec/resources/requests/storage", Value: size},
+		fmt.Sprintf("pvc-plumber: raised storage request from %s to %s: %s", requested, size, backup)
+}
+
+// annotate returns the operations setting annotations on pvc.
+func annotate(pvc *kube.PersistentVolumeClaim, annotations map[string]string) []patchOp {
+	if pvc.Metadata.Annotations == nil {
+		return []patchOp{{Op: "add", Path: "/metadata/annotations", Value: annotations}}
+	}
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ops := make([]patchOp, 0, len(keys))
+	for _, key := range keys {
+		ops = append(ops, patchOp{Op: "add", Path: "/metadata/annotations/" + escapePointer(key), Value: annotations[key]})
+	}
+	return ops
+}
+
+// escapePointer escapes a JSON pointer reference token.
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// formatBytes formats n in binary units with one decimal.
+func formatBytes(n int64) string {
+	const units = "KMGTPE"
+	if n < 1<<10 {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, unit := float64(n)/(1<<10), 0
+	for value >= 1<<10 && unit < len(units)-1 {
+		value /= 1 << 10
+		unit++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, units[unit])
+}
@@ -0,0 +1,457 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/backendtest"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/restic"
+	"github.com/mitchross/pvc-plumber/internal/stats"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+// sizerFunc adapts a function to Sizer.
+type sizerFunc func(ctx context.Context, namespace, pvc string) (Estimate, error)
+
+func (f sizerFunc) RestoreSize(ctx context.Context, namespace, pvc string, listing *Listing) (Estimate, error) {
+	return f(ctx, namespace, pvc)
+}
+
+func fixedSize(bytes int64) Sizer {
+	return sizerFunc(func(context.Context, string, string) (Estimate, error) {
+		return Estimate{Bytes: bytes, Source: SourceSnapshot}, nil
+	})
+}
+
+func pvcRequest(t *testing.T, object string) *Request {
+	t.Helper()
+	return &Request{
+		UID:       "705ab4f5-6393-11e8-b7cc-42010a800002",
+		Kind:      GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"},
+		Namespace: "karakeep",
+		Name:      "data-pvc",
+		Operation: OperationCreate,
+		Object:    json.RawMessage(object),
+	}
+}
+
+const dataPVC = `{
+  "apiVersion": "v1",
+  "kind": "PersistentVolumeClaim",
+  "metadata": {"name": "data-pvc", "namespace": "karakeep"},
+  "spec": {"accessModes": ["ReadWriteOnce"], "resources": {"requests": {"storage": "10Gi"}}}
+}`
+
+func newWebhook(checker backend.Backend, sizer Sizer, snapshots SnapshotFinder, opts Options) *Webhook {
+	wh := New(checker, nil, sizer, snapshots, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	wh.now = func() time.Time { return now }
+	return wh
+}
+
+func decodePatch(t *testing.T, resp *Response) []map[string]any {
+	t.Helper()
+	if resp.Patch == nil {
+		return nil
+	}
+	if resp.PatchType != "JSONPatch" {
+		t.Errorf("PatchType = %q, want JSONPatch", resp.PatchType)
+	}
+	var ops []map[string]any
+	if err := json.Unmarshal(resp.Patch, &ops); err != nil {
+		t.Fatalf("invalid patch %s: %v", resp.Patch, err)
+	}
+	return ops
+}
+
+func TestReview(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", now)
+	annotations := map[string]any{
+		"pvc-plumber.io/backup-exists": "true",
+		"pvc-plumber.io/checked-at":    "2026-10-18T12:00:00Z",
+	}
+	dataSourceRef := map[string]any{"apiGroup": "volsync.backube", "kind": "ReplicationDestination", "name": "data-pvc-dst"}
+
+	tests := []struct {
+		name         string
+		sizer        Sizer
+		mode         string
+		wantOps      []map[string]any
+		wantWarnings int
+	}{
+		{
+			name:  "fits",
+			sizer: fixedSize(8 << 30),
+			wantOps: []map[string]any{
+				{"op": "add", "path": "/metadata/annotations", "value": annotations},
+				{"op": "add", "path": "/spec/dataSourceRef", "value": dataSourceRef},
+			},
+		},
+		{
+			name:  "warn",
+			sizer: fixedSize(9 << 30),
+			wantOps: []map[string]any{
+				{"op": "add", "path": "/metadata/annotations", "value": annotations},
+				{"op": "add", "path": "/spec/dataSourceRef", "value": dataSourceRef},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name:  "patch",
+			sizer: fixedSize(9 << 30),
+			mode:  CapacityPatch,
+			wantOps: []map[string]any{
+				{"op": "add", "path": "/metadata/annotations", "value": annotations},
+				{"op": "add", "path": "/spec/dataSourceRef", "value": dataSourceRef},
+				{"op": "add", "path": "/spec/resources/requests/storage", "value": "11Gi"},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name: "patch from repository size",
+			sizer: sizerFunc(func(context.Context, string, string) (Estimate, error) {
+				return Estimate{Bytes: 9 << 30, Source: SourceRepository}, nil
+			}),
+			mode: CapacityPatch,
+			wantOps: []map[string]any{
+				{"op": "add", "path": "/metadata/annotations", "value": annotations},
+				{"op": "add", "path": "/spec/dataSourceRef", "value": dataSourceRef},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name:  "off",
+			sizer: fixedSize(100 << 30),
+			mode:  CapacityOff,
+			wantOps: []map[string]any{
+				{"op": "add", "path": "/metadata/annotations", "value": annotations},
+				{"op": "add", "path": "/spec/dataSourceRef", "value": dataSourceRef},
+			},
+		},
+		{
+			name: "estimate fails",
+			sizer: sizerFunc(func(context.Context, string, string) (Estimate, error) {
+				return Estimate{}, ErrNoEstimate
+			}),
+			mode: CapacityPatch,
+			wantOps: []map[string]any{
+				{"op": "add", "path": "/metadata/annotations", "value": annotations},
+				{"op": "add", "path": "/spec/dataSourceRef", "value": dataSourceRef},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := newWebhook(fake, tt.sizer, nil, Options{Capacity: tt.mode, Headroom: 0.2})
+			resp, result := wh.Review(context.Background(), pvcRequest(t, dataPVC))
+			if !resp.Allowed || resp.UID != "705ab4f5-6393-11e8-b7cc-42010a800002" {
+				t.Errorf("response = %+v, want allowed with the request UID", resp)
+			}
+			if result == nil || !result.Exists {
+				t.Errorf("result = %+v, want an existing backup", result)
+			}
+			if ops := decodePatch(t, resp); !reflect.DeepEqual(ops, tt.wantOps) {
+				t.Errorf("patch = %v\nwant %v", ops, tt.wantOps)
+			}
+			// The first warning explains the restore.
+			if len(resp.Warnings) != 1+tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d capacity warnings", resp.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestReview_NoBackup(t *testing.T) {
+	wh := newWebhook(backendtest.New(), fixedSize(1<<40), nil, Options{})
+	object := `{"metadata": {"name": "data-pvc", "annotations": {"a/b": "c"}}, "spec": {"resources": {"requests": {"storage": "1Gi"}}}}`
+	resp, result := wh.Review(context.Background(), pvcRequest(t, object))
+
+	if result == nil || result.Exists {
+		t.Errorf("result = %+v, want no backup", result)
+	}
+	want := []map[string]any{
+		{"op": "add", "path": "/metadata/annotations/pvc-plumber.io~1backup-exists", "value": "false"},
+		{"op": "add", "path": "/metadata/annotations/pvc-plumber.io~1checked-at", "value": "2026-10-18T12:00:00Z"},
+	}
+	if ops := decodePatch(t, resp); !reflect.DeepEqual(ops, want) {
+		t.Errorf("patch = %v\nwant %v", ops, want)
+	}
+	if want := []string{"pvc-plumber: no backup found for karakeep/data-pvc; provisioning an empty volume"}; !reflect.DeepEqual(resp.Warnings, want) {
+		t.Errorf("warnings = %q, want %q", resp.Warnings, want)
+	}
+}
+
+func TestReview_Kopia(t *testing.T) {
+	fake := backendtest.New()
+	fake.SetResult("karakeep", "data-pvc", backend.CheckResult{Exists: true, KeyCount: 4, RepoType: backend.RepoTypeKopia})
+	wh := newWebhook(fake, fixedSize(1<<40), nil, Options{Capacity: CapacityPatch})
+	resp, _ := wh.Review(context.Background(), pvcRequest(t, dataPVC))
+
+	// The backup is recorded, but the restic mover cannot restore it.
+	for _, op := range decodePatch(t, resp) {
+		if path := op["path"].(string); path != "/metadata/annotations" {
+			t.Errorf("unexpected patch of %s", path)
+		}
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "is a kopia repository, which the VolSync restic mover cannot restore") {
+		t.Errorf("warnings = %q", resp.Warnings)
+	}
+}
+
+func TestReview_Unchanged(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", now)
+	fake.Fail("karakeep", "broken", &backend.HTTPError{Service: "S3", StatusCode: http.StatusServiceUnavailable})
+	wh := newWebhook(fake, fixedSize(1<<40), nil, Options{Capacity: CapacityPatch})
+
+	update := pvcRequest(t, dataPVC)
+	update.Operation = "UPDATE"
+	pod := pvcRequest(t, dataPVC)
+	pod.Kind.Kind = "Pod"
+	generated := pvcRequest(t, `{"metadata": {"generateName": "data-"}}`)
+	cloned := pvcRequest(t, `{"metadata": {"name": "data-pvc"}, "spec": {"dataSource": {"kind": "PersistentVolumeClaim", "name": "other"}}}`)
+	broken := pvcRequest(t, `{"metadata": {"name": "broken"}}`)
+
+	tests := []struct {
+		name    string
+		req     *Request
+		warning string
+	}{
+		{"update", update, ""},
+		{"pod", pod, ""},
+		{"generateName", generated, "pvc-plumber: PVCs named by generateName are not restored"},
+		{"dataSource", cloned, "pvc-plumber: the PVC already has a data source; not restoring"},
+		{"failed check", broken, "pvc-plumber: backup check failed (BACKEND_UNAVAILABLE); provisioning an empty volume"},
+	}
+	for _, tt := range tests {
+		resp, result := wh.Review(context.Background(), tt.req)
+		if !resp.Allowed || resp.Patch != nil {
+			t.Errorf("%s: response = %+v, want allowed without changes", tt.name, resp)
+		}
+		if got := strings.Join(resp.Warnings, "\n"); got != tt.warning {
+			t.Errorf("%s: warnings = %q, want %q", tt.name, got, tt.warning)
+		}
+		if (result != nil) != (tt.name == "failed check") {
+			t.Errorf("%s: result = %+v", tt.name, result)
+		}
+	}
+}
+
+// countingLister returns fixed snapshots and counts the listings.
+type countingLister struct {
+	snapshots []restic.Snapshot
+	calls     int
+}
+
+func (l *countingLister) Snapshots(ctx context.Context, namespace, pvc string) ([]restic.Snapshot, error) {
+	l.calls++
+	return l.snapshots, nil
+}
+
+func TestReview_ListsSnapshotsOnce(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", now)
+	metadata := &countingLister{snapshots: []restic.Snapshot{{
+		ID:      "0123456789abcdef",
+		Time:    now.Add(-2 * time.Hour),
+		Summary: &restic.SnapshotSummary{TotalBytesProcessed: 12 << 30},
+	}}}
+	wh := New(fake, metadata, NewEstimator(nil), NewSnapshots(nil), Options{Capacity: CapacityWarn},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	wh.now = func() time.Time { return now }
+
+	resp, _ := wh.Review(context.Background(), pvcRequest(t, dataPVC))
+	if metadata.calls != 1 {
+		t.Errorf("Snapshots() called %d times, want 1", metadata.calls)
+	}
+	want := []string{
+		"pvc-plumber: restoring from snapshot 01234567 taken 2h ago via ReplicationDestination data-pvc-dst",
+		"pvc-plumber: storage request 10Gi may be too small to restore into: the backup holds about 12.0GiB (snapshot metadata)",
+	}
+	if !reflect.DeepEqual(resp.Warnings, want) {
+		t.Errorf("warnings = %q\nwant %q", resp.Warnings, want)
+	}
+}
+
+func TestEstimator(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", now)
+	collector := stats.New(fake, time.Minute)
+	repoSize := int64(155 + 460 + 1<<20 + 1024 + 256)
+	ctx := context.Background()
+
+	withSummary := &Listing{Snapshots: []restic.Snapshot{
+		{ID: "old", Summary: &restic.SnapshotSummary{TotalBytesProcessed: 1}},
+		{ID: "new", Summary: &restic.SnapshotSummary{TotalBytesProcessed: 5 << 30}},
+	}}
+	withoutSummary := &Listing{Snapshots: []restic.Snapshot{{ID: "restic-0.16"}}}
+
+	tests := []struct {
+		name      string
+		estimator *Estimator
+		listing   *Listing
+		want      Estimate
+		wantErr   error
+	}{
+		{"summary", NewEstimator(collector), withSummary, Estimate{Bytes: 5 << 30, Source: SourceSnapshot}, nil},
+		{"no summary", NewEstimator(collector), withoutSummary, Estimate{Bytes: repoSize, Source: SourceRepository}, nil},
+		{"stats only", NewEstimator(collector), nil, Estimate{Bytes: repoSize, Source: SourceRepository}, nil},
+		{"no summary without stats", NewEstimator(nil), withoutSummary, Estimate{}, ErrNoEstimate},
+		{"no sources", NewEstimator(nil), nil, Estimate{}, ErrNoEstimate},
+	}
+	for _, tt := range tests {
+		got, err := tt.estimator.RestoreSize(ctx, "karakeep", "data-pvc", tt.listing)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: RestoreSize() = %+v, %v; want %+v, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	missing := &Listing{Err: restic.ErrNotFound}
+	if _, err := NewEstimator(collector).RestoreSize(ctx, "karakeep", "missing", missing); !errors.Is(err, restic.ErrNotFound) || !errors.Is(err, stats.ErrNotFound) {
+		t.Errorf("RestoreSize() missing error = %v, want both sources' errors", err)
+	}
+}
+
+// TestReview_Fixtures replays AdmissionReviews recorded from an API server.
+func TestReview_Fixtures(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", now.Add(-27*time.Hour), now.Add(-3*time.Hour))
+	wh := newWebhook(fake, fixedSize(12<<30), NewSnapshots(fake), Options{Capacity: CapacityPatch, Headroom: 0.2})
+
+	restoring := "pvc-plumber: restoring from snapshot 12345678 taken 3h ago via ReplicationDestination data-pvc-dst"
+	raised := "pvc-plumber: raised storage request from 10Gi to 15Gi: the backup holds about 12.0GiB (snapshot metadata)"
+	tests := []struct {
+		file         string
+		wantPatch    []string
+		wantWarnings []string
+		wantChecked  bool
+	}{
+		{
+			file:         "create.json",
+			wantPatch:    []string{"/metadata/annotations/pvc-plumber.io~1backup-exists", "/metadata/annotations/pvc-plumber.io~1checked-at", "/spec/dataSourceRef", "/spec/resources/requests/storage"},
+			wantWarnings: []string{restoring, raised},
+			wantChecked:  true,
+		},
+		{
+			// Dry runs are reviewed like real requests; only the caller
+			// skips side effects.
+			file:         "create-dry-run.json",
+			wantPatch:    []string{"/metadata/annotations/pvc-plumber.io~1backup-exists", "/metadata/annotations/pvc-plumber.io~1checked-at", "/spec/dataSourceRef", "/spec/resources/requests/storage"},
+			wantWarnings: []string{restoring, raised},
+			wantChecked:  true,
+		},
+		{
+			file:         "create-no-backup.json",
+			wantPatch:    []string{"/metadata/annotations"},
+			wantWarnings: []string{"pvc-plumber: no backup found for karakeep/meili; provisioning an empty volume"},
+			wantChecked:  true,
+		},
+		{
+			file:         "create-generate-name.json",
+			wantWarnings: []string{"pvc-plumber: PVCs named by generateName are not restored"},
+		},
+		{
+			file:         "create-data-source.json",
+			wantWarnings: []string{"pvc-plumber: the PVC already has a data source; not restoring"},
+		},
+		{file: "update.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var review Review
+			if err := json.Unmarshal(data, &review); err != nil {
+				t.Fatalf("invalid fixture: %v", err)
+			}
+
+			resp, result := wh.Review(context.Background(), review.Request)
+			if !resp.Allowed || resp.UID != review.Request.UID {
+				t.Errorf("response = %+v, want allowed with UID %s", resp, review.Request.UID)
+			}
+			if (result != nil) != tt.wantChecked {
+				t.Errorf("result = %+v, want checked %t", result, tt.wantChecked)
+			}
+			var paths []string
+			for _, op := range decodePatch(t, resp) {
+				paths = append(paths, op["path"].(string))
+			}
+			if !reflect.DeepEqual(paths, tt.wantPatch) {
+				t.Errorf("patched paths = %q, want %q", paths, tt.wantPatch)
+			}
+			if !reflect.DeepEqual(resp.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q\nwant %q", resp.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", now.Add(-time.Hour), now.Add(-2*time.Hour))
+	metadata := &Listing{Snapshots: []restic.Snapshot{{ID: "old", Time: now.Add(-time.Hour)}, {ID: "new", Time: now}}}
+	ctx := context.Background()
+
+	ref, err := NewSnapshots(fake).LatestSnapshot(ctx, "karakeep", "data-pvc", metadata)
+	if err != nil || ref.ID != "new" || ref.Source != backend.SnapshotSourceMetadata {
+		t.Errorf("LatestSnapshot() metadata = %+v, %v", ref, err)
+	}
+	ref, err = NewSnapshots(fake).LatestSnapshot(ctx, "karakeep", "data-pvc", nil)
+	if err != nil || !ref.Time.Equal(now.Add(-time.Hour)) || ref.Source != backend.SnapshotSourceListing {
+		t.Errorf("LatestSnapshot() listing = %+v, %v", ref, err)
+	}
+	failing := &Listing{Err: restic.ErrWrongPassword}
+	if ref, err := NewSnapshots(fake).LatestSnapshot(ctx, "karakeep", "data-pvc", failing); ref != nil || !errors.Is(err, restic.ErrWrongPassword) {
+		t.Errorf("LatestSnapshot() failing = %+v, %v; want ErrWrongPassword", ref, err)
+	}
+	missing := &Listing{Err: restic.ErrNotFound}
+	for _, tt := range []struct {
+		snapshots *Snapshots
+		listing   *Listing
+	}{
+		{NewSnapshots(nil), missing},
+		{NewSnapshots(fake), &Listing{}},
+		{NewSnapshots(fake), nil},
+		{NewSnapshots(nil), nil},
+	} {
+		if ref, err := tt.snapshots.LatestSnapshot(ctx, "karakeep", "missing", tt.listing); ref != nil || err != nil {
+			t.Errorf("LatestSnapshot() missing = %+v, %v; want nil, nil", ref, err)
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		10 * time.Second: "just now",
+		45 * time.Minute: "45m ago",
+		3 * time.Hour:    "3h ago",
+		47 * time.Hour:   "47h ago",
+		72 * time.Hour:   "3d ago",
+	} {
+		if got := formatAge(d); got != want {
+			t.Errorf("formatAge(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{512: "512B", 1536: "1.5KiB", 9 << 30: "9.0GiB", 3 << 40: "3.0TiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
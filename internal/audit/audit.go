@@ -0,0 +1,143 @@
+// Package audit records every restore decision as a JSON line so that a
+// post-incident review can see what each PVC was told and why.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// LoggerName tags audit lines so they can be told apart from application
+// logs when both go to stdout.
+const LoggerName = "audit"
+
+// Decisions.
+const (
+	DecisionRestore = "restore"
+	DecisionFresh   = "fresh"
+)
+
+// Rules explain a decision.
+const (
+	RuleBackupExists       = "backup-exists"
+	RuleNoBackup           = "no-backup"
+	RuleNoMatchingSnapshot = "no-matching-snapshot"
+	RuleBackendError       = "backend-error"
+	RuleUnsupportedRepo    = "unsupported-repository"
+)
+
+// Event is one audit record.
+type Event struct {
+	Logger    string    `json:"logger"`
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"`
+	RequestID string    `json:"requestId,omitempty"`
+	TraceID   string    `json:"traceId,omitempty"`
+	Namespace string    `json:"namespace"`
+	PVC       string    `json:"pvc"`
+	Decision  string    `json:"decision"`
+	Rule      string    `json:"rule"`
+	Backend   string    `json:"backend"`
+	Target    string    `json:"target"`
+	RepoType  string    `json:"repoType,omitempty"`
+	KeyCount  int       `json:"keyCount"`
+	Snapshot  string    `json:"snapshot,omitempty"`
+	LatencyMS float64   `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"errorCode,omitempty"`
+}
+
+// Logger writes events as JSON lines.
+type Logger struct {
+	w        io.Writer
+	backend  string
+	location string
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+// New returns a Logger writing to w. backendName and location (such as
+// the endpoint and bucket) describe where backups are looked up; the
+// target of each event is location/{namespace}/{pvc}/.
+func New(w io.Writer, backendName, location string, logger *slog.Logger) *Logger {
+	return &Logger{
+		w:        w,
+		backend:  backendName,
+		location: strings.TrimSuffix(location, "/"),
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Decide derives the decision and rule for a backup check. noMatch reports
+// that a backup exists but no snapshot satisfied the requested selection.
+// A check that failed is reported as fresh because pvc-plumber fails open,
+// and so is a backup that is not a restic repository, which the VolSync
+// restic mover cannot restore.
+func Decide(result backend.CheckResult, noMatch bool) (decision, rule string) {
+	switch {
+	case result.Error != "":
+		return DecisionFresh, RuleBackendError
+	case result.Exists && result.RepoType != backend.RepoTypeRestic:
+		return DecisionFresh, RuleUnsupportedRepo
+	case result.Exists:
+		return DecisionRestore, RuleBackupExists
+	case noMatch:
+		return DecisionFresh, RuleNoMatchingSnapshot
+	default:
+		return DecisionFresh, RuleNoBackup
+	}
+}
+
+// Record writes the decision taken for namespace/pvc from result. source
+// names the caller, e.g. "exists"; start is when the request began.
+func (l *Logger) Record(ctx context.Context, source, namespace, pvc string, result backend.CheckResult, noMatch bool, start time.Time) {
+	now := l.now()
+	event := Event{
+		Logger:    LoggerName,
+		Time:      now.UTC(),
+		Source:    source,
+		Namespace: namespace,
+		PVC:       pvc,
+		Backend:   l.backend,
+		Target:    l.location + "/" + namespace + "/" + pvc + "/",
+		RepoType:  result.RepoType,
+		KeyCount:  result.KeyCount,
+		LatencyMS: float64(now.Sub(start).Microseconds()) / 1000,
+		Error:     result.Error,
+		ErrorCode: result.ErrorCode,
+	}
+	event.Decision, event.Rule = Decide(result, noMatch)
+	if result.Snapshot != nil {
+		event.Snapshot = result.Snapshot.ID
+	}
+	if s, ok := trace.FromContext(ctx); ok {
+		event.RequestID, event.TraceID = s.RequestID, s.TraceID
+	}
+	l.Write(event)
+}
+
+// Write writes one event. Failures are logged, never returned, so that
+// auditing cannot break admission.
+func (l *Logger) Write(event Event) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		l.logger.Error("failed to encode audit event", "error", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		l.logger.Error("failed to write audit event", "error", err)
+	}
+}
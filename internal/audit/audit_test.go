@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name         string
+		result       backend.CheckResult
+		noMatch      bool
+		wantDecision string
+		wantRule     string
+	}{
+		{name: "backup exists", result: backend.CheckResult{Exists: true, RepoType: backend.RepoTypeRestic, KeyCount: 6}, wantDecision: DecisionRestore, wantRule: RuleBackupExists},
+		{name: "kopia is not restored", result: backend.CheckResult{Exists: true, RepoType: backend.RepoTypeKopia, KeyCount: 3}, wantDecision: DecisionFresh, wantRule: RuleUnsupportedRepo},
+		{name: "unknown layout is not restored", result: backend.CheckResult{Exists: true, RepoType: backend.RepoTypeUnknown, KeyCount: 1}, wantDecision: DecisionFresh, wantRule: RuleUnsupportedRepo},
+		{name: "no backup", result: backend.CheckResult{}, wantDecision: DecisionFresh, wantRule: RuleNoBackup},
+		{name: "no matching snapshot", result: backend.CheckResult{KeyCount: 6}, noMatch: true, wantDecision: DecisionFresh, wantRule: RuleNoMatchingSnapshot},
+		{name: "backend error fails open", result: backend.CheckResult{Error: "timeout"}, wantDecision: DecisionFresh, wantRule: RuleBackendError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, rule := Decide(tt.result, tt.noMatch)
+			if decision != tt.wantDecision || rule != tt.wantRule {
+				t.Errorf("Decide() = %s/%s, want %s/%s", decision, rule, tt.wantDecision, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "s3", "http://minio:9000/volsync/", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return start.Add(1500 * time.Microsecond) }
+
+	ctx := trace.NewContext(context.Background(), trace.Span{RequestID: "req-1", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+	l.Record(ctx, "exists", "karakeep", "data-pvc", backend.CheckResult{
+		Exists:   true,
+		KeyCount: 6,
+		RepoType: backend.RepoTypeRestic,
+		Snapshot: &backend.SnapshotRef{ID: "23af6eef"},
+	}, false, start)
+	l.Record(context.Background(), "exists", "karakeep", "other", backend.CheckResult{Error: "timeout"}, false, start)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want 2", len(lines))
+	}
+	var got Event
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Event{
+		Logger:    LoggerName,
+		Time:      start.Add(1500 * time.Microsecond),
+		Source:    "exists",
+		RequestID: "req-1",
+		TraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		Namespace: "karakeep",
+		PVC:       "data-pvc",
+		Decision:  DecisionRestore,
+		Rule:      RuleBackupExists,
+		Backend:   "s3",
+		Target:    "http://minio:9000/volsync/karakeep/data-pvc/",
+		RepoType:  "restic",
+		KeyCount:  6,
+		Snapshot:  "23af6eef",
+		LatencyMS: 1.5,
+	}
+	if got != want {
+		t.Errorf("event = %+v\nwant    %+v", got, want)
+	}
+
+	got = Event{}
+	if err := json.Unmarshal(lines[1], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Decision != DecisionFresh || got.Rule != RuleBackendError || got.Error != "timeout" || got.RequestID != "" {
+		t.Errorf("error event = %+v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an append-only file that is rotated once it would grow
+// past MaxBytes. Rotated files are named path.1 (newest) to path.N.
+type RotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	logger     *slog.Logger
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	closed bool
+}
+
+// OpenRotatingFile opens path for appending, creating it if needed. Failed
+// rotations are logged to logger.
+func OpenRotatingFile(path string, maxBytes int64, maxBackups int, logger *slog.Logger) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups, logger: logger}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", r.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat %s: %w", r.path, err)
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past MaxBytes.
+// A single write is never split across files. When rotation fails, p is
+// still appended to the current file and the failure is logged rather than
+// returned, so that an error always means p was not written in full; the
+// next write tries again.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if r.f != nil && r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		rotateErr = r.rotate()
+	}
+	if r.f == nil {
+		// A failed rotation could not reopen the file either.
+		if err := r.open(); err != nil {
+			return 0, errors.Join(rotateErr, err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, errors.Join(rotateErr, err)
+	}
+	if rotateErr != nil {
+		r.logger.Warn("failed to rotate audit log, appending to the current file", "path", r.path, "error", rotateErr)
+	}
+	return n, nil
+}
+
+// rotate shifts path.i to path.i+1, dropping the oldest, and starts a new
+// file. With no backups the file is truncated. If rotation fails, path is
+// reopened for appending so that writing carries on in the old file.
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", r.path, err)
+	}
+	r.f = nil
+	if err := r.shift(); err != nil {
+		if openErr := r.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) shift() error {
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate %s: %w", r.path, err)
+			}
+		}
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", r.path, err)
+		}
+	} else if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate %s: %w", r.path, err)
+	}
+	return nil
+}
+
+func (r *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
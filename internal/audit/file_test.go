@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte("old-0\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenRotatingFile(path, 12, 2, discard)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	// The existing 6 bytes count toward the limit, so each line after the
+	// first starts a new file.
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:        "line-4\n",
+		path + ".1": "line-3\n",
+		path + ".2": "line-2\n",
+	} {
+		if got := readFile(t, name); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", path)
+	}
+}
+
+func TestRotatingFile_NoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenRotatingFile(path, 10, 0, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("file = %q, want only the latest line", got)
+	}
+	matches, _ := filepath.Glob(path + ".*")
+	if len(matches) != 0 {
+		t.Errorf("backups = %v, want none", matches)
+	}
+}
+
+func TestRotatingFile_OversizedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenRotatingFile(path, 4, 1, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Repeat("x", 10) + "\n"
+	if _, err := f.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != line {
+		t.Errorf("file = %q, want the whole line", got)
+	}
+	if _, err := f.Write([]byte("late\n")); err == nil {
+		t.Error("Write() after Close() error = nil")
+	}
+}
+
+func TestRotatingFile_RotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	var logs bytes.Buffer
+	f, err := OpenRotatingFile(path, 8, 1, slog.New(slog.NewTextHandler(&logs, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	// A non-empty directory in the way of path.1 makes the rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocker"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("line-1\n")); err != nil {
+		t.Fatal(err)
+	}
+	// The line is kept, so the write succeeds and only the rotation
+	// failure is logged.
+	if n, err := f.Write([]byte("line-2\n")); n != 7 || err != nil {
+		t.Errorf("Write() = %d, %v; want 7, nil", n, err)
+	}
+	if got := readFile(t, path); got != "line-1\nline-2\n" {
+		t.Errorf("file = %q, want both lines kept", got)
+	}
+	if !strings.Contains(logs.String(), "failed to rotate audit log") {
+		t.Errorf("logs = %q, want the rotation failure", logs.String())
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("line-3\n")); err != nil {
+		t.Fatalf("Write() after the failure error = %v", err)
+	}
+	if got := readFile(t, path); got != "line-3\n" {
+		t.Errorf("file = %q, want a fresh file", got)
+	}
+	if got := readFile(t, path+".1"); got != "line-1\nline-2\n" {
+		t.Errorf("backup = %q", got)
+	}
+}
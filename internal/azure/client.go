@@ -0,0 +1,212 @@
+package azure
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+const apiVersion = "2021-08-06"
+
+type EnumerationResults struct {
+	XMLName    xml.Name `xml:"EnumerationResults"`
+	Prefix     string   `xml:"Prefix"`
+	Blobs      []Blob   `xml:"Blobs>Blob"`
+	Prefixes   []string `xml:"Blobs>BlobPrefix>Name"`
+	NextMarker string   `xml:"NextMarker"`
+}
+
+type Blob struct {
+	Name       string `xml:"Name"`
+	Properties struct {
+		LastModified string `xml:"Last-Modified"`
+	} `xml:"Properties"`
+}
+
+// Client lists blobs in an Azure Storage container using either a shared
+// account key or a SAS token.
+type Client struct {
+	endpoint   string
+	account    string
+	container  string
+	accountKey []byte
+	sasToken   url.Values
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewClient returns a Client. endpoint defaults to
+// https://{account}.blob.core.windows.net; set it for Azurite or sovereign
+// clouds. Exactly one of accountKey (base64) and sasToken should be given.
+func NewClient(endpoint, account, container, accountKey, sasToken string, httpClient *http.Client) (*Client, error) {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+
+	c := &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		account:    account,
+		container:  container,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+
+	if accountKey != "" {
+		key, err := base64.StdEncoding.DecodeString(accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid account key: %w", err)
+		}
+		c.accountKey = key
+	}
+	if sasToken != "" {
+		values, err := url.ParseQuery(strings.TrimPrefix(sasToken, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SAS token: %w", err)
+		}
+		c.sasToken = values
+	}
+	return c, nil
+}
+
+// stringToSign builds the Shared Key string to sign for req as described in
+// "Authorize with Shared Key" for service version 2009-09-19 and later.
+func stringToSign(req *http.Request, account string) string {
+	contentLength := req.Header.Get("Content-Length")
+	if contentLength == "0" {
+		contentLength = ""
+	}
+
+	var b strings.Builder
+	for _, v := range []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date: x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	} {
+		b.WriteString(v)
+		b.WriteByte('\n')
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	for _, name := range msHeaders {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.TrimSpace(req.Header.Get(name)))
+		b.WriteByte('\n')
+	}
+
+	b.WriteString("/")
+	b.WriteString(account)
+	b.WriteString(req.URL.EscapedPath())
+
+	query := req.URL.Query()
+	names := make([]string, 0, len(query))
+	lowered := make(map[string][]string, len(query))
+	for name, values := range query {
+		lower := strings.ToLower(name)
+		if _, seen := lowered[lower]; !seen {
+			names = append(names, lower)
+		}
+		lowered[lower] = append(lowered[lower], values...)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := lowered[name]
+		sort.Strings(values)
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(values, ","))
+	}
+	return b.String()
+}
+
+func sign(key []byte, s string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newRequest returns a signed GET request for the container, or for the
+// blob named by blobPath when it is not empty.
+func (c *Client) newRequest(ctx context.Context, blobPath string, query url.Values) (*http.Request, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	for name, values := range c.sasToken {
+		query[name] = values
+	}
+
+	reqURL := fmt.Sprintf("%s/%s", c.endpoint, url.PathEscape(c.container))
+	if blobPath != "" {
+		reqURL += (&url.URL{Path: "/" + blobPath}).EscapedPath()
+	}
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	trace.Inject(ctx, req)
+	req.Header.Set("x-ms-date", c.now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", apiVersion)
+	if c.accountKey != nil {
+		signature := sign(c.accountKey, stringToSign(req, c.account))
+		req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", c.account, signature))
+	}
+	return req, nil
+}
+
+// CheckBackupExists runs backend.Detect over List Blobs calls on the
+// container.
+func (c *Client) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	prefix := fmt.Sprintf("%s/%s/", namespace, pvc)
+	return backend.Detect(func(name string) (string, error) {
+		blobs, _, err := c.list(ctx, prefix+name, "", 1)
+		if err != nil || len(blobs) == 0 {
+			return "", err
+		}
+		return strings.TrimPrefix(blobs[0].Name, prefix), nil
+	}, func(limit int) ([]string, error) {
+		blobs, prefixes, err := c.list(ctx, prefix, "/", limit)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]string, 0, len(blobs)+len(prefixes))
+		for _, blob := range blobs {
+			entries = append(entries, strings.TrimPrefix(blob.Name, prefix))
+		}
+		for _, p := range prefixes {
+			entries = append(entries, strings.TrimPrefix(p, prefix))
+		}
+		return entries, nil
+	})
+}
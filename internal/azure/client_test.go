@@ -0,0 +1,341 @@
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("pvc-plumber-test-account-key-123"))
+
+// listBlobsStub emulates the List Blobs and Get Blob operations of the Blob
+// service, verifying Shared Key signatures or SAS tokens on every request.
+// Blob contents are their names.
+type listBlobsStub struct {
+	account string
+	key     []byte
+	sas     string
+	blobs   map[string][]string
+	// pageSize limits the entries per listing page; 0 returns one page.
+	pageSize int
+	// lists counts List Blobs requests.
+	lists int
+}
+
+func (s *listBlobsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	container, blob, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if blob == "" && (query.Get("restype") != "container" || query.Get("comp") != "list") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("x-ms-version") == "" || r.Header.Get("x-ms-date") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case s.key != nil:
+		want := fmt.Sprintf("SharedKey %s:%s", s.account, sign(s.key, stringToSign(r, s.account)))
+		if r.Header.Get("Authorization") != want {
+			writeError(w, http.StatusForbidden, "AuthenticationFailed")
+			return
+		}
+	case s.sas != "":
+		if query.Get("sig") != s.sas {
+			writeError(w, http.StatusForbidden, "AuthenticationFailed")
+			return
+		}
+	}
+
+	names, ok := s.blobs[container]
+	if !ok {
+		writeError(w, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+	if blob != "" {
+		if !slices.Contains(names, blob) {
+			writeError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		_, _ = w.Write([]byte(blob))
+		return
+	}
+
+	s.lists++
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults ServiceEndpoint="http://%s/" ContainerName="%s">`, r.Host, container)
+	fmt.Fprintf(&b, "<Prefix>%s</Prefix><MaxResults>%s</MaxResults><Delimiter>%s</Delimiter><Blobs>", prefix, query.Get("maxresults"), delimiter)
+	seen := map[string]bool{}
+	var entries []string
+	for _, name := range names {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			if p := prefix + rest[:i+1]; !seen[p] {
+				seen[p] = true
+				entries = append(entries, fmt.Sprintf("<BlobPrefix><Name>%s</Name></BlobPrefix>", p))
+			}
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("<Blob><Name>%s</Name><Properties><Content-Length>155</Content-Length></Properties></Blob>", name))
+	}
+	// Markers are entry offsets.
+	start, _ := strconv.Atoi(query.Get("marker"))
+	pageSize := s.pageSize
+	if n, _ := strconv.Atoi(query.Get("maxresults")); n > 0 && (pageSize == 0 || n < pageSize) {
+		pageSize = n
+	}
+	end, next := len(entries), ""
+	if pageSize > 0 && start+pageSize < len(entries) {
+		end = start + pageSize
+		next = strconv.Itoa(end)
+	}
+	for _, entry := range entries[min(start, len(entries)):end] {
+		b.WriteString(entry)
+	}
+	fmt.Fprintf(&b, "</Blobs><NextMarker>%s</NextMarker></EnumerationResults>", next)
+
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>stub</Message></Error>`, code)
+}
+
+func newStub() *listBlobsStub {
+	key, _ := base64.StdEncoding.DecodeString(testKey)
+	return &listBlobsStub{
+		account: "volsync",
+		key:     key,
+		blobs: map[string][]string{
+			"backups": {
+				"karakeep/data-pvc/config",
+				"karakeep/data-pvc/data/00/00a1",
+				"karakeep/data-pvc/keys/abc",
+				"karakeep/data-pvc/snapshots/def",
+				"paperless/media/kopia.repository",
+				"paperless/media/p0a1b2",
+				"paperless/media/q9f8e7",
+				"paperless/media/xn0_0a1b2",
+				"stray/data-pvc/backup.tar.gz",
+			},
+		},
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	c, err := NewClient("", "volsync", "backups", testKey, "", http.DefaultClient)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if c.endpoint != "https://volsync.blob.core.windows.net" {
+		t.Errorf("endpoint = %v", c.endpoint)
+	}
+
+	if _, err := NewClient("", "volsync", "backups", "not base64!", "", http.DefaultClient); err == nil {
+		t.Error("expected error for invalid account key")
+	}
+
+	sas, err := NewClient("", "volsync", "backups", "", "?sv=2021-08-06&sig=abc", http.DefaultClient)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if sas.sasToken.Get("sig") != "abc" {
+		t.Errorf("sasToken = %v", sas.sasToken)
+	}
+}
+
+func TestStringToSign(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://volsync.blob.core.windows.net/backups?restype=container&comp=list&prefix=ns%2Fpvc%2F&maxresults=1", nil)
+	req.Header.Set("x-ms-date", "Sun, 18 Oct 2026 00:00:00 GMT")
+	req.Header.Set("x-ms-version", apiVersion)
+
+	want := "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+		"x-ms-date:Sun, 18 Oct 2026 00:00:00 GMT\n" +
+		"x-ms-version:2021-08-06\n" +
+		"/volsync/backups\n" +
+		"comp:list\n" +
+		"maxresults:1\n" +
+		"prefix:ns/pvc/\n" +
+		"restype:container"
+	if got := stringToSign(req, "volsync"); got != want {
+		t.Errorf("stringToSign() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCheckBackupExists(t *testing.T) {
+	tests := []struct {
+		name         string
+		accountKey   string
+		sasToken     string
+		stub         func(*listBlobsStub)
+		container    string
+		namespace    string
+		pvc          string
+		wantExists   bool
+		wantKeyCount int
+		wantRepoType string
+		wantError    bool
+	}{
+		{
+			name:         "shared key, backup exists",
+			accountKey:   testKey,
+			container:    "backups",
+			namespace:    "karakeep",
+			pvc:          "data-pvc",
+			wantExists:   true,
+			wantKeyCount: 4,
+			wantRepoType: backend.RepoTypeRestic,
+		},
+		{
+			name:         "kopia repository",
+			accountKey:   testKey,
+			container:    "backups",
+			namespace:    "paperless",
+			pvc:          "media",
+			wantExists:   true,
+			wantKeyCount: 3,
+			wantRepoType: backend.RepoTypeKopia,
+		},
+		{
+			name:         "unrecognised objects",
+			accountKey:   testKey,
+			container:    "backups",
+			namespace:    "stray",
+			pvc:          "data-pvc",
+			wantKeyCount: 1,
+			wantRepoType: backend.RepoTypeUnknown,
+		},
+		{
+			name:       "shared key, no backup",
+			accountKey: testKey,
+			container:  "backups",
+			namespace:  "karakeep",
+			pvc:        "other-pvc",
+		},
+		{
+			name:       "wrong shared key",
+			accountKey: base64.StdEncoding.EncodeToString([]byte("wrong")),
+			container:  "backups",
+			namespace:  "karakeep",
+			pvc:        "data-pvc",
+			wantError:  true,
+		},
+		{
+			name:         "SAS token",
+			sasToken:     "sv=2021-08-06&sp=rl&sig=secret",
+			stub:         func(s *listBlobsStub) { s.key, s.sas = nil, "secret" },
+			container:    "backups",
+			namespace:    "karakeep",
+			pvc:          "data-pvc",
+			wantExists:   true,
+			wantKeyCount: 4,
+			wantRepoType: backend.RepoTypeRestic,
+		},
+		{
+			name:       "missing container",
+			accountKey: testKey,
+			container:  "nope",
+			namespace:  "karakeep",
+			pvc:        "data-pvc",
+			wantError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStub()
+			if tt.stub != nil {
+				tt.stub(stub)
+			}
+			server := httptest.NewServer(stub)
+			defer server.Close()
+
+			client, err := NewClient(server.URL, "volsync", tt.container, tt.accountKey, tt.sasToken, &http.Client{Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			result := client.CheckBackupExists(context.Background(), tt.namespace, tt.pvc)
+
+			if result.Exists != tt.wantExists {
+				t.Errorf("Exists = %v, want %v", result.Exists, tt.wantExists)
+			}
+			if result.KeyCount != tt.wantKeyCount {
+				t.Errorf("KeyCount = %v, want %v", result.KeyCount, tt.wantKeyCount)
+			}
+			if result.RepoType != tt.wantRepoType {
+				t.Errorf("RepoType = %q, want %q", result.RepoType, tt.wantRepoType)
+			}
+			if tt.wantError && result.Error == "" {
+				t.Errorf("Expected error but got none")
+			}
+			if !tt.wantError && result.Error != "" {
+				t.Errorf("Unexpected error: %v", result.Error)
+			}
+		})
+	}
+}
+
+func TestCheckBackupExists_Paginates(t *testing.T) {
+	stub := newStub()
+	stub.pageSize = 2
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	// The top level of the restic repository spans two pages.
+	client, _ := NewClient(server.URL, "volsync", "backups", testKey, "", &http.Client{Timeout: 5 * time.Second})
+	result := client.CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+	if !result.Exists || result.RepoType != backend.RepoTypeRestic || result.KeyCount != 4 {
+		t.Errorf("result = %+v, want a restic repository with 4 entries", result)
+	}
+}
+
+func TestCheckBackupExists_Bounded(t *testing.T) {
+	stub := newStub()
+	for i := 0; i < 500; i++ {
+		stub.blobs["backups"] = append(stub.blobs["backups"], fmt.Sprintf("paperless/media/p%04x", i), fmt.Sprintf("stray/data-pvc/%04x", i))
+	}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client, _ := NewClient(server.URL, "volsync", "backups", testKey, "", &http.Client{Timeout: 5 * time.Second})
+
+	// Kopia is found by three one-blob probes, not by listing its blobs.
+	result := client.CheckBackupExists(context.Background(), "paperless", "media")
+	if !result.Exists || result.RepoType != backend.RepoTypeKopia || stub.lists != 3 {
+		t.Errorf("result = %+v after %d listings, want a Kopia repository after 3", result, stub.lists)
+	}
+
+	stub.lists = 0
+	result = client.CheckBackupExists(context.Background(), "stray", "data-pvc")
+	if result.Exists || result.KeyCount != backend.TopLevelLimit || stub.lists != 2 {
+		t.Errorf("result = %+v after %d listings, want %d entries after 2", result, stub.lists, backend.TopLevelLimit)
+	}
+}
+
+func TestCheckBackupExists_InvalidXML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not xml"))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "volsync", "backups", "", "", &http.Client{Timeout: 5 * time.Second})
+	result := client.CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+	if result.Exists || result.Error == "" {
+		t.Errorf("result = %+v, want parse error", result)
+	}
+}
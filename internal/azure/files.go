@@ -0,0 +1,143 @@
+package azure
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// ListFiles returns the names of the blobs under
+// {namespace}/{pvc}/{dir}/.
+func (c *Client) ListFiles(ctx context.Context, namespace, pvc, dir string) ([]string, error) {
+	prefix := fmt.Sprintf("%s/%s/%s/", namespace, pvc, dir)
+	blobs, err := c.listBlobs(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		names = append(names, strings.TrimPrefix(blob.Name, prefix))
+	}
+	return names, nil
+}
+
+// ListSnapshotFiles returns the blobs under {namespace}/{pvc}/snapshots/
+// with their Last-Modified times.
+func (c *Client) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]backend.SnapshotFile, error) {
+	prefix := fmt.Sprintf("%s/%s/snapshots/", namespace, pvc)
+	blobs, err := c.listBlobs(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]backend.SnapshotFile, 0, len(blobs))
+	for _, blob := range blobs {
+		modTime, err := http.ParseTime(blob.Properties.LastModified)
+		if err != nil {
+			return nil, fmt.Errorf("blob %s: invalid Last-Modified %q", blob.Name, blob.Properties.LastModified)
+		}
+		files = append(files, backend.SnapshotFile{Name: strings.TrimPrefix(blob.Name, prefix), ModTime: modTime})
+	}
+	return files, nil
+}
+
+// ListRepositories returns every {namespace}/{pvc}/ prefix in the container.
+func (c *Client) ListRepositories(ctx context.Context) ([]backend.Repository, error) {
+	_, namespaces, err := c.list(ctx, "", "/", 0)
+	if err != nil {
+		return nil, err
+	}
+	var repos []backend.Repository
+	for _, ns := range namespaces {
+		_, pvcs, err := c.list(ctx, ns, "/", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs {
+			repos = append(repos, backend.Repository{
+				Namespace: strings.TrimSuffix(ns, "/"),
+				PVC:       strings.TrimSuffix(strings.TrimPrefix(pvc, ns), "/"),
+			})
+		}
+	}
+	return repos, nil
+}
+
+// listBlobs returns every blob under prefix.
+func (c *Client) listBlobs(ctx context.Context, prefix string) ([]Blob, error) {
+	blobs, _, err := c.list(ctx, prefix, "", 0)
+	return blobs, err
+}
+
+// list returns the blobs and, when delimiter is set, the blob prefixes
+// under prefix, following continuation markers until the listing is
+// complete or, when limit is not 0, holds at least limit entries.
+func (c *Client) list(ctx context.Context, prefix, delimiter string, limit int) ([]Blob, []string, error) {
+	var blobs []Blob
+	var prefixes []string
+	marker := ""
+	for {
+		query := url.Values{}
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		query.Set("prefix", prefix)
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if limit > 0 {
+			query.Set("maxresults", strconv.Itoa(limit))
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+
+		body, err := c.get(ctx, "", query)
+		if err != nil {
+			return nil, nil, err
+		}
+		var result EnumerationResults
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, nil, backend.InvalidResponse(fmt.Errorf("failed to parse XML: %w", err))
+		}
+		blobs = append(blobs, result.Blobs...)
+		prefixes = append(prefixes, result.Prefixes...)
+
+		if result.NextMarker == "" || (limit > 0 && len(blobs)+len(prefixes) >= limit) {
+			return blobs, prefixes, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// ReadFile returns the blob {namespace}/{pvc}/{dir}/{name}.
+func (c *Client) ReadFile(ctx context.Context, namespace, pvc, dir, name string) ([]byte, error) {
+	return c.get(ctx, strings.Join([]string{namespace, pvc, dir, name}, "/"), nil)
+}
+
+func (c *Client) get(ctx context.Context, blobPath string, query url.Values) ([]byte, error) {
+	req, err := c.newRequest(ctx, blobPath, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Azure Blob Storage: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, backend.InvalidResponse(fmt.Errorf("failed to read response: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &backend.HTTPError{Service: "Azure Blob Storage", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
@@ -0,0 +1,92 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+func TestListFiles_Paginates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("prefix") != "karakeep/data-pvc/snapshots/" || query.Get("sig") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		name, next := "abc", "<NextMarker>page2</NextMarker>"
+		if query.Get("marker") == "page2" {
+			name, next = "def", "<NextMarker />"
+		}
+		fmt.Fprintf(w, `<EnumerationResults><Blobs><Blob><Name>karakeep/data-pvc/snapshots/%s</Name></Blob></Blobs>%s</EnumerationResults>`, name, next)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "volsync", "backups", "", "sig=secret", &http.Client{Timeout: 5 * time.Second})
+	names, err := client.ListFiles(context.Background(), "karakeep", "data-pvc", "snapshots")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if want := []string{"abc", "def"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListFiles() = %v, want %v", names, want)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	server := httptest.NewServer(newStub())
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "volsync", "backups", testKey, "", &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	data, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "abc")
+	if err != nil || string(data) != "karakeep/data-pvc/keys/abc" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+	if _, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "missing"); err == nil {
+		t.Error("expected error for missing blob")
+	}
+}
+
+func TestListSnapshotFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<EnumerationResults><Blobs><Blob><Name>karakeep/data-pvc/snapshots/abc</Name>`+
+			`<Properties><Last-Modified>Fri, 16 Oct 2026 02:01:07 GMT</Last-Modified></Properties></Blob></Blobs><NextMarker /></EnumerationResults>`)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "volsync", "backups", "", "sig=secret", &http.Client{Timeout: 5 * time.Second})
+	files, err := client.ListSnapshotFiles(context.Background(), "karakeep", "data-pvc")
+	if err != nil {
+		t.Fatalf("ListSnapshotFiles() error = %v", err)
+	}
+	want := time.Date(2026, 10, 16, 2, 1, 7, 0, time.UTC)
+	if len(files) != 1 || files[0].Name != "abc" || !files[0].ModTime.Equal(want) {
+		t.Errorf("ListSnapshotFiles() = %+v", files)
+	}
+}
+
+func TestListRepositories(t *testing.T) {
+	server := httptest.NewServer(newStub())
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "volsync", "backups", testKey, "", &http.Client{Timeout: 5 * time.Second})
+	repos, err := client.ListRepositories(context.Background())
+	if err != nil {
+		t.Fatalf("ListRepositories() error = %v", err)
+	}
+	want := []backend.Repository{
+		{Namespace: "karakeep", PVC: "data-pvc"},
+		{Namespace: "paperless", PVC: "media"},
+		{Namespace: "stray", PVC: "data-pvc"},
+	}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("ListRepositories() = %v, want %v", repos, want)
+	}
+}
@@ -0,0 +1,35 @@
+// Package backend defines the contract between the HTTP handlers and the
+// storage systems that hold backup repositories.
+package backend
+
+import "github.com/mitchross/pvc-plumber/plumber"
+
+// CheckResult is plumber.CheckResult.
+type CheckResult = plumber.CheckResult
+
+// Backend is plumber.BackupChecker.
+type Backend = plumber.BackupChecker
+
+// Unwrapper is implemented by Backends that decorate another Backend, such
+// as caches and retries.
+type Unwrapper interface {
+	Unwrap() Backend
+}
+
+// As returns the first Backend in b's chain of decorators, starting with b
+// itself, that implements T. Optional interfaces such as SnapshotFileLister
+// stay reachable through decorators that only implement Backend.
+func As[T any](b Backend) (T, bool) {
+	for b != nil {
+		if t, ok := b.(T); ok {
+			return t, true
+		}
+		u, ok := b.(Unwrapper)
+		if !ok {
+			break
+		}
+		b = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
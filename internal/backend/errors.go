@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mitchross/pvc-plumber/plumber"
+)
+
+// The error codes are plumber's Code constants.
+const (
+	CodeTimeout         = plumber.CodeTimeout
+	CodeUnavailable     = plumber.CodeUnavailable
+	CodeThrottled       = plumber.CodeThrottled
+	CodeAccessDenied    = plumber.CodeAccessDenied
+	CodeNoSuchBucket    = plumber.CodeNoSuchBucket
+	CodeInvalidResponse = plumber.CodeInvalidResponse
+	CodeBackendError    = plumber.CodeBackendError
+)
+
+// CodedError is plumber.CodedError.
+type CodedError = plumber.CodedError
+
+// Classify is plumber.Classify.
+func Classify(err error) (code string, retryable bool) {
+	return plumber.Classify(err)
+}
+
+// Failure is plumber.Failure.
+func Failure(err error) CheckResult {
+	return plumber.Failure(err)
+}
+
+// StatusCode returns the error code of an HTTP error status from a storage
+// service.
+func StatusCode(status int) (code string, retryable bool) {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return CodeAccessDenied, false
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return CodeTimeout, true
+	case status == http.StatusTooManyRequests:
+		return CodeThrottled, true
+	case status >= 500:
+		return CodeUnavailable, true
+	}
+	return CodeBackendError, false
+}
+
+// HTTPError is an unexpected HTTP status from a storage service.
+type HTTPError struct {
+	Service    string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.Service, e.StatusCode, e.Body)
+}
+
+func (e *HTTPError) ErrorCode() string {
+	code, _ := StatusCode(e.StatusCode)
+	return code
+}
+
+func (e *HTTPError) Retryable() bool {
+	_, retryable := StatusCode(e.StatusCode)
+	return retryable
+}
+
+// InvalidResponse marks err, a failure to read or decode a response, as
+// INVALID_RESPONSE.
+func InvalidResponse(err error) error {
+	return &invalidResponseError{err: err}
+}
+
+type invalidResponseError struct{ err error }
+
+func (e *invalidResponseError) Error() string     { return e.err.Error() }
+func (e *invalidResponseError) Unwrap() error     { return e.err }
+func (e *invalidResponseError) ErrorCode() string { return CodeInvalidResponse }
+func (e *invalidResponseError) Retryable() bool   { return false }
@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantCode      string
+		wantRetryable bool
+	}{
+		{"deadline", fmt.Errorf("failed to query S3: %w", context.DeadlineExceeded), CodeTimeout, true},
+		{"net timeout", fmt.Errorf("failed to query S3: %w", timeoutError{}), CodeTimeout, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, CodeUnavailable, true},
+		{"dns", fmt.Errorf("wrapped: %w", &net.DNSError{Name: "minio", Err: "no such host"}), CodeUnavailable, true},
+		{"http 403", &HTTPError{Service: "GCS", StatusCode: http.StatusForbidden}, CodeAccessDenied, false},
+		{"http 429", &HTTPError{Service: "GCS", StatusCode: http.StatusTooManyRequests}, CodeThrottled, true},
+		{"http 503", fmt.Errorf("list: %w", &HTTPError{Service: "GCS", StatusCode: http.StatusServiceUnavailable}), CodeUnavailable, true},
+		{"http 404", &HTTPError{Service: "GCS", StatusCode: http.StatusNotFound}, CodeBackendError, false},
+		{"invalid response", InvalidResponse(errors.New("failed to parse XML")), CodeInvalidResponse, false},
+		{"other", errors.New("permission denied"), CodeBackendError, false},
+	}
+	for _, tt := range tests {
+		code, retryable := Classify(tt.err)
+		if code != tt.wantCode || retryable != tt.wantRetryable {
+			t.Errorf("%s: Classify() = %q, %v, want %q, %v", tt.name, code, retryable, tt.wantCode, tt.wantRetryable)
+		}
+	}
+}
+
+func TestFailure(t *testing.T) {
+	err := &HTTPError{Service: "Azure Blob Storage", StatusCode: http.StatusForbidden, Body: "AuthorizationFailure"}
+	result := Failure(err)
+
+	want := CheckResult{
+		Error:     "Azure Blob Storage returned status 403: AuthorizationFailure",
+		ErrorCode: CodeAccessDenied,
+	}
+	if result != want {
+		t.Errorf("Failure() = %+v, want %+v", result, want)
+	}
+}
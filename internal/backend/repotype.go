@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/plumber"
+)
+
+// The repository formats are plumber's RepoType constants.
+const (
+	RepoTypeRestic  = plumber.RepoTypeRestic
+	RepoTypeKopia   = plumber.RepoTypeKopia
+	RepoTypeUnknown = plumber.RepoTypeUnknown
+)
+
+// Inspect classifies a repository from the entries directly under its
+// prefix and applies that format's validity rules. Entries are names
+// relative to the prefix; directories and common prefixes end in "/".
+//
+// A restic repository needs config plus data/, keys/ and snapshots/. A
+// Kopia repository needs kopia.repository plus at least one xn* index blob
+// and one q* metadata pack, which together hold its snapshot manifests.
+// Kopia's filesystem storage appends ".f" to blob files and shards blobs
+// into directories named after their first characters, so both forms are
+// accepted. Anything else under the prefix is reported as unknown and does
+// not count as a backup.
+func Inspect(entries []string) CheckResult {
+	if len(entries) == 0 {
+		return CheckResult{Exists: false, KeyCount: 0}
+	}
+
+	files := make(map[string]bool, len(entries))
+	dirs := make(map[string]bool, len(entries))
+	var hasIndex, hasMetadata bool
+	for _, entry := range entries {
+		name, isDir := strings.CutSuffix(entry, "/")
+		if isDir {
+			dirs[name] = true
+		} else {
+			name = strings.TrimSuffix(name, ".f")
+			files[name] = true
+		}
+		hasIndex = hasIndex || strings.HasPrefix(name, "xn")
+		hasMetadata = hasMetadata || strings.HasPrefix(name, "q")
+	}
+
+	// KeyCount is what was inspected, which for Detect is not the whole
+	// repository.
+	result := CheckResult{KeyCount: len(entries)}
+	switch {
+	case files["kopia.repository"]:
+		result.RepoType = RepoTypeKopia
+		result.Exists = hasIndex && hasMetadata
+	case files["config"]:
+		result.RepoType = RepoTypeRestic
+		result.Exists = dirs["data"] && dirs["keys"] && dirs["snapshots"]
+	default:
+		result.RepoType = RepoTypeUnknown
+	}
+	return result
+}
+
+// TopLevelLimit bounds the listing Detect makes of the top level of a
+// prefix that is not a Kopia repository. A restic repository has six
+// entries there.
+const TopLevelLimit = 100
+
+// Detect classifies an object store prefix like Inspect without listing
+// all of it. Kopia keeps every blob at the top level, so it is detected by
+// probing for kopia.repository and then for its index and metadata blobs.
+// probe returns the first entry whose name starts with name, or "" when
+// there is none. Otherwise list returns at least the first limit entries
+// of the top level, or all of them if there are fewer.
+func Detect(probe func(name string) (string, error), list func(limit int) ([]string, error)) CheckResult {
+	kopia, err := probe("kopia.repository")
+	if err != nil {
+		return Failure(err)
+	}
+	if kopia != "" {
+		entries := []string{kopia}
+		for _, blob := range []string{"xn", "q"} {
+			entry, err := probe(blob)
+			if err != nil {
+				return Failure(err)
+			}
+			if entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+		return Inspect(entries)
+	}
+
+	entries, err := list(TopLevelLimit)
+	if err != nil {
+		return Failure(err)
+	}
+	return Inspect(entries)
+}
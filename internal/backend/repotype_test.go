@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name         string
+		entries      []string
+		wantExists   bool
+		wantRepoType string
+	}{
+		{
+			name:    "empty",
+			entries: nil,
+		},
+		{
+			name:         "restic repository",
+			entries:      []string{"config", "data/", "index/", "keys/", "locks/", "snapshots/"},
+			wantExists:   true,
+			wantRepoType: RepoTypeRestic,
+		},
+		{
+			name:         "restic without snapshots",
+			entries:      []string{"config", "data/", "keys/"},
+			wantRepoType: RepoTypeRestic,
+		},
+		{
+			name:         "restic config is a directory",
+			entries:      []string{"config/", "data/", "keys/", "snapshots/"},
+			wantRepoType: RepoTypeUnknown,
+		},
+		{
+			name: "kopia object store repository",
+			entries: []string{
+				"_log_20261018120000_abcd_1697630400_1697630401_1_0123",
+				"kopia.blobcfg", "kopia.repository",
+				"p0a1b2c3d4e5f60718293a4b5c6d7e8f9-s1a2b3c4d5e6f7a8b-c1",
+				"q9f8e7d6c5b4a39281706f5e4d3c2b1a0-s1a2b3c4d5e6f7a8b-c1",
+				"xn0_0a1b2c3d4e5f60718293a4b5c6d7e8f9-s1a2b3c4d5e6f7a8b-c1",
+			},
+			wantExists:   true,
+			wantRepoType: RepoTypeKopia,
+		},
+		{
+			name:         "kopia filesystem repository",
+			entries:      []string{"kopia.blobcfg.f", "kopia.repository.f", "p0a/", "q9f/", "xn0/"},
+			wantExists:   true,
+			wantRepoType: RepoTypeKopia,
+		},
+		{
+			name:         "kopia without index",
+			entries:      []string{"kopia.repository", "p0a1b2", "q9f8e7"},
+			wantRepoType: RepoTypeKopia,
+		},
+		{
+			name:         "kopia without metadata packs",
+			entries:      []string{"kopia.repository", "p0a1b2", "xn0_0a1b2"},
+			wantRepoType: RepoTypeKopia,
+		},
+		{
+			name:         "unrelated objects",
+			entries:      []string{"backup.tar.gz", "README"},
+			wantRepoType: RepoTypeUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Inspect(tt.entries)
+			if result.Exists != tt.wantExists {
+				t.Errorf("Exists = %v, want %v", result.Exists, tt.wantExists)
+			}
+			if result.RepoType != tt.wantRepoType {
+				t.Errorf("RepoType = %q, want %q", result.RepoType, tt.wantRepoType)
+			}
+			if result.KeyCount != len(tt.entries) {
+				t.Errorf("KeyCount = %v, want %v", result.KeyCount, len(tt.entries))
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	entries := []string{"kopia.repository", "p0a1b2", "q9f8e7", "xn0_0a1b2"}
+	probe := func(name string) (string, error) {
+		for _, entry := range entries {
+			if strings.HasPrefix(entry, name) {
+				return entry, nil
+			}
+		}
+		return "", nil
+	}
+	listed := false
+	list := func(limit int) ([]string, error) {
+		listed = true
+		return entries, nil
+	}
+
+	if result := Detect(probe, list); !result.Exists || result.RepoType != RepoTypeKopia || result.KeyCount != 3 || listed {
+		t.Errorf("Detect() = %+v, listed %v; want a Kopia repository found by 3 probes", result, listed)
+	}
+
+	entries = []string{"config", "data/", "keys/", "snapshots/"}
+	if result := Detect(probe, list); !result.Exists || result.RepoType != RepoTypeRestic || !listed {
+		t.Errorf("Detect() = %+v, listed %v; want a listed restic repository", result, listed)
+	}
+
+	failing := func(string) (string, error) { return "", errors.New("connection refused") }
+	if result := Detect(failing, list); result.Error == "" {
+		t.Errorf("Detect() = %+v, want the probe error", result)
+	}
+}
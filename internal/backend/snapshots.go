@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/mitchross/pvc-plumber/internal/restic"
+	"github.com/mitchross/pvc-plumber/plumber"
+)
+
+// Sources of a selected snapshot.
+const (
+	SnapshotSourceMetadata = "metadata"
+	SnapshotSourceListing  = "listing"
+)
+
+// SnapshotRef is plumber.SnapshotRef.
+type SnapshotRef = plumber.SnapshotRef
+
+// SnapshotFile is plumber.SnapshotFile.
+type SnapshotFile = plumber.SnapshotFile
+
+// SnapshotFileLister is implemented by backends that can list snapshot
+// files with their modification times without decrypting the repository.
+type SnapshotFileLister interface {
+	ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]SnapshotFile, error)
+}
+
+// SnapshotLister lists the decrypted restic snapshots of a PVC's
+// repository, oldest first. restic.Lister implements it.
+type SnapshotLister interface {
+	Snapshots(ctx context.Context, namespace, pvc string) ([]restic.Snapshot, error)
+}
+
+// Repository is plumber.Repository.
+type Repository = plumber.Repository
+
+// Inventory is implemented by backends that can enumerate the
+// {namespace}/{pvc}/ repositories they hold.
+type Inventory interface {
+	ListRepositories(ctx context.Context) ([]Repository, error)
+}
+
+// RepositoryFile is plumber.RepositoryFile.
+type RepositoryFile = plumber.RepositoryFile
+
+// RepositoryFileLister is implemented by backends that can list every file
+// in a repository with its size.
+type RepositoryFileLister interface {
+	ListRepositoryFiles(ctx context.Context, namespace, pvc string) ([]RepositoryFile, error)
+}
@@ -0,0 +1,133 @@
+package checker
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// Cache remembers check results for a fixed time so that bursts of
+// admission requests for the same PVC query the backend once. Failed checks
+// are never cached. The least recently used entry is evicted when the cache
+// is full.
+type Cache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type cacheEntry struct {
+	key     string
+	result  backend.CheckResult
+	expires time.Time
+}
+
+func NewCache(ttl time.Duration, size int) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Middleware caches the results of next.
+func (c *Cache) Middleware(next backend.Backend) backend.Backend {
+	return &cached{next: next, cache: c}
+}
+
+type cached struct {
+	next  backend.Backend
+	cache *Cache
+}
+
+func (b *cached) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	ctx, span := trace.Start(ctx, "check-cache", trace.KindInternal)
+	defer span.End()
+
+	key := namespace + "/" + pvc
+	if result, ok := b.cache.get(key); ok {
+		b.cache.hits.Add(1)
+		span.SetAttribute("cache.hit", true)
+		return result
+	}
+	b.cache.misses.Add(1)
+	span.SetAttribute("cache.hit", false)
+
+	result := b.next.CheckBackupExists(ctx, namespace, pvc)
+	if result.Error != "" {
+		span.SetError(result.Error)
+		return result
+	}
+	b.cache.put(key, result)
+	return result
+}
+
+func (b *cached) Unwrap() backend.Backend { return b.next }
+
+func (c *Cache) get(key string) (backend.CheckResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return backend.CheckResult{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return backend.CheckResult{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.result, true
+}
+
+func (c *Cache) put(key string, result backend.CheckResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.result, entry.expires = result, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// WriteMetrics writes the cache counters in Prometheus text format.
+func (c *Cache) WriteMetrics(w io.Writer) {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_check_cache_hits_total Backup checks answered from the cache\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_check_cache_hits_total counter\n")
+	_, _ = fmt.Fprintf(w, "pvc_plumber_check_cache_hits_total %d\n", c.hits.Load())
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_check_cache_misses_total Backup checks passed to the backend\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_check_cache_misses_total counter\n")
+	_, _ = fmt.Fprintf(w, "pvc_plumber_check_cache_misses_total %d\n", c.misses.Load())
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_check_cache_entries Cached check results\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_check_cache_entries gauge\n")
+	_, _ = fmt.Fprintf(w, "pvc_plumber_check_cache_entries %d\n", entries)
+}
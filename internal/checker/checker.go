@@ -0,0 +1,91 @@
+// Package checker decorates a backend.Backend with logging, metrics,
+// caching, retries and a fallback backend. main assembles the chain from
+// configuration; the handler and controller only see a backend.Backend.
+package checker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// Middleware decorates a Backend.
+type Middleware func(backend.Backend) backend.Backend
+
+// Chain wraps b in middleware. The first middleware is the outermost and
+// sees every check first.
+func Chain(b backend.Backend, middleware ...Middleware) backend.Backend {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		b = middleware[i](b)
+	}
+	return b
+}
+
+// Logging logs failed checks at warn level and every other check at debug
+// level, with the request's trace attributes.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next backend.Backend) backend.Backend {
+		return &logging{next: next, logger: logger}
+	}
+}
+
+type logging struct {
+	next   backend.Backend
+	logger *slog.Logger
+}
+
+func (l *logging) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	start := time.Now()
+	result := l.next.CheckBackupExists(ctx, namespace, pvc)
+
+	logger := trace.Logger(ctx, l.logger).With(
+		"namespace", namespace,
+		"pvc", pvc,
+		"duration", time.Since(start))
+	if result.Error != "" {
+		logger.Warn("backend check failed", "error", result.Error, "error_code", result.ErrorCode, "retryable", result.Retryable)
+	} else {
+		logger.Debug("backend check", "exists", result.Exists, "keyCount", result.KeyCount, "repoType", result.RepoType)
+	}
+	return result
+}
+
+func (l *logging) Unwrap() backend.Backend { return l.next }
+
+// Fallback answers from secondary, such as a replica bucket, when the
+// primary check fails. A definitive answer from the primary, including "no
+// backup", is never overridden. If both fail, the primary's error is
+// returned with the secondary's appended.
+func Fallback(secondary backend.Backend, logger *slog.Logger) Middleware {
+	return func(next backend.Backend) backend.Backend {
+		return &fallback{primary: next, secondary: secondary, logger: logger}
+	}
+}
+
+type fallback struct {
+	primary   backend.Backend
+	secondary backend.Backend
+	logger    *slog.Logger
+}
+
+func (f *fallback) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	result := f.primary.CheckBackupExists(ctx, namespace, pvc)
+	if result.Error == "" {
+		return result
+	}
+
+	trace.Logger(ctx, f.logger).Warn("primary backend failed, checking fallback",
+		"namespace", namespace, "pvc", pvc, "error", result.Error)
+	secondary := f.secondary.CheckBackupExists(ctx, namespace, pvc)
+	if secondary.Error == "" {
+		return secondary
+	}
+	result.Error += "; fallback: " + secondary.Error
+	result.Retryable = result.Retryable || secondary.Retryable
+	return result
+}
+
+func (f *fallback) Unwrap() backend.Backend { return f.primary }
@@ -0,0 +1,286 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/backendtest"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/s3"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+	"github.com/mitchross/pvc-plumber/s3test"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+var errThrottled = &backend.HTTPError{Service: "S3", StatusCode: http.StatusTooManyRequests}
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next backend.Backend) backend.Backend {
+			return backendFunc(func(ctx context.Context, namespace, pvc string) backend.CheckResult {
+				order = append(order, name)
+				return next.CheckBackupExists(ctx, namespace, pvc)
+			})
+		}
+	}
+
+	fake := backendtest.New()
+	Chain(fake, tag("outer"), tag("inner")).CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+
+	if strings.Join(order, ",") != "outer,inner" || fake.Calls("karakeep", "data-pvc") != 1 {
+		t.Errorf("order = %v, calls = %d", order, fake.Calls("karakeep", "data-pvc"))
+	}
+}
+
+type backendFunc func(ctx context.Context, namespace, pvc string) backend.CheckResult
+
+func (f backendFunc) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	return f(ctx, namespace, pvc)
+}
+
+func TestChain_As(t *testing.T) {
+	fake := backendtest.New()
+	chain := Chain(fake, Logging(logger), NewCache(time.Minute, 10).Middleware, NewMetrics().Middleware, Retry(1, time.Millisecond))
+
+	if _, ok := chain.(backend.SnapshotFileLister); ok {
+		t.Fatal("chain itself should not implement SnapshotFileLister")
+	}
+	lister, ok := backend.As[backend.SnapshotFileLister](chain)
+	if !ok || lister != fake {
+		t.Errorf("As() = %v, %v, want the fake", lister, ok)
+	}
+	if _, ok := backend.As[backend.Inventory](backendFunc(nil)); ok {
+		t.Error("As() found an Inventory in a plain Backend")
+	}
+}
+
+func TestCache(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", time.Now())
+	fake.Fail("karakeep", "broken", errThrottled)
+
+	cache := NewCache(time.Minute, 2)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	b := cache.Middleware(fake)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if result := b.CheckBackupExists(ctx, "karakeep", "data-pvc"); !result.Exists {
+			t.Fatalf("result = %+v", result)
+		}
+	}
+	if calls := fake.Calls("karakeep", "data-pvc"); calls != 1 {
+		t.Errorf("backend calls = %d, want 1", calls)
+	}
+
+	// "No backup" is an answer and is cached; failures are not.
+	b.CheckBackupExists(ctx, "karakeep", "meili")
+	b.CheckBackupExists(ctx, "karakeep", "meili")
+	b.CheckBackupExists(ctx, "karakeep", "broken")
+	b.CheckBackupExists(ctx, "karakeep", "broken")
+	if fake.Calls("karakeep", "meili") != 1 || fake.Calls("karakeep", "broken") != 2 {
+		t.Errorf("calls: meili = %d, broken = %d", fake.Calls("karakeep", "meili"), fake.Calls("karakeep", "broken"))
+	}
+
+	// A third cached PVC evicts data-pvc, the least recently used entry.
+	b.CheckBackupExists(ctx, "karakeep", "other")
+	b.CheckBackupExists(ctx, "karakeep", "data-pvc")
+	if calls := fake.Calls("karakeep", "data-pvc"); calls != 2 {
+		t.Errorf("backend calls after eviction = %d, want 2", calls)
+	}
+
+	now = now.Add(time.Minute)
+	b.CheckBackupExists(ctx, "karakeep", "data-pvc")
+	if calls := fake.Calls("karakeep", "data-pvc"); calls != 3 {
+		t.Errorf("backend calls after expiry = %d, want 3", calls)
+	}
+
+	var buf bytes.Buffer
+	cache.WriteMetrics(&buf)
+	for _, want := range []string{
+		"pvc_plumber_check_cache_hits_total 3",
+		"pvc_plumber_check_cache_misses_total 7",
+		"pvc_plumber_check_cache_entries 2",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+type spanRecorder struct{ spans []trace.SpanData }
+
+func (r *spanRecorder) Export(s trace.SpanData) { r.spans = append(r.spans, s) }
+
+func TestCache_Spans(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", time.Now())
+	fake.Fail("karakeep", "broken", errThrottled)
+	b := NewCache(time.Minute, 10).Middleware(fake)
+
+	rec := &spanRecorder{}
+	handler := trace.NewTracer(rec, 1).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.CheckBackupExists(r.Context(), "karakeep", r.URL.Path[1:])
+	}))
+	for _, pvc := range []string{"data-pvc", "data-pvc", "broken"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/"+pvc, nil))
+	}
+
+	var cacheSpans []trace.SpanData
+	for _, s := range rec.spans {
+		if s.Name == "check-cache" {
+			cacheSpans = append(cacheSpans, s)
+		}
+	}
+	if len(cacheSpans) != 3 {
+		t.Fatalf("check-cache spans = %d, want 3", len(cacheSpans))
+	}
+	for i, want := range []bool{false, true, false} {
+		if cacheSpans[i].Attributes["cache.hit"] != want {
+			t.Errorf("span %d cache.hit = %v, want %v", i, cacheSpans[i].Attributes["cache.hit"], want)
+		}
+	}
+	if cacheSpans[0].Error != "" || cacheSpans[2].Error == "" {
+		t.Errorf("span errors = %q, %q, want only the failed check marked", cacheSpans[0].Error, cacheSpans[2].Error)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "retryable", err: errThrottled, wantCalls: 3},
+		{name: "not retryable", err: &backend.HTTPError{Service: "S3", StatusCode: http.StatusForbidden}, wantCalls: 1},
+		{name: "success", wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backendtest.New()
+			if tt.err != nil {
+				fake.Fail("karakeep", "data-pvc", tt.err)
+			}
+			var waits []time.Duration
+			b := Retry(2, 10*time.Millisecond)(fake).(*retry)
+			b.sleep = func(ctx context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+
+			result := b.CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+			if calls := fake.Calls("karakeep", "data-pvc"); calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.err != nil && result.Error == "" {
+				t.Error("final failure was not returned")
+			}
+			if tt.wantCalls == 3 && (len(waits) != 2 || waits[0] != 10*time.Millisecond || waits[1] != 20*time.Millisecond) {
+				t.Errorf("waits = %v, want [10ms 20ms]", waits)
+			}
+		})
+	}
+}
+
+func TestRetry_ContextDone(t *testing.T) {
+	fake := backendtest.New()
+	fake.Fail("karakeep", "data-pvc", errThrottled)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := Retry(5, time.Hour)(fake).CheckBackupExists(ctx, "karakeep", "data-pvc")
+	if result.ErrorCode != backend.CodeThrottled || fake.Calls("karakeep", "data-pvc") != 1 {
+		t.Errorf("result = %+v, calls = %d", result, fake.Calls("karakeep", "data-pvc"))
+	}
+}
+
+func TestFallback(t *testing.T) {
+	primary, replica := backendtest.New(), backendtest.New()
+	primary.Fail("karakeep", "data-pvc", errors.New("connection reset"))
+	replica.AddRepository("karakeep", "data-pvc", time.Now())
+	primary.Fail("karakeep", "both", errThrottled)
+	replica.Fail("karakeep", "both", errors.New("no route to host"))
+	replica.AddRepository("karakeep", "missing", time.Now())
+
+	b := Fallback(replica, logger)(primary)
+	ctx := context.Background()
+
+	if result := b.CheckBackupExists(ctx, "karakeep", "data-pvc"); !result.Exists || result.Error != "" {
+		t.Errorf("fallback result = %+v, want the replica's", result)
+	}
+
+	// The primary's "no backup" is authoritative.
+	if result := b.CheckBackupExists(ctx, "karakeep", "missing"); result.Exists || replica.Calls("karakeep", "missing") != 0 {
+		t.Errorf("result = %+v, replica calls = %d", result, replica.Calls("karakeep", "missing"))
+	}
+
+	result := b.CheckBackupExists(ctx, "karakeep", "both")
+	if result.ErrorCode != backend.CodeThrottled || !result.Retryable {
+		t.Errorf("result = %+v, want the primary's error code", result)
+	}
+	if want := "S3 returned status 429: ; fallback: no route to host"; result.Error != want {
+		t.Errorf("Error = %q, want %q", result.Error, want)
+	}
+}
+
+func TestFallback_SignedReplica(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+	server.CreateBucket("volsync-replica")
+	server.PutResticRepository("volsync-replica", "karakeep", "data-pvc", time.Now())
+	creds := s3test.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Region: "eu-west-1"}
+	server.RequireSigV4(creds)
+
+	primary := backendtest.New()
+	primary.Fail("karakeep", "data-pvc", errors.New("connection reset"))
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	ctx := context.Background()
+
+	anonymous := s3.NewClient(server.URL, "volsync-replica", httpClient)
+	if result := Fallback(anonymous, logger)(primary).CheckBackupExists(ctx, "karakeep", "data-pvc"); result.Exists || !strings.Contains(result.Error, "AccessDenied") {
+		t.Errorf("anonymous replica result = %+v, want AccessDenied", result)
+	}
+	signed := s3.NewClient(server.URL, "volsync-replica", httpClient, s3.WithCredentials(s3.Credentials(creds)))
+	if result := Fallback(signed, logger)(primary).CheckBackupExists(ctx, "karakeep", "data-pvc"); !result.Exists || result.Error != "" {
+		t.Errorf("signed replica result = %+v, want the replica's backup", result)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", time.Now())
+	fake.Fail("karakeep", "broken", errThrottled)
+
+	metrics := NewMetrics()
+	b := metrics.Middleware(fake)
+	ctx := context.Background()
+	b.CheckBackupExists(ctx, "karakeep", "data-pvc")
+	b.CheckBackupExists(ctx, "karakeep", "meili")
+	b.CheckBackupExists(ctx, "karakeep", "broken")
+
+	var buf bytes.Buffer
+	metrics.WriteMetrics(&buf)
+	for _, want := range []string{
+		`pvc_plumber_backend_checks_total{outcome="exists"} 1`,
+		`pvc_plumber_backend_checks_total{outcome="missing"} 1`,
+		`pvc_plumber_backend_checks_total{outcome="error"} 1`,
+		`pvc_plumber_backend_check_duration_seconds_bucket{le="10"} 3`,
+		`pvc_plumber_backend_check_duration_seconds_bucket{le="+Inf"} 3`,
+		"pvc_plumber_backend_check_duration_seconds_count 3",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the check duration
+// histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Outcomes of a check, as in the check-backup span.
+var outcomes = []string{"exists", "missing", "error"}
+
+// Metrics counts checks by outcome and records their duration.
+type Metrics struct {
+	mu       sync.Mutex
+	outcomes map[string]int64
+	buckets  []int64
+	sum      float64
+	count    int64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		outcomes: make(map[string]int64, len(outcomes)),
+		buckets:  make([]int64, len(durationBuckets)),
+	}
+}
+
+// Middleware measures the checks of next.
+func (m *Metrics) Middleware(next backend.Backend) backend.Backend {
+	return &measured{next: next, metrics: m}
+}
+
+type measured struct {
+	next    backend.Backend
+	metrics *Metrics
+}
+
+func (b *measured) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	start := time.Now()
+	result := b.next.CheckBackupExists(ctx, namespace, pvc)
+
+	outcome := "missing"
+	switch {
+	case result.Error != "":
+		outcome = "error"
+	case result.Exists:
+		outcome = "exists"
+	}
+	b.metrics.observe(outcome, time.Since(start))
+	return result
+}
+
+func (b *measured) Unwrap() backend.Backend { return b.next }
+
+func (m *Metrics) observe(outcome string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outcomes[outcome]++
+	seconds := d.Seconds()
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			m.buckets[i]++
+		}
+	}
+	m.sum += seconds
+	m.count++
+}
+
+// WriteMetrics writes the check counters and duration histogram in
+// Prometheus text format.
+func (m *Metrics) WriteMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_backend_checks_total Backend checks by outcome\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_backend_checks_total counter\n")
+	for _, outcome := range outcomes {
+		_, _ = fmt.Fprintf(w, "pvc_plumber_backend_checks_total{outcome=%q} %d\n", outcome, m.outcomes[outcome])
+	}
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_backend_check_duration_seconds Duration of backend checks\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_backend_check_duration_seconds histogram\n")
+	for i, le := range durationBuckets {
+		_, _ = fmt.Fprintf(w, "pvc_plumber_backend_check_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), m.buckets[i])
+	}
+	_, _ = fmt.Fprintf(w, "pvc_plumber_backend_check_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	_, _ = fmt.Fprintf(w, "pvc_plumber_backend_check_duration_seconds_sum %g\n", m.sum)
+	_, _ = fmt.Fprintf(w, "pvc_plumber_backend_check_duration_seconds_count %d\n", m.count)
+}
@@ -0,0 +1,52 @@
+package checker
+
+import (
+	"context"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// Retry repeats checks that fail with a retryable error, such as a timeout
+// or throttling, up to retries more times. The wait starts at backoff and
+// doubles after each attempt. It stops early when ctx is done, returning
+// the last failure.
+func Retry(retries int, backoff time.Duration) Middleware {
+	return func(next backend.Backend) backend.Backend {
+		return &retry{next: next, retries: retries, backoff: backoff, sleep: sleep}
+	}
+}
+
+type retry struct {
+	next    backend.Backend
+	retries int
+	backoff time.Duration
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func (r *retry) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	wait := r.backoff
+	for attempt := 0; ; attempt++ {
+		result := r.next.CheckBackupExists(ctx, namespace, pvc)
+		if result.Error == "" || !result.Retryable || attempt == r.retries {
+			return result
+		}
+		if err := r.sleep(ctx, wait); err != nil {
+			return result
+		}
+		wait *= 2
+	}
+}
+
+func (r *retry) Unwrap() backend.Backend { return r.next }
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
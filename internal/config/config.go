@@ -2,27 +2,258 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Supported values for BACKEND.
+const (
+	BackendS3         = "s3"
+	BackendFilesystem = "filesystem"
+	BackendRest       = "rest"
+	BackendAzure      = "azure"
+	BackendGCS        = "gcs"
+)
+
 type Config struct {
-	S3Endpoint  string
-	S3Bucket    string
-	HTTPTimeout time.Duration
-	Port        string
-	LogLevel    string
+	Backend      string
+	FSRoot       string
+	RestURL      string
+	RestUsername string
+	RestPassword string
+
+	AzureEndpoint   string
+	AzureAccount    string
+	AzureContainer  string
+	AzureAccountKey string
+	AzureSASToken   string
+
+	GCSEndpoint        string
+	GCSBucket          string
+	GCSCredentialsFile string
+
+	S3Endpoint        string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3Region          string
+	HTTPTimeout       time.Duration
+	Port              string
+	LogLevel          string
+
+	ControllerEnabled   bool
+	ControllerNamespace string
+	ControllerResync    time.Duration
+
+	VolSyncCopyMethod       string
+	VolSyncDestinationName  string
+	VolSyncRepositorySecret string
+	VolSyncStorageClass     string
+	VolSyncSnapshotClass    string
+	VolSyncCapacity         string
+	RestorePlanApply        bool
+
+	ResticPasswordFile string
+
+	FreshnessEnabled         bool
+	FreshnessInterval        time.Duration
+	FreshnessMaxAge          time.Duration
+	FreshnessNamespaceMaxAge map[string]time.Duration
+
+	ReportEnabled bool
+
+	StatsEnabled      bool
+	StatsCacheTTL     time.Duration
+	ExistsIncludeSize bool
+
+	WebhookEnabled   bool
+	TLSCertFile      string
+	TLSKeyFile       string
+	CapacityGuard    string
+	CapacityHeadroom float64
+
+	OrphanCleanupEnabled  bool
+	OrphanCleanupInterval time.Duration
+	OrphanGracePeriod     time.Duration
+	OrphanCleanupRules    []string
+	OrphanCleanupDelete   bool
+	OrphanDeleteInterval  time.Duration
+	OrphanDeleteMaxRepos  int
+	OrphanAuditLog        string
+	OrphanStateFile       string
+
+	OTLPEndpoint      string
+	OTLPServiceName   string
+	TraceSampleRatio  float64
+	TraceBatchSize    int
+	TraceExportPeriod time.Duration
+
+	AuditLog           string
+	AuditLogMaxSize    int64
+	AuditLogMaxBackups int
+
+	RateLimitRPS         float64
+	RateLimitBurst       int
+	RateLimitKey         string
+	RateLimitTrustTokens bool
+	MaxConcurrentLookups int
+	LookupQueueSize      int
+	LookupQueueTimeout   time.Duration
+
+	CheckCacheTTL      time.Duration
+	CheckCacheSize     int
+	CheckRetries       int
+	CheckRetryBackoff  time.Duration
+	FallbackS3Endpoint string
+	FallbackS3Bucket   string
+	// The replica's credentials default to the primary's.
+	FallbackS3AccessKeyID     string
+	FallbackS3SecretAccessKey string
+	FallbackS3Region          string
 }
 
-func Load() (*Config, error) {
-	s3Endpoint := os.Getenv("S3_ENDPOINT")
-	if s3Endpoint == "" {
-		return nil, fmt.Errorf("S3_ENDPOINT is required")
+func getBool(name string, def bool) (bool, error) {
+	str := os.Getenv(name)
+	if str == "" {
+		return def, nil
+	}
+	value, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// getDuration parses a positive duration, returning def when name is unset.
+func getDuration(name string, def time.Duration) (time.Duration, error) {
+	value, err := getOptionalDuration(name, def)
+	if err == nil && value == 0 {
+		return 0, fmt.Errorf("invalid %s: must be positive", name)
+	}
+	return value, err
+}
+
+// getOptionalDuration parses a duration for a setting that 0 turns off,
+// returning def when name is unset.
+func getOptionalDuration(name string, def time.Duration) (time.Duration, error) {
+	str := os.Getenv(name)
+	if str == "" {
+		return def, nil
+	}
+	value, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
 	}
+	if value < 0 {
+		return 0, fmt.Errorf("invalid %s: must not be negative", name)
+	}
+	return value, nil
+}
 
+// getInt parses an integer of at least min, returning def when name is
+// unset.
+func getInt(name string, def, min int) (int, error) {
+	str := os.Getenv(name)
+	if str == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if value < min {
+		return 0, fmt.Errorf("invalid %s: must be at least %d", name, min)
+	}
+	return value, nil
+}
+
+// getList splits a comma-separated list, dropping empty entries.
+func getList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getDurationMap parses comma-separated key=duration pairs such as
+// "media=192h,karakeep=26h".
+func getDurationMap(name string) (map[string]time.Duration, error) {
+	values := make(map[string]time.Duration)
+	for _, pair := range strings.Split(os.Getenv(name), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, str, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %s: %q is not key=duration", name, pair)
+		}
+		value, err := time.ParseDuration(str)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid %s: %q is not a positive duration", name, str)
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, nil
+}
+
+func getString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+func Load() (*Config, error) {
+	backendName := getString("BACKEND", BackendS3)
+	s3Endpoint := os.Getenv("S3_ENDPOINT")
 	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		return nil, fmt.Errorf("S3_BUCKET is required")
+	s3AccessKeyID := getString("S3_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID"))
+	s3SecretAccessKey := getString("S3_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	s3Region := getString("S3_REGION", getString("AWS_REGION", "us-east-1"))
+	fsRoot := os.Getenv("FS_ROOT")
+	restURL := os.Getenv("REST_URL")
+
+	switch backendName {
+	case BackendS3:
+		if s3Endpoint == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT is required")
+		}
+		if s3Bucket == "" {
+			return nil, fmt.Errorf("S3_BUCKET is required")
+		}
+		if (s3AccessKeyID == "") != (s3SecretAccessKey == "") {
+			return nil, fmt.Errorf("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set together")
+		}
+	case BackendFilesystem:
+		if fsRoot == "" {
+			return nil, fmt.Errorf("FS_ROOT is required when BACKEND=%s", BackendFilesystem)
+		}
+	case BackendRest:
+		if restURL == "" {
+			return nil, fmt.Errorf("REST_URL is required when BACKEND=%s", BackendRest)
+		}
+	case BackendAzure:
+		if os.Getenv("AZURE_STORAGE_ACCOUNT") == "" || os.Getenv("AZURE_CONTAINER") == "" {
+			return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT and AZURE_CONTAINER are required when BACKEND=%s", BackendAzure)
+		}
+		if (os.Getenv("AZURE_STORAGE_KEY") == "") == (os.Getenv("AZURE_SAS_TOKEN") == "") {
+			return nil, fmt.Errorf("exactly one of AZURE_STORAGE_KEY and AZURE_SAS_TOKEN is required when BACKEND=%s", BackendAzure)
+		}
+	case BackendGCS:
+		if os.Getenv("GCS_BUCKET") == "" {
+			return nil, fmt.Errorf("GCS_BUCKET is required when BACKEND=%s", BackendGCS)
+		}
+	default:
+		return nil, fmt.Errorf("invalid BACKEND: %q (want one of %s, %s, %s, %s, %s)",
+			backendName, BackendS3, BackendFilesystem, BackendRest, BackendAzure, BackendGCS)
 	}
 
 	httpTimeout := 3 * time.Second
@@ -44,11 +275,333 @@ func Load() (*Config, error) {
 		logLevel = "info"
 	}
 
+	controllerEnabled, err := getBool("CONTROLLER_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+
+	controllerResync, err := getDuration("CONTROLLER_RESYNC", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	copyMethod := getString("VOLSYNC_COPY_METHOD", "Snapshot")
+	switch copyMethod {
+	case "Snapshot", "Direct", "Clone":
+	default:
+		return nil, fmt.Errorf("invalid VOLSYNC_COPY_METHOD: %q (want Snapshot, Direct or Clone)", copyMethod)
+	}
+
+	restorePlanApply, err := getBool("RESTORE_PLAN_APPLY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	freshnessEnabled, err := getBool("FRESHNESS_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	freshnessInterval, err := getDuration("FRESHNESS_INTERVAL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	freshnessMaxAge, err := getDuration("FRESHNESS_MAX_AGE", 26*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	freshnessNamespaceMaxAge, err := getDurationMap("FRESHNESS_NAMESPACE_MAX_AGE")
+	if err != nil {
+		return nil, err
+	}
+
+	reportEnabled, err := getBool("REPORT_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+
+	statsEnabled, err := getBool("STATS_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	statsCacheTTL, err := getDuration("STATS_CACHE_TTL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	existsIncludeSize, err := getBool("EXISTS_INCLUDE_SIZE", false)
+	if err != nil {
+		return nil, err
+	}
+	if existsIncludeSize && !statsEnabled {
+		return nil, fmt.Errorf("EXISTS_INCLUDE_SIZE requires STATS_ENABLED")
+	}
+
+	webhookEnabled, err := getBool("WEBHOOK_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	tlsCertFile, tlsKeyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if webhookEnabled && tlsCertFile == "" {
+		// The API server only calls webhooks over HTTPS.
+		return nil, fmt.Errorf("WEBHOOK_ENABLED requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	capacityGuard := getString("CAPACITY_GUARD", "warn")
+	switch capacityGuard {
+	case "off", "warn", "patch":
+	default:
+		return nil, fmt.Errorf("invalid CAPACITY_GUARD: %q (want off, warn or patch)", capacityGuard)
+	}
+	capacityHeadroom, err := getInt("CAPACITY_HEADROOM_PERCENT", 20, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	orphanCleanupEnabled, err := getBool("ORPHAN_CLEANUP_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	orphanCleanupInterval, err := getDuration("ORPHAN_CLEANUP_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	orphanGracePeriod, err := getDuration("ORPHAN_GRACE_PERIOD", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	orphanCleanupRules := getList("ORPHAN_CLEANUP_RULES")
+	for _, rule := range orphanCleanupRules {
+		if _, err := path.Match(rule, ""); err != nil {
+			return nil, fmt.Errorf("invalid ORPHAN_CLEANUP_RULES: %q: %w", rule, err)
+		}
+	}
+	orphanCleanupDelete, err := getBool("ORPHAN_CLEANUP_DELETE", false)
+	if err != nil {
+		return nil, err
+	}
+	orphanDeleteInterval, err := getDuration("ORPHAN_DELETE_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	orphanDeleteMaxRepos, err := getInt("ORPHAN_DELETE_MAX_REPOSITORIES", 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	orphanAuditLog := os.Getenv("ORPHAN_AUDIT_LOG")
+	orphanStateFile := os.Getenv("ORPHAN_STATE_FILE")
+	if orphanCleanupDelete {
+		if backendName != BackendS3 {
+			return nil, fmt.Errorf("ORPHAN_CLEANUP_DELETE is only supported when BACKEND=%s", BackendS3)
+		}
+		if len(orphanCleanupRules) == 0 || orphanAuditLog == "" || orphanStateFile == "" {
+			return nil, fmt.Errorf("ORPHAN_CLEANUP_DELETE requires ORPHAN_CLEANUP_RULES, ORPHAN_AUDIT_LOG and ORPHAN_STATE_FILE")
+		}
+		if s3AccessKeyID == "" {
+			return nil, fmt.Errorf("ORPHAN_CLEANUP_DELETE requires S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+	}
+
+	// Tracing follows the OpenTelemetry SDK environment variables.
+	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if otlpEndpoint != "" {
+		if u, err := url.Parse(otlpEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT: %q is not an http(s) URL", otlpEndpoint)
+		}
+	}
+	traceSampleRatio := 1.0
+	if str := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); str != "" {
+		value, err := strconv.ParseFloat(str, 64)
+		if err != nil || value < 0 || value > 1 {
+			return nil, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG: %q is not a ratio between 0 and 1", str)
+		}
+		traceSampleRatio = value
+	}
+	traceBatchSize, err := getInt("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", 512, 1)
+	if err != nil {
+		return nil, err
+	}
+	traceExportDelay, err := getInt("OTEL_BSP_SCHEDULE_DELAY", 5000, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLogMaxSizeMB, err := getInt("AUDIT_LOG_MAX_SIZE_MB", 100, 1)
+	if err != nil {
+		return nil, err
+	}
+	auditLogMaxBackups, err := getInt("AUDIT_LOG_MAX_BACKUPS", 5, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitRPS := 0.0
+	if str := os.Getenv("RATE_LIMIT_RPS"); str != "" {
+		value, err := strconv.ParseFloat(str, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_RPS: %q is not a non-negative number", str)
+		}
+		rateLimitRPS = value
+	}
+	rateLimitBurst, err := getInt("RATE_LIMIT_BURST", 20, 1)
+	if err != nil {
+		return nil, err
+	}
+	rateLimitKey := getString("RATE_LIMIT_KEY", "ip")
+	switch rateLimitKey {
+	case "ip", "token", "serviceaccount":
+	default:
+		return nil, fmt.Errorf("invalid RATE_LIMIT_KEY: %q (want ip, token or serviceaccount)", rateLimitKey)
+	}
+	rateLimitTrustTokens, err := getBool("RATE_LIMIT_TRUST_TOKENS", false)
+	if err != nil {
+		return nil, err
+	}
+	if rateLimitKey != "ip" && !rateLimitTrustTokens {
+		// Unverified tokens let a client pick a new identity, and bucket, for
+		// every request.
+		return nil, fmt.Errorf("RATE_LIMIT_KEY=%s requires RATE_LIMIT_TRUST_TOKENS=true: bearer tokens are not verified, so only use it behind an authenticating proxy", rateLimitKey)
+	}
+	maxConcurrentLookups, err := getInt("MAX_CONCURRENT_LOOKUPS", 32, 0)
+	if err != nil {
+		return nil, err
+	}
+	lookupQueueSize, err := getInt("LOOKUP_QUEUE_SIZE", 64, 0)
+	if err != nil {
+		return nil, err
+	}
+	lookupQueueTimeout, err := getDuration("LOOKUP_QUEUE_TIMEOUT", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// Caching is off unless a TTL is set.
+	checkCacheTTL, err := getOptionalDuration("CHECK_CACHE_TTL", 0)
+	if err != nil {
+		return nil, err
+	}
+	checkCacheSize, err := getInt("CHECK_CACHE_SIZE", 1024, 1)
+	if err != nil {
+		return nil, err
+	}
+	checkRetries, err := getInt("CHECK_RETRIES", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	checkRetryBackoff, err := getDuration("CHECK_RETRY_BACKOFF", 100*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	fallbackS3Endpoint := os.Getenv("FALLBACK_S3_ENDPOINT")
+	fallbackS3Bucket := getString("FALLBACK_S3_BUCKET", s3Bucket)
+	fallbackS3AccessKeyID := getString("FALLBACK_S3_ACCESS_KEY_ID", s3AccessKeyID)
+	fallbackS3SecretAccessKey := getString("FALLBACK_S3_SECRET_ACCESS_KEY", s3SecretAccessKey)
+	if fallbackS3Endpoint != "" {
+		if u, err := url.Parse(fallbackS3Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid FALLBACK_S3_ENDPOINT: %q is not an http(s) URL", fallbackS3Endpoint)
+		}
+		if fallbackS3Bucket == "" {
+			return nil, fmt.Errorf("FALLBACK_S3_BUCKET is required when FALLBACK_S3_ENDPOINT is set")
+		}
+		if (fallbackS3AccessKeyID == "") != (fallbackS3SecretAccessKey == "") {
+			return nil, fmt.Errorf("FALLBACK_S3_ACCESS_KEY_ID and FALLBACK_S3_SECRET_ACCESS_KEY must be set together")
+		}
+	}
+
 	return &Config{
-		S3Endpoint:  s3Endpoint,
-		S3Bucket:    s3Bucket,
-		HTTPTimeout: httpTimeout,
-		Port:        port,
-		LogLevel:    logLevel,
+		Backend:      backendName,
+		FSRoot:       fsRoot,
+		RestURL:      restURL,
+		RestUsername: os.Getenv("REST_USERNAME"),
+		RestPassword: os.Getenv("REST_PASSWORD"),
+
+		AzureEndpoint:   os.Getenv("AZURE_ENDPOINT"),
+		AzureAccount:    os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		AzureContainer:  os.Getenv("AZURE_CONTAINER"),
+		AzureAccountKey: os.Getenv("AZURE_STORAGE_KEY"),
+		AzureSASToken:   os.Getenv("AZURE_SAS_TOKEN"),
+
+		GCSEndpoint:        os.Getenv("GCS_ENDPOINT"),
+		GCSBucket:          os.Getenv("GCS_BUCKET"),
+		GCSCredentialsFile: getString("GCS_CREDENTIALS_FILE", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")),
+
+		S3Endpoint:        s3Endpoint,
+		S3Bucket:          s3Bucket,
+		S3AccessKeyID:     s3AccessKeyID,
+		S3SecretAccessKey: s3SecretAccessKey,
+		S3Region:          s3Region,
+		HTTPTimeout:       httpTimeout,
+		Port:              port,
+		LogLevel:          logLevel,
+
+		ControllerEnabled:   controllerEnabled,
+		ControllerNamespace: os.Getenv("CONTROLLER_NAMESPACE"),
+		ControllerResync:    controllerResync,
+
+		VolSyncCopyMethod:       copyMethod,
+		VolSyncDestinationName:  getString("VOLSYNC_DESTINATION_NAME", "{pvc}-dst"),
+		VolSyncRepositorySecret: getString("VOLSYNC_REPOSITORY_SECRET", "{pvc}-volsync-secret"),
+		VolSyncStorageClass:     os.Getenv("VOLSYNC_STORAGE_CLASS"),
+		VolSyncSnapshotClass:    os.Getenv("VOLSYNC_SNAPSHOT_CLASS"),
+		VolSyncCapacity:         os.Getenv("VOLSYNC_CAPACITY"),
+		RestorePlanApply:        restorePlanApply,
+
+		ResticPasswordFile: os.Getenv("RESTIC_PASSWORD_FILE"),
+
+		FreshnessEnabled:         freshnessEnabled,
+		FreshnessInterval:        freshnessInterval,
+		FreshnessMaxAge:          freshnessMaxAge,
+		FreshnessNamespaceMaxAge: freshnessNamespaceMaxAge,
+
+		ReportEnabled: reportEnabled,
+
+		StatsEnabled:      statsEnabled,
+		StatsCacheTTL:     statsCacheTTL,
+		ExistsIncludeSize: existsIncludeSize,
+
+		WebhookEnabled:   webhookEnabled,
+		TLSCertFile:      tlsCertFile,
+		TLSKeyFile:       tlsKeyFile,
+		CapacityGuard:    capacityGuard,
+		CapacityHeadroom: float64(capacityHeadroom) / 100,
+
+		OrphanCleanupEnabled:  orphanCleanupEnabled,
+		OrphanCleanupInterval: orphanCleanupInterval,
+		OrphanGracePeriod:     orphanGracePeriod,
+		OrphanCleanupRules:    orphanCleanupRules,
+		OrphanCleanupDelete:   orphanCleanupDelete,
+		OrphanDeleteInterval:  orphanDeleteInterval,
+		OrphanDeleteMaxRepos:  orphanDeleteMaxRepos,
+		OrphanAuditLog:        orphanAuditLog,
+		OrphanStateFile:       orphanStateFile,
+
+		OTLPEndpoint:      otlpEndpoint,
+		OTLPServiceName:   getString("OTEL_SERVICE_NAME", "pvc-plumber"),
+		TraceSampleRatio:  traceSampleRatio,
+		TraceBatchSize:    traceBatchSize,
+		TraceExportPeriod: time.Duration(traceExportDelay) * time.Millisecond,
+
+		AuditLog:           os.Getenv("AUDIT_LOG"),
+		AuditLogMaxSize:    int64(auditLogMaxSizeMB) << 20,
+		AuditLogMaxBackups: auditLogMaxBackups,
+
+		RateLimitRPS:         rateLimitRPS,
+		RateLimitBurst:       rateLimitBurst,
+		RateLimitKey:         rateLimitKey,
+		RateLimitTrustTokens: rateLimitTrustTokens,
+		MaxConcurrentLookups: maxConcurrentLookups,
+		LookupQueueSize:      lookupQueueSize,
+		LookupQueueTimeout:   lookupQueueTimeout,
+
+		CheckCacheTTL:      checkCacheTTL,
+		CheckCacheSize:     checkCacheSize,
+		CheckRetries:       checkRetries,
+		CheckRetryBackoff:  checkRetryBackoff,
+		FallbackS3Endpoint: fallbackS3Endpoint,
+		FallbackS3Bucket:   fallbackS3Bucket,
+
+		FallbackS3AccessKeyID:     fallbackS3AccessKeyID,
+		FallbackS3SecretAccessKey: fallbackS3SecretAccessKey,
+		FallbackS3Region:          getString("FALLBACK_S3_REGION", s3Region),
 	}, nil
 }
@@ -151,3 +151,633 @@ func TestLoad(t *testing.T) {
 		})
 	}
 }
+
+func TestLoad_Controller(t *testing.T) {
+	tests := []struct {
+		name          string
+		envVars       map[string]string
+		wantErr       bool
+		wantEnabled   bool
+		wantNamespace string
+		wantResync    time.Duration
+	}{
+		{
+			name:       "controller disabled by default",
+			envVars:    map[string]string{},
+			wantResync: 10 * time.Minute,
+		},
+		{
+			name: "controller enabled",
+			envVars: map[string]string{
+				"CONTROLLER_ENABLED":   "true",
+				"CONTROLLER_NAMESPACE": "karakeep",
+				"CONTROLLER_RESYNC":    "1m",
+			},
+			wantEnabled:   true,
+			wantNamespace: "karakeep",
+			wantResync:    time.Minute,
+		},
+		{
+			name:    "invalid CONTROLLER_ENABLED",
+			envVars: map[string]string{"CONTROLLER_ENABLED": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid CONTROLLER_RESYNC",
+			envVars: map[string]string{"CONTROLLER_RESYNC": "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "zero CONTROLLER_RESYNC",
+			envVars: map[string]string{"CONTROLLER_RESYNC": "0s"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+			t.Setenv("S3_BUCKET", "test-bucket")
+			t.Setenv("CONTROLLER_ENABLED", "")
+			t.Setenv("CONTROLLER_NAMESPACE", "")
+			t.Setenv("CONTROLLER_RESYNC", "")
+			for k, v := range tt.envVars {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Load() error = nil, wantErr = true")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+
+			if cfg.ControllerEnabled != tt.wantEnabled {
+				t.Errorf("ControllerEnabled = %v, want %v", cfg.ControllerEnabled, tt.wantEnabled)
+			}
+			if cfg.ControllerNamespace != tt.wantNamespace {
+				t.Errorf("ControllerNamespace = %v, want %v", cfg.ControllerNamespace, tt.wantNamespace)
+			}
+			if cfg.ControllerResync != tt.wantResync {
+				t.Errorf("ControllerResync = %v, want %v", cfg.ControllerResync, tt.wantResync)
+			}
+		})
+	}
+}
+
+func TestLoad_VolSync(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.VolSyncCopyMethod != "Snapshot" {
+			t.Errorf("VolSyncCopyMethod = %v, want Snapshot", cfg.VolSyncCopyMethod)
+		}
+		if cfg.VolSyncDestinationName != "{pvc}-dst" {
+			t.Errorf("VolSyncDestinationName = %v, want {pvc}-dst", cfg.VolSyncDestinationName)
+		}
+		if cfg.VolSyncRepositorySecret != "{pvc}-volsync-secret" {
+			t.Errorf("VolSyncRepositorySecret = %v, want {pvc}-volsync-secret", cfg.VolSyncRepositorySecret)
+		}
+		if cfg.RestorePlanApply {
+			t.Error("RestorePlanApply = true, want false")
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("VOLSYNC_COPY_METHOD", "Direct")
+		t.Setenv("VOLSYNC_REPOSITORY_SECRET", "restic-{namespace}-{pvc}")
+		t.Setenv("VOLSYNC_STORAGE_CLASS", "longhorn")
+		t.Setenv("VOLSYNC_CAPACITY", "10Gi")
+		t.Setenv("RESTORE_PLAN_APPLY", "true")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.VolSyncCopyMethod != "Direct" {
+			t.Errorf("VolSyncCopyMethod = %v, want Direct", cfg.VolSyncCopyMethod)
+		}
+		if cfg.VolSyncRepositorySecret != "restic-{namespace}-{pvc}" {
+			t.Errorf("VolSyncRepositorySecret = %v", cfg.VolSyncRepositorySecret)
+		}
+		if cfg.VolSyncStorageClass != "longhorn" || cfg.VolSyncCapacity != "10Gi" {
+			t.Errorf("VolSyncStorageClass/Capacity = %v/%v", cfg.VolSyncStorageClass, cfg.VolSyncCapacity)
+		}
+		if !cfg.RestorePlanApply {
+			t.Error("RestorePlanApply = false, want true")
+		}
+	})
+
+	t.Run("invalid copy method", func(t *testing.T) {
+		t.Setenv("VOLSYNC_COPY_METHOD", "Rsync")
+		if _, err := Load(); err == nil {
+			t.Error("Load() error = nil, want error")
+		}
+	})
+
+	t.Run("invalid RESTORE_PLAN_APPLY", func(t *testing.T) {
+		t.Setenv("RESTORE_PLAN_APPLY", "sometimes")
+		if _, err := Load(); err == nil {
+			t.Error("Load() error = nil, want error")
+		}
+	})
+}
+
+func TestLoad_Backend(t *testing.T) {
+	tests := []struct {
+		name        string
+		envVars     map[string]string
+		wantErr     bool
+		wantBackend string
+		wantFSRoot  string
+	}{
+		{
+			name:        "s3 by default",
+			envVars:     map[string]string{"S3_ENDPOINT": "http://minio:9000", "S3_BUCKET": "volsync-backup"},
+			wantBackend: BackendS3,
+		},
+		{
+			name: "s3 with credentials",
+			envVars: map[string]string{
+				"S3_ENDPOINT":          "http://minio:9000",
+				"S3_BUCKET":            "volsync-backup",
+				"S3_ACCESS_KEY_ID":     "AKID",
+				"S3_SECRET_ACCESS_KEY": "secret",
+			},
+			wantBackend: BackendS3,
+		},
+		{
+			name:    "s3 requires both credential halves",
+			envVars: map[string]string{"S3_ENDPOINT": "http://minio:9000", "S3_BUCKET": "volsync-backup", "S3_ACCESS_KEY_ID": "AKID"},
+			wantErr: true,
+		},
+		{
+			name:        "filesystem without S3 settings",
+			envVars:     map[string]string{"BACKEND": "filesystem", "FS_ROOT": "/mnt/restic"},
+			wantBackend: BackendFilesystem,
+			wantFSRoot:  "/mnt/restic",
+		},
+		{
+			name:    "filesystem requires FS_ROOT",
+			envVars: map[string]string{"BACKEND": "filesystem"},
+			wantErr: true,
+		},
+		{
+			name:        "rest server",
+			envVars:     map[string]string{"BACKEND": "rest", "REST_URL": "http://rest-server:8000"},
+			wantBackend: BackendRest,
+		},
+		{
+			name:    "rest requires REST_URL",
+			envVars: map[string]string{"BACKEND": "rest"},
+			wantErr: true,
+		},
+		{
+			name: "azure with shared key",
+			envVars: map[string]string{
+				"BACKEND":               "azure",
+				"AZURE_STORAGE_ACCOUNT": "volsync",
+				"AZURE_CONTAINER":       "backups",
+				"AZURE_STORAGE_KEY":     "a2V5",
+			},
+			wantBackend: BackendAzure,
+		},
+		{
+			name: "azure requires exactly one credential",
+			envVars: map[string]string{
+				"BACKEND":               "azure",
+				"AZURE_STORAGE_ACCOUNT": "volsync",
+				"AZURE_CONTAINER":       "backups",
+				"AZURE_STORAGE_KEY":     "a2V5",
+				"AZURE_SAS_TOKEN":       "sig=abc",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "azure requires account and container",
+			envVars: map[string]string{"BACKEND": "azure", "AZURE_SAS_TOKEN": "sig=abc"},
+			wantErr: true,
+		},
+		{
+			name:        "gcs",
+			envVars:     map[string]string{"BACKEND": "gcs", "GCS_BUCKET": "backups"},
+			wantBackend: BackendGCS,
+		},
+		{
+			name:    "gcs requires GCS_BUCKET",
+			envVars: map[string]string{"BACKEND": "gcs"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown backend",
+			envVars: map[string]string{"BACKEND": "ftp"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"BACKEND", "FS_ROOT", "REST_URL", "S3_ENDPOINT", "S3_BUCKET",
+				"S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY",
+				"AZURE_STORAGE_ACCOUNT", "AZURE_CONTAINER", "AZURE_STORAGE_KEY", "AZURE_SAS_TOKEN", "GCS_BUCKET"} {
+				t.Setenv(k, "")
+			}
+			for k, v := range tt.envVars {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Load() error = nil, wantErr = true")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+			if cfg.Backend != tt.wantBackend {
+				t.Errorf("Backend = %v, want %v", cfg.Backend, tt.wantBackend)
+			}
+			if cfg.FSRoot != tt.wantFSRoot {
+				t.Errorf("FSRoot = %v, want %v", cfg.FSRoot, tt.wantFSRoot)
+			}
+		})
+	}
+}
+
+func TestLoad_Freshness(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.FreshnessEnabled {
+			t.Error("FreshnessEnabled = true, want false")
+		}
+		if cfg.FreshnessInterval != 15*time.Minute || cfg.FreshnessMaxAge != 26*time.Hour {
+			t.Errorf("FreshnessInterval/MaxAge = %v/%v", cfg.FreshnessInterval, cfg.FreshnessMaxAge)
+		}
+		if len(cfg.FreshnessNamespaceMaxAge) != 0 {
+			t.Errorf("FreshnessNamespaceMaxAge = %v, want empty", cfg.FreshnessNamespaceMaxAge)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("FRESHNESS_ENABLED", "true")
+		t.Setenv("FRESHNESS_INTERVAL", "5m")
+		t.Setenv("FRESHNESS_MAX_AGE", "50h")
+		t.Setenv("FRESHNESS_NAMESPACE_MAX_AGE", "media=192h, karakeep=2h")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if !cfg.FreshnessEnabled || cfg.FreshnessInterval != 5*time.Minute || cfg.FreshnessMaxAge != 50*time.Hour {
+			t.Errorf("Freshness = %v/%v/%v", cfg.FreshnessEnabled, cfg.FreshnessInterval, cfg.FreshnessMaxAge)
+		}
+		if cfg.FreshnessNamespaceMaxAge["media"] != 192*time.Hour || cfg.FreshnessNamespaceMaxAge["karakeep"] != 2*time.Hour {
+			t.Errorf("FreshnessNamespaceMaxAge = %v", cfg.FreshnessNamespaceMaxAge)
+		}
+	})
+
+	for name, env := range map[string][2]string{
+		"invalid interval":      {"FRESHNESS_INTERVAL", "often"},
+		"zero max age":          {"FRESHNESS_MAX_AGE", "0s"},
+		"missing duration":      {"FRESHNESS_NAMESPACE_MAX_AGE", "media"},
+		"invalid namespace age": {"FRESHNESS_NAMESPACE_MAX_AGE", "media=8d"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(env[0], env[1])
+			if _, err := Load(); err == nil {
+				t.Error("Load() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLoad_Stats(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if cfg.StatsEnabled || cfg.StatsCacheTTL != 10*time.Minute || cfg.ExistsIncludeSize {
+		t.Errorf("Stats enabled/TTL/in exists = %v/%v/%v", cfg.StatsEnabled, cfg.StatsCacheTTL, cfg.ExistsIncludeSize)
+	}
+
+	t.Setenv("EXISTS_INCLUDE_SIZE", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Load() error = nil, want error for EXISTS_INCLUDE_SIZE without STATS_ENABLED")
+	}
+
+	t.Setenv("STATS_ENABLED", "true")
+	t.Setenv("STATS_CACHE_TTL", "1h")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if !cfg.StatsEnabled || cfg.StatsCacheTTL != time.Hour || !cfg.ExistsIncludeSize {
+		t.Errorf("Stats enabled/TTL/in exists = %v/%v/%v", cfg.StatsEnabled, cfg.StatsCacheTTL, cfg.ExistsIncludeSize)
+	}
+}
+
+func TestLoad_Webhook(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if cfg.WebhookEnabled || cfg.TLSCertFile != "" || cfg.CapacityGuard != "warn" || cfg.CapacityHeadroom != 0.2 {
+		t.Errorf("Webhook enabled/cert/guard/headroom = %v/%q/%q/%v", cfg.WebhookEnabled, cfg.TLSCertFile, cfg.CapacityGuard, cfg.CapacityHeadroom)
+	}
+
+	t.Setenv("WEBHOOK_ENABLED", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Load() error = nil, want error for WEBHOOK_ENABLED without TLS")
+	}
+	t.Setenv("TLS_CERT_FILE", "/tls/tls.crt")
+	if _, err := Load(); err == nil {
+		t.Error("Load() error = nil, want error for TLS_CERT_FILE without TLS_KEY_FILE")
+	}
+	t.Setenv("TLS_KEY_FILE", "/tls/tls.key")
+	t.Setenv("CAPACITY_GUARD", "resize")
+	if _, err := Load(); err == nil {
+		t.Error("Load() error = nil, want error for invalid CAPACITY_GUARD")
+	}
+
+	t.Setenv("CAPACITY_GUARD", "patch")
+	t.Setenv("CAPACITY_HEADROOM_PERCENT", "50")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if !cfg.WebhookEnabled || cfg.TLSKeyFile != "/tls/tls.key" || cfg.CapacityGuard != "patch" || cfg.CapacityHeadroom != 0.5 {
+		t.Errorf("Webhook enabled/key/guard/headroom = %v/%q/%q/%v", cfg.WebhookEnabled, cfg.TLSKeyFile, cfg.CapacityGuard, cfg.CapacityHeadroom)
+	}
+}
+
+func TestLoad_OrphanCleanup(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.OrphanCleanupEnabled || cfg.OrphanCleanupDelete {
+			t.Error("orphan cleanup enabled by default")
+		}
+		if cfg.OrphanCleanupInterval != time.Hour || cfg.OrphanGracePeriod != 720*time.Hour {
+			t.Errorf("OrphanCleanupInterval/GracePeriod = %v/%v", cfg.OrphanCleanupInterval, cfg.OrphanGracePeriod)
+		}
+		if cfg.OrphanDeleteInterval != time.Second || cfg.OrphanDeleteMaxRepos != 1 {
+			t.Errorf("OrphanDeleteInterval/MaxRepos = %v/%v", cfg.OrphanDeleteInterval, cfg.OrphanDeleteMaxRepos)
+		}
+	})
+
+	t.Run("delete mode", func(t *testing.T) {
+		t.Setenv("ORPHAN_CLEANUP_ENABLED", "true")
+		t.Setenv("ORPHAN_CLEANUP_DELETE", "true")
+		t.Setenv("ORPHAN_CLEANUP_RULES", "scratch/*, ci-*/*")
+		t.Setenv("ORPHAN_AUDIT_LOG", "/var/log/pvc-plumber/audit.log")
+		t.Setenv("ORPHAN_STATE_FILE", "/var/lib/pvc-plumber/orphans.json")
+		t.Setenv("ORPHAN_DELETE_MAX_REPOSITORIES", "3")
+		t.Setenv("S3_ACCESS_KEY_ID", "AKID")
+		t.Setenv("S3_SECRET_ACCESS_KEY", "secret")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if !cfg.OrphanCleanupDelete || cfg.OrphanDeleteMaxRepos != 3 {
+			t.Errorf("OrphanCleanupDelete/MaxRepos = %v/%v", cfg.OrphanCleanupDelete, cfg.OrphanDeleteMaxRepos)
+		}
+		if len(cfg.OrphanCleanupRules) != 2 || cfg.OrphanCleanupRules[1] != "ci-*/*" {
+			t.Errorf("OrphanCleanupRules = %q", cfg.OrphanCleanupRules)
+		}
+		if cfg.OrphanStateFile != "/var/lib/pvc-plumber/orphans.json" {
+			t.Errorf("OrphanStateFile = %q", cfg.OrphanStateFile)
+		}
+		if cfg.S3AccessKeyID != "AKID" || cfg.S3Region != "us-east-1" {
+			t.Errorf("S3AccessKeyID/Region = %q/%q", cfg.S3AccessKeyID, cfg.S3Region)
+		}
+	})
+
+	for name, env := range map[string]map[string]string{
+		"delete without rules":       {"ORPHAN_CLEANUP_DELETE": "true", "ORPHAN_AUDIT_LOG": "/tmp/audit.log", "ORPHAN_STATE_FILE": "/tmp/orphans.json"},
+		"delete without audit log":   {"ORPHAN_CLEANUP_DELETE": "true", "ORPHAN_CLEANUP_RULES": "scratch/*", "ORPHAN_STATE_FILE": "/tmp/orphans.json"},
+		"delete without state file":  {"ORPHAN_CLEANUP_DELETE": "true", "ORPHAN_CLEANUP_RULES": "scratch/*", "ORPHAN_AUDIT_LOG": "/tmp/audit.log"},
+		"delete without credentials": {"ORPHAN_CLEANUP_DELETE": "true", "ORPHAN_CLEANUP_RULES": "scratch/*", "ORPHAN_AUDIT_LOG": "/tmp/audit.log", "ORPHAN_STATE_FILE": "/tmp/orphans.json"},
+		"invalid rule":               {"ORPHAN_CLEANUP_RULES": "scratch/["},
+		"zero max repositories":      {"ORPHAN_DELETE_MAX_REPOSITORIES": "0"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(); err == nil {
+				t.Error("Load() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLoad_AuditLog(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if cfg.AuditLog != "" || cfg.AuditLogMaxSize != 100<<20 || cfg.AuditLogMaxBackups != 5 {
+		t.Errorf("AuditLog/MaxSize/MaxBackups = %q/%v/%v", cfg.AuditLog, cfg.AuditLogMaxSize, cfg.AuditLogMaxBackups)
+	}
+
+	t.Setenv("AUDIT_LOG", "/var/log/pvc-plumber/decisions.log")
+	t.Setenv("AUDIT_LOG_MAX_SIZE_MB", "10")
+	t.Setenv("AUDIT_LOG_MAX_BACKUPS", "2")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if cfg.AuditLog != "/var/log/pvc-plumber/decisions.log" || cfg.AuditLogMaxSize != 10<<20 || cfg.AuditLogMaxBackups != 2 {
+		t.Errorf("AuditLog/MaxSize/MaxBackups = %q/%v/%v", cfg.AuditLog, cfg.AuditLogMaxSize, cfg.AuditLogMaxBackups)
+	}
+
+	t.Setenv("AUDIT_LOG_MAX_SIZE_MB", "big")
+	if _, err := Load(); err == nil {
+		t.Error("Load() error = nil, want error")
+	}
+}
+
+func TestLoad_RateLimit(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.RateLimitRPS != 0 || cfg.RateLimitBurst != 20 || cfg.RateLimitKey != "ip" {
+			t.Errorf("RateLimit RPS/Burst/Key = %v/%v/%q", cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitKey)
+		}
+		if cfg.MaxConcurrentLookups != 32 || cfg.LookupQueueSize != 64 || cfg.LookupQueueTimeout != time.Second {
+			t.Errorf("Lookups concurrent/queue/timeout = %v/%v/%v", cfg.MaxConcurrentLookups, cfg.LookupQueueSize, cfg.LookupQueueTimeout)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_RPS", "2.5")
+		t.Setenv("RATE_LIMIT_BURST", "5")
+		t.Setenv("RATE_LIMIT_KEY", "serviceaccount")
+		t.Setenv("RATE_LIMIT_TRUST_TOKENS", "true")
+		t.Setenv("MAX_CONCURRENT_LOOKUPS", "0")
+		t.Setenv("LOOKUP_QUEUE_SIZE", "0")
+		t.Setenv("LOOKUP_QUEUE_TIMEOUT", "250ms")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.RateLimitRPS != 2.5 || cfg.RateLimitBurst != 5 || cfg.RateLimitKey != "serviceaccount" {
+			t.Errorf("RateLimit RPS/Burst/Key = %v/%v/%q", cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitKey)
+		}
+		if cfg.MaxConcurrentLookups != 0 || cfg.LookupQueueSize != 0 || cfg.LookupQueueTimeout != 250*time.Millisecond {
+			t.Errorf("Lookups concurrent/queue/timeout = %v/%v/%v", cfg.MaxConcurrentLookups, cfg.LookupQueueSize, cfg.LookupQueueTimeout)
+		}
+	})
+
+	for name, env := range map[string][2]string{
+		"negative rate":      {"RATE_LIMIT_RPS", "-1"},
+		"zero burst":         {"RATE_LIMIT_BURST", "0"},
+		"unknown key":        {"RATE_LIMIT_KEY", "header"},
+		"untrusted tokens":   {"RATE_LIMIT_KEY", "token"},
+		"negative lookups":   {"MAX_CONCURRENT_LOOKUPS", "-1"},
+		"zero queue timeout": {"LOOKUP_QUEUE_TIMEOUT", "0s"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(env[0], env[1])
+			if _, err := Load(); err == nil {
+				t.Error("Load() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLoad_CheckPipeline(t *testing.T) {
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "test-bucket")
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.CheckCacheTTL != 0 || cfg.CheckCacheSize != 1024 || cfg.CheckRetries != 0 || cfg.CheckRetryBackoff != 100*time.Millisecond {
+			t.Errorf("Check TTL/size/retries/backoff = %v/%v/%v/%v", cfg.CheckCacheTTL, cfg.CheckCacheSize, cfg.CheckRetries, cfg.CheckRetryBackoff)
+		}
+		if cfg.FallbackS3Endpoint != "" || cfg.FallbackS3Bucket != "test-bucket" {
+			t.Errorf("Fallback endpoint/bucket = %q/%q", cfg.FallbackS3Endpoint, cfg.FallbackS3Bucket)
+		}
+	})
+
+	t.Run("fallback credentials default to the primary's", func(t *testing.T) {
+		t.Setenv("S3_ACCESS_KEY_ID", "primary-key")
+		t.Setenv("S3_SECRET_ACCESS_KEY", "primary-secret")
+		t.Setenv("S3_REGION", "eu-west-1")
+		t.Setenv("FALLBACK_S3_ENDPOINT", "https://replica:9000")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.FallbackS3AccessKeyID != "primary-key" || cfg.FallbackS3SecretAccessKey != "primary-secret" || cfg.FallbackS3Region != "eu-west-1" {
+			t.Errorf("Fallback credentials = %q/%q/%q", cfg.FallbackS3AccessKeyID, cfg.FallbackS3SecretAccessKey, cfg.FallbackS3Region)
+		}
+
+		t.Setenv("FALLBACK_S3_ACCESS_KEY_ID", "replica-key")
+		t.Setenv("FALLBACK_S3_SECRET_ACCESS_KEY", "replica-secret")
+		t.Setenv("FALLBACK_S3_REGION", "us-west-2")
+		cfg, err = Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.FallbackS3AccessKeyID != "replica-key" || cfg.FallbackS3SecretAccessKey != "replica-secret" || cfg.FallbackS3Region != "us-west-2" {
+			t.Errorf("Fallback credentials = %q/%q/%q", cfg.FallbackS3AccessKeyID, cfg.FallbackS3SecretAccessKey, cfg.FallbackS3Region)
+		}
+	})
+
+	t.Run("fallback key without secret", func(t *testing.T) {
+		t.Setenv("FALLBACK_S3_ENDPOINT", "https://replica:9000")
+		t.Setenv("FALLBACK_S3_ACCESS_KEY_ID", "replica-key")
+		if _, err := Load(); err == nil {
+			t.Error("Load() error = nil, want error")
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("CHECK_CACHE_TTL", "10s")
+		t.Setenv("CHECK_CACHE_SIZE", "64")
+		t.Setenv("CHECK_RETRIES", "2")
+		t.Setenv("CHECK_RETRY_BACKOFF", "50ms")
+		t.Setenv("FALLBACK_S3_ENDPOINT", "https://replica:9000")
+		t.Setenv("FALLBACK_S3_BUCKET", "volsync-replica")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.CheckCacheTTL != 10*time.Second || cfg.CheckCacheSize != 64 || cfg.CheckRetries != 2 || cfg.CheckRetryBackoff != 50*time.Millisecond {
+			t.Errorf("Check TTL/size/retries/backoff = %v/%v/%v/%v", cfg.CheckCacheTTL, cfg.CheckCacheSize, cfg.CheckRetries, cfg.CheckRetryBackoff)
+		}
+		if cfg.FallbackS3Endpoint != "https://replica:9000" || cfg.FallbackS3Bucket != "volsync-replica" {
+			t.Errorf("Fallback endpoint/bucket = %q/%q", cfg.FallbackS3Endpoint, cfg.FallbackS3Bucket)
+		}
+	})
+
+	t.Run("zero cache ttl disables the cache", func(t *testing.T) {
+		t.Setenv("CHECK_CACHE_TTL", "0")
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if cfg.CheckCacheTTL != 0 {
+			t.Errorf("CheckCacheTTL = %v, want 0", cfg.CheckCacheTTL)
+		}
+	})
+
+	for name, env := range map[string][2]string{
+		"zero cache size":    {"CHECK_CACHE_SIZE", "0"},
+		"negative retries":   {"CHECK_RETRIES", "-1"},
+		"fallback scheme":    {"FALLBACK_S3_ENDPOINT", "ftp://replica"},
+		"zero backoff":       {"CHECK_RETRY_BACKOFF", "0s"},
+		"negative cache ttl": {"CHECK_CACHE_TTL", "-1s"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(env[0], env[1])
+			if _, err := Load(); err == nil {
+				t.Error("Load() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+)
+
+// Annotations written onto reconciled PVCs.
+const (
+	AnnotationBackupExists = "pvc-plumber.io/backup-exists"
+	AnnotationCheckedAt    = "pvc-plumber.io/checked-at"
+)
+
+// Event reasons emitted for reconciled PVCs.
+const (
+	ReasonBackupFound       = "BackupFound"
+	ReasonBackupNotFound    = "BackupNotFound"
+	ReasonBackupCheckFailed = "BackupCheckFailed"
+)
+
+const component = "pvc-plumber"
+
+// Controller watches PersistentVolumeClaims and records backup check results
+// for claims that are still pending, covering PVCs created while admission
+// checks were unavailable.
+type Controller struct {
+	kube      *kube.Client
+	checker   backend.Backend
+	namespace string
+	resync    time.Duration
+	backoff   time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu sync.Mutex
+	// failing holds the PVCs, by namespace/name, whose last check failed.
+	failing map[string]bool
+}
+
+func New(kubeClient *kube.Client, checker backend.Backend, namespace string, resync time.Duration, logger *slog.Logger) *Controller {
+	return &Controller{
+		kube:      kubeClient,
+		checker:   checker,
+		namespace: namespace,
+		resync:    resync,
+		backoff:   5 * time.Second,
+		logger:    logger,
+		now:       time.Now,
+		failing:   make(map[string]bool),
+	}
+}
+
+// Run lists and watches PVCs until ctx is canceled. The full list is
+// re-read on every resync period and whenever the watch resourceVersion
+// expires.
+func (c *Controller) Run(ctx context.Context) error {
+	c.logger.Info("controller starting", "namespace", c.namespace, "resync", c.resync)
+
+	for {
+		resourceVersion, err := c.relist(ctx)
+		if err == nil {
+			err = c.watch(ctx, resourceVersion)
+		}
+
+		if ctx.Err() != nil {
+			c.logger.Info("controller stopped")
+			return nil
+		}
+		if err != nil {
+			c.logger.Warn("controller loop error, retrying", "error", err, "backoff", c.backoff)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(c.backoff):
+			}
+		}
+	}
+}
+
+func (c *Controller) relist(ctx context.Context) (string, error) {
+	list, err := c.kube.ListPVCs(ctx, c.namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to list PVCs: %w", err)
+	}
+
+	c.logger.Debug("listed PVCs", "count", len(list.Items), "resourceVersion", list.Metadata.ResourceVersion)
+	for i := range list.Items {
+		c.Reconcile(ctx, &list.Items[i])
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch follows changes from resourceVersion, advancing it on every event
+// including bookmarks, until the resync period elapses.
+func (c *Controller) watch(ctx context.Context, resourceVersion string) error {
+	deadline := c.now().Add(c.resync)
+
+	for c.now().Before(deadline) {
+		remaining := deadline.Sub(c.now())
+		w, err := c.kube.WatchPVCs(ctx, c.namespace, resourceVersion, remaining)
+		if errors.Is(err, kube.ErrGone) {
+			c.logger.Info("watch resourceVersion expired, relisting", "resourceVersion", resourceVersion)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resourceVersion, err = c.consume(ctx, w, resourceVersion)
+		_ = w.Close()
+		if errors.Is(err, kube.ErrGone) {
+			c.logger.Info("watch resourceVersion expired, relisting", "resourceVersion", resourceVersion)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Controller) consume(ctx context.Context, w *kube.Watcher, resourceVersion string) (string, error) {
+	for {
+		event, err := w.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return resourceVersion, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return resourceVersion, nil
+			}
+			return resourceVersion, err
+		}
+
+		pvc, err := event.PVC()
+		if err != nil {
+			c.logger.Warn("failed to decode watch event", "type", event.Type, "error", err)
+			continue
+		}
+		if pvc.Metadata.ResourceVersion != "" {
+			resourceVersion = pvc.Metadata.ResourceVersion
+		}
+
+		switch event.Type {
+		case kube.EventAdded, kube.EventModified:
+			c.Reconcile(ctx, pvc)
+		case kube.EventDeleted:
+			c.setFailing(pvc, false)
+		}
+	}
+}
+
+func needsCheck(pvc *kube.PersistentVolumeClaim) bool {
+	if pvc.Status.Phase != "" && pvc.Status.Phase != kube.ClaimPending {
+		return false
+	}
+	_, checked := pvc.Metadata.Annotations[AnnotationBackupExists]
+	return !checked
+}
+
+// Reconcile checks the backup for a single pending PVC and records the
+// result. Failed checks are not recorded on the claim, so it is retried on
+// the next resync; a warning event is emitted only when a claim starts
+// failing, not on every retry.
+func (c *Controller) Reconcile(ctx context.Context, pvc *kube.PersistentVolumeClaim) {
+	if !needsCheck(pvc) {
+		c.setFailing(pvc, false)
+		return
+	}
+
+	namespace, name := pvc.Metadata.Namespace, pvc.Metadata.Name
+	result := c.checker.CheckBackupExists(ctx, namespace, name)
+
+	if result.Error != "" {
+		c.logger.Warn("backup check failed", "namespace", namespace, "pvc", name, "error", result.Error)
+		if !c.setFailing(pvc, true) {
+			c.recordEvent(ctx, pvc, "Warning", ReasonBackupCheckFailed, "Backup check failed: "+result.Error)
+		}
+		return
+	}
+	c.setFailing(pvc, false)
+
+	annotations := map[string]string{
+		AnnotationBackupExists: fmt.Sprintf("%t", result.Exists),
+		AnnotationCheckedAt:    c.now().UTC().Format(time.RFC3339),
+	}
+	if err := c.kube.PatchPVCAnnotations(ctx, namespace, name, annotations); err != nil {
+		c.logger.Warn("failed to annotate PVC", "namespace", namespace, "pvc", name, "error", err)
+		return
+	}
+
+	c.logger.Info("reconciled PVC", "namespace", namespace, "pvc", name, "exists", result.Exists)
+	if result.Exists {
+		c.recordEvent(ctx, pvc, "Normal", ReasonBackupFound,
+			fmt.Sprintf("Backup found for %s/%s", namespace, name))
+	} else {
+		c.recordEvent(ctx, pvc, "Normal", ReasonBackupNotFound,
+			fmt.Sprintf("No backup found for %s/%s", namespace, name))
+	}
+}
+
+// setFailing records whether the last check of pvc failed and returns what
+// was recorded before.
+func (c *Controller) setFailing(pvc *kube.PersistentVolumeClaim, failing bool) bool {
+	key := pvc.Metadata.Namespace + "/" + pvc.Metadata.Name
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	was := c.failing[key]
+	if failing {
+		c.failing[key] = true
+	} else {
+		delete(c.failing, key)
+	}
+	return was
+}
+
+func (c *Controller) recordEvent(ctx context.Context, pvc *kube.PersistentVolumeClaim, eventType, reason, message string) {
+	now := c.now().UTC()
+	event := &kube.Event{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata: kube.ObjectMeta{
+			GenerateName: pvc.Metadata.Name + ".",
+			Namespace:    pvc.Metadata.Namespace,
+		},
+		InvolvedObject: kube.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "PersistentVolumeClaim",
+			Namespace:       pvc.Metadata.Namespace,
+			Name:            pvc.Metadata.Name,
+			UID:             pvc.Metadata.UID,
+			ResourceVersion: pvc.Metadata.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         kube.EventSource{Component: component},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if err := c.kube.CreateEvent(ctx, event); err != nil {
+		c.logger.Warn("failed to record event", "namespace", pvc.Metadata.Namespace, "pvc", pvc.Metadata.Name, "error", err)
+	}
+}
@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+)
+
+type fakeChecker struct {
+	mu      sync.Mutex
+	results map[string]backend.CheckResult
+	calls   []string
+}
+
+func (f *fakeChecker) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, namespace+"/"+pvc)
+	return f.results[namespace+"/"+pvc]
+}
+
+func (f *fakeChecker) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.calls...)
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func pendingPVC(namespace, name string) kube.PersistentVolumeClaim {
+	return kube.PersistentVolumeClaim{
+		Metadata: kube.ObjectMeta{Namespace: namespace, Name: name},
+		Status:   kube.PersistentVolumeClaimStatus{Phase: kube.ClaimPending},
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name           string
+		pvc            kube.PersistentVolumeClaim
+		result         backend.CheckResult
+		wantChecked    bool
+		wantAnnotation string
+		wantReason     string
+	}{
+		{
+			name:           "pending PVC with backup",
+			pvc:            pendingPVC("karakeep", "data-pvc"),
+			result:         backend.CheckResult{Exists: true, KeyCount: 1},
+			wantChecked:    true,
+			wantAnnotation: "true",
+			wantReason:     ReasonBackupFound,
+		},
+		{
+			name:           "pending PVC without backup",
+			pvc:            pendingPVC("karakeep", "data-pvc"),
+			result:         backend.CheckResult{Exists: false},
+			wantChecked:    true,
+			wantAnnotation: "false",
+			wantReason:     ReasonBackupNotFound,
+		},
+		{
+			name:        "check error only records event",
+			pvc:         pendingPVC("karakeep", "data-pvc"),
+			result:      backend.CheckResult{Error: "S3 returned status 500"},
+			wantChecked: true,
+			wantReason:  ReasonBackupCheckFailed,
+		},
+		{
+			name: "bound PVC is skipped",
+			pvc: kube.PersistentVolumeClaim{
+				Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "data-pvc"},
+				Status:   kube.PersistentVolumeClaimStatus{Phase: "Bound"},
+			},
+		},
+		{
+			name: "already annotated PVC is skipped",
+			pvc: kube.PersistentVolumeClaim{
+				Metadata: kube.ObjectMeta{
+					Namespace:   "karakeep",
+					Name:        "data-pvc",
+					Annotations: map[string]string{AnnotationBackupExists: "true"},
+				},
+				Status: kube.PersistentVolumeClaimStatus{Phase: kube.ClaimPending},
+			},
+			wantAnnotation: "true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := kubetest.NewServer()
+			defer server.Close()
+			server.AddPVC(tt.pvc)
+
+			checker := &fakeChecker{results: map[string]backend.CheckResult{"karakeep/data-pvc": tt.result}}
+			c := New(server.Client(), checker, "", time.Minute, testLogger())
+
+			stored, _ := server.PVC("karakeep", "data-pvc")
+			c.Reconcile(context.Background(), &stored)
+
+			if got := len(checker.Calls()) > 0; got != tt.wantChecked {
+				t.Errorf("checked = %v, want %v", got, tt.wantChecked)
+			}
+
+			updated, _ := server.PVC("karakeep", "data-pvc")
+			if got := updated.Metadata.Annotations[AnnotationBackupExists]; got != tt.wantAnnotation {
+				t.Errorf("annotation = %q, want %q", got, tt.wantAnnotation)
+			}
+			if tt.wantAnnotation != "" && tt.wantChecked && updated.Metadata.Annotations[AnnotationCheckedAt] == "" {
+				t.Error("expected checked-at annotation")
+			}
+
+			events := server.Events()
+			if tt.wantReason == "" {
+				if len(events) != 0 {
+					t.Errorf("events = %+v, want none", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Reason != tt.wantReason {
+				t.Fatalf("events = %+v, want one %s", events, tt.wantReason)
+			}
+			if events[0].InvolvedObject.Kind != "PersistentVolumeClaim" || events[0].InvolvedObject.Name != "data-pvc" {
+				t.Errorf("involvedObject = %+v", events[0].InvolvedObject)
+			}
+		})
+	}
+}
+
+func TestReconcile_FailureEventOnce(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(pendingPVC("karakeep", "data-pvc"))
+
+	checker := &fakeChecker{results: map[string]backend.CheckResult{
+		"karakeep/data-pvc": {Error: "S3 returned status 500"},
+	}}
+	c := New(server.Client(), checker, "", time.Minute, testLogger())
+
+	// Every resync retries the claim, but only the first failure is an event.
+	for i := 0; i < 3; i++ {
+		stored, _ := server.PVC("karakeep", "data-pvc")
+		c.Reconcile(context.Background(), &stored)
+	}
+	if events := server.Events(); len(events) != 1 || events[0].Reason != ReasonBackupCheckFailed {
+		t.Fatalf("events = %+v, want one %s", events, ReasonBackupCheckFailed)
+	}
+
+	checker.mu.Lock()
+	checker.results["karakeep/data-pvc"] = backend.CheckResult{Exists: true}
+	checker.mu.Unlock()
+	stored, _ := server.PVC("karakeep", "data-pvc")
+	c.Reconcile(context.Background(), &stored)
+
+	events := server.Events()
+	if len(events) != 2 || events[1].Reason != ReasonBackupFound {
+		t.Errorf("events = %+v, want %s after the failure", events, ReasonBackupFound)
+	}
+	if len(checker.Calls()) != 4 {
+		t.Errorf("checker calls = %v, want 4", checker.Calls())
+	}
+}
+
+func TestRun_ListAndWatch(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(pendingPVC("karakeep", "existing"))
+
+	checker := &fakeChecker{results: map[string]backend.CheckResult{
+		"karakeep/existing": {Exists: true, KeyCount: 1},
+		"karakeep/created":  {Exists: false},
+	}}
+	c := New(server.Client(), checker, "", time.Minute, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx)
+	}()
+
+	waitFor(t, "existing PVC annotation", func() bool {
+		pvc, _ := server.PVC("karakeep", "existing")
+		return pvc.Metadata.Annotations[AnnotationBackupExists] == "true"
+	})
+
+	// A PVC created while the controller is watching is picked up from the
+	// watch stream rather than a relist.
+	server.AddPVC(pendingPVC("karakeep", "created"))
+	waitFor(t, "created PVC annotation", func() bool {
+		pvc, _ := server.PVC("karakeep", "created")
+		return pvc.Metadata.Annotations[AnnotationBackupExists] == "false"
+	})
+
+	cancel()
+	<-done
+
+	// Our own annotation patches come back as MODIFIED events and must not
+	// trigger another check.
+	calls := checker.Calls()
+	if len(calls) != 2 {
+		t.Errorf("checker calls = %v, want exactly 2", calls)
+	}
+}
+
+func TestRun_RelistsOnGone(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+
+	checker := &fakeChecker{results: map[string]backend.CheckResult{
+		"karakeep/missed": {Exists: true, KeyCount: 1},
+	}}
+	c := New(server.Client(), checker, "", time.Minute, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	waitFor(t, "watch to start", func() bool { return len(server.WatchQueries()) == 1 })
+
+	// Simulate events lost to compaction: the open watch fails with 410 and
+	// the controller must relist to discover the PVC.
+	server.CompactWithPVC(pendingPVC("karakeep", "missed"))
+
+	waitFor(t, "missed PVC annotation", func() bool {
+		pvc, _ := server.PVC("karakeep", "missed")
+		return pvc.Metadata.Annotations[AnnotationBackupExists] == "true"
+	})
+}
+
+func TestRun_ResumesFromBookmark(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(kube.PersistentVolumeClaim{
+		Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "bound"},
+		Status:   kube.PersistentVolumeClaimStatus{Phase: "Bound"},
+	})
+
+	c := New(server.Client(), &fakeChecker{}, "karakeep", time.Minute, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	waitFor(t, "watch to start", func() bool { return len(server.WatchQueries()) == 1 })
+	server.Bookmark()
+	server.Bookmark()
+	time.Sleep(50 * time.Millisecond)
+	server.CloseWatches()
+
+	waitFor(t, "watch to resume", func() bool { return len(server.WatchQueries()) == 2 })
+
+	queries := server.WatchQueries()
+	if !strings.Contains(queries[0], "resourceVersion=1&") {
+		t.Errorf("first watch query = %q, want resourceVersion=1", queries[0])
+	}
+	if !strings.Contains(queries[1], "resourceVersion=3&") {
+		t.Errorf("resumed watch query = %q, want resourceVersion=3 from the last bookmark", queries[1])
+	}
+}
@@ -0,0 +1,132 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// ListFiles returns the names of the regular files in
+// {root}/{namespace}/{pvc}/{dir}.
+func (b *Backend) ListFiles(ctx context.Context, namespace, pvc, dir string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !validName(namespace) || !validName(pvc) || !validName(dir) {
+		return nil, fmt.Errorf("invalid repository path %q/%q/%q", namespace, pvc, dir)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(b.root, namespace, pvc, dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// ReadFile returns the contents of {root}/{namespace}/{pvc}/{dir}/{name}.
+func (b *Backend) ReadFile(ctx context.Context, namespace, pvc, dir, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, elem := range []string{namespace, pvc, dir, name} {
+		if !validName(elem) {
+			return nil, fmt.Errorf("invalid repository path element %q", elem)
+		}
+	}
+	return os.ReadFile(filepath.Join(b.root, namespace, pvc, dir, name))
+}
+
+// ListSnapshotFiles returns the files in {root}/{namespace}/{pvc}/snapshots
+// with their modification times.
+func (b *Backend) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]backend.SnapshotFile, error) {
+	names, err := b.ListFiles(ctx, namespace, pvc, "snapshots")
+	if err != nil {
+		return nil, err
+	}
+	files := make([]backend.SnapshotFile, 0, len(names))
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(b.root, namespace, pvc, "snapshots", name))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, backend.SnapshotFile{Name: name, ModTime: info.ModTime()})
+	}
+	return files, nil
+}
+
+// ListRepositoryFiles returns every regular file under
+// {root}/{namespace}/{pvc} with its size. Paths use "/" on every platform.
+func (b *Backend) ListRepositoryFiles(ctx context.Context, namespace, pvc string) ([]backend.RepositoryFile, error) {
+	if !validName(namespace) || !validName(pvc) {
+		return nil, fmt.Errorf("invalid repository path %q/%q", namespace, pvc)
+	}
+	repo := filepath.Join(b.root, namespace, pvc)
+	var files []backend.RepositoryFile
+	err := filepath.WalkDir(repo, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(repo, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, backend.RepositoryFile{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return files, err
+}
+
+// ListRepositories returns every {root}/{namespace}/{pvc} directory.
+func (b *Backend) ListRepositories(ctx context.Context) ([]backend.Repository, error) {
+	namespaces, err := os.ReadDir(b.root)
+	if err != nil {
+		return nil, err
+	}
+	var repos []backend.Repository
+	for _, ns := range namespaces {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !ns.IsDir() || !validName(ns.Name()) {
+			continue
+		}
+		pvcs, err := os.ReadDir(filepath.Join(b.root, ns.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs {
+			if pvc.IsDir() && validName(pvc.Name()) {
+				repos = append(repos, backend.Repository{Namespace: ns.Name(), PVC: pvc.Name()})
+			}
+		}
+	}
+	return repos, nil
+}
@@ -0,0 +1,92 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+func TestListFiles(t *testing.T) {
+	root := t.TempDir()
+	makeRepo(t, filepath.Join(root, "karakeep", "data-pvc"),
+		[]string{"config", "snapshots/def", "snapshots/abc"},
+		[]string{"snapshots/nested"})
+
+	b := New(root)
+	names, err := b.ListFiles(context.Background(), "karakeep", "data-pvc", "snapshots")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	sort.Strings(names)
+	if want := []string{"abc", "def"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListFiles() = %v, want %v", names, want)
+	}
+
+	names, err = b.ListFiles(context.Background(), "karakeep", "other-pvc", "snapshots")
+	if err != nil || len(names) != 0 {
+		t.Errorf("ListFiles() on missing repository = %v, %v; want no names", names, err)
+	}
+
+	if _, err := b.ListFiles(context.Background(), "karakeep", "..", "snapshots"); err == nil {
+		t.Error("expected error for path traversal")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "karakeep", "data-pvc", "keys")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "abc"), []byte("key"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	data, err := b.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "abc")
+	if err != nil || string(data) != "key" {
+		t.Errorf("ReadFile() = %q, %v; want %q", data, err, "key")
+	}
+	if _, err := b.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "../../x"); err == nil {
+		t.Error("expected error for path traversal")
+	}
+}
+
+func TestListSnapshotFiles(t *testing.T) {
+	root := t.TempDir()
+	makeRepo(t, filepath.Join(root, "karakeep", "data-pvc"), []string{"snapshots/abc"}, []string{"snapshots"})
+	modTime := time.Date(2026, 10, 16, 2, 1, 7, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(root, "karakeep", "data-pvc", "snapshots", "abc"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := New(root).ListSnapshotFiles(context.Background(), "karakeep", "data-pvc")
+	if err != nil {
+		t.Fatalf("ListSnapshotFiles() error = %v", err)
+	}
+	if len(files) != 1 || files[0].Name != "abc" || !files[0].ModTime.Equal(modTime) {
+		t.Errorf("ListSnapshotFiles() = %+v", files)
+	}
+}
+
+func TestListRepositories(t *testing.T) {
+	root := t.TempDir()
+	makeRepo(t, filepath.Join(root, "karakeep", "data-pvc"), []string{"config"}, nil)
+	makeRepo(t, filepath.Join(root, "paperless", "media"), nil, nil)
+	makeRepo(t, root, []string{"README"}, nil)
+
+	repos, err := New(root).ListRepositories(context.Background())
+	if err != nil {
+		t.Fatalf("ListRepositories() error = %v", err)
+	}
+	want := []backend.Repository{{Namespace: "karakeep", PVC: "data-pvc"}, {Namespace: "paperless", PVC: "media"}}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("ListRepositories() = %v, want %v", repos, want)
+	}
+}
@@ -0,0 +1,56 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// Backend checks for restic and Kopia repositories on a local or NFS-mounted path
+// laid out as {root}/{namespace}/{pvc}/.
+type Backend struct {
+	root string
+}
+
+func New(root string) *Backend {
+	return &Backend{root: root}
+}
+
+// validName rejects path elements that could escape the root directory.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func (b *Backend) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	if err := ctx.Err(); err != nil {
+		return backend.Failure(fmt.Errorf("failed to check repository: %w", err))
+	}
+	if !validName(namespace) || !validName(pvc) {
+		return backend.CheckResult{Exists: false, Error: fmt.Sprintf("invalid repository path %q/%q", namespace, pvc)}
+	}
+
+	repo := filepath.Join(b.root, namespace, pvc)
+	entries, err := os.ReadDir(repo)
+	if errors.Is(err, fs.ErrNotExist) {
+		return backend.CheckResult{Exists: false, KeyCount: 0}
+	}
+	if err != nil {
+		return backend.Failure(fmt.Errorf("failed to read repository: %w", err))
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name()+"/")
+		} else {
+			names = append(names, entry.Name())
+		}
+	}
+	return backend.Inspect(names)
+}
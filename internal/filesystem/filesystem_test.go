@@ -0,0 +1,112 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func makeRepo(t *testing.T, dir string, files []string, dirs []string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckBackupExists(t *testing.T) {
+	root := t.TempDir()
+	makeRepo(t, filepath.Join(root, "karakeep", "data-pvc"),
+		[]string{"config"}, []string{"data", "index", "keys", "locks", "snapshots"})
+	makeRepo(t, filepath.Join(root, "partial", "data-pvc"),
+		[]string{"config"}, []string{"keys"})
+	makeRepo(t, filepath.Join(root, "wrong", "data-pvc"),
+		nil, []string{"config", "data", "keys", "snapshots"})
+	makeRepo(t, filepath.Join(root, "empty", "data-pvc"), nil, nil)
+	makeRepo(t, filepath.Join(root, "paperless", "media"),
+		[]string{"kopia.blobcfg.f", "kopia.repository.f"}, []string{"p0a", "q9f", "xn0"})
+
+	tests := []struct {
+		name         string
+		namespace    string
+		pvc          string
+		wantExists   bool
+		wantKeyCount int
+		wantRepoType string
+		wantError    bool
+	}{
+		{name: "restic repository", namespace: "karakeep", pvc: "data-pvc", wantExists: true, wantKeyCount: 6, wantRepoType: "restic"},
+		{name: "kopia repository", namespace: "paperless", pvc: "media", wantExists: true, wantKeyCount: 5, wantRepoType: "kopia"},
+		{name: "missing directory", namespace: "karakeep", pvc: "other-pvc"},
+		{name: "missing namespace", namespace: "nope", pvc: "data-pvc"},
+		{name: "incomplete layout", namespace: "partial", pvc: "data-pvc", wantKeyCount: 2, wantRepoType: "restic"},
+		{name: "config is a directory", namespace: "wrong", pvc: "data-pvc", wantKeyCount: 4, wantRepoType: "unknown"},
+		{name: "empty directory", namespace: "empty", pvc: "data-pvc"},
+		{name: "path traversal in namespace", namespace: "..", pvc: "etc", wantError: true},
+		{name: "path traversal in pvc", namespace: "karakeep", pvc: "../partial", wantError: true},
+		{name: "empty pvc", namespace: "karakeep", pvc: "", wantError: true},
+	}
+
+	b := New(root)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := b.CheckBackupExists(context.Background(), tt.namespace, tt.pvc)
+
+			if result.Exists != tt.wantExists {
+				t.Errorf("Exists = %v, want %v", result.Exists, tt.wantExists)
+			}
+			if result.KeyCount != tt.wantKeyCount {
+				t.Errorf("KeyCount = %v, want %v", result.KeyCount, tt.wantKeyCount)
+			}
+			if result.RepoType != tt.wantRepoType {
+				t.Errorf("RepoType = %q, want %q", result.RepoType, tt.wantRepoType)
+			}
+			if tt.wantError && result.Error == "" {
+				t.Errorf("Expected error but got none")
+			}
+			if !tt.wantError && result.Error != "" {
+				t.Errorf("Unexpected error: %v", result.Error)
+			}
+		})
+	}
+}
+
+func TestCheckBackupExists_Unreadable(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply")
+	}
+
+	root := t.TempDir()
+	repo := filepath.Join(root, "locked", "data-pvc")
+	makeRepo(t, repo, []string{"config"}, []string{"data", "keys", "snapshots"})
+	if err := os.Chmod(repo, 0o000); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chmod(repo, 0o755) }()
+
+	result := New(root).CheckBackupExists(context.Background(), "locked", "data-pvc")
+	if result.Exists || result.Error == "" {
+		t.Errorf("result = %+v, want error", result)
+	}
+}
+
+func TestCheckBackupExists_CanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := New(t.TempDir()).CheckBackupExists(ctx, "karakeep", "data-pvc")
+	if result.Exists || result.Error == "" {
+		t.Errorf("result = %+v, want error on canceled context", result)
+	}
+}
@@ -0,0 +1,242 @@
+// Package freshness periodically inventories backup repositories and
+// compares the age of each PVC's newest snapshot with its SLO.
+package freshness
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// Source is a backend that can enumerate repositories and list their
+// snapshot files.
+type Source interface {
+	backend.Backend
+	backend.Inventory
+	backend.SnapshotFileLister
+}
+
+// SLO is the maximum age of the newest snapshot, per namespace.
+type SLO struct {
+	MaxAge     time.Duration
+	Namespaces map[string]time.Duration
+}
+
+// MaxAgeFor returns the SLO for namespace.
+func (s SLO) MaxAgeFor(namespace string) time.Duration {
+	if d, ok := s.Namespaces[namespace]; ok {
+		return d
+	}
+	return s.MaxAge
+}
+
+// Status is the freshness of one repository. Only restic snapshots can be
+// dated; other repositories are reported as Unsupported, never stale.
+type Status struct {
+	Namespace      string     `json:"namespace"`
+	PVC            string     `json:"pvc"`
+	Snapshots      int        `json:"snapshots"`
+	NewestSnapshot *time.Time `json:"newestSnapshot,omitempty"`
+	AgeSeconds     float64    `json:"ageSeconds,omitempty"`
+	MaxAgeSeconds  float64    `json:"maxAgeSeconds"`
+	Stale          bool       `json:"stale"`
+	RepoType       string     `json:"repoType,omitempty"`
+	Unsupported    bool       `json:"unsupported,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// Scanner inventories a Source every interval. Ages are computed when the
+// results are read, so they keep growing between scans.
+type Scanner struct {
+	source   Source
+	slo      SLO
+	interval time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu        sync.RWMutex
+	scannedAt time.Time
+	repos     []repoState
+}
+
+type repoState struct {
+	backend.Repository
+	repoType  string
+	snapshots int
+	newest    time.Time
+	err       string
+}
+
+func New(source Source, slo SLO, interval time.Duration, logger *slog.Logger) *Scanner {
+	return &Scanner{
+		source:   source,
+		slo:      slo,
+		interval: interval,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Run scans immediately and then every interval until ctx is canceled.
+func (s *Scanner) Run(ctx context.Context) {
+	s.logger.Info("freshness scanner starting", "interval", s.interval, "maxAge", s.slo.MaxAge)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Scan(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warn("freshness scan failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			s.logger.Info("freshness scanner stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan inventories the source once. Repositories that are not restic
+// repositories are recorded as unsupported; per-repository errors are
+// recorded in the report rather than failing the scan.
+func (s *Scanner) Scan(ctx context.Context) error {
+	repos, err := s.source.ListRepositories(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list repositories: %w", err)
+	}
+
+	states := make([]repoState, 0, len(repos))
+	for _, repo := range repos {
+		state := repoState{Repository: repo}
+
+		result := s.source.CheckBackupExists(ctx, repo.Namespace, repo.PVC)
+		switch {
+		case result.Error != "":
+			state.err = result.Error
+		case result.RepoType != backend.RepoTypeRestic:
+			state.repoType = result.RepoType
+			if state.repoType == "" {
+				state.repoType = backend.RepoTypeUnknown
+			}
+		default:
+			state.repoType = backend.RepoTypeRestic
+			files, err := s.source.ListSnapshotFiles(ctx, repo.Namespace, repo.PVC)
+			if err != nil {
+				state.err = err.Error()
+				break
+			}
+			state.snapshots = len(files)
+			for _, f := range files {
+				if f.ModTime.After(state.newest) {
+					state.newest = f.ModTime
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Namespace != states[j].Namespace {
+			return states[i].Namespace < states[j].Namespace
+		}
+		return states[i].PVC < states[j].PVC
+	})
+
+	s.mu.Lock()
+	s.scannedAt = s.now()
+	s.repos = states
+	s.mu.Unlock()
+
+	s.logger.Debug("freshness scan complete", "repositories", len(states))
+	return nil
+}
+
+// Report returns the time of the last completed scan, which is zero before
+// the first one, and the status of every repository it found.
+func (s *Scanner) Report() (time.Time, []Status) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	statuses := make([]Status, 0, len(s.repos))
+	for _, repo := range s.repos {
+		maxAge := s.slo.MaxAgeFor(repo.Namespace)
+		st := Status{
+			Namespace:     repo.Namespace,
+			PVC:           repo.PVC,
+			Snapshots:     repo.snapshots,
+			MaxAgeSeconds: maxAge.Seconds(),
+			RepoType:      repo.repoType,
+			Unsupported:   repo.err == "" && repo.repoType != backend.RepoTypeRestic,
+			Error:         repo.err,
+		}
+		if repo.err == "" && !st.Unsupported {
+			st.Stale = true
+			if !repo.newest.IsZero() {
+				newest := repo.newest
+				age := now.Sub(newest)
+				st.NewestSnapshot = &newest
+				st.AgeSeconds = age.Seconds()
+				st.Stale = age > maxAge
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return s.scannedAt, statuses
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes the freshness gauges in the Prometheus text format.
+// Repositories whose scan failed have no gauges, and unsupported ones only
+// the unsupported gauge.
+func (s *Scanner) WriteMetrics(w io.Writer) {
+	scannedAt, statuses := s.Report()
+
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_backup_age_seconds Age of the newest snapshot of each PVC's backup\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_backup_age_seconds gauge\n")
+	for _, st := range statuses {
+		if st.NewestSnapshot != nil {
+			_, _ = fmt.Fprintf(w, "pvc_plumber_backup_age_seconds{namespace=\"%s\",pvc=\"%s\"} %g\n",
+				labelEscaper.Replace(st.Namespace), labelEscaper.Replace(st.PVC), st.AgeSeconds)
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_backup_stale Whether a PVC's newest snapshot is older than its SLO (1) or not (0)\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_backup_stale gauge\n")
+	for _, st := range statuses {
+		if st.Error != "" || st.Unsupported {
+			continue
+		}
+		stale := 0
+		if st.Stale {
+			stale = 1
+		}
+		_, _ = fmt.Fprintf(w, "pvc_plumber_backup_stale{namespace=\"%s\",pvc=\"%s\"} %d\n",
+			labelEscaper.Replace(st.Namespace), labelEscaper.Replace(st.PVC), stale)
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_backup_freshness_unsupported Repositories whose snapshots cannot be dated, such as Kopia repositories\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_backup_freshness_unsupported gauge\n")
+	for _, st := range statuses {
+		if st.Unsupported {
+			_, _ = fmt.Fprintf(w, "pvc_plumber_backup_freshness_unsupported{namespace=\"%s\",pvc=\"%s\",repo_type=\"%s\"} 1\n",
+				labelEscaper.Replace(st.Namespace), labelEscaper.Replace(st.PVC), labelEscaper.Replace(st.RepoType))
+		}
+	}
+
+	if !scannedAt.IsZero() {
+		_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_backup_last_scan_timestamp_seconds Time of the last completed freshness scan\n")
+		_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_backup_last_scan_timestamp_seconds gauge\n")
+		_, _ = fmt.Fprintf(w, "pvc_plumber_backup_last_scan_timestamp_seconds %d\n", scannedAt.Unix())
+	}
+}
@@ -0,0 +1,169 @@
+package freshness
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+// fakeSource serves repositories from maps keyed by "namespace/pvc".
+type fakeSource struct {
+	repoTypes map[string]string
+	files     map[string][]time.Time
+	failing   string
+}
+
+func (f *fakeSource) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	if namespace+"/"+pvc == f.failing {
+		return backend.CheckResult{Error: "connection refused"}
+	}
+	return backend.CheckResult{Exists: true, RepoType: f.repoTypes[namespace+"/"+pvc]}
+}
+
+func (f *fakeSource) ListRepositories(ctx context.Context) ([]backend.Repository, error) {
+	var repos []backend.Repository
+	for id := range f.repoTypes {
+		ns, pvc, _ := strings.Cut(id, "/")
+		repos = append(repos, backend.Repository{Namespace: ns, PVC: pvc})
+	}
+	return repos, nil
+}
+
+func (f *fakeSource) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]backend.SnapshotFile, error) {
+	var files []backend.SnapshotFile
+	for i, t := range f.files[namespace+"/"+pvc] {
+		files = append(files, backend.SnapshotFile{Name: string(rune('a' + i)), ModTime: t})
+	}
+	return files, nil
+}
+
+func newTestScanner(source Source) *Scanner {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	s := New(source, SLO{MaxAge: 26 * time.Hour, Namespaces: map[string]time.Duration{"media": 8 * 24 * time.Hour}}, time.Hour, logger)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestScan(t *testing.T) {
+	source := &fakeSource{
+		repoTypes: map[string]string{
+			"karakeep/data-pvc":  backend.RepoTypeRestic,
+			"karakeep/old-pvc":   backend.RepoTypeRestic,
+			"karakeep/empty-pvc": backend.RepoTypeRestic,
+			"media/library":      backend.RepoTypeRestic,
+			"paperless/media":    backend.RepoTypeKopia,
+			"broken/data":        backend.RepoTypeRestic,
+		},
+		files: map[string][]time.Time{
+			"karakeep/data-pvc": {now.Add(-50 * time.Hour), now.Add(-2 * time.Hour)},
+			"karakeep/old-pvc":  {now.Add(-30 * time.Hour)},
+			"media/library":     {now.Add(-5 * 24 * time.Hour)},
+		},
+		failing: "broken/data",
+	}
+	s := newTestScanner(source)
+
+	if scannedAt, _ := s.Report(); !scannedAt.IsZero() {
+		t.Errorf("scannedAt = %v before the first scan", scannedAt)
+	}
+	if err := s.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	scannedAt, statuses := s.Report()
+	if !scannedAt.Equal(now) {
+		t.Errorf("scannedAt = %v, want %v", scannedAt, now)
+	}
+
+	type want struct {
+		stale       bool
+		age         float64
+		err         bool
+		unsupported bool
+	}
+	wants := map[string]want{
+		"broken/data":        {err: true},
+		"karakeep/data-pvc":  {age: 2 * 3600},
+		"karakeep/empty-pvc": {stale: true},
+		"karakeep/old-pvc":   {stale: true, age: 30 * 3600},
+		"media/library":      {age: 5 * 24 * 3600},
+		"paperless/media":    {unsupported: true},
+	}
+	if len(statuses) != len(wants) {
+		t.Fatalf("statuses = %+v, want %d", statuses, len(wants))
+	}
+	for i, st := range statuses {
+		id := st.Namespace + "/" + st.PVC
+		w, ok := wants[id]
+		if !ok {
+			t.Errorf("unexpected status for %s", id)
+			continue
+		}
+		if i > 0 && id < statuses[i-1].Namespace+"/"+statuses[i-1].PVC {
+			t.Errorf("statuses not sorted at %s", id)
+		}
+		if st.Stale != w.stale || st.AgeSeconds != w.age || (st.Error != "") != w.err || st.Unsupported != w.unsupported {
+			t.Errorf("%s: status = %+v, want %+v", id, st, w)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	source := &fakeSource{
+		repoTypes: map[string]string{
+			"karakeep/data-pvc":  backend.RepoTypeRestic,
+			"karakeep/empty-pvc": backend.RepoTypeRestic,
+			"paperless/media":    backend.RepoTypeKopia,
+		},
+		files: map[string][]time.Time{"karakeep/data-pvc": {now.Add(-30 * time.Hour)}},
+	}
+	s := newTestScanner(source)
+	if err := s.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	s.WriteMetrics(&b)
+	out := b.String()
+	for _, line := range []string{
+		`pvc_plumber_backup_age_seconds{namespace="karakeep",pvc="data-pvc"} 108000`,
+		`pvc_plumber_backup_stale{namespace="karakeep",pvc="data-pvc"} 1`,
+		`pvc_plumber_backup_stale{namespace="karakeep",pvc="empty-pvc"} 1`,
+		`pvc_plumber_backup_freshness_unsupported{namespace="paperless",pvc="media",repo_type="kopia"} 1`,
+		`pvc_plumber_backup_last_scan_timestamp_seconds 1792324800`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, `pvc_plumber_backup_age_seconds{namespace="karakeep",pvc="empty-pvc"}`) {
+		t.Error("age reported for a repository without snapshots")
+	}
+	if strings.Contains(out, `pvc_plumber_backup_stale{namespace="paperless"`) {
+		t.Error("staleness reported for an unsupported repository")
+	}
+}
+
+type failingInventory struct{ fakeSource }
+
+func (failingInventory) ListRepositories(ctx context.Context) ([]backend.Repository, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestScan_InventoryError(t *testing.T) {
+	s := newTestScanner(&failingInventory{})
+	if err := s.Scan(context.Background()); err == nil {
+		t.Error("Scan() error = nil, want error")
+	}
+	if scannedAt, _ := s.Report(); !scannedAt.IsZero() {
+		t.Error("failed scan recorded as completed")
+	}
+}
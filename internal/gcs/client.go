@@ -0,0 +1,174 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+const (
+	defaultEndpoint = "https://storage.googleapis.com"
+	readOnlyScope   = "https://www.googleapis.com/auth/devstorage.read_only"
+)
+
+type Objects struct {
+	Items         []Object `json:"items"`
+	Prefixes      []string `json:"prefixes"`
+	NextPageToken string   `json:"nextPageToken"`
+}
+
+type Object struct {
+	Name    string    `json:"name"`
+	Updated time.Time `json:"updated"`
+}
+
+// Client lists objects with the Cloud Storage JSON API. Requests are
+// anonymous when no service account key is configured.
+type Client struct {
+	endpoint   string
+	bucket     string
+	key        *serviceAccountKey
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// NewClient returns a Client. credentialsFile is a service account JSON key
+// and may be empty for public buckets; endpoint defaults to
+// https://storage.googleapis.com.
+func NewClient(endpoint, bucket, credentialsFile string, httpClient *http.Client) (*Client, error) {
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+
+	c := &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		bucket:     bucket,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+
+	if credentialsFile != "" {
+		data, err := os.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials file: %w", err)
+		}
+		key, err := parseServiceAccountKey(data)
+		if err != nil {
+			return nil, err
+		}
+		c.key = key
+	}
+	return c, nil
+}
+
+// token returns a cached access token, exchanging a fresh signed JWT when the
+// current one is within a minute of expiring.
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.accessToken != "" && now.Add(time.Minute).Before(c.expiry) {
+		return c.accessToken, nil
+	}
+
+	assertion, err := c.key.signJWT(readOnlyScope, now)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch access token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &backend.HTTPError{Service: "token endpoint", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response: %s", string(body))
+	}
+
+	c.accessToken = tok.AccessToken
+	c.expiry = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return c.accessToken, nil
+}
+
+// newRequest returns a GET request for reqURL, authorized when a service
+// account key is configured.
+func (c *Client) newRequest(ctx context.Context, reqURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	trace.Inject(ctx, req)
+
+	if c.key != nil {
+		token, err := c.token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// CheckBackupExists runs backend.Detect over objects.list requests on the
+// bucket.
+func (c *Client) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	prefix := fmt.Sprintf("%s/%s/", namespace, pvc)
+	return backend.Detect(func(name string) (string, error) {
+		objects, _, err := c.list(ctx, prefix+name, "", 1)
+		if err != nil || len(objects) == 0 {
+			return "", err
+		}
+		return strings.TrimPrefix(objects[0].Name, prefix), nil
+	}, func(limit int) ([]string, error) {
+		objects, prefixes, err := c.list(ctx, prefix, "/", limit)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]string, 0, len(objects)+len(prefixes))
+		for _, obj := range objects {
+			entries = append(entries, strings.TrimPrefix(obj.Name, prefix))
+		}
+		for _, p := range prefixes {
+			entries = append(entries, strings.TrimPrefix(p, prefix))
+		}
+		return entries, nil
+	})
+}
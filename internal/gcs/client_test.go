@@ -0,0 +1,365 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// gcsStub emulates the OAuth token endpoint and the JSON API objects.list
+// and objects.get methods. Object contents are their names.
+type gcsStub struct {
+	t           *testing.T
+	objects     map[string][]string
+	requireAuth bool
+	tokens      atomic.Int32
+	// pageSize limits the entries per listing page; 0 returns one page.
+	pageSize int
+	// lists counts objects.list requests.
+	lists atomic.Int32
+}
+
+func (s *gcsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		s.serveToken(w, r)
+		return
+	}
+
+	bucket, ok := strings.CutPrefix(r.URL.Path, "/storage/v1/b/")
+	if b, object, found := strings.Cut(bucket, "/o/"); ok && found {
+		s.serveObject(w, r, b, object)
+		return
+	}
+	bucket, ok2 := strings.CutSuffix(bucket, "/o")
+	if !ok || !ok2 || r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if s.requireAuth && r.Header.Get("Authorization") != "Bearer ya29.test-token" {
+		writeJSONError(w, http.StatusUnauthorized, "Anonymous caller does not have storage.objects.list access")
+		return
+	}
+
+	names, ok := s.objects[bucket]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+
+	s.lists.Add(1)
+	prefix, delimiter := r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter")
+	pageSize := s.pageSize
+	if n, _ := strconv.Atoi(r.URL.Query().Get("maxResults")); n > 0 && (pageSize == 0 || n < pageSize) {
+		pageSize = n
+	}
+	result := Objects{}
+	seen := map[string]bool{}
+	// Page tokens are entry offsets.
+	start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	n := 0
+	for _, name := range names {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		p := ""
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			if p = prefix + rest[:i+1]; seen[p] {
+				continue
+			}
+			seen[p] = true
+		}
+		if n++; n <= start {
+			continue
+		}
+		if pageSize > 0 && n > start+pageSize {
+			result.NextPageToken = strconv.Itoa(start + pageSize)
+			break
+		}
+		if p != "" {
+			result.Prefixes = append(result.Prefixes, p)
+		} else {
+			result.Items = append(result.Items, Object{Name: name})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (s *gcsStub) serveObject(w http.ResponseWriter, r *http.Request, bucket, object string) {
+	if s.requireAuth && r.Header.Get("Authorization") != "Bearer ya29.test-token" {
+		writeJSONError(w, http.StatusUnauthorized, "Anonymous caller does not have storage.objects.get access")
+		return
+	}
+	if r.URL.Query().Get("alt") != "media" || !slices.Contains(s.objects[bucket], object) {
+		writeJSONError(w, http.StatusNotFound, "No such object")
+		return
+	}
+	_, _ = w.Write([]byte(object))
+}
+
+func (s *gcsStub) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, err := verifyJWT(s.t, r.Form.Get("assertion")); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	s.tokens.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"access_token":"ya29.test-token","expires_in":3599,"token_type":"Bearer"}`))
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": status, "message": message}})
+}
+
+func writeKeyFile(t *testing.T, tokenURI string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, keyJSON(t, tokenURI), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewClient(t *testing.T) {
+	c, err := NewClient("", "backups", "", http.DefaultClient)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if c.endpoint != defaultEndpoint || c.key != nil {
+		t.Errorf("client = %+v, want default endpoint and no key", c)
+	}
+
+	if _, err := NewClient("", "backups", filepath.Join(t.TempDir(), "missing.json"), http.DefaultClient); err == nil {
+		t.Error("expected error for missing credentials file")
+	}
+}
+
+func TestCheckBackupExists(t *testing.T) {
+	tests := []struct {
+		name         string
+		bucket       string
+		withKey      bool
+		requireAuth  bool
+		namespace    string
+		pvc          string
+		wantExists   bool
+		wantKeyCount int
+		wantRepoType string
+		wantError    bool
+	}{
+		{
+			name:         "service account, backup exists",
+			bucket:       "backups",
+			withKey:      true,
+			requireAuth:  true,
+			namespace:    "karakeep",
+			pvc:          "data-pvc",
+			wantExists:   true,
+			wantKeyCount: 4,
+			wantRepoType: backend.RepoTypeRestic,
+		},
+		{
+			name:         "kopia repository",
+			bucket:       "backups",
+			withKey:      true,
+			requireAuth:  true,
+			namespace:    "paperless",
+			pvc:          "media",
+			wantExists:   true,
+			wantKeyCount: 3,
+			wantRepoType: backend.RepoTypeKopia,
+		},
+		{
+			name:        "service account, no backup",
+			bucket:      "backups",
+			withKey:     true,
+			requireAuth: true,
+			namespace:   "karakeep",
+			pvc:         "other-pvc",
+		},
+		{
+			name:         "anonymous public bucket",
+			bucket:       "backups",
+			namespace:    "karakeep",
+			pvc:          "data-pvc",
+			wantExists:   true,
+			wantKeyCount: 4,
+			wantRepoType: backend.RepoTypeRestic,
+		},
+		{
+			name:        "anonymous on private bucket",
+			bucket:      "backups",
+			requireAuth: true,
+			namespace:   "karakeep",
+			pvc:         "data-pvc",
+			wantError:   true,
+		},
+		{
+			name:      "missing bucket",
+			bucket:    "nope",
+			namespace: "karakeep",
+			pvc:       "data-pvc",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &gcsStub{
+				t: t,
+				objects: map[string][]string{"backups": {
+					"karakeep/data-pvc/config",
+					"karakeep/data-pvc/data/00/00a1",
+					"karakeep/data-pvc/keys/abc",
+					"karakeep/data-pvc/snapshots/def",
+					"paperless/media/kopia.repository",
+					"paperless/media/q9f8e7",
+					"paperless/media/xn0_0a1b2",
+				}},
+				requireAuth: tt.requireAuth,
+			}
+			server := httptest.NewServer(stub)
+			defer server.Close()
+
+			credentials := ""
+			if tt.withKey {
+				credentials = writeKeyFile(t, server.URL+"/token")
+			}
+			client, err := NewClient(server.URL, tt.bucket, credentials, &http.Client{Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			result := client.CheckBackupExists(context.Background(), tt.namespace, tt.pvc)
+
+			if result.Exists != tt.wantExists {
+				t.Errorf("Exists = %v, want %v", result.Exists, tt.wantExists)
+			}
+			if result.KeyCount != tt.wantKeyCount {
+				t.Errorf("KeyCount = %v, want %v", result.KeyCount, tt.wantKeyCount)
+			}
+			if result.RepoType != tt.wantRepoType {
+				t.Errorf("RepoType = %q, want %q", result.RepoType, tt.wantRepoType)
+			}
+			if tt.wantError && result.Error == "" {
+				t.Errorf("Expected error but got none")
+			}
+			if !tt.wantError && result.Error != "" {
+				t.Errorf("Unexpected error: %v", result.Error)
+			}
+		})
+	}
+}
+
+func TestCheckBackupExists_Paginates(t *testing.T) {
+	// The top level of the restic repository spans two pages.
+	stub := &gcsStub{t: t, pageSize: 2, objects: map[string][]string{"backups": {
+		"karakeep/data-pvc/config",
+		"karakeep/data-pvc/data/00/00a1",
+		"karakeep/data-pvc/keys/abc",
+		"karakeep/data-pvc/snapshots/def",
+	}}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "backups", "", &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	result := client.CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+	if !result.Exists || result.RepoType != backend.RepoTypeRestic || result.KeyCount != 4 {
+		t.Errorf("result = %+v, want a restic repository with 4 entries", result)
+	}
+}
+
+func TestCheckBackupExists_Bounded(t *testing.T) {
+	names := []string{"paperless/media/kopia.repository", "paperless/media/q9f8e7", "paperless/media/xn0_0a1b2"}
+	for i := 0; i < 500; i++ {
+		names = append(names, fmt.Sprintf("paperless/media/p%04x", i), fmt.Sprintf("stray/data-pvc/%04x", i))
+	}
+	stub := &gcsStub{t: t, objects: map[string][]string{"backups": names}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client, err := NewClient(server.URL, "backups", "", &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Kopia is found by three one-object probes, not by listing its blobs.
+	result := client.CheckBackupExists(context.Background(), "paperless", "media")
+	if lists := stub.lists.Swap(0); !result.Exists || result.RepoType != backend.RepoTypeKopia || lists != 3 {
+		t.Errorf("result = %+v after %d listings, want a Kopia repository after 3", result, lists)
+	}
+
+	result = client.CheckBackupExists(context.Background(), "stray", "data-pvc")
+	if lists := stub.lists.Load(); result.Exists || result.KeyCount != backend.TopLevelLimit || lists != 2 {
+		t.Errorf("result = %+v after %d listings, want %d entries after 2", result, lists, backend.TopLevelLimit)
+	}
+}
+
+func TestCheckBackupExists_CachesToken(t *testing.T) {
+	stub := &gcsStub{t: t, objects: map[string][]string{"backups": {}}, requireAuth: true}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "backups", writeKeyFile(t, server.URL+"/token"), &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if result := client.CheckBackupExists(context.Background(), "karakeep", "data-pvc"); result.Error != "" {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+	}
+	if got := stub.tokens.Load(); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+
+	// Within a minute of expiry the token is refreshed.
+	now = now.Add(59 * time.Minute)
+	client.CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+	if got := stub.tokens.Load(); got != 2 {
+		t.Errorf("token requests = %d, want 2 after expiry", got)
+	}
+}
+
+func TestCheckBackupExists_TokenRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "backups", writeKeyFile(t, server.URL+"/token"), &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	result := client.CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+	if result.Exists || !strings.Contains(result.Error, "token endpoint returned status 400") {
+		t.Errorf("result = %+v, want token error", result)
+	}
+}
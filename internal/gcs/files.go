@@ -0,0 +1,139 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// ListFiles returns the names of the objects under
+// {namespace}/{pvc}/{dir}/.
+func (c *Client) ListFiles(ctx context.Context, namespace, pvc, dir string) ([]string, error) {
+	prefix := fmt.Sprintf("%s/%s/%s/", namespace, pvc, dir)
+	objects, err := c.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, strings.TrimPrefix(obj.Name, prefix))
+	}
+	return names, nil
+}
+
+// ListSnapshotFiles returns the objects under {namespace}/{pvc}/snapshots/
+// with their last update times.
+func (c *Client) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]backend.SnapshotFile, error) {
+	prefix := fmt.Sprintf("%s/%s/snapshots/", namespace, pvc)
+	objects, err := c.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]backend.SnapshotFile, 0, len(objects))
+	for _, obj := range objects {
+		files = append(files, backend.SnapshotFile{Name: strings.TrimPrefix(obj.Name, prefix), ModTime: obj.Updated})
+	}
+	return files, nil
+}
+
+// ListRepositories returns every {namespace}/{pvc}/ prefix in the bucket.
+func (c *Client) ListRepositories(ctx context.Context) ([]backend.Repository, error) {
+	_, namespaces, err := c.list(ctx, "", "/", 0)
+	if err != nil {
+		return nil, err
+	}
+	var repos []backend.Repository
+	for _, ns := range namespaces {
+		_, pvcs, err := c.list(ctx, ns, "/", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs {
+			repos = append(repos, backend.Repository{
+				Namespace: strings.TrimSuffix(ns, "/"),
+				PVC:       strings.TrimSuffix(strings.TrimPrefix(pvc, ns), "/"),
+			})
+		}
+	}
+	return repos, nil
+}
+
+// listObjects returns every object under prefix.
+func (c *Client) listObjects(ctx context.Context, prefix string) ([]Object, error) {
+	objects, _, err := c.list(ctx, prefix, "", 0)
+	return objects, err
+}
+
+// list returns the objects and, when delimiter is set, the prefixes under
+// prefix, following page tokens until the listing is complete or, when
+// limit is not 0, holds at least limit entries.
+func (c *Client) list(ctx context.Context, prefix, delimiter string, limit int) ([]Object, []string, error) {
+	var objects []Object
+	var prefixes []string
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("prefix", prefix)
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		query.Set("fields", "items(name,updated),prefixes,nextPageToken")
+		if limit > 0 {
+			query.Set("maxResults", strconv.Itoa(limit))
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		body, err := c.get(ctx, fmt.Sprintf("%s/storage/v1/b/%s/o?%s", c.endpoint, url.PathEscape(c.bucket), query.Encode()))
+		if err != nil {
+			return nil, nil, err
+		}
+		var result Objects
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, nil, backend.InvalidResponse(fmt.Errorf("failed to parse JSON: %w", err))
+		}
+		objects = append(objects, result.Items...)
+		prefixes = append(prefixes, result.Prefixes...)
+
+		if result.NextPageToken == "" || (limit > 0 && len(objects)+len(prefixes) >= limit) {
+			return objects, prefixes, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+// ReadFile returns the contents of the object {namespace}/{pvc}/{dir}/{name}.
+func (c *Client) ReadFile(ctx context.Context, namespace, pvc, dir, name string) ([]byte, error) {
+	object := strings.Join([]string{namespace, pvc, dir, name}, "/")
+	return c.get(ctx, fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", c.endpoint, url.PathEscape(c.bucket), url.PathEscape(object)))
+}
+
+func (c *Client) get(ctx context.Context, reqURL string) ([]byte, error) {
+	req, err := c.newRequest(ctx, reqURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GCS: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, backend.InvalidResponse(fmt.Errorf("failed to read response: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &backend.HTTPError{Service: "GCS", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
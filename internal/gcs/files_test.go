@@ -0,0 +1,76 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+func TestListFiles_Paginates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/storage/v1/b/backups/o" || query.Get("prefix") != "karakeep/data-pvc/snapshots/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result := Objects{Items: []Object{{Name: "karakeep/data-pvc/snapshots/abc"}}, NextPageToken: "page2"}
+		if query.Get("pageToken") == "page2" {
+			result = Objects{Items: []Object{{Name: "karakeep/data-pvc/snapshots/def"}}}
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "backups", "", &http.Client{Timeout: 5 * time.Second})
+	names, err := client.ListFiles(context.Background(), "karakeep", "data-pvc", "snapshots")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if want := []string{"abc", "def"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListFiles() = %v, want %v", names, want)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	stub := &gcsStub{t: t, objects: map[string][]string{"backups": {"karakeep/data-pvc/keys/abc"}}, requireAuth: true}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "backups", writeKeyFile(t, server.URL+"/token"), &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	data, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "abc")
+	if err != nil || string(data) != "karakeep/data-pvc/keys/abc" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+	if _, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "missing"); err == nil {
+		t.Error("expected error for missing object")
+	}
+}
+
+func TestListRepositories(t *testing.T) {
+	stub := &gcsStub{t: t, objects: map[string][]string{"backups": {
+		"karakeep/data-pvc/config",
+		"karakeep/data-pvc/keys/abc",
+		"paperless/media/kopia.repository",
+	}}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	client, _ := NewClient(server.URL, "backups", "", &http.Client{Timeout: 5 * time.Second})
+	repos, err := client.ListRepositories(context.Background())
+	if err != nil {
+		t.Fatalf("ListRepositories() error = %v", err)
+	}
+	want := []backend.Repository{{Namespace: "karakeep", PVC: "data-pvc"}, {Namespace: "paperless", PVC: "media"}}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("ListRepositories() = %v, want %v", repos, want)
+	}
+}
@@ -0,0 +1,132 @@
+package gcs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testKeyOnce sync.Once
+	testRSAKey  *rsa.PrivateKey
+)
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	testKeyOnce.Do(func() {
+		var err error
+		testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+	})
+	return testRSAKey
+}
+
+func keyJSON(t *testing.T, tokenURI string) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "pvc-plumber@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURI,
+	})
+	return data
+}
+
+// verifyJWT checks an RS256 assertion against the test key and returns its
+// claims.
+func verifyJWT(t *testing.T, assertion string) (map[string]any, error) {
+	t.Helper()
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("want three JWT segments")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&rsaKey(t).PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	return claims, json.Unmarshal(payload, &claims)
+}
+
+func TestParseServiceAccountKey(t *testing.T) {
+	key, err := parseServiceAccountKey(keyJSON(t, ""))
+	if err != nil {
+		t.Fatalf("parseServiceAccountKey() error = %v", err)
+	}
+	if key.TokenURI != defaultTokenURI {
+		t.Errorf("TokenURI = %v, want default", key.TokenURI)
+	}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not JSON", "nope"},
+		{"wrong type", `{"type":"authorized_user","client_email":"a@b"}`},
+		{"no email", `{"type":"service_account"}`},
+		{"no PEM", `{"type":"service_account","client_email":"a@b","private_key":"x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseServiceAccountKey([]byte(tt.data)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSignJWT(t *testing.T) {
+	key, err := parseServiceAccountKey(keyJSON(t, "https://oauth2.example.com/token"))
+	if err != nil {
+		t.Fatalf("parseServiceAccountKey() error = %v", err)
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assertion, err := key.signJWT(readOnlyScope, now)
+	if err != nil {
+		t.Fatalf("signJWT() error = %v", err)
+	}
+
+	claims, err := verifyJWT(t, assertion)
+	if err != nil {
+		t.Fatalf("JWT does not verify: %v", err)
+	}
+	if claims["iss"] != "pvc-plumber@project.iam.gserviceaccount.com" {
+		t.Errorf("iss = %v", claims["iss"])
+	}
+	if claims["aud"] != "https://oauth2.example.com/token" {
+		t.Errorf("aud = %v", claims["aud"])
+	}
+	if claims["scope"] != readOnlyScope {
+		t.Errorf("scope = %v", claims["scope"])
+	}
+	if claims["exp"].(float64)-claims["iat"].(float64) != 3600 {
+		t.Errorf("exp - iat = %v, want 3600", claims["exp"].(float64)-claims["iat"].(float64))
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mitchross/pvc-plumber/internal/audit"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+func TestHandleExists_Audit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	files := []backend.SnapshotFile{{Name: "aaa", ModTime: day(14)}}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantDecision string
+		wantRule     string
+	}{
+		{name: "restore", path: "/exists/karakeep/data-pvc", wantDecision: audit.DecisionRestore, wantRule: audit.RuleBackupExists},
+		{name: "no matching snapshot", path: "/exists/karakeep/data-pvc?asOf=2026-10-01T00:00:00Z", wantDecision: audit.DecisionFresh, wantRule: audit.RuleNoMatchingSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := New(listingBackend{files: files}, logger,
+				WithAudit(audit.New(&buf, "s3", "http://minio:9000/volsync", logger)))
+
+			apiMux(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+
+			var event audit.Event
+			if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+				t.Fatalf("audit log %q: %v", buf.String(), err)
+			}
+			if event.Source != "exists" || event.Namespace != "karakeep" || event.PVC != "data-pvc" {
+				t.Errorf("event = %+v", event)
+			}
+			if event.Decision != tt.wantDecision || event.Rule != tt.wantRule {
+				t.Errorf("decision = %s/%s, want %s/%s", event.Decision, event.Rule, tt.wantDecision, tt.wantRule)
+			}
+			if event.Target != "http://minio:9000/volsync/karakeep/data-pvc/" || event.LatencyMS < 0 {
+				t.Errorf("target/latency = %s/%v", event.Target, event.LatencyMS)
+			}
+		})
+	}
+
+	// Rejected requests are not decisions and are not audited.
+	var buf bytes.Buffer
+	h := New(listingBackend{files: files}, logger, WithAudit(audit.New(&buf, "s3", "", logger)))
+	w := httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/exists/karakeep", nil))
+	if w.Code != http.StatusBadRequest || buf.Len() != 0 {
+		t.Errorf("Status = %v, audit log = %q", w.Code, buf.String())
+	}
+}
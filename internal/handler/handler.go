@@ -1,75 +1,248 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/mitchross/pvc-plumber/internal/s3"
+	"github.com/mitchross/pvc-plumber/internal/admission"
+	"github.com/mitchross/pvc-plumber/internal/audit"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/freshness"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kyverno"
+	"github.com/mitchross/pvc-plumber/internal/orphans"
+	"github.com/mitchross/pvc-plumber/internal/otlp"
+	"github.com/mitchross/pvc-plumber/internal/protection"
+	"github.com/mitchross/pvc-plumber/internal/ratelimit"
+	"github.com/mitchross/pvc-plumber/internal/restic"
+	"github.com/mitchross/pvc-plumber/internal/stats"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+	"github.com/mitchross/pvc-plumber/internal/volsync"
+	"github.com/mitchross/pvc-plumber/internal/yaml"
 )
 
 type Handler struct {
-	s3Client       *s3.Client
+	backend        backend.Backend
 	logger         *slog.Logger
+	planner        *volsync.Planner
+	snapshots      backend.SnapshotLister
+	freshness      *freshness.Scanner
+	reporter       *protection.Reporter
+	orphans        *orphans.Cleaner
+	stats          *stats.Collector
+	existsSize     bool
+	admission      *admission.Webhook
+	kyverno        *kyverno.Responder
+	spans          *otlp.Exporter
+	audit          *audit.Logger
+	guard          *ratelimit.Guard
+	metrics        []MetricsWriter
 	requestsTotal  atomic.Int64
 	requestsErrors atomic.Int64
+
+	errorsMu      sync.Mutex
+	backendErrors map[errorLabels]int64
+}
+
+// errorLabels are the labels of pvc_plumber_backend_errors_total.
+type errorLabels struct {
+	code      string
+	retryable bool
 }
 
-func New(s3Client *s3.Client, logger *slog.Logger) *Handler {
-	return &Handler{
-		s3Client: s3Client,
-		logger:   logger,
+type Option func(*Handler)
+
+// WithRestorePlanner enables the /restore-plan endpoints.
+func WithRestorePlanner(planner *volsync.Planner) Option {
+	return func(h *Handler) {
+		h.planner = planner
 	}
 }
 
-func (h *Handler) HandleExists(w http.ResponseWriter, r *http.Request) {
-	h.requestsTotal.Add(1)
+// WithSnapshotLister enables the /snapshots endpoint.
+func WithSnapshotLister(l backend.SnapshotLister) Option {
+	return func(h *Handler) {
+		h.snapshots = l
+	}
+}
 
-	// Extract namespace and pvc from path
-	// Expected path: /exists/{namespace}/{pvc}
-	path := r.URL.Path
-
-	var namespace, pvc string
-	// Simple path parsing
-	if len(path) > 8 { // "/exists/"
-		parts := path[8:] // Remove "/exists/"
-		var foundSlash bool
-		var i int
-		for i = 0; i < len(parts); i++ {
-			if parts[i] == '/' {
-				namespace = parts[:i]
-				foundSlash = true
-				break
-			}
-		}
-		if foundSlash && i+1 < len(parts) {
-			pvc = parts[i+1:]
-		}
+// WithFreshness enables the /stale report and the backup freshness gauges.
+func WithFreshness(scanner *freshness.Scanner) Option {
+	return func(h *Handler) {
+		h.freshness = scanner
+	}
+}
+
+// WithProtectionReport enables the /report endpoint.
+func WithProtectionReport(reporter *protection.Reporter) Option {
+	return func(h *Handler) {
+		h.reporter = reporter
+	}
+}
+
+// WithOrphanCleaner enables the /orphans endpoint.
+func WithOrphanCleaner(cleaner *orphans.Cleaner) Option {
+	return func(h *Handler) {
+		h.orphans = cleaner
+	}
+}
+
+// WithStats enables the /stats endpoint. With existsSize, /exists answers
+// for existing backups include the repository's sizeBytes.
+func WithStats(collector *stats.Collector, existsSize bool) Option {
+	return func(h *Handler) {
+		h.stats = collector
+		h.existsSize = existsSize
+	}
+}
+
+// WithAdmission enables the admission webhook endpoint.
+func WithAdmission(wh *admission.Webhook) Option {
+	return func(h *Handler) {
+		h.admission = wh
+	}
+}
+
+// WithKyverno enables the /kyverno endpoint.
+func WithKyverno(r *kyverno.Responder) Option {
+	return func(h *Handler) {
+		h.kyverno = r
+	}
+}
+
+// WithTraceExporter adds the span exporter counters to /metrics.
+func WithTraceExporter(exporter *otlp.Exporter) Option {
+	return func(h *Handler) {
+		h.spans = exporter
 	}
+}
+
+// WithAudit records every restore decision to the audit log.
+func WithAudit(l *audit.Logger) Option {
+	return func(h *Handler) {
+		h.audit = l
+	}
+}
 
+// WithRateLimit adds the throttling counters to /metrics.
+func WithRateLimit(guard *ratelimit.Guard) Option {
+	return func(h *Handler) {
+		h.guard = guard
+	}
+}
+
+// MetricsWriter writes metrics in Prometheus text format.
+type MetricsWriter interface {
+	WriteMetrics(w io.Writer)
+}
+
+// WithMetrics adds m, such as the backend checker's counters, to /metrics.
+func WithMetrics(m MetricsWriter) Option {
+	return func(h *Handler) {
+		h.metrics = append(h.metrics, m)
+	}
+}
+
+func New(b backend.Backend, logger *slog.Logger, opts ...Option) *Handler {
+	h := &Handler{
+		backend: b,
+		logger:  logger,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) HandleExists(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	h.requestsTotal.Add(1)
+	logger := trace.Logger(r.Context(), h.logger)
+
+	// Registered for GET /exists/{namespace}/{pvc}, and for GET /exists/ so
+	// that malformed paths get a JSON error instead of the mux's 404.
+	namespace, pvc := r.PathValue("namespace"), r.PathValue("pvc")
 	if namespace == "" || pvc == "" {
 		h.requestsErrors.Add(1)
-		h.logger.Warn("invalid request path", "path", path)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]any{
+		logger.Warn("invalid request path", "path", r.URL.Path)
+		writeJSON(w, http.StatusBadRequest, map[string]any{
 			"exists": false,
 			"error":  "invalid path format, expected /exists/{namespace}/{pvc}",
 		})
 		return
 	}
+	if err := validateNames(namespace, pvc); err != nil {
+		h.requestsErrors.Add(1)
+		logger.Warn("invalid request", "path", r.URL.Path, "error", err)
+		writeJSON(w, http.StatusBadRequest, map[string]any{"exists": false, "error": err.Error()})
+		return
+	}
+
+	sel, err := parseSelector(r.URL.Query())
+	if err == nil && !sel.isZero() && !h.canSelect(sel) {
+		err = errSelectionUnsupported
+	}
+	if err != nil {
+		h.requestsErrors.Add(1)
+		writeJSON(w, http.StatusBadRequest, map[string]any{"exists": false, "error": err.Error()})
+		return
+	}
 
-	h.logger.Info("checking backup", "namespace", namespace, "pvc", pvc)
+	logger.Info("checking backup", "namespace", namespace, "pvc", pvc)
 
-	result := h.s3Client.CheckBackupExists(r.Context(), namespace, pvc)
+	ctx, span := trace.Start(r.Context(), "check-backup", trace.KindInternal)
+	defer span.End()
+	span.SetAttribute("namespace", namespace)
+	span.SetAttribute("pvc", pvc)
 
-	if result.Error != "" {
+	result, noMatch := h.checkSelected(ctx, namespace, pvc, sel)
+
+	outcome := "missing"
+	switch {
+	case result.Error != "":
 		h.requestsErrors.Add(1)
+		h.countBackendError(&result)
+		outcome = "error"
+		span.SetError(result.Error)
+		span.SetAttribute("error_code", result.ErrorCode)
+	case result.Exists:
+		outcome = "exists"
+	}
+	span.SetAttribute("outcome", outcome)
+	span.SetAttribute("exists", result.Exists)
+	span.SetAttribute("key_count", result.KeyCount)
+	if result.RepoType != "" {
+		span.SetAttribute("repo_type", result.RepoType)
 	}
 
-	h.logger.Info("backup check complete",
+	if result.Exists && h.existsSize {
+		// Sizing is best effort; the decision stands without it.
+		if s, err := h.stats.Get(ctx, namespace, pvc); err != nil {
+			logger.Warn("failed to compute repository size", "namespace", namespace, "pvc", pvc, "error", err)
+		} else {
+			result.SizeBytes = s.TotalBytes
+		}
+	}
+
+	h.recordDecision(ctx, "exists", namespace, pvc, result, noMatch, start)
+
+	logger.Info("backup check complete",
 		"namespace", namespace,
 		"pvc", pvc,
 		"exists", result.Exists,
@@ -79,6 +252,417 @@ func (h *Handler) HandleExists(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(result)
 }
 
+// checkSelected checks for a backup of namespace/pvc and, unless sel is
+// zero, for a snapshot in it that satisfies sel. noMatch is true when a
+// backup exists but no snapshot does.
+func (h *Handler) checkSelected(ctx context.Context, namespace, pvc string, sel selector) (result backend.CheckResult, noMatch bool) {
+	result = h.backend.CheckBackupExists(ctx, namespace, pvc)
+	if !result.Exists || sel.isZero() {
+		return result, false
+	}
+	ref, err := h.selectSnapshot(ctx, namespace, pvc, sel)
+	switch {
+	case err != nil:
+		result.Exists = false
+		result.Error = fmt.Sprintf("failed to select snapshot: %v", err)
+		result.ErrorCode, result.Retryable = backend.Classify(err)
+	case ref == nil:
+		// A backup exists, but nothing in it satisfies the request.
+		result.Exists = false
+		noMatch = true
+	default:
+		result.Snapshot = ref
+		result.RestoreAsOf = restoreAsOf(ref)
+	}
+	return result, noMatch
+}
+
+// HandleKyverno answers /exists in the shape the generated Kyverno policy
+// copies onto PVCs. Failed checks are reported in the body with status 200,
+// so that the policy proceeds without restoring.
+func (h *Handler) HandleKyverno(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if h.kyverno == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "kyverno responses are not enabled"})
+		return
+	}
+	h.requestsTotal.Add(1)
+	logger := trace.Logger(r.Context(), h.logger)
+
+	namespace, pvc := r.PathValue("namespace"), r.PathValue("pvc")
+	if err := validateNames(namespace, pvc); err != nil {
+		h.requestsErrors.Add(1)
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	sel, err := parseSelector(r.URL.Query())
+	if err == nil && !sel.isZero() && !h.canSelect(sel) {
+		err = errSelectionUnsupported
+	}
+	if err != nil {
+		h.requestsErrors.Add(1)
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	result, noMatch := h.checkSelected(r.Context(), namespace, pvc, sel)
+	if result.Error != "" {
+		h.requestsErrors.Add(1)
+		h.countBackendError(&result)
+		logger.Warn("backup check failed for kyverno", "namespace", namespace, "pvc", pvc, "error", result.Error)
+	}
+	h.recordDecision(r.Context(), "kyverno", namespace, pvc, result, noMatch, start)
+
+	writeJSON(w, http.StatusOK, h.kyverno.Respond(namespace, pvc, result, time.Now()))
+}
+
+// HandleRestorePlan renders the VolSync ReplicationDestination that restores
+// {namespace}/{pvc} from its backup. POST additionally applies it to the
+// cluster. The response is JSON unless ?format=yaml or a YAML Accept header
+// is given.
+func (h *Handler) HandleRestorePlan(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	namespace, pvc := r.PathValue("namespace"), r.PathValue("pvc")
+	if h.planner == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "restore plans are not enabled"})
+		return
+	}
+	if namespace == "" || pvc == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error": "invalid path format, expected /restore-plan/{namespace}/{pvc}",
+		})
+		return
+	}
+	if err := validateNames(namespace, pvc); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	if r.Method == http.MethodPost && !h.authorizeApply(w, r, namespace, pvc) {
+		return
+	}
+
+	sel, err := parseSelector(r.URL.Query())
+	if err == nil && !sel.isZero() && !h.canSelect(sel) {
+		err = errSelectionUnsupported
+	}
+	capacity := r.URL.Query().Get("capacity")
+	if err == nil && capacity != "" {
+		if _, qerr := kube.ParseQuantity(capacity); qerr != nil {
+			err = fmt.Errorf("invalid capacity: %w", qerr)
+		}
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	// Only applying a plan restores anything, so only POST is audited.
+	record := func(result backend.CheckResult, noMatch bool) {
+		if r.Method == http.MethodPost {
+			h.recordDecision(r.Context(), "restore-plan", namespace, pvc, result, noMatch, start)
+		}
+	}
+
+	result := h.backend.CheckBackupExists(r.Context(), namespace, pvc)
+	if result.Error != "" {
+		record(result, false)
+		h.countBackendError(&result)
+		h.logger.Warn("backup check failed for restore plan", "namespace", namespace, "pvc", pvc, "error", result.Error)
+		writeJSON(w, http.StatusBadGateway, map[string]any{
+			"error":     result.Error,
+			"errorCode": result.ErrorCode,
+			"retryable": result.Retryable,
+		})
+		return
+	}
+	if !result.Exists {
+		record(result, false)
+		writeJSON(w, http.StatusNotFound, map[string]any{
+			"error": fmt.Sprintf("no backup found for %s/%s", namespace, pvc),
+		})
+		return
+	}
+
+	if result.RepoType != backend.RepoTypeRestic {
+		record(result, false)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":    fmt.Sprintf("the backup of %s/%s is a %s repository, which the VolSync restic mover cannot restore", namespace, pvc, result.RepoType),
+			"repoType": result.RepoType,
+		})
+		return
+	}
+
+	rd, err := h.planner.Plan(r.Context(), namespace, pvc, capacity)
+	if err != nil {
+		h.logger.Error("failed to render restore plan", "namespace", namespace, "pvc", pvc, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	if !sel.isZero() {
+		ref, err := h.selectSnapshot(r.Context(), namespace, pvc, sel)
+		if err != nil {
+			result.Exists, result.Error = false, fmt.Sprintf("failed to select snapshot: %v", err)
+			result.ErrorCode, result.Retryable = backend.Classify(err)
+			record(result, false)
+			h.writeBackendError(w, err)
+			return
+		}
+		if ref == nil {
+			result.Exists = false
+			record(result, true)
+			writeJSON(w, http.StatusNotFound, map[string]any{
+				"error": fmt.Sprintf("no snapshot of %s/%s matches the request", namespace, pvc),
+			})
+			return
+		}
+		rd.Spec.Restic.RestoreAsOf = restoreAsOf(ref)
+		result.Snapshot = ref
+	}
+
+	if r.Method == http.MethodPost {
+		if err := h.planner.Apply(r.Context(), rd); err != nil {
+			result.Exists, result.Error = false, fmt.Sprintf("failed to apply restore plan: %v", err)
+			result.ErrorCode, result.Retryable = backend.Classify(err)
+			record(result, false)
+			if errors.Is(err, volsync.ErrUnmanaged) || kube.IsConflict(err) {
+				writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error()})
+				return
+			}
+			h.logger.Error("failed to apply restore plan", "namespace", namespace, "pvc", pvc, "error", err)
+			h.writeBackendError(w, err)
+			return
+		}
+		record(result, false)
+		h.logger.Info("applied restore plan", "namespace", namespace, "pvc", pvc, "name", rd.Metadata.Name)
+	}
+
+	if wantsYAML(r) {
+		out, err := yaml.Marshal(rd)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(out)
+		return
+	}
+	writeJSON(w, http.StatusOK, rd)
+}
+
+// authorizeApply checks that the caller of POST /restore-plan may patch
+// the ReplicationDestination itself and writes a 401 or 403 if not.
+func (h *Handler) authorizeApply(w http.ResponseWriter, r *http.Request, namespace, pvc string) bool {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	err := h.planner.Authorize(r.Context(), token, namespace, pvc)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, volsync.ErrUnauthenticated):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": err.Error()})
+	case errors.Is(err, volsync.ErrForbidden):
+		writeJSON(w, http.StatusForbidden, map[string]any{"error": err.Error()})
+	case errors.Is(err, volsync.ErrApplyDisabled):
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": err.Error()})
+	default:
+		h.logger.Error("failed to authorize restore plan", "namespace", namespace, "pvc", pvc, "error", err)
+		h.writeBackendError(w, err)
+	}
+	return false
+}
+
+// HandleSnapshots lists the snapshots in the restic repository of
+// {namespace}/{pvc}, oldest first, by decrypting the repository metadata.
+func (h *Handler) HandleSnapshots(w http.ResponseWriter, r *http.Request) {
+	namespace, pvc := r.PathValue("namespace"), r.PathValue("pvc")
+	if h.snapshots == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "snapshot listing is not enabled"})
+		return
+	}
+	if namespace == "" || pvc == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error": "invalid path format, expected /snapshots/{namespace}/{pvc}",
+		})
+		return
+	}
+	if err := validateNames(namespace, pvc); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	snapshots, err := h.snapshots.Snapshots(r.Context(), namespace, pvc)
+	if errors.Is(err, restic.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]any{
+			"error": fmt.Sprintf("no restic repository found for %s/%s", namespace, pvc),
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Warn("failed to list snapshots", "namespace", namespace, "pvc", pvc, "error", err)
+		h.writeBackendError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"namespace": namespace,
+		"pvc":       pvc,
+		"snapshots": snapshots,
+	})
+}
+
+// HandleStats reports the size and contents of the repository of
+// {namespace}/{pvc}, from a complete listing cached for STATS_CACHE_TTL.
+func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	namespace, pvc := r.PathValue("namespace"), r.PathValue("pvc")
+	if h.stats == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "backup statistics are not enabled"})
+		return
+	}
+	if err := validateNames(namespace, pvc); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	s, err := h.stats.Get(r.Context(), namespace, pvc)
+	if errors.Is(err, stats.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]any{
+			"error": fmt.Sprintf("no backup found for %s/%s", namespace, pvc),
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Warn("failed to compute repository stats", "namespace", namespace, "pvc", pvc, "error", err)
+		h.writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// HandleAdmission answers AdmissionReviews for PVC creations from the API
+// server. Reviews are always allowed; see admission.Webhook. Dry-run
+// requests persist nothing, so their decisions are not audited.
+func (h *Handler) HandleAdmission(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if h.admission == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "the admission webhook is not enabled"})
+		return
+	}
+
+	var review admission.Review
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAdmissionReview)).Decode(&review); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": fmt.Sprintf("invalid AdmissionReview: %v", err)})
+		return
+	}
+	if review.APIVersion != admission.APIVersion || review.Request == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error": fmt.Sprintf("invalid AdmissionReview: want an %s request", admission.APIVersion),
+		})
+		return
+	}
+
+	req := review.Request
+	resp, result := h.admission.Review(r.Context(), req)
+	if result != nil {
+		h.requestsTotal.Add(1)
+		if result.Error != "" {
+			h.requestsErrors.Add(1)
+			h.countBackendError(result)
+		}
+		if req.DryRun == nil || !*req.DryRun {
+			h.recordDecision(r.Context(), "admission", req.Namespace, req.Name, *result, false, start)
+		}
+	}
+	writeJSON(w, http.StatusOK, admission.Review{
+		APIVersion: admission.APIVersion,
+		Kind:       "AdmissionReview",
+		Response:   resp,
+	})
+}
+
+// maxAdmissionReview bounds the size of AdmissionReview bodies. PVCs are
+// small; the API server limits objects to a few MiB.
+const maxAdmissionReview = 3 << 20
+
+// HandleReport cross-checks the cluster's PVCs against the backend and
+// lists unprotected PVCs, orphaned backups and likely name mismatches.
+// ?namespace= limits the report to one namespace.
+func (h *Handler) HandleReport(w http.ResponseWriter, r *http.Request) {
+	if h.reporter == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "protection reports are not enabled"})
+		return
+	}
+
+	report, err := h.reporter.Report(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		h.logger.Warn("failed to build protection report", "error", err)
+		h.writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// HandleOrphans reports orphaned repositories and whether each is eligible
+// for cleanup. It never deletes anything; ?namespace= limits the report to
+// one namespace.
+func (h *Handler) HandleOrphans(w http.ResponseWriter, r *http.Request) {
+	if h.orphans == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "orphan cleanup is not enabled"})
+		return
+	}
+
+	result, err := h.orphans.Find(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		h.logger.Warn("failed to find orphaned repositories", "error", err)
+		h.writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeBackendError writes a 502 for err with its error code.
+func (h *Handler) writeBackendError(w http.ResponseWriter, err error) {
+	result := backend.Failure(err)
+	h.countBackendError(&result)
+	writeJSON(w, http.StatusBadGateway, map[string]any{
+		"error":     result.Error,
+		"errorCode": result.ErrorCode,
+		"retryable": result.Retryable,
+	})
+}
+
+// countBackendError counts a failed backend call by error code. Results
+// from backends that do not classify their errors get BACKEND_ERROR.
+func (h *Handler) countBackendError(result *backend.CheckResult) {
+	if result.ErrorCode == "" {
+		result.ErrorCode = backend.CodeBackendError
+	}
+	h.errorsMu.Lock()
+	defer h.errorsMu.Unlock()
+	if h.backendErrors == nil {
+		h.backendErrors = make(map[errorLabels]int64)
+	}
+	h.backendErrors[errorLabels{result.ErrorCode, result.Retryable}]++
+}
+
+// recordDecision writes a restore decision to the audit log, if enabled.
+func (h *Handler) recordDecision(ctx context.Context, source, namespace, pvc string, result backend.CheckResult, noMatch bool, start time.Time) {
+	if h.audit != nil {
+		h.audit.Record(ctx, source, namespace, pvc, result, noMatch, start)
+	}
+}
+
+func wantsYAML(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "yaml":
+		return true
+	case "json":
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "yaml")
+}
+
 func (h *Handler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
@@ -97,4 +681,75 @@ func (h *Handler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_requests_errors_total Total number of failed backup check requests\n")
 	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_requests_errors_total counter\n")
 	_, _ = fmt.Fprintf(w, "pvc_plumber_requests_errors_total %d\n", h.requestsErrors.Load())
+	h.writeErrorMetrics(w)
+	if h.freshness != nil {
+		h.freshness.WriteMetrics(w)
+	}
+	if h.spans != nil {
+		h.spans.WriteMetrics(w)
+	}
+	if h.guard != nil {
+		h.guard.WriteMetrics(w)
+	}
+	for _, m := range h.metrics {
+		m.WriteMetrics(w)
+	}
+}
+
+func (h *Handler) writeErrorMetrics(w http.ResponseWriter) {
+	h.errorsMu.Lock()
+	defer h.errorsMu.Unlock()
+	labels := make([]errorLabels, 0, len(h.backendErrors))
+	for l := range h.backendErrors {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].code != labels[j].code {
+			return labels[i].code < labels[j].code
+		}
+		return !labels[i].retryable && labels[j].retryable
+	})
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_backend_errors_total Failed backend calls by error code\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_backend_errors_total counter\n")
+	for _, l := range labels {
+		_, _ = fmt.Fprintf(w, "pvc_plumber_backend_errors_total{code=%q,retryable=\"%t\"} %d\n", l.code, l.retryable, h.backendErrors[l])
+	}
+}
+
+// HandleStale reports the repositories whose newest snapshot is older than
+// their SLO, whose check failed or whose snapshots cannot be dated, or every
+// scanned repository with ?all=true.
+func (h *Handler) HandleStale(w http.ResponseWriter, r *http.Request) {
+	if h.freshness == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "freshness monitoring is not enabled"})
+		return
+	}
+	scannedAt, statuses := h.freshness.Report()
+	if scannedAt.IsZero() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "no freshness scan has completed yet"})
+		return
+	}
+
+	all := r.URL.Query().Get("all") == "true"
+	stale, unsupported := 0, 0
+	report := make([]freshness.Status, 0, len(statuses))
+	for _, st := range statuses {
+		if st.Stale {
+			stale++
+		}
+		if st.Unsupported {
+			unsupported++
+		}
+		if all || st.Stale || st.Unsupported || st.Error != "" {
+			report = append(report, st)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"scannedAt":    scannedAt,
+		"repositories": len(statuses),
+		"stale":        stale,
+		"unsupported":  unsupported,
+		"items":        report,
+	})
 }
@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -10,16 +14,64 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mitchross/pvc-plumber/backendtest"
+	"github.com/mitchross/pvc-plumber/internal/admission"
+	"github.com/mitchross/pvc-plumber/internal/audit"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+	"github.com/mitchross/pvc-plumber/internal/kyverno"
+	"github.com/mitchross/pvc-plumber/internal/ratelimit"
+	"github.com/mitchross/pvc-plumber/internal/restic"
 	"github.com/mitchross/pvc-plumber/internal/s3"
+	"github.com/mitchross/pvc-plumber/internal/stats"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+	"github.com/mitchross/pvc-plumber/internal/volsync"
 )
 
+// resticListing is a delimited ListObjectsV2 response for the top level of a
+// restic repository.
+const resticListing = `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <KeyCount>4</KeyCount>
+  <Contents><Key>karakeep/data-pvc/config</Key></Contents>
+  <CommonPrefixes><Prefix>karakeep/data-pvc/data/</Prefix></CommonPrefixes>
+  <CommonPrefixes><Prefix>karakeep/data-pvc/keys/</Prefix></CommonPrefixes>
+  <CommonPrefixes><Prefix>karakeep/data-pvc/snapshots/</Prefix></CommonPrefixes>
+</ListBucketResult>`
+
+// kopiaListing is the same for a Kopia repository.
+const kopiaListing = `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <KeyCount>3</KeyCount>
+  <Contents><Key>karakeep/data-pvc/kopia.repository</Key></Contents>
+  <Contents><Key>karakeep/data-pvc/xn0_5f6a</Key></Contents>
+  <Contents><Key>karakeep/data-pvc/q0a1b2c</Key></Contents>
+</ListBucketResult>`
+
+func TestHandleExists_MethodNotAllowed(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mux := apiMux(New(&s3.Client{}, logger))
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, "/exists/karakeep/data-pvc", nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: Status = %v, want %v", method, w.Code, http.StatusMethodNotAllowed)
+		}
+		if allow := w.Header().Get("Allow"); !strings.Contains(allow, http.MethodGet) {
+			t.Errorf("%s: Allow = %q, want GET", method, allow)
+		}
+	}
+}
+
 func TestHandleExists(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
 
 	tests := []struct {
 		name         string
 		path         string
-		mockResult   s3.CheckResult
+		mockResult   backend.CheckResult
 		wantStatus   int
 		wantExists   bool
 		wantKeyCount int
@@ -28,19 +80,19 @@ func TestHandleExists(t *testing.T) {
 		{
 			name: "backup exists",
 			path: "/exists/karakeep/data-pvc",
-			mockResult: s3.CheckResult{
+			mockResult: backend.CheckResult{
 				Exists:   true,
-				KeyCount: 1,
+				KeyCount: 4,
 			},
 			wantStatus:   http.StatusOK,
 			wantExists:   true,
-			wantKeyCount: 1,
+			wantKeyCount: 4,
 			wantError:    false,
 		},
 		{
 			name: "no backup",
 			path: "/exists/test-ns/test-pvc",
-			mockResult: s3.CheckResult{
+			mockResult: backend.CheckResult{
 				Exists:   false,
 				KeyCount: 0,
 			},
@@ -52,7 +104,7 @@ func TestHandleExists(t *testing.T) {
 		{
 			name: "S3 error",
 			path: "/exists/error-ns/error-pvc",
-			mockResult: s3.CheckResult{
+			mockResult: backend.CheckResult{
 				Exists:   false,
 				KeyCount: 0,
 				Error:    "S3 connection failed",
@@ -76,6 +128,30 @@ func TestHandleExists(t *testing.T) {
 			wantExists: false,
 			wantError:  true,
 		},
+		{
+			name:       "invalid path - extra segment",
+			path:       "/exists/karakeep/data-pvc/extra",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
+		{
+			name:       "invalid namespace - uppercase",
+			path:       "/exists/Karakeep/data-pvc",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
+		{
+			name:       "invalid pvc - encoded slash",
+			path:       "/exists/karakeep/data%2Fpvc",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
+		{
+			name:       "invalid pvc - underscore",
+			path:       "/exists/karakeep/data_pvc",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -89,10 +165,7 @@ func TestHandleExists(t *testing.T) {
 				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					w.WriteHeader(http.StatusOK)
 					if tt.mockResult.Exists {
-						_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
-<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
-  <KeyCount>1</KeyCount>
-</ListBucketResult>`))
+						_, _ = w.Write([]byte(resticListing))
 					} else if tt.mockResult.Error != "" {
 						w.WriteHeader(http.StatusInternalServerError)
 						_, _ = w.Write([]byte(`error`))
@@ -122,13 +195,13 @@ func TestHandleExists(t *testing.T) {
 			req := httptest.NewRequest("GET", tt.path, nil)
 			w := httptest.NewRecorder()
 
-			handler.HandleExists(w, req)
+			apiMux(handler).ServeHTTP(w, req)
 
 			if w.Code != tt.wantStatus {
 				t.Errorf("Status = %v, want %v", w.Code, tt.wantStatus)
 			}
 
-			var response s3.CheckResult
+			var response backend.CheckResult
 			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 				t.Fatalf("Failed to decode response: %v", err)
 			}
@@ -230,16 +303,45 @@ func TestHandleMetrics(t *testing.T) {
 	}
 }
 
+func TestHandleMetrics_RateLimit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	h := New(nil, logger, WithRateLimit(ratelimit.New(ratelimit.Options{MaxConcurrent: 4})))
+
+	w := httptest.NewRecorder()
+	h.HandleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{`pvc_plumber_throttled_requests_total{reason="rate_limit"} 0`, "pvc_plumber_lookups_in_flight 0"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+type metricsFunc func(w io.Writer)
+
+func (f metricsFunc) WriteMetrics(w io.Writer) { f(w) }
+
+func TestHandleMetrics_Writers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	h := New(backendtest.New(), logger,
+		WithMetrics(metricsFunc(func(w io.Writer) { fmt.Fprintln(w, "first 1") })),
+		WithMetrics(metricsFunc(func(w io.Writer) { fmt.Fprintln(w, "second 2") })))
+
+	w := httptest.NewRecorder()
+	h.HandleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	first, second := strings.Index(body, "first 1\n"), strings.Index(body, "second 2\n")
+	if first < 0 || second < first {
+		t.Errorf("metrics writers missing or out of order:\n%s", body)
+	}
+}
+
 func TestMetricsCounters(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
 
 	// Create a mock server that returns success
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
-<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
-  <KeyCount>1</KeyCount>
-</ListBucketResult>`))
+		_, _ = w.Write([]byte(resticListing))
 	}))
 	defer server.Close()
 
@@ -249,7 +351,7 @@ func TestMetricsCounters(t *testing.T) {
 	// Make a request to /exists
 	req := httptest.NewRequest("GET", "/exists/test-ns/test-pvc", nil)
 	w := httptest.NewRecorder()
-	handler.HandleExists(w, req)
+	apiMux(handler).ServeHTTP(w, req)
 
 	// Check metrics
 	metricsReq := httptest.NewRequest("GET", "/metrics", nil)
@@ -261,3 +363,574 @@ func TestMetricsCounters(t *testing.T) {
 		t.Errorf("Expected requests_total to be 1, got: %s", body)
 	}
 }
+
+func TestHandleExists_ErrorCode(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`))
+	}))
+	defer server.Close()
+
+	h := New(s3.NewClient(server.URL, "test-bucket", &http.Client{Timeout: 5 * time.Second}), logger)
+	w := httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %v, want %v", w.Code, http.StatusOK)
+	}
+	var result backend.CheckResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Exists || result.ErrorCode != backend.CodeAccessDenied || result.Retryable {
+		t.Errorf("result = %+v, want ACCESS_DENIED, not retryable", result)
+	}
+
+	// A backend that does not classify its errors gets BACKEND_ERROR.
+	w = httptest.NewRecorder()
+	apiMux(New(errorBackend{}, logger)).ServeHTTP(w, httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil))
+	if !strings.Contains(w.Body.String(), `"errorCode":"BACKEND_ERROR"`) {
+		t.Errorf("body = %s, want errorCode BACKEND_ERROR", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `pvc_plumber_backend_errors_total{code="ACCESS_DENIED",retryable="false"} 1`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("metrics missing %q:\n%s", want, w.Body.String())
+	}
+}
+
+func TestHandleExists_SizeBytes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", time.Now())
+	h := New(fake, logger, WithStats(stats.New(fake, time.Minute), true))
+
+	w := httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil))
+	var result backend.CheckResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if want := int64(155 + 460 + 1<<20 + 1024 + 256); !result.Exists || result.SizeBytes != want {
+		t.Errorf("result = %+v, want sizeBytes %d", result, want)
+	}
+
+	w = httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/exists/karakeep/other", nil))
+	if strings.Contains(w.Body.String(), "sizeBytes") {
+		t.Errorf("body = %s, want no sizeBytes without a backup", w.Body.String())
+	}
+}
+
+func TestHandleAdmission(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", time.Now())
+	var buf bytes.Buffer
+	h := New(fake, logger,
+		WithAdmission(admission.New(fake, nil, nil, nil, admission.Options{}, logger)),
+		WithAudit(audit.New(&buf, "s3", "http://minio:9000/volsync", logger)))
+
+	w := httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("POST", "/v1/admission/pvc", strings.NewReader(admissionReview)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %v, want %v (body %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	var review admission.Review
+	if err := json.NewDecoder(w.Body).Decode(&review); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	resp := review.Response
+	if review.APIVersion != admission.APIVersion || review.Kind != "AdmissionReview" || resp == nil {
+		t.Fatalf("review = %+v", review)
+	}
+	if resp.UID != "705ab4f5-6393-11e8-b7cc-42010a800002" || !resp.Allowed || !strings.Contains(string(resp.Patch), `"/spec/dataSourceRef"`) {
+		t.Errorf("response = %+v, patch %s", resp, resp.Patch)
+	}
+
+	var event audit.Event
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("audit log %q: %v", buf.String(), err)
+	}
+	if event.Source != "admission" || event.PVC != "data-pvc" || event.Decision != audit.DecisionRestore {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Dry runs are reviewed but not audited.
+	buf.Reset()
+	dryRun := strings.Replace(admissionReview, `"operation": "CREATE",`, `"operation": "CREATE", "dryRun": true,`, 1)
+	w = httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("POST", "/v1/admission/pvc", strings.NewReader(dryRun)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"patch"`) || buf.Len() != 0 {
+		t.Errorf("dry run: Status = %v, body %s, audit log %q", w.Code, w.Body.String(), buf.String())
+	}
+
+	for _, body := range []string{"{", `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`} {
+		w = httptest.NewRecorder()
+		apiMux(h).ServeHTTP(w, httptest.NewRequest("POST", "/v1/admission/pvc", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: Status = %v, want %v", body, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandleKyverno(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", time.Now())
+	var buf bytes.Buffer
+	h := New(fake, logger,
+		WithKyverno(kyverno.NewResponder(kyverno.Options{DestinationTemplate: "restore-{pvc}"})),
+		WithAudit(audit.New(&buf, "s3", "http://minio:9000/volsync", logger)))
+
+	w := httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/v1/kyverno/karakeep/data-pvc", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %v, want %v (body %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp kyverno.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Restore || resp.DataSourceRef == nil || resp.DataSourceRef.Name != "restore-data-pvc" ||
+		resp.RepositorySecret != "data-pvc-volsync-secret" || resp.Annotations["pvc-plumber.io/backup-exists"] != "true" {
+		t.Errorf("response = %+v", resp)
+	}
+
+	var event audit.Event
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("audit log %q: %v", buf.String(), err)
+	}
+	if event.Source != "kyverno" || event.PVC != "data-pvc" || event.Decision != audit.DecisionRestore {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Without a backup the policy still annotates, but does not restore.
+	w = httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/v1/kyverno/karakeep/other", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"restore":false`) ||
+		!strings.Contains(body, `"dataSourceRef":null`) || !strings.Contains(body, `"pvc-plumber.io/backup-exists":"false"`) {
+		t.Errorf("no backup: Status = %v, body %s", w.Code, body)
+	}
+
+	// A Kopia backup exists but is audited as not restored.
+	fake.SetResult("karakeep", "kopia-pvc", backend.CheckResult{Exists: true, RepoType: backend.RepoTypeKopia, KeyCount: 3})
+	buf.Reset()
+	w = httptest.NewRecorder()
+	apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/v1/kyverno/karakeep/kopia-pvc", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"restore":false`) {
+		t.Errorf("kopia: Status = %v, body %s", w.Code, body)
+	}
+	event = audit.Event{}
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("audit log %q: %v", buf.String(), err)
+	}
+	if event.Decision != audit.DecisionFresh || event.Rule != audit.RuleUnsupportedRepo || event.RepoType != backend.RepoTypeKopia {
+		t.Errorf("kopia event = %+v", event)
+	}
+}
+
+func TestHandleRestorePlan(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		accept          string
+		token           string
+		keyCount        int
+		listing         string
+		s3Status        int
+		withApply       bool
+		existing        string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantApplied     bool
+	}{
+		{
+			name:            "renders JSON",
+			method:          "GET",
+			path:            "/restore-plan/karakeep/data-pvc",
+			keyCount:        1,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `"repository":"data-pvc-volsync-secret"`,
+		},
+		{
+			name:            "renders YAML by query",
+			method:          "GET",
+			path:            "/restore-plan/karakeep/data-pvc?format=yaml",
+			keyCount:        1,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/yaml",
+			wantBody:        "kind: ReplicationDestination\n",
+		},
+		{
+			name:            "renders YAML by Accept header",
+			method:          "GET",
+			path:            "/restore-plan/karakeep/data-pvc?capacity=5Gi",
+			accept:          "application/yaml",
+			keyCount:        1,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/yaml",
+			wantBody:        "capacity: 5Gi\n",
+		},
+		{
+			name:       "no backup",
+			method:     "GET",
+			path:       "/restore-plan/karakeep/data-pvc",
+			keyCount:   0,
+			wantStatus: http.StatusNotFound,
+			wantBody:   "no backup found",
+		},
+		{
+			name:       "backend error",
+			method:     "GET",
+			path:       "/restore-plan/karakeep/data-pvc",
+			s3Status:   http.StatusInternalServerError,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "invalid capacity",
+			method:     "GET",
+			path:       "/restore-plan/karakeep/data-pvc?capacity=5GB",
+			keyCount:   1,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "invalid capacity",
+		},
+		{
+			name:       "kopia repository",
+			method:     "GET",
+			path:       "/restore-plan/karakeep/data-pvc",
+			keyCount:   1,
+			listing:    kopiaListing,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `"repoType":"kopia"`,
+		},
+		{
+			name:            "POST applies",
+			method:          "POST",
+			path:            "/restore-plan/karakeep/data-pvc",
+			token:           "operator-token",
+			keyCount:        1,
+			withApply:       true,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantApplied:     true,
+		},
+		{
+			name:            "POST updates a managed plan",
+			method:          "POST",
+			path:            "/restore-plan/karakeep/data-pvc",
+			token:           "operator-token",
+			keyCount:        1,
+			withApply:       true,
+			existing:        `{"metadata":{"labels":{"app.kubernetes.io/managed-by":"pvc-plumber"}}}`,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantApplied:     true,
+		},
+		{
+			name:       "POST without a token",
+			method:     "POST",
+			path:       "/restore-plan/karakeep/data-pvc",
+			keyCount:   1,
+			withApply:  true,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "POST with an unknown token",
+			method:     "POST",
+			path:       "/restore-plan/karakeep/data-pvc",
+			token:      "stolen-token",
+			keyCount:   1,
+			withApply:  true,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "POST without RBAC",
+			method:     "POST",
+			path:       "/restore-plan/karakeep/data-pvc",
+			token:      "viewer-token",
+			keyCount:   1,
+			withApply:  true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "POST does not take over an unmanaged object",
+			method:     "POST",
+			path:       "/restore-plan/karakeep/data-pvc",
+			token:      "operator-token",
+			keyCount:   1,
+			withApply:  true,
+			existing:   `{"metadata":{"labels":{"app.kubernetes.io/managed-by":"argocd"}}}`,
+			wantStatus: http.StatusConflict,
+			wantBody:   "not managed by pvc-plumber",
+		},
+		{
+			name:       "POST of a kopia repository",
+			method:     "POST",
+			path:       "/restore-plan/karakeep/data-pvc",
+			token:      "operator-token",
+			keyCount:   1,
+			listing:    kopiaListing,
+			withApply:  true,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.s3Status != 0 {
+					w.WriteHeader(tt.s3Status)
+					return
+				}
+				if tt.keyCount > 0 {
+					listing := tt.listing
+					if listing == "" {
+						listing = resticListing
+					}
+					_, _ = w.Write([]byte(listing))
+					return
+				}
+				_, _ = w.Write([]byte(`<ListBucketResult><KeyCount>0</KeyCount></ListBucketResult>`))
+			}))
+			defer s3Server.Close()
+
+			const rdPath = "/apis/volsync.backube/v1alpha1/namespaces/karakeep/replicationdestinations/data-pvc-dst"
+			kubeServer := kubetest.NewServer()
+			defer kubeServer.Close()
+			kubeServer.AddToken("operator-token", kube.UserInfo{Username: "operator"})
+			kubeServer.AddToken("viewer-token", kube.UserInfo{Username: "viewer"})
+			kubeServer.Allow("operator", kube.ResourceAttributes{
+				Namespace: "karakeep", Verb: "patch", Group: volsync.Group, Resource: "replicationdestinations", Name: "data-pvc-dst",
+			})
+			if tt.existing != "" {
+				kubeServer.SetObject(rdPath, json.RawMessage(tt.existing))
+			}
+			var kubeClient *kube.Client
+			if tt.withApply {
+				kubeClient = kubeServer.Client()
+			}
+
+			s3Client := s3.NewClient(s3Server.URL, "test-bucket", &http.Client{Timeout: 5 * time.Second})
+			h := New(s3Client, logger, WithRestorePlanner(volsync.NewPlanner(volsync.Options{}, kubeClient)))
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /restore-plan/{namespace}/{pvc}", h.HandleRestorePlan)
+			mux.HandleFunc("POST /restore-plan/{namespace}/{pvc}", h.HandleRestorePlan)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %v, want %v (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantContentType != "" && w.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("Content-Type = %v, want %v", w.Header().Get("Content-Type"), tt.wantContentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+
+			obj, _ := kubeServer.Object(rdPath)
+			applied := strings.Contains(string(obj), `"kind":"ReplicationDestination"`)
+			if applied != tt.wantApplied {
+				t.Errorf("applied = %v, want %v", applied, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestHandleRestorePlan_Disabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	h := New(nil, logger)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /restore-plan/{namespace}/{pvc}", h.HandleRestorePlan)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/restore-plan/karakeep/data-pvc", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
+
+// stubLister returns canned snapshots for karakeep/data-pvc.
+type stubLister struct {
+	err error
+}
+
+func (l stubLister) Snapshots(ctx context.Context, namespace, pvc string) ([]restic.Snapshot, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	if namespace != "karakeep" || pvc != "data-pvc" {
+		return nil, restic.ErrNotFound
+	}
+	return []restic.Snapshot{{
+		ID:       "9aec13b0",
+		Time:     time.Date(2026, 10, 17, 2, 0, 4, 0, time.UTC),
+		Hostname: "volsync",
+		Paths:    []string{"/data"},
+		Tags:     []string{"daily"},
+	}}, nil
+}
+
+func TestHandleSnapshots(t *testing.T) {
+	tests := []struct {
+		name       string
+		lister     backend.SnapshotLister
+		path       string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{
+			name:       "snapshots listed",
+			lister:     stubLister{},
+			path:       "/snapshots/karakeep/data-pvc",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"9aec13b0"},
+		},
+		{
+			name:       "no repository",
+			lister:     stubLister{},
+			path:       "/snapshots/karakeep/other-pvc",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "wrong password",
+			lister:     stubLister{err: restic.ErrWrongPassword},
+			path:       "/snapshots/karakeep/data-pvc",
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "not enabled",
+			path:       "/snapshots/karakeep/data-pvc",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+			var opts []Option
+			if tt.lister != nil {
+				opts = append(opts, WithSnapshotLister(tt.lister))
+			}
+			h := New(nil, logger, opts...)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /snapshots/{namespace}/{pvc}", h.HandleSnapshots)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Namespace string            `json:"namespace"`
+				PVC       string            `json:"pvc"`
+				Snapshots []restic.Snapshot `json:"snapshots"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Namespace != "karakeep" || resp.PVC != "data-pvc" {
+				t.Errorf("response = %+v", resp)
+			}
+			var ids []string
+			for _, sn := range resp.Snapshots {
+				ids = append(ids, sn.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("snapshot IDs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestHandleExists_Trace(t *testing.T) {
+	var upstream http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Clone()
+		_, _ = w.Write([]byte(resticListing))
+	}))
+	defer server.Close()
+
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	h := New(s3.NewClient(server.URL, "test-bucket", server.Client()), logger)
+
+	req := httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil)
+	req.Header.Set(trace.RequestIDHeader, "kyverno-42")
+	req.Header.Set(trace.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	trace.Middleware(apiMux(h)).ServeHTTP(w, req)
+
+	if w.Header().Get(trace.RequestIDHeader) != "kyverno-42" {
+		t.Errorf("response %s = %q", trace.RequestIDHeader, w.Header().Get(trace.RequestIDHeader))
+	}
+	if upstream.Get(trace.RequestIDHeader) != "kyverno-42" || upstream.Get(trace.TraceparentHeader) != w.Header().Get(trace.TraceparentHeader) {
+		t.Errorf("upstream headers = %v, response traceparent %q", upstream, w.Header().Get(trace.TraceparentHeader))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if !strings.Contains(line, "request_id=kyverno-42") || !strings.Contains(line, "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") {
+			t.Errorf("log line missing trace context: %s", line)
+		}
+	}
+}
+
+type spanRecorder struct{ spans []trace.SpanData }
+
+func (r *spanRecorder) Export(s trace.SpanData) { r.spans = append(r.spans, s) }
+
+func TestHandleExists_Spans(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(resticListing))
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	h := New(s3.NewClient(server.URL, "test-bucket", server.Client()), logger)
+	rec := &spanRecorder{}
+	w := httptest.NewRecorder()
+	trace.NewTracer(rec, 1).Middleware(apiMux(h)).
+		ServeHTTP(w, httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil))
+
+	names := make([]string, 0, len(rec.spans))
+	for _, s := range rec.spans {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "s3.ListObjectsV2,s3.ListObjectsV2,check-backup,GET" {
+		t.Fatalf("spans = %v, want Kopia probe, S3 list, check and server spans", names)
+	}
+	probe, list, check, srv := rec.spans[0], rec.spans[1], rec.spans[2], rec.spans[3]
+	if probe.ParentID != check.SpanID || list.ParentID != check.SpanID || check.ParentID != srv.SpanID {
+		t.Errorf("span parents = %s,%s->%s->%s", probe.ParentID, list.ParentID, check.ParentID, srv.SpanID)
+	}
+	if list.Attributes["http.response.status_code"] != http.StatusOK || list.Attributes["s3.key_count"] != 4 {
+		t.Errorf("S3 span attributes = %v", list.Attributes)
+	}
+	if check.Attributes["namespace"] != "karakeep" || check.Attributes["pvc"] != "data-pvc" || check.Attributes["outcome"] != "exists" {
+		t.Errorf("check span attributes = %v", check.Attributes)
+	}
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// APIPrefix is the path prefix of the versioned API. The unversioned paths
+// remain registered as aliases for existing clients.
+const APIPrefix = "/v1"
+
+// openAPISpec is the OpenAPI 3 document of the API. TestOpenAPI checks the
+// handlers' responses against it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// HandleOpenAPI serves the OpenAPI document.
+func (h *Handler) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
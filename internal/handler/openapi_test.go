@@ -0,0 +1,396 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/admission"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/filesystem"
+	"github.com/mitchross/pvc-plumber/internal/freshness"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+	"github.com/mitchross/pvc-plumber/internal/kyverno"
+	"github.com/mitchross/pvc-plumber/internal/orphans"
+	"github.com/mitchross/pvc-plumber/internal/protection"
+	"github.com/mitchross/pvc-plumber/internal/stats"
+	"github.com/mitchross/pvc-plumber/internal/volsync"
+)
+
+// apiMux registers every route, without rate limiting.
+func apiMux(h *Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	h.Register(mux, Routes{ApplyRestorePlans: true})
+	return mux
+}
+
+// admissionReview is an AdmissionReview for creating karakeep/data-pvc.
+const admissionReview = `{
+  "apiVersion": "admission.k8s.io/v1",
+  "kind": "AdmissionReview",
+  "request": {
+    "uid": "705ab4f5-6393-11e8-b7cc-42010a800002",
+    "kind": {"group": "", "version": "v1", "kind": "PersistentVolumeClaim"},
+    "namespace": "karakeep",
+    "name": "data-pvc",
+    "operation": "CREATE",
+    "object": {"metadata": {"name": "data-pvc"}, "spec": {"resources": {"requests": {"storage": "1Gi"}}}}
+  }
+}`
+
+// errorBackend fails every check.
+type errorBackend struct{}
+
+func (errorBackend) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	return backend.CheckResult{Error: "timeout waiting for S3 response"}
+}
+
+// TestOpenAPI sends requests to the handlers and validates each response
+// against the schema the embedded document declares for its operation and
+// status. Every documented operation must be exercised.
+func TestOpenAPI(t *testing.T) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	v := schemaValidator{spec: spec}
+	v.checkRefs(t, spec)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	kubeServer := kubetest.NewServer()
+	defer kubeServer.Close()
+	kubeServer.AddPVC(kube.PersistentVolumeClaim{Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "data-pvc"}})
+	kubeServer.AddPVC(kube.PersistentVolumeClaim{Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "meili"}})
+	kubeServer.AddToken("operator-token", kube.UserInfo{Username: "operator"})
+	kubeServer.Allow("operator", kube.ResourceAttributes{
+		Namespace: "karakeep", Verb: "patch", Group: volsync.Group, Resource: "replicationdestinations", Name: "data-pvc-dst",
+	})
+	root := t.TempDir()
+	for _, dir := range []string{"karakeep/data-pvc/snapshots", "gone/cache/snapshots"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "karakeep/data-pvc/config"), []byte("config"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := filesystem.New(root)
+	reporter := protection.NewReporter(kubeServer.Client(), fs)
+	scanner := freshness.New(inventoryBackend{}, freshness.SLO{MaxAge: 26 * time.Hour}, time.Hour, logger)
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	full := New(listingBackend{files: []backend.SnapshotFile{{Name: "aaa", ModTime: day(14)}}}, logger,
+		WithRestorePlanner(volsync.NewPlanner(volsync.Options{}, kubeServer.Client())),
+		WithSnapshotLister(stubLister{}),
+		WithFreshness(scanner),
+		WithProtectionReport(reporter),
+		WithOrphanCleaner(orphans.New(reporter, fs, nil, orphans.Options{}, nil, logger)),
+		WithStats(stats.New(fs, time.Minute), false),
+		WithAdmission(admission.New(fs, nil, nil, nil, admission.Options{}, logger)),
+		WithKyverno(kyverno.NewResponder(kyverno.Options{})),
+	)
+	disabled := New(errorBackend{}, logger)
+	failing := New(errorBackend{}, logger, WithKyverno(kyverno.NewResponder(kyverno.Options{})))
+
+	tests := []struct {
+		operation  string
+		h          *Handler
+		path       string
+		wantStatus int
+	}{
+		{"GET /v1/exists/{namespace}/{pvc}", full, "/v1/exists/karakeep/data-pvc", http.StatusOK},
+		{"GET /v1/exists/{namespace}/{pvc}", full, "/v1/exists/karakeep/data-pvc?asOf=2026-10-15T00:00:00Z", http.StatusOK},
+		{"GET /v1/exists/{namespace}/{pvc}", disabled, "/v1/exists/karakeep/data-pvc", http.StatusOK},
+		{"GET /v1/exists/{namespace}/{pvc}", full, "/v1/exists/Karakeep/data-pvc", http.StatusBadRequest},
+		{"GET /v1/exists/{namespace}/{pvc}", full, "/v1/exists/karakeep", http.StatusBadRequest},
+		{"GET /exists/{namespace}/{pvc}", full, "/exists/karakeep/data-pvc", http.StatusOK},
+		{"GET /v1/restore-plan/{namespace}/{pvc}", full, "/v1/restore-plan/karakeep/data-pvc?capacity=5Gi", http.StatusOK},
+		{"GET /v1/restore-plan/{namespace}/{pvc}", full, "/v1/restore-plan/karakeep/data-pvc?asOf=2026-10-01T00:00:00Z", http.StatusNotFound},
+		{"GET /v1/restore-plan/{namespace}/{pvc}", disabled, "/v1/restore-plan/karakeep/data-pvc", http.StatusNotFound},
+		{"POST /v1/restore-plan/{namespace}/{pvc}", full, "/v1/restore-plan/karakeep/data-pvc", http.StatusOK},
+		{"POST /v1/restore-plan/{namespace}/{pvc}", full, "/v1/restore-plan/karakeep/data-pvc?format=json", http.StatusUnauthorized},
+		{"POST /v1/restore-plan/{namespace}/{pvc}", full, "/v1/restore-plan/karakeep/data-pvc?capacity=lots", http.StatusBadRequest},
+		{"GET /v1/snapshots/{namespace}/{pvc}", full, "/v1/snapshots/karakeep/data-pvc", http.StatusOK},
+		{"GET /v1/snapshots/{namespace}/{pvc}", full, "/v1/snapshots/karakeep/other", http.StatusNotFound},
+		{"GET /v1/snapshots/{namespace}/{pvc}", full, "/v1/snapshots/karakeep/data_pvc", http.StatusBadRequest},
+		{"GET /v1/stats/{namespace}/{pvc}", full, "/v1/stats/karakeep/data-pvc", http.StatusOK},
+		{"GET /v1/stats/{namespace}/{pvc}", full, "/v1/stats/karakeep/other", http.StatusNotFound},
+		{"GET /v1/stats/{namespace}/{pvc}", full, "/v1/stats/karakeep/data_pvc", http.StatusBadRequest},
+		{"GET /v1/stats/{namespace}/{pvc}", disabled, "/v1/stats/karakeep/data-pvc", http.StatusNotFound},
+		{"GET /v1/kyverno/{namespace}/{pvc}", full, "/v1/kyverno/karakeep/data-pvc", http.StatusOK},
+		{"GET /v1/kyverno/{namespace}/{pvc}", full, "/v1/kyverno/karakeep/data-pvc?asOf=2026-10-01T00:00:00Z", http.StatusOK},
+		{"GET /v1/kyverno/{namespace}/{pvc}", failing, "/v1/kyverno/karakeep/data-pvc", http.StatusOK},
+		{"GET /v1/kyverno/{namespace}/{pvc}", full, "/v1/kyverno/karakeep/data_pvc", http.StatusBadRequest},
+		{"GET /v1/kyverno/{namespace}/{pvc}", disabled, "/v1/kyverno/karakeep/data-pvc", http.StatusNotFound},
+		{"POST /v1/admission/pvc", full, "/v1/admission/pvc", http.StatusOK},
+		{"POST /v1/admission/pvc", full, "/v1/admission/pvc?invalid", http.StatusBadRequest},
+		{"POST /v1/admission/pvc", disabled, "/v1/admission/pvc", http.StatusNotFound},
+		{"GET /v1/stale", full, "/v1/stale?all=true", http.StatusOK},
+		{"GET /v1/stale", disabled, "/v1/stale", http.StatusNotFound},
+		{"GET /v1/report", full, "/v1/report", http.StatusOK},
+		{"GET /v1/report", disabled, "/v1/report", http.StatusNotFound},
+		{"GET /v1/orphans", full, "/v1/orphans", http.StatusOK},
+		{"GET /healthz", full, "/healthz", http.StatusOK},
+		{"GET /readyz", full, "/readyz", http.StatusOK},
+		{"GET /metrics", full, "/metrics", http.StatusOK},
+		{"GET /openapi.json", full, "/openapi.json", http.StatusOK},
+	}
+
+	// Bodies of POST requests by path.
+	bodies := map[string]string{
+		"/v1/admission/pvc":         admissionReview,
+		"/v1/admission/pvc?invalid": `{"apiVersion": "admission.k8s.io/v1beta1", "kind": "AdmissionReview"}`,
+	}
+
+	// Bearer tokens of requests by path.
+	tokens := map[string]string{
+		"/v1/restore-plan/karakeep/data-pvc":               "operator-token",
+		"/v1/restore-plan/karakeep/data-pvc?capacity=lots": "operator-token",
+	}
+
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.operation+" "+tt.path, func(t *testing.T) {
+			method, template, _ := strings.Cut(tt.operation, " ")
+			op, ok := v.lookup("paths", template, strings.ToLower(method)).(map[string]any)
+			if !ok {
+				t.Fatalf("operation %s is not documented", tt.operation)
+			}
+			covered[tt.operation] = true
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(method, tt.path, strings.NewReader(bodies[tt.path]))
+			if token := tokens[tt.path]; token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			apiMux(tt.h).ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %v, want %v (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			response, ok := op["responses"].(map[string]any)[fmt.Sprint(w.Code)].(map[string]any)
+			if !ok {
+				t.Fatalf("status %d of %s is not documented", w.Code, tt.operation)
+			}
+			mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("Content-Type = %q: %v", w.Header().Get("Content-Type"), err)
+			}
+			contents, _ := v.resolve(response)["content"].(map[string]any)
+			content, ok := contents[mediaType].(map[string]any)
+			if !ok {
+				t.Fatalf("media type %s of %s %d is not documented", mediaType, tt.operation, w.Code)
+			}
+			schema := content["schema"].(map[string]any)
+
+			var body any
+			if mediaType == "application/json" {
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("invalid JSON response: %v", err)
+				}
+			} else {
+				body = w.Body.String()
+			}
+			for _, problem := range v.validate(schema, body, "$") {
+				t.Error(problem)
+			}
+		})
+	}
+
+	var missing []string
+	for path, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			if operation := strings.ToUpper(method) + " " + path; !covered[operation] {
+				missing = append(missing, operation)
+			}
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("operations without a test case: %v", missing)
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	w := httptest.NewRecorder()
+	apiMux(New(nil, logger)).ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), openAPISpec) {
+		t.Error("body is not the embedded document")
+	}
+}
+
+// schemaValidator checks JSON values against the subset of OpenAPI 3.0
+// schemas that openapi.json uses.
+type schemaValidator struct {
+	spec map[string]any
+}
+
+// lookup follows keys from the document root and returns nil if any is
+// missing.
+func (v schemaValidator) lookup(keys ...string) any {
+	var node any = v.spec
+	for _, key := range keys {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = m[key]
+	}
+	return node
+}
+
+// resolve follows $ref until it reaches a node without one.
+func (v schemaValidator) resolve(node map[string]any) map[string]any {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		target, _ := v.lookup(strings.Split(strings.TrimPrefix(ref, "#/"), "/")...).(map[string]any)
+		if target == nil {
+			return map[string]any{}
+		}
+		node = target
+	}
+}
+
+// checkRefs reports every $ref in node that does not resolve.
+func (v schemaValidator) checkRefs(t *testing.T, node any) {
+	t.Helper()
+	switch n := node.(type) {
+	case map[string]any:
+		if ref, ok := n["$ref"].(string); ok {
+			if !strings.HasPrefix(ref, "#/") || v.lookup(strings.Split(ref[2:], "/")...) == nil {
+				t.Errorf("unresolved $ref %q", ref)
+			}
+		}
+		for _, child := range n {
+			v.checkRefs(t, child)
+		}
+	case []any:
+		for _, child := range n {
+			v.checkRefs(t, child)
+		}
+	}
+}
+
+func (v schemaValidator) validate(schema map[string]any, value any, at string) []string {
+	schema = v.resolve(schema)
+	if value == nil && schema["nullable"] == true {
+		return nil
+	}
+	var problems []string
+	fail := func(format string, args ...any) {
+		problems = append(problems, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if e == value {
+				found = true
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			fail("%T is not an object", value)
+			return problems
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, val := range obj {
+			if prop, ok := properties[name].(map[string]any); ok {
+				problems = append(problems, v.validate(prop, val, at+"."+name)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					fail("undocumented property %q", name)
+				}
+			case map[string]any:
+				problems = append(problems, v.validate(extra, val, at+"."+name)...)
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			fail("%T is not an array", value)
+			return problems
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range arr {
+			problems = append(problems, v.validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("%T is not a string", value)
+			return problems
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				fail("%q is not a date-time", s)
+			}
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(s) {
+			fail("%q does not match %s", s, pattern)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && float64(len(s)) > max {
+			fail("%q is longer than %v", s, max)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			fail("%T is not a number", value)
+			return problems
+		}
+		if schema["type"] == "integer" && n != float64(int64(n)) {
+			fail("%v is not an integer", n)
+		}
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			fail("%v is less than %v", n, min)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("%T is not a boolean", value)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchross/pvc-plumber/internal/filesystem"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+	"github.com/mitchross/pvc-plumber/internal/orphans"
+	"github.com/mitchross/pvc-plumber/internal/protection"
+)
+
+func TestHandleReport(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(kube.PersistentVolumeClaim{Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "data-pvc"}})
+	server.AddPVC(kube.PersistentVolumeClaim{Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "meili"}})
+
+	root := t.TempDir()
+	for _, dir := range []string{"karakeep/data-pvc", "gone/cache"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	fs := filesystem.New(root)
+	h := New(fs, logger, WithProtectionReport(protection.NewReporter(server.Client(), fs)))
+
+	w := httptest.NewRecorder()
+	h.HandleReport(w, httptest.NewRequest("GET", "/report", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %v: %s", w.Code, w.Body.String())
+	}
+	var report protection.Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(report.Unprotected) != 1 || report.Unprotected[0].PVC != "meili" {
+		t.Errorf("Unprotected = %v", report.Unprotected)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0].Namespace != "gone" {
+		t.Errorf("Orphans = %v", report.Orphans)
+	}
+
+	w = httptest.NewRecorder()
+	New(fs, logger).HandleReport(w, httptest.NewRequest("GET", "/report", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status when disabled = %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleOrphans(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(kube.PersistentVolumeClaim{Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "data-pvc"}})
+
+	root := t.TempDir()
+	for _, dir := range []string{"karakeep/data-pvc", "gone/cache"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	fs := filesystem.New(root)
+	cleaner := orphans.New(protection.NewReporter(server.Client(), fs), fs, nil, orphans.Options{}, nil, logger)
+	h := New(fs, logger, WithOrphanCleaner(cleaner))
+
+	w := httptest.NewRecorder()
+	h.HandleOrphans(w, httptest.NewRequest("GET", "/orphans", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %v: %s", w.Code, w.Body.String())
+	}
+	var result orphans.Result
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !result.DryRun || len(result.Candidates) != 1 || result.Candidates[0].Namespace != "gone" || result.Candidates[0].Eligible {
+		t.Errorf("result = %+v", result)
+	}
+
+	w = httptest.NewRecorder()
+	New(fs, logger).HandleOrphans(w, httptest.NewRequest("GET", "/orphans", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status when disabled = %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
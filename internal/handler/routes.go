@@ -0,0 +1,57 @@
+package handler
+
+import "net/http"
+
+// Routes configures the middleware Register wraps around each group of
+// routes. A nil middleware leaves its routes unwrapped.
+type Routes struct {
+	// Limited wraps routes that are rate limited per client.
+	Limited func(http.Handler) http.Handler
+	// Lookup wraps routes that query the backend, so that they can also
+	// share a concurrency cap.
+	Lookup func(http.Handler) http.Handler
+	// Admission wraps the admission webhook. The API server is a single
+	// client, so it should share the concurrency cap without a per-client
+	// rate limit.
+	Admission func(http.Handler) http.Handler
+	// ApplyRestorePlans registers POST /restore-plan.
+	ApplyRestorePlans bool
+}
+
+// Register adds every route to mux. API routes are served under APIPrefix
+// and, for existing clients, unversioned. Probes, metrics and the OpenAPI
+// document are never wrapped.
+func (h *Handler) Register(mux *http.ServeMux, routes Routes) {
+	wrap := func(middleware func(http.Handler) http.Handler) func(http.HandlerFunc) http.Handler {
+		return func(f http.HandlerFunc) http.Handler {
+			if middleware == nil {
+				return f
+			}
+			return middleware(f)
+		}
+	}
+	limited, lookup := wrap(routes.Limited), wrap(routes.Lookup)
+	api := func(method, path string, next http.Handler) {
+		mux.Handle(method+" "+APIPrefix+path, next)
+		mux.Handle(method+" "+path, next)
+	}
+
+	api("GET", "/exists/{namespace}/{pvc}", lookup(h.HandleExists))
+	// Malformed /exists paths get a JSON 400 instead of the mux's 404.
+	api("GET", "/exists/", limited(h.HandleExists))
+	api("GET", "/restore-plan/{namespace}/{pvc}", lookup(h.HandleRestorePlan))
+	api("GET", "/snapshots/{namespace}/{pvc}", lookup(h.HandleSnapshots))
+	api("GET", "/stats/{namespace}/{pvc}", lookup(h.HandleStats))
+	api("GET", "/kyverno/{namespace}/{pvc}", lookup(h.HandleKyverno))
+	api("GET", "/stale", limited(h.HandleStale))
+	api("GET", "/report", lookup(h.HandleReport))
+	api("GET", "/orphans", lookup(h.HandleOrphans))
+	if routes.ApplyRestorePlans {
+		api("POST", "/restore-plan/{namespace}/{pvc}", lookup(h.HandleRestorePlan))
+	}
+	mux.Handle("POST "+APIPrefix+"/admission/pvc", wrap(routes.Admission)(h.HandleAdmission))
+	mux.HandleFunc("GET /healthz", h.HandleHealthz)
+	mux.HandleFunc("GET /readyz", h.HandleReadyz)
+	mux.HandleFunc("GET /metrics", h.HandleMetrics)
+	mux.HandleFunc("GET /openapi.json", h.HandleOpenAPI)
+}
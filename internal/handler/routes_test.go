@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	var wrapped []string
+	tag := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				wrapped = append(wrapped, name)
+				w.WriteHeader(http.StatusTeapot)
+			})
+		}
+	}
+	mux := http.NewServeMux()
+	New(nil, logger).Register(mux, Routes{Limited: tag("limited"), Lookup: tag("lookup"), Admission: tag("admission")})
+
+	for _, tt := range []struct {
+		method, path, want string
+	}{
+		{"GET", "/v1/exists/karakeep/data-pvc", "lookup"},
+		{"GET", "/exists/karakeep/data-pvc", "lookup"},
+		{"GET", "/v1/exists/karakeep", "limited"},
+		{"GET", "/v1/stale", "limited"},
+		{"GET", "/orphans", "lookup"},
+		{"POST", "/v1/admission/pvc", "admission"},
+		{"GET", "/healthz", ""},
+		{"GET", "/openapi.json", ""},
+	} {
+		wrapped = nil
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+		if got := append(wrapped, "")[0]; got != tt.want {
+			t.Errorf("%s %s went through %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/v1/restore-plan/karakeep/data-pvc", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /restore-plan without ApplyRestorePlans: status %d, want 405", w.Code)
+	}
+}
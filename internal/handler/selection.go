@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/restic"
+)
+
+// selector picks the latest snapshot taken at or before asOf that carries
+// all of tags and was taken on host. Zero fields match everything.
+type selector struct {
+	asOf time.Time
+	tags []string
+	host string
+}
+
+// parseSelector reads the asOf, tag and host query parameters. tag may be
+// repeated or comma-separated.
+func parseSelector(query url.Values) (selector, error) {
+	var s selector
+	if v := query.Get("asOf"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return selector{}, fmt.Errorf("invalid asOf %q: want an RFC 3339 time", v)
+		}
+		s.asOf = t
+	}
+	for _, v := range query["tag"] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				s.tags = append(s.tags, tag)
+			}
+		}
+	}
+	s.host = query.Get("host")
+	return s, nil
+}
+
+func (s selector) isZero() bool {
+	return s.asOf.IsZero() && len(s.tags) == 0 && s.host == ""
+}
+
+// needsMetadata reports whether s filters on fields that only decrypted
+// snapshots have.
+func (s selector) needsMetadata() bool {
+	return len(s.tags) > 0 || s.host != ""
+}
+
+func (s selector) matches(sn restic.Snapshot) bool {
+	if !s.asOf.IsZero() && sn.Time.After(s.asOf) {
+		return false
+	}
+	if s.host != "" && sn.Hostname != s.host {
+		return false
+	}
+	for _, tag := range s.tags {
+		if !slices.Contains(sn.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+var errSelectionUnsupported = errors.New("snapshot selection needs RESTIC_PASSWORD_FILE or a backend that lists snapshot files")
+
+// selectSnapshot returns the snapshot of namespace/pvc matching s, or nil
+// if none does. Decrypted metadata is used when a SnapshotLister is
+// configured; otherwise only asOf can be applied, to the modification times
+// of the snapshot files.
+func (h *Handler) selectSnapshot(ctx context.Context, namespace, pvc string, s selector) (*backend.SnapshotRef, error) {
+	if h.snapshots != nil {
+		snapshots, err := h.snapshots.Snapshots(ctx, namespace, pvc)
+		if errors.Is(err, restic.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Snapshots are sorted oldest first.
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			if s.matches(snapshots[i]) {
+				return &backend.SnapshotRef{ID: snapshots[i].ID, Time: snapshots[i].Time, Source: backend.SnapshotSourceMetadata}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	lister, ok := backend.As[backend.SnapshotFileLister](h.backend)
+	if !ok || s.needsMetadata() {
+		return nil, errSelectionUnsupported
+	}
+	files, err := lister.ListSnapshotFiles(ctx, namespace, pvc)
+	if err != nil {
+		return nil, err
+	}
+	var latest *backend.SnapshotRef
+	for _, f := range files {
+		if !s.asOf.IsZero() && f.ModTime.After(s.asOf) {
+			continue
+		}
+		if latest == nil || f.ModTime.After(latest.Time) {
+			latest = &backend.SnapshotRef{ID: f.Name, Time: f.ModTime, Source: backend.SnapshotSourceListing}
+		}
+	}
+	return latest, nil
+}
+
+// canSelect reports whether selectSnapshot can serve s.
+func (h *Handler) canSelect(s selector) bool {
+	if h.snapshots != nil {
+		return true
+	}
+	_, ok := backend.As[backend.SnapshotFileLister](h.backend)
+	return ok && !s.needsMetadata()
+}
+
+// restoreAsOf formats the time of ref for VolSync, which restores the latest
+// snapshot at or before restoreAsOf. The VolSync mover compares whole
+// seconds, so sub-second precision is dropped.
+func restoreAsOf(ref *backend.SnapshotRef) string {
+	return ref.Time.UTC().Format(time.RFC3339)
+}
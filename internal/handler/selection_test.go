@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/restic"
+	"github.com/mitchross/pvc-plumber/internal/volsync"
+)
+
+// listingBackend reports a restic repository and lists snapshot files.
+type listingBackend struct {
+	files []backend.SnapshotFile
+}
+
+func (b listingBackend) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	return backend.CheckResult{Exists: true, KeyCount: 4, RepoType: backend.RepoTypeRestic}
+}
+
+func (b listingBackend) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]backend.SnapshotFile, error) {
+	return b.files, nil
+}
+
+// fixedLister returns the same snapshots, oldest first, for every PVC.
+type fixedLister []restic.Snapshot
+
+func (l fixedLister) Snapshots(ctx context.Context, namespace, pvc string) ([]restic.Snapshot, error) {
+	return l, nil
+}
+
+func day(d int) time.Time {
+	return time.Date(2026, 10, d, 2, 0, 4, 500_000_000, time.UTC)
+}
+
+func TestHandleExists_SnapshotSelection(t *testing.T) {
+	snapshots := fixedLister{
+		{ID: "aaa", Time: day(14), Hostname: "volsync", Tags: []string{"daily"}},
+		{ID: "bbb", Time: day(15), Hostname: "volsync", Tags: []string{"weekly", "daily"}},
+		{ID: "ccc", Time: day(16), Hostname: "laptop", Tags: []string{"daily"}},
+	}
+	files := []backend.SnapshotFile{
+		{Name: "aaa", ModTime: day(14).Add(time.Minute)},
+		{Name: "ccc", ModTime: day(16).Add(time.Minute)},
+		{Name: "bbb", ModTime: day(15).Add(time.Minute)},
+	}
+
+	tests := []struct {
+		name        string
+		lister      backend.SnapshotLister
+		query       string
+		wantStatus  int
+		wantExists  bool
+		wantID      string
+		wantSource  string
+		wantAsOf    string
+		wantErrBody bool
+	}{
+		{
+			name:       "latest from metadata",
+			lister:     snapshots,
+			query:      "?asOf=2026-10-31T00:00:00Z",
+			wantStatus: http.StatusOK,
+			wantExists: true,
+			wantID:     "ccc",
+			wantSource: backend.SnapshotSourceMetadata,
+			wantAsOf:   "2026-10-16T02:00:04Z",
+		},
+		{
+			name:       "latest before time",
+			lister:     snapshots,
+			query:      "?asOf=2026-10-15T12:00:00%2B02:00",
+			wantStatus: http.StatusOK,
+			wantExists: true,
+			wantID:     "bbb",
+			wantSource: backend.SnapshotSourceMetadata,
+			wantAsOf:   "2026-10-15T02:00:04Z",
+		},
+		{
+			name:       "tag and host",
+			lister:     snapshots,
+			query:      "?tag=daily&host=volsync",
+			wantStatus: http.StatusOK,
+			wantExists: true,
+			wantID:     "bbb",
+			wantSource: backend.SnapshotSourceMetadata,
+			wantAsOf:   "2026-10-15T02:00:04Z",
+		},
+		{
+			name:       "all tags required",
+			lister:     snapshots,
+			query:      "?tag=daily,weekly&asOf=2026-10-14T23:00:00Z",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "asOf from object listing",
+			query:      "?asOf=2026-10-16T00:00:00Z",
+			wantStatus: http.StatusOK,
+			wantExists: true,
+			wantID:     "bbb",
+			wantSource: backend.SnapshotSourceListing,
+			wantAsOf:   "2026-10-15T02:01:04Z",
+		},
+		{
+			name:        "tag without metadata",
+			query:       "?tag=daily",
+			wantStatus:  http.StatusBadRequest,
+			wantErrBody: true,
+		},
+		{
+			name:        "invalid asOf",
+			lister:      snapshots,
+			query:       "?asOf=yesterday",
+			wantStatus:  http.StatusBadRequest,
+			wantErrBody: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+			var opts []Option
+			if tt.lister != nil {
+				opts = append(opts, WithSnapshotLister(tt.lister))
+			}
+			h := New(listingBackend{files: files}, logger, opts...)
+
+			w := httptest.NewRecorder()
+			apiMux(h).ServeHTTP(w, httptest.NewRequest("GET", "/exists/karakeep/data-pvc"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var result backend.CheckResult
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if result.Exists != tt.wantExists {
+				t.Errorf("Exists = %v, want %v", result.Exists, tt.wantExists)
+			}
+			if tt.wantErrBody != (result.Error != "") {
+				t.Errorf("Error = %q", result.Error)
+			}
+			if tt.wantID == "" {
+				if result.Snapshot != nil {
+					t.Errorf("Snapshot = %+v, want none", result.Snapshot)
+				}
+				return
+			}
+			if result.Snapshot == nil || result.Snapshot.ID != tt.wantID || result.Snapshot.Source != tt.wantSource {
+				t.Fatalf("Snapshot = %+v, want %s from %s", result.Snapshot, tt.wantID, tt.wantSource)
+			}
+			if result.RestoreAsOf != tt.wantAsOf {
+				t.Errorf("RestoreAsOf = %q, want %q", result.RestoreAsOf, tt.wantAsOf)
+			}
+		})
+	}
+}
+
+func TestHandleRestorePlan_RestoreAsOf(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	lister := fixedLister{{ID: "aaa", Time: day(14), Tags: []string{"daily"}}}
+	planner := volsync.NewPlanner(volsync.Options{
+		NameTemplate:             "{pvc}-dst",
+		RepositorySecretTemplate: "{pvc}-volsync-secret",
+		CopyMethod:               "Snapshot",
+	}, nil)
+	h := New(listingBackend{}, logger, WithRestorePlanner(planner), WithSnapshotLister(lister))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /restore-plan/{namespace}/{pvc}", h.HandleRestorePlan)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/restore-plan/karakeep/data-pvc?tag=daily", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %v: %s", w.Code, w.Body.String())
+	}
+	var rd volsync.ReplicationDestination
+	if err := json.NewDecoder(w.Body).Decode(&rd); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rd.Spec.Restic.RestoreAsOf != "2026-10-14T02:00:04Z" {
+		t.Errorf("restoreAsOf = %q", rd.Spec.Restic.RestoreAsOf)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/restore-plan/karakeep/data-pvc?tag=weekly", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status = %v, want %v for unmatched tag", w.Code, http.StatusNotFound)
+	}
+}
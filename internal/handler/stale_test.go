@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/freshness"
+)
+
+// inventoryBackend holds two restic repositories, data-pvc backed up an hour
+// ago and old-pvc three days ago, and the Kopia repository paperless/media.
+type inventoryBackend struct{ listingBackend }
+
+func (inventoryBackend) ListRepositories(ctx context.Context) ([]backend.Repository, error) {
+	return []backend.Repository{
+		{Namespace: "karakeep", PVC: "data-pvc"},
+		{Namespace: "karakeep", PVC: "old-pvc"},
+		{Namespace: "paperless", PVC: "media"},
+	}, nil
+}
+
+func (b inventoryBackend) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	if namespace == "paperless" {
+		return backend.CheckResult{Exists: true, KeyCount: 3, RepoType: backend.RepoTypeKopia}
+	}
+	return b.listingBackend.CheckBackupExists(ctx, namespace, pvc)
+}
+
+func (inventoryBackend) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]backend.SnapshotFile, error) {
+	age := time.Hour
+	if pvc == "old-pvc" {
+		age = 72 * time.Hour
+	}
+	return []backend.SnapshotFile{{Name: "abc", ModTime: time.Now().Add(-age)}}, nil
+}
+
+func TestHandleStale(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	scanner := freshness.New(inventoryBackend{}, freshness.SLO{MaxAge: 26 * time.Hour}, time.Hour, logger)
+	h := New(inventoryBackend{}, logger, WithFreshness(scanner))
+
+	w := httptest.NewRecorder()
+	h.HandleStale(w, httptest.NewRequest("GET", "/stale", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status before first scan = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+
+	if err := scanner.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	for query, wantItems := range map[string]int{"": 2, "?all=true": 3} {
+		w = httptest.NewRecorder()
+		h.HandleStale(w, httptest.NewRequest("GET", "/stale"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Status = %v: %s", w.Code, w.Body.String())
+		}
+		var report struct {
+			Repositories int                `json:"repositories"`
+			Stale        int                `json:"stale"`
+			Unsupported  int                `json:"unsupported"`
+			Items        []freshness.Status `json:"items"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if report.Repositories != 3 || report.Stale != 1 || report.Unsupported != 1 || len(report.Items) != wantItems {
+			t.Fatalf("%q: report = %+v", query, report)
+		}
+		if query == "" && (report.Items[0].PVC != "old-pvc" || !report.Items[1].Unsupported) {
+			t.Errorf("items = %+v, want old-pvc and the unsupported paperless/media", report.Items)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `pvc_plumber_backup_stale{namespace="karakeep",pvc="old-pvc"} 1`) {
+		t.Errorf("metrics missing stale gauge:\n%s", w.Body.String())
+	}
+}
+
+func TestHandleStale_Disabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	h := New(nil, logger)
+
+	w := httptest.NewRecorder()
+	h.HandleStale(w, httptest.NewRequest("GET", "/stale", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kubernetes name length limits.
+const (
+	maxLabelLength     = 63
+	maxSubdomainLength = 253
+)
+
+// validateNames checks namespace and pvc against the Kubernetes naming
+// rules before they are used in a backend prefix: a namespace is a DNS-1123
+// label and a PVC name a DNS-1123 subdomain.
+func validateNames(namespace, pvc string) error {
+	if !isDNS1123Label(namespace) {
+		return fmt.Errorf("invalid namespace %q: must be a lowercase RFC 1123 label of at most %d characters", namespace, maxLabelLength)
+	}
+	if !isDNS1123Subdomain(pvc) {
+		return fmt.Errorf("invalid PVC name %q: must be a lowercase RFC 1123 subdomain of at most %d characters", pvc, maxSubdomainLength)
+	}
+	return nil
+}
+
+// isDNS1123Label reports whether s matches [a-z0-9]([-a-z0-9]*[a-z0-9])?
+// and is at most 63 characters long.
+func isDNS1123Label(s string) bool {
+	return len(s) <= maxLabelLength && isLabel(s)
+}
+
+// isDNS1123Subdomain reports whether s is a dot-separated sequence of
+// labels, each matching the label pattern, of at most 253 characters in
+// total. As in Kubernetes, the labels themselves are not length limited.
+func isDNS1123Subdomain(s string) bool {
+	if len(s) > maxSubdomainLength {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if !isLabel(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLabel reports whether s matches [a-z0-9]([-a-z0-9]*[a-z0-9])?.
+func isLabel(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-' && i != 0 && i != len(s)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// The reference patterns from k8s.io/apimachinery/pkg/util/validation.
+var (
+	labelPattern     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	subdomainPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		namespace string
+		pvc       string
+		wantErr   bool
+	}{
+		{namespace: "karakeep", pvc: "data-pvc"},
+		{namespace: "kube-system", pvc: "data.v2"},
+		{namespace: "a", pvc: "0"},
+		{namespace: strings.Repeat("a", 63), pvc: strings.Repeat("b", 253)},
+		{namespace: strings.Repeat("a", 64), pvc: "data", wantErr: true},
+		{namespace: "karakeep", pvc: strings.Repeat("b", 254), wantErr: true},
+		{namespace: "Karakeep", pvc: "data", wantErr: true},
+		{namespace: "-karakeep", pvc: "data", wantErr: true},
+		{namespace: "karakeep-", pvc: "data", wantErr: true},
+		{namespace: "kara.keep", pvc: "data", wantErr: true},
+		{namespace: "karakeep", pvc: "a/b", wantErr: true},
+		{namespace: "karakeep", pvc: "..", wantErr: true},
+		{namespace: "karakeep", pvc: "data.", wantErr: true},
+		{namespace: "karakeep", pvc: "data_pvc", wantErr: true},
+		{namespace: "karakeep", pvc: "data pvc", wantErr: true},
+		{namespace: "", pvc: "data", wantErr: true},
+		{namespace: "karakeep", pvc: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := validateNames(tt.namespace, tt.pvc)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateNames(%q, %q) error = %v, wantErr %v", tt.namespace, tt.pvc, err, tt.wantErr)
+		}
+	}
+}
+
+func FuzzValidateNames(f *testing.F) {
+	for _, seed := range []string{"karakeep", "data-pvc", "data.v2", "-a", "a-", "a..b", "A", "a_b", "ä", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		wantLabel := len(name) <= maxLabelLength && labelPattern.MatchString(name)
+		if got := isDNS1123Label(name); got != wantLabel {
+			t.Errorf("isDNS1123Label(%q) = %v, want %v", name, got, wantLabel)
+		}
+		wantSubdomain := len(name) <= maxSubdomainLength && subdomainPattern.MatchString(name)
+		if got := isDNS1123Subdomain(name); got != wantSubdomain {
+			t.Errorf("isDNS1123Subdomain(%q) = %v, want %v", name, got, wantSubdomain)
+		}
+	})
+}
+
+// recordingBackend records the names it is asked about.
+type recordingBackend struct {
+	namespace, pvc string
+}
+
+func (b *recordingBackend) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	b.namespace, b.pvc = namespace, pvc
+	return backend.CheckResult{}
+}
+
+func FuzzExistsPath(f *testing.F) {
+	for _, seed := range []string{
+		"karakeep/data-pvc",
+		"karakeep",
+		"karakeep/data-pvc/extra",
+		"karakeep/data%2Fpvc",
+		"karakeep/..",
+		"../etc/passwd",
+		"%2e%2e/data",
+		"Karakeep/Data",
+		"karakeep/data-pvc?asOf=2026-10-18T00:00:00Z",
+		"karakeep//data-pvc",
+	} {
+		f.Add(seed)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	f.Fuzz(func(t *testing.T, path string) {
+		req, err := http.NewRequest(http.MethodGet, "http://pvc-plumber/exists/"+path, nil)
+		if err != nil {
+			t.Skip()
+		}
+		b := &recordingBackend{}
+		w := httptest.NewRecorder()
+		apiMux(New(b, logger)).ServeHTTP(w, req)
+
+		switch w.Code {
+		case http.StatusOK, http.StatusBadRequest, http.StatusNotFound, http.StatusMovedPermanently, http.StatusTemporaryRedirect:
+		default:
+			t.Fatalf("GET /exists/%s: unexpected status %d", path, w.Code)
+		}
+		if w.Code == http.StatusOK && (!labelPattern.MatchString(b.namespace) || !subdomainPattern.MatchString(b.pvc)) {
+			t.Fatalf("GET /exists/%s: backend queried with %q/%q", path, b.namespace, b.pvc)
+		}
+		if strings.ContainsAny(b.namespace+b.pvc, "/%\\") {
+			t.Fatalf("GET /exists/%s: backend queried with %q/%q", path, b.namespace, b.pvc)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// UserInfo identifies the user a token belongs to.
+type UserInfo struct {
+	Username string              `json:"username,omitempty"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+type TokenReviewSpec struct {
+	Token string `json:"token"`
+}
+
+type TokenReviewStatus struct {
+	Authenticated bool     `json:"authenticated"`
+	User          UserInfo `json:"user"`
+	Error         string   `json:"error,omitempty"`
+}
+
+type TokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       TokenReviewSpec   `json:"spec"`
+	Status     TokenReviewStatus `json:"status"`
+}
+
+// ResourceAttributes describe the request a SubjectAccessReview asks about.
+type ResourceAttributes struct {
+	Namespace string `json:"namespace,omitempty"`
+	Verb      string `json:"verb"`
+	Group     string `json:"group,omitempty"`
+	Resource  string `json:"resource"`
+	Name      string `json:"name,omitempty"`
+}
+
+type SubjectAccessReviewSpec struct {
+	ResourceAttributes *ResourceAttributes `json:"resourceAttributes"`
+	User               string              `json:"user,omitempty"`
+	UID                string              `json:"uid,omitempty"`
+	Groups             []string            `json:"groups,omitempty"`
+	Extra              map[string][]string `json:"extra,omitempty"`
+}
+
+type SubjectAccessReviewStatus struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type SubjectAccessReview struct {
+	APIVersion string                    `json:"apiVersion"`
+	Kind       string                    `json:"kind"`
+	Spec       SubjectAccessReviewSpec   `json:"spec"`
+	Status     SubjectAccessReviewStatus `json:"status"`
+}
+
+// create POSTs obj to path and decodes the created object into out.
+func (c *Client) create(ctx context.Context, path string, obj, out any) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode object: %w", err)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, path, nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, out)
+}
+
+// ReviewToken asks the API server who token belongs to. It returns nil
+// when the token is not valid. The client's service account needs create
+// on tokenreviews.authentication.k8s.io.
+func (c *Client) ReviewToken(ctx context.Context, token string) (*UserInfo, error) {
+	review := TokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+		Spec:       TokenReviewSpec{Token: token},
+	}
+	if err := c.create(ctx, "/apis/authentication.k8s.io/v1/tokenreviews", &review, &review); err != nil {
+		return nil, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, nil
+	}
+	return &review.Status.User, nil
+}
+
+// Authorize asks the API server whether user may make the request attrs
+// describe. The client's service account needs create on
+// subjectaccessreviews.authorization.k8s.io.
+func (c *Client) Authorize(ctx context.Context, user *UserInfo, attrs ResourceAttributes) (bool, error) {
+	review := SubjectAccessReview{
+		APIVersion: "authorization.k8s.io/v1",
+		Kind:       "SubjectAccessReview",
+		Spec: SubjectAccessReviewSpec{
+			ResourceAttributes: &attrs,
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              user.Extra,
+		},
+	}
+	if err := c.create(ctx, "/apis/authorization.k8s.io/v1/subjectaccessreviews", &review, &review); err != nil {
+		return false, fmt.Errorf("failed to review access: %w", err)
+	}
+	return review.Status.Allowed, nil
+}
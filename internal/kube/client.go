@@ -0,0 +1,374 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// requestTimeout bounds every API request of the in-cluster client
+	// except watches, and how long a watch may outlast its timeoutSeconds.
+	requestTimeout = 30 * time.Second
+)
+
+// ErrGone is returned when the API server reports that a watch or list
+// resourceVersion is too old (HTTP 410 / Status code 410).
+var ErrGone = errors.New("resource version expired")
+
+// StatusError is returned for non-2xx responses from the API server.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes API returned status %d: %s", e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the API server.
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a 409 from the API server, such as a
+// server-side apply that would take fields owned by another manager.
+func IsConflict(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusConflict
+}
+
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	watchClient *http.Client
+
+	// tokenFile, when set, is re-read for every request; token holds the
+	// last token read.
+	tokenFile string
+	tokenMu   sync.Mutex
+	token     string
+}
+
+func NewClient(baseURL, token string, httpClient *http.Client) *Client {
+	// Watches are long-lived, so they use a copy of httpClient without its
+	// overall Timeout and WatchPVCs bounds them instead.
+	watchClient := *httpClient
+	watchClient.Timeout = 0
+	return &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		token:       token,
+		httpClient:  httpClient,
+		watchClient: &watchClient,
+	}
+}
+
+// NewTokenFileClient returns a client that reads its bearer token from
+// tokenFile for every request, because the kubelet rotates projected
+// service account tokens and the API server rejects expired ones. If the
+// file cannot be read, the last token read is used.
+func NewTokenFileClient(baseURL, tokenFile string, httpClient *http.Client) (*Client, error) {
+	c := NewClient(baseURL, "", httpClient)
+	c.tokenFile = tokenFile
+	if _, err := c.bearerToken(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// bearerToken returns the token to send, re-reading the token file if
+// there is one.
+func (c *Client) bearerToken() (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.tokenFile == "" {
+		return c.token, nil
+	}
+	data, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		if c.token != "" {
+			return c.token, nil
+		}
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+	c.token = strings.TrimSpace(string(data))
+	return c.token, nil
+}
+
+// NewInClusterClient builds a client from the pod's service account token,
+// CA bundle and the KUBERNETES_SERVICE_HOST/PORT environment variables.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST/PORT not set")
+	}
+
+	caPEM, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in service account CA")
+	}
+
+	httpClient := &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig:     &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+
+	baseURL := "https://" + net.JoinHostPort(host, port)
+	return NewTokenFileClient(baseURL, serviceAccountDir+"/token", httpClient)
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	reqURL := c.baseURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	token, err := c.bearerToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request, out any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query kubernetes API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusGone {
+		return ErrGone
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var status Status
+	if err := json.Unmarshal(body, &status); err == nil && status.Message != "" {
+		return &StatusError{Code: resp.StatusCode, Message: status.Message}
+	}
+	return &StatusError{Code: resp.StatusCode, Message: string(body)}
+}
+
+func pvcPath(namespace string) string {
+	if namespace == "" {
+		return "/api/v1/persistentvolumeclaims"
+	}
+	return "/api/v1/namespaces/" + url.PathEscape(namespace) + "/persistentvolumeclaims"
+}
+
+// ListPVCs lists PersistentVolumeClaims in namespace, or across all
+// namespaces when namespace is empty.
+func (c *Client) ListPVCs(ctx context.Context, namespace string) (*PersistentVolumeClaimList, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, pvcPath(namespace), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list PersistentVolumeClaimList
+	if err := c.do(req, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetPVC fetches a single PersistentVolumeClaim.
+func (c *Client) GetPVC(ctx context.Context, namespace, name string) (*PersistentVolumeClaim, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, pvcPath(namespace)+"/"+url.PathEscape(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var pvc PersistentVolumeClaim
+	if err := c.do(req, &pvc); err != nil {
+		return nil, err
+	}
+	return &pvc, nil
+}
+
+// WatchPVCs opens a watch starting at resourceVersion with bookmarks
+// enabled. The server ends the watch after timeout; should it not, the
+// watch is canceled requestTimeout later. The caller must Close the
+// returned Watcher.
+func (c *Client) WatchPVCs(ctx context.Context, namespace, resourceVersion string, timeout time.Duration) (*Watcher, error) {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("allowWatchBookmarks", "true")
+	if resourceVersion != "" {
+		query.Set("resourceVersion", resourceVersion)
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		// timeoutSeconds=0 means no timeout, so shorter waits round up.
+		query.Set("timeoutSeconds", strconv.Itoa(max(1, int(timeout.Seconds()))))
+		ctx, cancel = context.WithTimeout(ctx, timeout+requestTimeout)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, pvcPath(namespace), query, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := c.watchClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start watch: %w", err)
+	}
+	if err := checkStatus(resp); err != nil {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, err
+	}
+
+	return &Watcher{body: resp.Body, decoder: json.NewDecoder(resp.Body), cancel: cancel}, nil
+}
+
+// PatchPVCAnnotations merge-patches the given annotations onto a PVC.
+func (c *Client) PatchPVCAnnotations(ctx context.Context, namespace, name string, annotations map[string]string) error {
+	patch := map[string]any{
+		"metadata": map[string]any{
+			"annotations": annotations,
+		},
+	}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to encode patch: %w", err)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch, pvcPath(namespace)+"/"+url.PathEscape(name), nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	return c.do(req, nil)
+}
+
+// Get fetches the object at path, e.g.
+// /apis/volsync.backube/v1alpha1/namespaces/ns/replicationdestinations/name.
+func (c *Client) Get(ctx context.Context, path string, out any) error {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+// Apply server-side applies obj at path (the object's own URL, as for Get)
+// and decodes the resulting object into out when it is not nil. Apply does
+// not force: fields owned by another manager make the API server answer
+// 409, see IsConflict.
+func (c *Client) Apply(ctx context.Context, path, fieldManager string, obj, out any) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode object: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("fieldManager", fieldManager)
+
+	req, err := c.newRequest(ctx, http.MethodPatch, path, query, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// JSON is valid YAML, so the apply patch can be sent as-is.
+	req.Header.Set("Content-Type", "application/apply-patch+yaml")
+
+	return c.do(req, out)
+}
+
+// CreateEvent records a core/v1 Event in the event's namespace.
+func (c *Client) CreateEvent(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	path := "/api/v1/namespaces/" + url.PathEscape(event.Metadata.Namespace) + "/events"
+	req, err := c.newRequest(ctx, http.MethodPost, path, nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, nil)
+}
+
+// Watcher decodes a stream of watch events from the API server.
+type Watcher struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+	cancel  context.CancelFunc
+}
+
+// Next blocks until the next event arrives. It returns io.EOF when the
+// server closes the watch and ErrGone when the resourceVersion expired.
+func (w *Watcher) Next() (*WatchEvent, error) {
+	var event WatchEvent
+	if err := w.decoder.Decode(&event); err != nil {
+		return nil, err
+	}
+
+	if event.Type == EventError {
+		var status Status
+		if err := json.Unmarshal(event.Object, &status); err == nil && status.Code == http.StatusGone {
+			return nil, ErrGone
+		}
+		return nil, fmt.Errorf("watch error: %s", string(event.Object))
+	}
+	return &event, nil
+}
+
+func (w *Watcher) Close() error {
+	defer w.cancel()
+	return w.body.Close()
+}
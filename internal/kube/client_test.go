@@ -0,0 +1,266 @@
+package kube_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+)
+
+func pvc(namespace, name, phase string) kube.PersistentVolumeClaim {
+	return kube.PersistentVolumeClaim{
+		Metadata: kube.ObjectMeta{Namespace: namespace, Name: name},
+		Status:   kube.PersistentVolumeClaimStatus{Phase: phase},
+	}
+}
+
+func TestListPVCs(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(pvc("karakeep", "data-pvc", kube.ClaimPending))
+	server.AddPVC(pvc("other", "cache", "Bound"))
+
+	client := server.Client()
+
+	all, err := client.ListPVCs(context.Background(), "")
+	if err != nil {
+		t.Fatalf("ListPVCs() error = %v", err)
+	}
+	if len(all.Items) != 2 {
+		t.Errorf("len(Items) = %d, want 2", len(all.Items))
+	}
+	if all.Metadata.ResourceVersion != "2" {
+		t.Errorf("ResourceVersion = %q, want 2", all.Metadata.ResourceVersion)
+	}
+
+	namespaced, err := client.ListPVCs(context.Background(), "karakeep")
+	if err != nil {
+		t.Fatalf("ListPVCs() error = %v", err)
+	}
+	if len(namespaced.Items) != 1 || namespaced.Items[0].Metadata.Name != "data-pvc" {
+		t.Errorf("namespaced Items = %+v, want only data-pvc", namespaced.Items)
+	}
+}
+
+func TestListPVCs_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"kind":"Status","message":"persistentvolumeclaims is forbidden","code":403}`))
+	}))
+	defer server.Close()
+
+	client := kube.NewClient(server.URL, "token", server.Client())
+	_, err := client.ListPVCs(context.Background(), "")
+
+	var statusErr *kube.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("error = %v, want *StatusError", err)
+	}
+	if statusErr.Code != http.StatusForbidden || !strings.Contains(statusErr.Message, "forbidden") {
+		t.Errorf("StatusError = %+v", statusErr)
+	}
+}
+
+func TestWatchPVCs(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(pvc("karakeep", "data-pvc", kube.ClaimPending))
+
+	client := server.Client()
+	w, err := client.WatchPVCs(context.Background(), "", "1", 5*time.Second)
+	if err != nil {
+		t.Fatalf("WatchPVCs() error = %v", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	server.AddPVC(pvc("karakeep", "new-pvc", kube.ClaimPending))
+	server.Bookmark()
+
+	event, err := w.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	claim, err := event.PVC()
+	if err != nil {
+		t.Fatalf("PVC() error = %v", err)
+	}
+	if event.Type != kube.EventAdded || claim.Metadata.Name != "new-pvc" {
+		t.Errorf("event = %s %s, want ADDED new-pvc", event.Type, claim.Metadata.Name)
+	}
+
+	event, err = w.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	bookmark, _ := event.PVC()
+	if event.Type != kube.EventBookmark || bookmark.Metadata.ResourceVersion != "3" {
+		t.Errorf("event = %s rv=%s, want BOOKMARK rv=3", event.Type, bookmark.Metadata.ResourceVersion)
+	}
+
+	queries := server.WatchQueries()
+	if len(queries) != 1 || !strings.Contains(queries[0], "allowWatchBookmarks=true") {
+		t.Errorf("watch queries = %v, want allowWatchBookmarks=true", queries)
+	}
+}
+
+func TestWatchPVCs_Timeouts(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(pvc("karakeep", "data-pvc", kube.ClaimPending))
+
+	// The client's Timeout bounds requests, but not watches.
+	client := kube.NewClient(server.URL, "test-token", &http.Client{Timeout: 50 * time.Millisecond})
+	w, err := client.WatchPVCs(context.Background(), "", "1", 500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchPVCs() error = %v", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	time.Sleep(100 * time.Millisecond)
+	server.AddPVC(pvc("karakeep", "new-pvc", kube.ClaimPending))
+	if event, err := w.Next(); err != nil || event.Type != kube.EventAdded {
+		t.Fatalf("Next() = %+v, %v, want ADDED", event, err)
+	}
+
+	// timeoutSeconds=0 would mean no timeout at all.
+	if queries := server.WatchQueries(); len(queries) != 1 || !strings.Contains(queries[0], "timeoutSeconds=1") {
+		t.Errorf("watch queries = %v, want timeoutSeconds=1", queries)
+	}
+}
+
+func TestWatchPVCs_Gone(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(pvc("karakeep", "data-pvc", kube.ClaimPending))
+	server.AddPVC(pvc("karakeep", "other-pvc", kube.ClaimPending))
+	server.Compact()
+
+	w, err := server.Client().WatchPVCs(context.Background(), "", "1", 5*time.Second)
+	if err != nil {
+		t.Fatalf("WatchPVCs() error = %v", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	if _, err := w.Next(); !errors.Is(err, kube.ErrGone) {
+		t.Errorf("Next() error = %v, want ErrGone", err)
+	}
+}
+
+func TestWatchPVCs_GoneStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	client := kube.NewClient(server.URL, "token", server.Client())
+	if _, err := client.WatchPVCs(context.Background(), "", "1", time.Second); !errors.Is(err, kube.ErrGone) {
+		t.Errorf("WatchPVCs() error = %v, want ErrGone", err)
+	}
+}
+
+func TestPatchPVCAnnotations(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddPVC(pvc("karakeep", "data-pvc", kube.ClaimPending))
+
+	client := server.Client()
+	err := client.PatchPVCAnnotations(context.Background(), "karakeep", "data-pvc", map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatalf("PatchPVCAnnotations() error = %v", err)
+	}
+
+	got, _ := server.PVC("karakeep", "data-pvc")
+	if got.Metadata.Annotations["a"] != "b" {
+		t.Errorf("annotations = %v, want a=b", got.Metadata.Annotations)
+	}
+
+	err = client.PatchPVCAnnotations(context.Background(), "karakeep", "missing", map[string]string{"a": "b"})
+	var statusErr *kube.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		t.Errorf("error = %v, want 404 StatusError", err)
+	}
+}
+
+func TestCreateEvent(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+
+	event := &kube.Event{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata:   kube.ObjectMeta{GenerateName: "data-pvc.", Namespace: "karakeep"},
+		Reason:     "BackupFound",
+		Type:       "Normal",
+	}
+	if err := server.Client().CreateEvent(context.Background(), event); err != nil {
+		t.Fatalf("CreateEvent() error = %v", err)
+	}
+
+	events := server.Events()
+	if len(events) != 1 || events[0].Reason != "BackupFound" {
+		t.Errorf("events = %+v, want one BackupFound", events)
+	}
+}
+
+func TestNewInClusterClient_NotInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+
+	if _, err := kube.NewInClusterClient(); err == nil {
+		t.Error("NewInClusterClient() error = nil, want error outside a cluster")
+	}
+}
+
+func TestNewTokenFileClient_Rotation(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeToken := func(token string) {
+		if err := os.WriteFile(tokenFile, []byte(token), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeToken("first\n")
+	client, err := kube.NewTokenFileClient(server.URL, tokenFile, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	list := func() {
+		if _, err := client.ListPVCs(ctx, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list()
+	// The kubelet rotates the token in place.
+	writeToken("second\n")
+	list()
+	// A missing file keeps the last token rather than failing.
+	if err := os.Remove(tokenFile); err != nil {
+		t.Fatal(err)
+	}
+	list()
+
+	want := []string{"Bearer first", "Bearer second", "Bearer second"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+
+	if _, err := kube.NewTokenFileClient(server.URL, tokenFile, server.Client()); err == nil {
+		t.Error("NewTokenFileClient() without a token file succeeded")
+	}
+}
@@ -0,0 +1,542 @@
+// Package kubetest provides an in-memory fake of the small part of the
+// Kubernetes API that pvc-plumber talks to, served over httptest.
+package kubetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/kube"
+)
+
+type logEntry struct {
+	rv        int
+	eventType string
+	namespace string
+	object    json.RawMessage
+}
+
+// Server is a fake API server holding PVCs and recorded Events.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	rv        int
+	compacted int
+	pvcs      map[string]*kube.PersistentVolumeClaim
+	events    []kube.Event
+	objects   map[string]json.RawMessage
+	log       []logEntry
+	changed   chan struct{}
+	done      chan struct{}
+	hangup    chan struct{}
+	watches   []string
+	patches   int
+	tokens    map[string]kube.UserInfo
+	grants    map[string][]kube.ResourceAttributes
+}
+
+func NewServer() *Server {
+	s := &Server{
+		pvcs:    make(map[string]*kube.PersistentVolumeClaim),
+		objects: make(map[string]json.RawMessage),
+		tokens:  make(map[string]kube.UserInfo),
+		grants:  make(map[string][]kube.ResourceAttributes),
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		hangup:  make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close ends open watches before shutting the server down.
+func (s *Server) Close() {
+	close(s.done)
+	s.Server.Close()
+}
+
+// Client returns a kube.Client pointed at the fake server.
+func (s *Server) Client() *kube.Client {
+	return kube.NewClient(s.URL, "test-token", s.Server.Client())
+}
+
+func key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// notify must be called with mu held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// record must be called with mu held.
+func (s *Server) record(eventType string, pvc *kube.PersistentVolumeClaim) {
+	obj, _ := json.Marshal(pvc)
+	s.log = append(s.log, logEntry{rv: s.rv, eventType: eventType, namespace: pvc.Metadata.Namespace, object: obj})
+	s.notify()
+}
+
+// AddPVC creates or replaces a PVC and emits the matching watch event.
+func (s *Server) AddPVC(pvc kube.PersistentVolumeClaim) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rv++
+	pvc.APIVersion, pvc.Kind = "v1", "PersistentVolumeClaim"
+	pvc.Metadata.ResourceVersion = strconv.Itoa(s.rv)
+	if pvc.Metadata.UID == "" {
+		pvc.Metadata.UID = fmt.Sprintf("uid-%d", s.rv)
+	}
+
+	k := key(pvc.Metadata.Namespace, pvc.Metadata.Name)
+	eventType := kube.EventAdded
+	if _, ok := s.pvcs[k]; ok {
+		eventType = kube.EventModified
+	}
+	s.pvcs[k] = &pvc
+	s.record(eventType, &pvc)
+}
+
+// CompactWithPVC stores pvc without a watch event and then compacts, as if
+// the event had been lost to etcd compaction while a watch was running.
+func (s *Server) CompactWithPVC(pvc kube.PersistentVolumeClaim) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rv++
+	pvc.APIVersion, pvc.Kind = "v1", "PersistentVolumeClaim"
+	pvc.Metadata.ResourceVersion = strconv.Itoa(s.rv)
+	s.pvcs[key(pvc.Metadata.Namespace, pvc.Metadata.Name)] = &pvc
+	s.compacted = s.rv
+	s.log = nil
+	s.notify()
+}
+
+// DeletePVC removes a PVC and emits a DELETED watch event.
+func (s *Server) DeletePVC(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pvc, ok := s.pvcs[key(namespace, name)]
+	if !ok {
+		return
+	}
+	delete(s.pvcs, key(namespace, name))
+	s.rv++
+	pvc.Metadata.ResourceVersion = strconv.Itoa(s.rv)
+	s.record(kube.EventDeleted, pvc)
+}
+
+// Bookmark emits a BOOKMARK event carrying the current resourceVersion.
+func (s *Server) Bookmark() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rv++
+	obj, _ := json.Marshal(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata":   map[string]string{"resourceVersion": strconv.Itoa(s.rv)},
+	})
+	s.log = append(s.log, logEntry{rv: s.rv, eventType: kube.EventBookmark, object: obj})
+	s.notify()
+}
+
+// Compact makes every resourceVersion up to the current one expire, so
+// watches starting from them fail with 410 Gone.
+func (s *Server) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compacted = s.rv
+	s.log = nil
+	s.notify()
+}
+
+// CloseWatches ends all open watches cleanly, as the API server does when
+// timeoutSeconds elapses.
+func (s *Server) CloseWatches() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.hangup)
+	s.hangup = make(chan struct{})
+}
+
+// PVC returns a copy of the stored PVC.
+func (s *Server) PVC(namespace, name string) (kube.PersistentVolumeClaim, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pvc, ok := s.pvcs[key(namespace, name)]
+	if !ok {
+		return kube.PersistentVolumeClaim{}, false
+	}
+	return *pvc, true
+}
+
+// Events returns the Events created through the API.
+func (s *Server) Events() []kube.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]kube.Event(nil), s.events...)
+}
+
+// Object returns the last object applied at an /apis/ path.
+func (s *Server) Object(path string) (json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[path]
+	return obj, ok
+}
+
+// SetObject stores obj at an /apis/ path, as if another client had
+// created it.
+func (s *Server) SetObject(path string, obj json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[path] = obj
+}
+
+// AddToken makes TokenReviews of token authenticate as user.
+func (s *Server) AddToken(token string, user kube.UserInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token] = user
+}
+
+// Allow makes SubjectAccessReviews of username for exactly attrs allowed.
+func (s *Server) Allow(username string, attrs kube.ResourceAttributes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.grants[username] = append(s.grants[username], attrs)
+}
+
+// WatchQueries returns the raw query strings of every watch request.
+func (s *Server) WatchQueries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.watches...)
+}
+
+// Patches returns the number of PATCH requests served.
+func (s *Server) Patches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.patches
+}
+
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(kube.Status{Kind: "Status", Status: "Failure", Message: message, Code: code})
+}
+
+// parsePath splits /api/v1[/namespaces/{ns}]/{resource}[/{name}].
+func parsePath(path string) (namespace, resource, name string, ok bool) {
+	rest, found := strings.CutPrefix(path, "/api/v1/")
+	if !found {
+		return "", "", "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		namespace, parts = parts[1], parts[2:]
+	}
+	switch len(parts) {
+	case 1:
+		return namespace, parts[0], "", true
+	case 2:
+		return namespace, parts[0], parts[1], true
+	}
+	return "", "", "", false
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		writeStatus(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/apis/authentication.k8s.io/v1/tokenreviews" && r.Method == http.MethodPost:
+		s.serveTokenReview(w, r)
+		return
+	case r.URL.Path == "/apis/authorization.k8s.io/v1/subjectaccessreviews" && r.Method == http.MethodPost:
+		s.serveAccessReview(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/apis/") && r.Method == http.MethodGet:
+		s.serveObject(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/apis/"):
+		s.serveApply(w, r)
+		return
+	}
+
+	namespace, resource, name, ok := parsePath(r.URL.Path)
+	if !ok {
+		writeStatus(w, http.StatusNotFound, "the server could not find the requested resource")
+		return
+	}
+
+	switch {
+	case resource == "persistentvolumeclaims" && name == "" && r.Method == http.MethodGet:
+		if r.URL.Query().Get("watch") == "true" {
+			s.serveWatch(w, r, namespace)
+			return
+		}
+		s.serveList(w, namespace)
+	case resource == "persistentvolumeclaims" && name != "" && r.Method == http.MethodGet:
+		s.serveGet(w, namespace, name)
+	case resource == "persistentvolumeclaims" && name != "" && r.Method == http.MethodPatch:
+		s.servePatch(w, r, namespace, name)
+	case resource == "events" && r.Method == http.MethodPost:
+		s.serveCreateEvent(w, r)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) serveList(w http.ResponseWriter, namespace string) {
+	s.mu.Lock()
+	list := kube.PersistentVolumeClaimList{
+		Metadata: kube.ListMeta{ResourceVersion: strconv.Itoa(s.rv)},
+		Items:    []kube.PersistentVolumeClaim{},
+	}
+	for _, pvc := range s.pvcs {
+		if namespace == "" || pvc.Metadata.Namespace == namespace {
+			list.Items = append(list.Items, *pvc)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		return key(list.Items[i].Metadata.Namespace, list.Items[i].Metadata.Name) <
+			key(list.Items[j].Metadata.Namespace, list.Items[j].Metadata.Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) serveWatch(w http.ResponseWriter, r *http.Request, namespace string) {
+	query := r.URL.Query()
+	sent, _ := strconv.Atoi(query.Get("resourceVersion"))
+	bookmarks := query.Get("allowWatchBookmarks") == "true"
+
+	timeout := time.Minute
+	if secs, err := strconv.Atoi(query.Get("timeoutSeconds")); err == nil && secs > 0 {
+		timeout = time.Duration(secs) * time.Second
+	}
+	deadline := time.After(timeout)
+
+	s.mu.Lock()
+	s.watches = append(s.watches, r.URL.RawQuery)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for {
+		s.mu.Lock()
+		if sent < s.compacted {
+			s.mu.Unlock()
+			status, _ := json.Marshal(kube.Status{Kind: "Status", Status: "Failure", Reason: "Expired", Code: http.StatusGone,
+				Message: fmt.Sprintf("too old resource version: %d (%d)", sent, s.compacted)})
+			_ = enc.Encode(kube.WatchEvent{Type: kube.EventError, Object: status})
+			return
+		}
+		var pending []logEntry
+		for _, entry := range s.log {
+			if entry.rv <= sent {
+				continue
+			}
+			if entry.eventType == kube.EventBookmark && !bookmarks {
+				continue
+			}
+			if namespace != "" && entry.namespace != "" && entry.namespace != namespace {
+				continue
+			}
+			pending = append(pending, entry)
+		}
+		changed, hangup := s.changed, s.hangup
+		s.mu.Unlock()
+
+		for _, entry := range pending {
+			if err := enc.Encode(kube.WatchEvent{Type: entry.eventType, Object: entry.object}); err != nil {
+				return
+			}
+			sent = entry.rv
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return
+		case <-s.done:
+			return
+		case <-hangup:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) serveGet(w http.ResponseWriter, namespace, name string) {
+	pvc, ok := s.PVC(namespace, name)
+	if !ok {
+		writeStatus(w, http.StatusNotFound, fmt.Sprintf("persistentvolumeclaims %q not found", name))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pvc)
+}
+
+// serveObject returns the object stored at an /apis/ path.
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request) {
+	obj, ok := s.Object(r.URL.Path)
+	if !ok {
+		writeStatus(w, http.StatusNotFound, fmt.Sprintf("%s not found", r.URL.Path))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(obj)
+}
+
+func (s *Server) serveTokenReview(w http.ResponseWriter, r *http.Request) {
+	var review kube.TokenReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		writeStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	user, ok := s.tokens[review.Spec.Token]
+	s.mu.Unlock()
+	review.Status = kube.TokenReviewStatus{Authenticated: ok, User: user}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(review)
+}
+
+func (s *Server) serveAccessReview(w http.ResponseWriter, r *http.Request) {
+	var review kube.SubjectAccessReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Spec.ResourceAttributes == nil {
+		writeStatus(w, http.StatusBadRequest, "resourceAttributes are required")
+		return
+	}
+
+	s.mu.Lock()
+	for _, attrs := range s.grants[review.Spec.User] {
+		review.Status.Allowed = review.Status.Allowed || attrs == *review.Spec.ResourceAttributes
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(review)
+}
+
+// serveApply stores server-side apply patches for any custom resource path.
+func (s *Server) serveApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch || r.Header.Get("Content-Type") != "application/apply-patch+yaml" {
+		writeStatus(w, http.StatusMethodNotAllowed, "only server-side apply is supported")
+		return
+	}
+	if r.URL.Query().Get("fieldManager") == "" {
+		writeStatus(w, http.StatusBadRequest, "fieldManager is required for apply patches")
+		return
+	}
+	if r.URL.Query().Has("force") {
+		writeStatus(w, http.StatusBadRequest, "pvc-plumber must not force apply patches")
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if !json.Valid(body) {
+		writeStatus(w, http.StatusBadRequest, "invalid apply patch")
+		return
+	}
+
+	s.mu.Lock()
+	s.objects[r.URL.Path] = body
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func (s *Server) servePatch(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+		writeStatus(w, http.StatusUnsupportedMediaType, "unsupported patch type")
+		return
+	}
+
+	var patch kube.PersistentVolumeClaim
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &patch); err != nil {
+		writeStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.patches++
+	pvc, ok := s.pvcs[key(namespace, name)]
+	if !ok {
+		writeStatus(w, http.StatusNotFound, fmt.Sprintf("persistentvolumeclaims %q not found", name))
+		return
+	}
+	if pvc.Metadata.Annotations == nil {
+		pvc.Metadata.Annotations = make(map[string]string)
+	}
+	for k, v := range patch.Metadata.Annotations {
+		pvc.Metadata.Annotations[k] = v
+	}
+	s.rv++
+	pvc.Metadata.ResourceVersion = strconv.Itoa(s.rv)
+	s.record(kube.EventModified, pvc)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pvc)
+}
+
+func (s *Server) serveCreateEvent(w http.ResponseWriter, r *http.Request) {
+	var event kube.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		writeStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(event)
+}
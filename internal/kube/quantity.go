@@ -0,0 +1,53 @@
+package kube
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// quantitySuffixes are the multipliers of the resource quantity suffixes
+// used for storage sizes.
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18},
+}
+
+// ParseQuantity returns the number of bytes in a resource quantity such as
+// "10Gi", "500M" or "1.5Ti", rounded up to a whole byte. Exponent notation
+// such as "1e9" is not supported.
+func ParseQuantity(s string) (int64, error) {
+	number, multiplier := s, int64(1)
+	for _, q := range quantitySuffixes {
+		if n, ok := strings.CutSuffix(s, q.suffix); ok {
+			number, multiplier = n, q.multiplier
+			break
+		}
+	}
+	r, ok := new(big.Rat).SetString(number)
+	if !ok || number == "" || strings.ContainsAny(number, "/eE") || r.Sign() < 0 {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(multiplier))
+
+	bytes := new(big.Int).Quo(r.Num(), r.Denom())
+	if new(big.Rat).SetInt(bytes).Cmp(r) < 0 {
+		bytes.Add(bytes, big.NewInt(1))
+	}
+	if !bytes.IsInt64() {
+		return 0, fmt.Errorf("quantity %q is too large", s)
+	}
+	return bytes.Int64(), nil
+}
+
+// FormatGi formats bytes as a quantity in whole gibibytes, rounding up.
+func FormatGi(bytes int64) string {
+	gi := bytes >> 30
+	if bytes&(1<<30-1) != 0 {
+		gi++
+	}
+	return fmt.Sprintf("%dGi", gi)
+}
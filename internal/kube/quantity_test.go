@@ -0,0 +1,41 @@
+package kube_test
+
+import (
+	"testing"
+
+	"github.com/mitchross/pvc-plumber/internal/kube"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "10Gi", want: 10 << 30},
+		{in: "500M", want: 500e6},
+		{in: "1.5Ti", want: 3 << 39},
+		{in: "0.1k", want: 100},
+		{in: "1.0001", want: 2},
+		{in: "Gi", wantErr: true},
+		{in: "-1Gi", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "10GB", wantErr: true},
+		{in: "16Ei", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := kube.ParseQuantity(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseQuantity(%q) = %d, %v; want %d, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFormatGi(t *testing.T) {
+	for bytes, want := range map[int64]string{0: "0Gi", 1: "1Gi", 1 << 30: "1Gi", 1<<30 + 1: "2Gi", 12 << 30: "12Gi"} {
+		if got := kube.FormatGi(bytes); got != want {
+			t.Errorf("FormatGi(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+}
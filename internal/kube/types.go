@@ -0,0 +1,124 @@
+package kube
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Watch event types as sent by the API server.
+const (
+	EventAdded    = "ADDED"
+	EventModified = "MODIFIED"
+	EventDeleted  = "DELETED"
+	EventBookmark = "BOOKMARK"
+	EventError    = "ERROR"
+)
+
+// ClaimPending is the phase of a PVC that has not been bound to a volume.
+const ClaimPending = "Pending"
+
+type ObjectMeta struct {
+	Name              string            `json:"name,omitempty"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	CreationTimestamp *time.Time        `json:"creationTimestamp,omitempty"`
+	GenerateName      string            `json:"generateName,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+}
+
+type ListMeta struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Continue        string `json:"continue,omitempty"`
+}
+
+type TypedObjectReference struct {
+	APIGroup  *string `json:"apiGroup,omitempty"`
+	Kind      string  `json:"kind"`
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+type ResourceRequirements struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+type PersistentVolumeClaimSpec struct {
+	AccessModes      []string              `json:"accessModes,omitempty"`
+	StorageClassName *string               `json:"storageClassName,omitempty"`
+	VolumeName       string                `json:"volumeName,omitempty"`
+	VolumeMode       *string               `json:"volumeMode,omitempty"`
+	Resources        ResourceRequirements  `json:"resources,omitempty"`
+	DataSource       *TypedObjectReference `json:"dataSource,omitempty"`
+	DataSourceRef    *TypedObjectReference `json:"dataSourceRef,omitempty"`
+}
+
+type PersistentVolumeClaimStatus struct {
+	Phase string `json:"phase,omitempty"`
+}
+
+type PersistentVolumeClaim struct {
+	APIVersion string                      `json:"apiVersion,omitempty"`
+	Kind       string                      `json:"kind,omitempty"`
+	Metadata   ObjectMeta                  `json:"metadata"`
+	Spec       PersistentVolumeClaimSpec   `json:"spec"`
+	Status     PersistentVolumeClaimStatus `json:"status,omitempty"`
+}
+
+type PersistentVolumeClaimList struct {
+	Metadata ListMeta                `json:"metadata"`
+	Items    []PersistentVolumeClaim `json:"items"`
+}
+
+type ObjectReference struct {
+	APIVersion      string `json:"apiVersion,omitempty"`
+	Kind            string `json:"kind,omitempty"`
+	Namespace       string `json:"namespace,omitempty"`
+	Name            string `json:"name,omitempty"`
+	UID             string `json:"uid,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type EventSource struct {
+	Component string `json:"component,omitempty"`
+}
+
+type Event struct {
+	APIVersion     string          `json:"apiVersion"`
+	Kind           string          `json:"kind"`
+	Metadata       ObjectMeta      `json:"metadata"`
+	InvolvedObject ObjectReference `json:"involvedObject"`
+	Reason         string          `json:"reason"`
+	Message        string          `json:"message"`
+	Type           string          `json:"type"`
+	Source         EventSource     `json:"source"`
+	FirstTimestamp time.Time       `json:"firstTimestamp"`
+	LastTimestamp  time.Time       `json:"lastTimestamp"`
+	Count          int             `json:"count"`
+}
+
+// Status is the body the API server returns for errors.
+type Status struct {
+	Kind    string `json:"kind,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+type WatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// PVC decodes the event object as a PersistentVolumeClaim. Bookmark events
+// decode to a claim that only carries metadata.resourceVersion.
+func (e *WatchEvent) PVC() (*PersistentVolumeClaim, error) {
+	var pvc PersistentVolumeClaim
+	if err := json.Unmarshal(e.Object, &pvc); err != nil {
+		return nil, err
+	}
+	return &pvc, nil
+}
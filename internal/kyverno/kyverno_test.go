@@ -0,0 +1,148 @@
+package kyverno
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/controller"
+	"github.com/mitchross/pvc-plumber/internal/yaml"
+)
+
+func TestRespond(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r := NewResponder(Options{RepositorySecretTemplate: "restic-{namespace}-{pvc}"})
+
+	t.Run("restore", func(t *testing.T) {
+		resp := r.Respond("karakeep", "data-pvc", backend.CheckResult{Exists: true, RepoType: backend.RepoTypeRestic, RestoreAsOf: "2026-10-17T00:00:00Z"}, now)
+		if !resp.Restore {
+			t.Fatal("Restore = false, want true")
+		}
+		if resp.DataSourceRef == nil || *resp.DataSourceRef.APIGroup != "volsync.backube" ||
+			resp.DataSourceRef.Kind != "ReplicationDestination" || resp.DataSourceRef.Name != "data-pvc-dst" {
+			t.Errorf("DataSourceRef = %+v", resp.DataSourceRef)
+		}
+		if resp.ReplicationDestination != "data-pvc-dst" || resp.RepositorySecret != "restic-karakeep-data-pvc" {
+			t.Errorf("names = %q, %q", resp.ReplicationDestination, resp.RepositorySecret)
+		}
+		if got := resp.Annotations[controller.AnnotationBackupExists]; got != "true" {
+			t.Errorf("backup-exists annotation = %q, want true", got)
+		}
+		if got := resp.Annotations[controller.AnnotationCheckedAt]; got != "2026-10-18T12:00:00Z" {
+			t.Errorf("checked-at annotation = %q", got)
+		}
+		if resp.RestoreAsOf != "2026-10-17T00:00:00Z" {
+			t.Errorf("RestoreAsOf = %q", resp.RestoreAsOf)
+		}
+		// The policy's generate rule reads the decision from the PVC.
+		if resp.Annotations[AnnotationRepositorySecret] != "restic-karakeep-data-pvc" || resp.Annotations[AnnotationRestoreAsOf] != "2026-10-17T00:00:00Z" {
+			t.Errorf("annotations = %v, want the repository Secret and restoreAsOf", resp.Annotations)
+		}
+		if resp.Spec.DataSourceRef != resp.DataSourceRef {
+			t.Errorf("Spec.DataSourceRef = %+v, want %+v", resp.Spec.DataSourceRef, resp.DataSourceRef)
+		}
+	})
+
+	t.Run("latest snapshot", func(t *testing.T) {
+		resp := r.Respond("karakeep", "data-pvc", backend.CheckResult{Exists: true, RepoType: backend.RepoTypeRestic}, now)
+		if !resp.Restore || resp.RestoreAsOf != "2026-10-18T12:00:00Z" {
+			t.Errorf("Restore = %v, RestoreAsOf = %q, want the time of the check", resp.Restore, resp.RestoreAsOf)
+		}
+	})
+
+	t.Run("kopia", func(t *testing.T) {
+		resp := r.Respond("paperless", "media", backend.CheckResult{Exists: true, RepoType: backend.RepoTypeKopia}, now)
+		if resp.Restore || resp.DataSourceRef != nil || resp.Spec.DataSourceRef != nil || resp.RestoreAsOf != "" {
+			t.Errorf("response = %+v, want no restore", resp)
+		}
+		if _, ok := resp.Annotations[AnnotationRestoreAsOf]; ok {
+			t.Errorf("annotations = %v, want no restore-as-of", resp.Annotations)
+		}
+		if !strings.Contains(resp.Reason, "kopia repositories cannot be restored") {
+			t.Errorf("Reason = %q", resp.Reason)
+		}
+		if got := resp.Annotations[controller.AnnotationBackupExists]; got != "true" {
+			t.Errorf("backup-exists annotation = %q, want true", got)
+		}
+	})
+
+	t.Run("no backup", func(t *testing.T) {
+		resp := r.Respond("karakeep", "data-pvc", backend.CheckResult{}, now)
+		if resp.Restore || resp.DataSourceRef != nil {
+			t.Errorf("Restore = %v, DataSourceRef = %+v, want no restore", resp.Restore, resp.DataSourceRef)
+		}
+		if got := resp.Annotations[controller.AnnotationBackupExists]; got != "false" {
+			t.Errorf("backup-exists annotation = %q, want false", got)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		resp := r.Respond("karakeep", "data-pvc", backend.CheckResult{Error: "boom", ErrorCode: backend.CodeBackendError}, now)
+		if resp.Restore || resp.DataSourceRef != nil || len(resp.Annotations) != 0 {
+			t.Errorf("response = %+v, want no restore and no annotations", resp)
+		}
+		if resp.Error != "boom" || resp.ErrorCode != backend.CodeBackendError {
+			t.Errorf("error = %q (%s)", resp.Error, resp.ErrorCode)
+		}
+	})
+}
+
+func TestPolicy(t *testing.T) {
+	p, err := Policy(PolicyOptions{
+		ServiceURL:       "http://pvc-plumber.kube-system.svc:8080/",
+		StorageClassName: "longhorn",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := yaml.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+
+	for _, want := range []string{
+		"kind: ClusterPolicy\n",
+		"  name: pvc-plumber-restore\n",
+		"  failurePolicy: Ignore\n",
+		"url: http://pvc-plumber.kube-system.svc:8080/v1/kyverno/{{request.namespace}}/{{request.object.metadata.name}}\n",
+		`annotations: "{{ plumber.annotations }}"`,
+		`spec: "{{ plumber.spec }}"`,
+		`name: "{{ request.object.spec.dataSourceRef.name }}"`,
+		`repository: "{{ request.object.metadata.annotations.\"pvc-plumber.io/repository-secret\" || '' }}"`,
+		`restoreAsOf: "{{ request.object.metadata.annotations.\"pvc-plumber.io/restore-as-of\" || '' }}"`,
+		"copyMethod: Snapshot\n",
+		"storageClassName: longhorn\n",
+		"kind: ReplicationDestination\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("policy does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "volumeSnapshotClassName") {
+		t.Errorf("policy sets an unconfigured snapshot class:\n%s", got)
+	}
+	if n := strings.Count(got, "operations:\n"); n != 2 {
+		t.Errorf("%d rules match on operations, want 2", n)
+	}
+	// Every rule would make its own call; only the mutate rule may.
+	if n := strings.Count(got, "apiCall:"); n != 1 {
+		t.Errorf("policy makes %d API calls, want 1:\n%s", n, got)
+	}
+
+	// Claims named by generateName have no name at admission, and would
+	// call the URL without its last segment.
+	lookup := p.Spec.Rules[0]
+	if len(lookup.Context) == 0 || lookup.Preconditions == nil ||
+		lookup.Preconditions.All[0] != (Condition{Key: "{{ request.object.metadata.name || '' }}", Operator: "NotEquals", Value: ""}) {
+		t.Errorf("rule %s does not skip unnamed PVCs: %+v", lookup.Name, lookup.Preconditions)
+	}
+
+	if _, err := Policy(PolicyOptions{}); err == nil {
+		t.Error("Policy without a service URL succeeded")
+	}
+	if _, err := Policy(PolicyOptions{ServiceURL: "http://svc", CopyMethod: "Direct"}); err == nil {
+		t.Error("Policy with copy method Direct succeeded")
+	}
+}
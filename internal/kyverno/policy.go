@@ -0,0 +1,230 @@
+package kyverno
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/volsync"
+)
+
+// contextName is the policy variable holding the /kyverno response.
+const contextName = "plumber"
+
+type PolicyOptions struct {
+	// Name is the ClusterPolicy's name.
+	Name string
+	// ServiceURL is the base URL of pvc-plumber as seen from Kyverno.
+	ServiceURL string
+	// CopyMethod, StorageClassName and VolumeSnapshotClassName configure
+	// the generated ReplicationDestinations, as for restore plans.
+	CopyMethod              string
+	StorageClassName        string
+	VolumeSnapshotClassName string
+}
+
+type ClusterPolicy struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   Metadata   `json:"metadata"`
+	Spec       PolicySpec `json:"spec"`
+}
+
+type Metadata struct {
+	Name        string            `json:"name"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type PolicySpec struct {
+	Background    bool   `json:"background"`
+	FailurePolicy string `json:"failurePolicy"`
+	Rules         []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Name          string         `json:"name"`
+	Match         Match          `json:"match"`
+	Context       []ContextEntry `json:"context,omitempty"`
+	Preconditions *Preconditions `json:"preconditions,omitempty"`
+	Mutate        *Mutation      `json:"mutate,omitempty"`
+	Generate      *Generation    `json:"generate,omitempty"`
+}
+
+type Match struct {
+	Any []ResourceFilter `json:"any"`
+}
+
+type ResourceFilter struct {
+	Resources ResourceDescription `json:"resources"`
+}
+
+type ResourceDescription struct {
+	Kinds      []string `json:"kinds"`
+	Operations []string `json:"operations"`
+}
+
+type ContextEntry struct {
+	Name    string  `json:"name"`
+	APICall APICall `json:"apiCall"`
+}
+
+type APICall struct {
+	Method  string  `json:"method"`
+	Service Service `json:"service"`
+}
+
+type Service struct {
+	URL string `json:"url"`
+}
+
+type Preconditions struct {
+	All []Condition `json:"all"`
+}
+
+type Condition struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    any    `json:"value"`
+}
+
+type Mutation struct {
+	PatchStrategicMerge map[string]any `json:"patchStrategicMerge"`
+}
+
+type Generation struct {
+	APIVersion  string `json:"apiVersion"`
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	Synchronize bool   `json:"synchronize"`
+	Data        any    `json:"data"`
+}
+
+type destinationData struct {
+	Spec destinationSpec `json:"spec"`
+}
+
+type destinationSpec struct {
+	Trigger volsync.Trigger `json:"trigger"`
+	Restic  resticData      `json:"restic"`
+}
+
+// resticData mirrors volsync.ResticSpec with access modes taken whole from
+// the PVC by a single variable.
+type resticData struct {
+	Repository              string `json:"repository"`
+	CopyMethod              string `json:"copyMethod"`
+	Capacity                string `json:"capacity"`
+	AccessModes             string `json:"accessModes"`
+	StorageClassName        string `json:"storageClassName,omitempty"`
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+	RestoreAsOf             string `json:"restoreAsOf"`
+}
+
+// Policy renders a ClusterPolicy that asks pvc-plumber about every new PVC
+// without a data source of its own. One rule copies the answer onto the
+// PVC: the check annotations and, when a restic backup exists, a
+// dataSourceRef to a ReplicationDestination. A second rule generates that
+// ReplicationDestination from the mutated PVC, so pvc-plumber is called
+// once per PVC creation.
+//
+// The destination and Secret name templates are expanded by the service,
+// so the policy stays valid when they change.
+func Policy(opts PolicyOptions) (*ClusterPolicy, error) {
+	if opts.Name == "" {
+		opts.Name = "pvc-plumber-restore"
+	}
+	if opts.ServiceURL == "" {
+		return nil, errors.New("service URL is required")
+	}
+	if opts.CopyMethod == "" {
+		opts.CopyMethod = volsync.CopyMethodSnapshot
+	}
+	if opts.CopyMethod == volsync.CopyMethodDirect {
+		// Direct restores into an existing claim, but the volume populator
+		// fills a new one from a snapshot.
+		return nil, fmt.Errorf("copy method %s cannot populate new PVCs", volsync.CopyMethodDirect)
+	}
+
+	match := Match{Any: []ResourceFilter{{Resources: ResourceDescription{
+		Kinds:      []string{"PersistentVolumeClaim"},
+		Operations: []string{"CREATE"},
+	}}}}
+	lookup := []ContextEntry{{Name: contextName, APICall: APICall{
+		Method: "GET",
+		Service: Service{
+			URL: strings.TrimSuffix(opts.ServiceURL, "/") + "/v1/kyverno/{{request.namespace}}/{{request.object.metadata.name}}",
+		},
+	}}}
+	annotation := func(name string) string {
+		return "{{ request.object.metadata.annotations.\"" + name + "\" || '' }}"
+	}
+
+	return &ClusterPolicy{
+		APIVersion: "kyverno.io/v1",
+		Kind:       "ClusterPolicy",
+		Metadata: Metadata{
+			Name: opts.Name,
+			Annotations: map[string]string{
+				"policies.kyverno.io/description": "Restores new PVCs from their backups, as decided by pvc-plumber.",
+			},
+		},
+		Spec: PolicySpec{
+			// Restores only make sense at admission, and a failed lookup
+			// must not block PVC creation.
+			Background:    false,
+			FailurePolicy: "Ignore",
+			Rules: []Rule{
+				{
+					Name:    "restore-from-backup",
+					Match:   match,
+					Context: lookup,
+					Preconditions: &Preconditions{All: []Condition{
+						// Claims named by generateName have no name yet to
+						// look a backup up by, as in the admission webhook.
+						{Key: "{{ request.object.metadata.name || '' }}", Operator: "NotEquals", Value: ""},
+						// Claims with a data source already say where their
+						// data comes from.
+						{
+							Key:      "{{ request.object.spec.dataSourceRef.name || request.object.spec.dataSource.name || '' }}",
+							Operator: "Equals",
+							Value:    "",
+						},
+					}},
+					Mutate: &Mutation{PatchStrategicMerge: map[string]any{
+						"metadata": map[string]any{"annotations": "{{ " + contextName + ".annotations }}"},
+						"spec":     "{{ " + contextName + ".spec }}",
+					}},
+				},
+				{
+					// Kyverno generates from the PVC as mutated by the rule
+					// above, whose annotations record the restore.
+					Name:  "generate-replication-destination",
+					Match: match,
+					Preconditions: &Preconditions{All: []Condition{
+						{Key: annotation(AnnotationRestoreAsOf), Operator: "NotEquals", Value: ""},
+						{Key: "{{ request.object.spec.dataSourceRef.kind || '' }}", Operator: "Equals", Value: volsync.Kind},
+					}},
+					Generate: &Generation{
+						APIVersion: volsync.APIVersion,
+						Kind:       volsync.Kind,
+						Name:       "{{ request.object.spec.dataSourceRef.name }}",
+						Namespace:  "{{ request.namespace }}",
+						Data: destinationData{Spec: destinationSpec{
+							Trigger: volsync.Trigger{Manual: "restore-once"},
+							Restic: resticData{
+								Repository:              annotation(AnnotationRepositorySecret),
+								CopyMethod:              opts.CopyMethod,
+								Capacity:                "{{ request.object.spec.resources.requests.storage }}",
+								AccessModes:             "{{ request.object.spec.accessModes }}",
+								StorageClassName:        opts.StorageClassName,
+								VolumeSnapshotClassName: opts.VolumeSnapshotClassName,
+								RestoreAsOf:             annotation(AnnotationRestoreAsOf),
+							},
+						}},
+					},
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,114 @@
+// Package kyverno shapes backup checks for Kyverno policies and renders a
+// ClusterPolicy that restores new PVCs from them.
+package kyverno
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/controller"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/volsync"
+)
+
+// Annotations recording a restore decision on the PVC, so that the
+// policy's generate rule can build the ReplicationDestination without
+// asking pvc-plumber again.
+const (
+	AnnotationRepositorySecret = "pvc-plumber.io/repository-secret"
+	AnnotationRestoreAsOf      = "pvc-plumber.io/restore-as-of"
+)
+
+type Options struct {
+	// DestinationTemplate and RepositorySecretTemplate name the
+	// ReplicationDestination restoring a PVC and its restic Secret. They
+	// accept {namespace} and {pvc}.
+	DestinationTemplate      string
+	RepositorySecretTemplate string
+}
+
+// Response carries everything a policy copies onto a new PVC, so that the
+// policy needs no JMESPath beyond field references and a single API call.
+type Response struct {
+	// Restore is true when the PVC should be restored from its backup.
+	Restore bool `json:"restore"`
+	// Reason explains why an existing backup is not restored.
+	Reason string `json:"reason,omitempty"`
+	// Annotations are the controller mode annotations and, when Restore is
+	// true, the repository Secret and RestoreAsOf. They are empty when the
+	// check failed, so that the controller retries the PVC.
+	Annotations map[string]string `json:"annotations"`
+	// Spec is merged into the PVC's spec. It sets dataSourceRef when
+	// Restore is true, and is empty otherwise.
+	Spec SpecPatch `json:"spec"`
+	// DataSourceRef points at the ReplicationDestination when Restore is
+	// true, and is null otherwise.
+	DataSourceRef          *kube.TypedObjectReference `json:"dataSourceRef"`
+	ReplicationDestination string                     `json:"replicationDestination"`
+	RepositorySecret       string                     `json:"repositorySecret"`
+	// RestoreAsOf is set whenever Restore is true: the selected snapshot's
+	// time, or else the time of the check, so that the restore uses the
+	// snapshot the decision was made on.
+	RestoreAsOf string `json:"restoreAsOf,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorCode   string `json:"errorCode,omitempty"`
+}
+
+type SpecPatch struct {
+	DataSourceRef *kube.TypedObjectReference `json:"dataSourceRef,omitempty"`
+}
+
+// Responder builds Responses from backup checks.
+type Responder struct {
+	opts Options
+}
+
+func NewResponder(opts Options) *Responder {
+	if opts.DestinationTemplate == "" {
+		opts.DestinationTemplate = "{pvc}-dst"
+	}
+	if opts.RepositorySecretTemplate == "" {
+		opts.RepositorySecretTemplate = "{pvc}-volsync-secret"
+	}
+	return &Responder{opts: opts}
+}
+
+// Respond describes result, the backup check of namespace/pvc made at now.
+func (r *Responder) Respond(namespace, pvc string, result backend.CheckResult, now time.Time) Response {
+	resp := Response{
+		Annotations:            map[string]string{},
+		ReplicationDestination: volsync.ExpandTemplate(r.opts.DestinationTemplate, namespace, pvc),
+		RepositorySecret:       volsync.ExpandTemplate(r.opts.RepositorySecretTemplate, namespace, pvc),
+	}
+	if result.Error != "" {
+		resp.Error, resp.ErrorCode = result.Error, result.ErrorCode
+		return resp
+	}
+
+	resp.Annotations[controller.AnnotationBackupExists] = fmt.Sprintf("%t", result.Exists)
+	resp.Annotations[controller.AnnotationCheckedAt] = now.UTC().Format(time.RFC3339)
+	if !result.Exists {
+		return resp
+	}
+	if result.RepoType != backend.RepoTypeRestic {
+		resp.Reason = fmt.Sprintf("%s repositories cannot be restored by the VolSync restic mover", result.RepoType)
+		return resp
+	}
+
+	resp.Restore = true
+	group := volsync.Group
+	resp.DataSourceRef = &kube.TypedObjectReference{
+		APIGroup: &group,
+		Kind:     volsync.Kind,
+		Name:     resp.ReplicationDestination,
+	}
+	resp.Spec.DataSourceRef = resp.DataSourceRef
+	resp.RestoreAsOf = result.RestoreAsOf
+	if resp.RestoreAsOf == "" {
+		resp.RestoreAsOf = now.UTC().Format(time.RFC3339)
+	}
+	resp.Annotations[AnnotationRepositorySecret] = resp.RepositorySecret
+	resp.Annotations[AnnotationRestoreAsOf] = resp.RestoreAsOf
+	return resp
+}
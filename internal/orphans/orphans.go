@@ -0,0 +1,394 @@
+// Package orphans finds backup repositories whose PVC no longer exists and,
+// when enabled, deletes those that have been orphaned for longer than a
+// grace period and are allowed by the cleanup rules.
+package orphans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/protection"
+)
+
+// Source classifies repositories and lists their snapshot files.
+type Source interface {
+	backend.Backend
+	backend.SnapshotFileLister
+}
+
+// Deleter removes repository objects. DeleteObjects receives at most
+// BatchSize keys per call.
+type Deleter interface {
+	ListRepositoryObjects(ctx context.Context, namespace, pvc string) ([]string, error)
+	DeleteObjects(ctx context.Context, keys []string) error
+}
+
+// BatchSize is the number of keys passed to each DeleteObjects call.
+const BatchSize = 1000
+
+type Options struct {
+	// GracePeriod is how long a repository must have been orphaned, from
+	// the first run that found it without a PVC, before it may be deleted.
+	GracePeriod time.Duration
+	// StateFile keeps the time each repository was first seen orphaned
+	// across restarts. Without it, the grace period restarts with the
+	// process.
+	StateFile string
+	// Rules are path.Match patterns on "namespace/pvc". Only repositories
+	// matching a rule are deleted; with no rules nothing is.
+	Rules []string
+	// Delete enables deletion; otherwise runs only report.
+	Delete bool
+	// DeleteInterval is the minimum time between DeleteObjects calls.
+	DeleteInterval time.Duration
+	// MaxRepositories caps the repositories deleted per run.
+	MaxRepositories int
+}
+
+// Candidate is an orphaned repository and whether it may be deleted.
+type Candidate struct {
+	Namespace      string     `json:"namespace"`
+	PVC            string     `json:"pvc"`
+	RepoType       string     `json:"repoType,omitempty"`
+	NewestSnapshot *time.Time `json:"newestSnapshot,omitempty"`
+	OrphanedSince  *time.Time `json:"orphanedSince,omitempty"`
+	Eligible       bool       `json:"eligible"`
+	Reason         string     `json:"reason,omitempty"`
+	Deleted        bool       `json:"deleted,omitempty"`
+	Objects        int        `json:"objects,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// Result is the outcome of one run.
+type Result struct {
+	Time       time.Time   `json:"time"`
+	DryRun     bool        `json:"dryRun"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// AuditRecord is written to the audit log for every deletion attempt.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Namespace string    `json:"namespace"`
+	PVC       string    `json:"pvc"`
+	Objects   int       `json:"objects"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Cleaner finds and optionally deletes orphaned repositories.
+type Cleaner struct {
+	reporter *protection.Reporter
+	source   Source
+	deleter  Deleter
+	opts     Options
+	audit    io.Writer
+	logger   *slog.Logger
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+
+	mu        sync.Mutex
+	last      *Result
+	firstSeen map[string]time.Time
+}
+
+// New returns a Cleaner. deleter and audit may be nil when opts.Delete is
+// false.
+func New(reporter *protection.Reporter, source Source, deleter Deleter, opts Options, audit io.Writer, logger *slog.Logger) *Cleaner {
+	return &Cleaner{
+		reporter: reporter,
+		source:   source,
+		deleter:  deleter,
+		opts:     opts,
+		audit:    audit,
+		logger:   logger,
+		now:      time.Now,
+		sleep:    sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Run cleans up every interval until ctx is canceled.
+func (c *Cleaner) Run(ctx context.Context, interval time.Duration) {
+	c.logger.Info("orphan cleanup starting", "interval", interval, "delete", c.opts.Delete, "gracePeriod", c.opts.GracePeriod)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Clean(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Warn("orphan cleanup failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			c.logger.Info("orphan cleanup stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the result of the last completed Clean, or nil.
+func (c *Cleaner) Last() *Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Find reports the orphaned repositories in namespace (all namespaces when
+// empty) without deleting anything or recording them as orphaned.
+func (c *Cleaner) Find(ctx context.Context, namespace string) (*Result, error) {
+	report, err := c.reporter.Report(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	firstSeen, err := c.orphanedSince(nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return c.evaluateReport(ctx, report, firstSeen), nil
+}
+
+func (c *Cleaner) evaluateReport(ctx context.Context, report *protection.Report, firstSeen map[string]time.Time) *Result {
+	renamed := make(map[backend.Repository]protection.Mismatch, len(report.Mismatches))
+	for _, m := range report.Mismatches {
+		renamed[m.Backup] = m
+	}
+	result := &Result{Time: c.now().UTC(), DryRun: true, Candidates: make([]Candidate, 0, len(report.Orphans))}
+	for _, repo := range report.Orphans {
+		var since *time.Time
+		if t, ok := firstSeen[stateKey(repo)]; ok {
+			since = &t
+		}
+		cand := c.evaluate(ctx, repo, since)
+		if m, ok := renamed[repo]; ok && cand.Error == "" {
+			// The PVC was probably renamed and still needs these backups.
+			cand.Eligible = false
+			cand.Reason = fmt.Sprintf("likely backup of PVC %s/%s (%s)", m.PVC.Namespace, m.PVC.PVC, m.Reason)
+		}
+		result.Candidates = append(result.Candidates, cand)
+	}
+	return result
+}
+
+func stateKey(repo backend.Repository) string {
+	return repo.Namespace + "/" + repo.PVC
+}
+
+// orphanedSince returns when each repository was first seen orphaned. With
+// record, it first records orphans as the current orphans of all
+// namespaces, forgetting repositories that are no longer orphaned, and
+// saves the state.
+func (c *Cleaner) orphanedSince(orphans []backend.Repository, record bool) (map[string]time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.firstSeen == nil {
+		c.firstSeen = map[string]time.Time{}
+		if c.opts.StateFile != "" {
+			firstSeen, err := loadState(c.opts.StateFile)
+			if err != nil {
+				c.firstSeen = nil
+				return nil, err
+			}
+			c.firstSeen = firstSeen
+		}
+	}
+	if record {
+		next := make(map[string]time.Time, len(orphans))
+		now := c.now().UTC()
+		for _, repo := range orphans {
+			key := stateKey(repo)
+			if t, ok := c.firstSeen[key]; ok {
+				next[key] = t
+			} else {
+				next[key] = now
+			}
+		}
+		if c.opts.StateFile != "" {
+			if err := saveState(c.opts.StateFile, next); err != nil {
+				return nil, err
+			}
+		}
+		c.firstSeen = next
+	}
+	return maps.Clone(c.firstSeen), nil
+}
+
+// evaluate decides whether an orphaned repository may be deleted. since is
+// when it was first seen orphaned, or nil if it has not been recorded.
+func (c *Cleaner) evaluate(ctx context.Context, repo backend.Repository, since *time.Time) Candidate {
+	cand := Candidate{Namespace: repo.Namespace, PVC: repo.PVC, OrphanedSince: since}
+
+	check := c.source.CheckBackupExists(ctx, repo.Namespace, repo.PVC)
+	if check.Error != "" {
+		cand.Error = check.Error
+		return cand
+	}
+	cand.RepoType = check.RepoType
+	if check.RepoType != backend.RepoTypeRestic {
+		cand.Reason = "not a restic repository"
+		return cand
+	}
+
+	files, err := c.source.ListSnapshotFiles(ctx, repo.Namespace, repo.PVC)
+	if err != nil {
+		cand.Error = err.Error()
+		return cand
+	}
+	var newest time.Time
+	for _, f := range files {
+		if f.ModTime.After(newest) {
+			newest = f.ModTime
+		}
+	}
+	if newest.IsZero() {
+		cand.Reason = "repository has no snapshots"
+		return cand
+	}
+	cand.NewestSnapshot = &newest
+
+	if since == nil {
+		cand.Reason = "not yet recorded as orphaned"
+		return cand
+	}
+	if age := c.now().Sub(*since); age < c.opts.GracePeriod {
+		cand.Reason = fmt.Sprintf("orphaned for %s, grace period is %s", age.Truncate(time.Minute), c.opts.GracePeriod)
+		return cand
+	}
+	if !c.allowed(repo) {
+		cand.Reason = "not allowed by cleanup rules"
+		return cand
+	}
+	cand.Eligible = true
+	return cand
+}
+
+func (c *Cleaner) allowed(repo backend.Repository) bool {
+	name := repo.Namespace + "/" + repo.PVC
+	for _, rule := range c.opts.Rules {
+		if ok, _ := path.Match(rule, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean records the current orphans and, when deletion is enabled, deletes
+// up to MaxRepositories eligible ones. If the orphans cannot be recorded,
+// nothing is deleted.
+func (c *Cleaner) Clean(ctx context.Context) (*Result, error) {
+	report, err := c.reporter.Report(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	firstSeen, err := c.orphanedSince(report.Orphans, true)
+	if err != nil {
+		return nil, err
+	}
+	result := c.evaluateReport(ctx, report, firstSeen)
+	result.DryRun = !c.opts.Delete || c.deleter == nil
+
+	deleted := 0
+	for i := range result.Candidates {
+		cand := &result.Candidates[i]
+		if !cand.Eligible {
+			continue
+		}
+		if result.DryRun {
+			c.logger.Info("orphaned repository eligible for deletion (dry run)", "namespace", cand.Namespace, "pvc", cand.PVC)
+			continue
+		}
+		if c.opts.MaxRepositories > 0 && deleted >= c.opts.MaxRepositories {
+			break
+		}
+		c.delete(ctx, cand)
+		deleted++
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	c.last = result
+	c.mu.Unlock()
+	return result, ctx.Err()
+}
+
+// delete removes every object of cand in rate-limited batches and audits
+// the attempt. The PVC is looked up again before every batch, and deletion
+// stops if it has been recreated since the report.
+func (c *Cleaner) delete(ctx context.Context, cand *Candidate) {
+	keys, err := c.deleter.ListRepositoryObjects(ctx, cand.Namespace, cand.PVC)
+	for start := 0; err == nil && start < len(keys); start += BatchSize {
+		if start > 0 {
+			if err = c.sleep(ctx, c.opts.DeleteInterval); err != nil {
+				break
+			}
+		}
+		if err = c.checkOrphaned(ctx, cand); err != nil {
+			break
+		}
+		batch := keys[start:min(start+BatchSize, len(keys))]
+		if err = c.deleter.DeleteObjects(ctx, batch); err == nil {
+			cand.Objects += len(batch)
+		}
+	}
+
+	record := AuditRecord{
+		Time:      c.now().UTC(),
+		Action:    "delete-repository",
+		Namespace: cand.Namespace,
+		PVC:       cand.PVC,
+		Objects:   cand.Objects,
+	}
+	if err != nil {
+		cand.Error = err.Error()
+		record.Error = err.Error()
+		c.logger.Error("failed to delete orphaned repository", "namespace", cand.Namespace, "pvc", cand.PVC, "objects", cand.Objects, "error", err)
+	} else {
+		cand.Deleted = true
+		c.logger.Warn("deleted orphaned repository", "namespace", cand.Namespace, "pvc", cand.PVC, "objects", cand.Objects)
+	}
+	c.writeAudit(record)
+
+	// Space out repositories as well as batches.
+	_ = c.sleep(ctx, c.opts.DeleteInterval)
+}
+
+// checkOrphaned returns an error unless cand's PVC is still absent.
+func (c *Cleaner) checkOrphaned(ctx context.Context, cand *Candidate) error {
+	exists, err := c.reporter.PVCExists(ctx, cand.Namespace, cand.PVC)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("PVC %s/%s exists again, deletion aborted", cand.Namespace, cand.PVC)
+	}
+	return nil
+}
+
+func (c *Cleaner) writeAudit(record AuditRecord) {
+	if c.audit == nil {
+		return
+	}
+	line, _ := json.Marshal(record)
+	if _, err := c.audit.Write(append(line, '\n')); err != nil {
+		c.logger.Error("failed to write audit log", "error", err)
+	}
+}
@@ -0,0 +1,365 @@
+package orphans
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/filesystem"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+	"github.com/mitchross/pvc-plumber/internal/protection"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+// resticRepo creates a restic layout under root whose single snapshot was
+// written at snapshotTime; a zero time creates no snapshot.
+func resticRepo(t *testing.T, root, name string, snapshotTime time.Time) {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	for _, d := range []string{"data", "index", "keys", "locks", "snapshots"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if snapshotTime.IsZero() {
+		return
+	}
+	snap := filepath.Join(dir, "snapshots", "0123abcd")
+	if err := os.WriteFile(snap, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(snap, snapshotTime, snapshotTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type fakeDeleter struct {
+	objects map[string][]string
+	batches [][]string
+	fail    bool
+	// deleted, when set, is called after each successful batch.
+	deleted func()
+}
+
+func (d *fakeDeleter) ListRepositoryObjects(_ context.Context, namespace, pvc string) ([]string, error) {
+	return d.objects[namespace+"/"+pvc], nil
+}
+
+func (d *fakeDeleter) DeleteObjects(_ context.Context, keys []string) error {
+	if d.fail {
+		return fmt.Errorf("access denied")
+	}
+	d.batches = append(d.batches, keys)
+	if d.deleted != nil {
+		d.deleted()
+	}
+	return nil
+}
+
+func newCleaner(t *testing.T, deleter Deleter, opts Options, audit io.Writer) (*Cleaner, *[]time.Duration) {
+	t.Helper()
+	return newCleanerWithServer(t, kubetest.NewServer(), deleter, opts, audit)
+}
+
+// newCleanerWithServer is newCleaner backed by server.
+func newCleanerWithServer(t *testing.T, server *kubetest.Server, deleter Deleter, opts Options, audit io.Writer) (*Cleaner, *[]time.Duration) {
+	t.Helper()
+	t.Cleanup(server.Close)
+	server.AddPVC(kube.PersistentVolumeClaim{
+		Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "data-pvc"},
+		Status:   kube.PersistentVolumeClaimStatus{Phase: "Bound"},
+	})
+	// keep/db looks like the backup of this claim after a namespace rename.
+	server.AddPVC(kube.PersistentVolumeClaim{
+		Metadata: kube.ObjectMeta{Namespace: "renamed", Name: "db"},
+		Status:   kube.PersistentVolumeClaimStatus{Phase: "Bound"},
+	})
+
+	root := t.TempDir()
+	resticRepo(t, root, "karakeep/data-pvc", now.Add(-24*time.Hour))
+	resticRepo(t, root, "gone/cache", now.Add(-60*24*time.Hour))
+	resticRepo(t, root, "gone/recent", now.Add(-2*time.Hour))
+	resticRepo(t, root, "gone/empty", time.Time{})
+	resticRepo(t, root, "keep/db", now.Add(-60*24*time.Hour))
+	if err := os.MkdirAll(filepath.Join(root, "gone", "notes"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	source := filesystem.New(root)
+	c := New(protection.NewReporter(server.Client(), source), source, deleter, opts, audit,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.now = func() time.Time { return now }
+	var sleeps []time.Duration
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return c, &sleeps
+}
+
+// writeState saves first-seen times, keyed by namespace/pvc, to a new
+// state file and returns its path.
+func writeState(t *testing.T, firstSeen map[string]time.Time) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "orphans.json")
+	if err := saveState(name, firstSeen); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestFind(t *testing.T) {
+	state := writeState(t, map[string]time.Time{
+		"gone/cache":  now.Add(-800 * time.Hour),
+		"gone/recent": now.Add(-2 * time.Hour),
+		"keep/db":     now.Add(-800 * time.Hour),
+	})
+	c, _ := newCleaner(t, nil, Options{GracePeriod: 720 * time.Hour, Rules: []string{"gone/*", "keep/*"}, StateFile: state}, nil)
+
+	result, err := c.Find(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if !result.DryRun {
+		t.Error("DryRun = false, want true")
+	}
+
+	want := map[string]string{
+		"gone/cache":  "",
+		"gone/empty":  "repository has no snapshots",
+		"gone/notes":  "not a restic repository",
+		"gone/recent": "grace period",
+		"keep/db":     "likely backup of PVC renamed/db",
+	}
+	if len(result.Candidates) != len(want) {
+		t.Fatalf("Candidates = %+v, want %d", result.Candidates, len(want))
+	}
+	for _, cand := range result.Candidates {
+		name := cand.Namespace + "/" + cand.PVC
+		reason, ok := want[name]
+		if !ok {
+			t.Errorf("unexpected candidate %s", name)
+			continue
+		}
+		if cand.Eligible != (reason == "") {
+			t.Errorf("%s: Eligible = %v, reason %q", name, cand.Eligible, cand.Reason)
+		}
+		if !strings.Contains(cand.Reason, reason) {
+			t.Errorf("%s: Reason = %q, want %q", name, cand.Reason, reason)
+		}
+	}
+
+	// Find only reads the state; unrecorded orphans are never eligible.
+	c, _ = newCleaner(t, nil, Options{GracePeriod: 720 * time.Hour, Rules: []string{"*/*"}}, nil)
+	result, err = c.Find(context.Background(), "gone")
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	for _, cand := range result.Candidates {
+		if cand.Eligible || cand.OrphanedSince != nil {
+			t.Errorf("unrecorded candidate = %+v, want ineligible", cand)
+		}
+	}
+	if c.firstSeen == nil || len(c.firstSeen) != 0 {
+		t.Errorf("firstSeen = %v, want empty", c.firstSeen)
+	}
+}
+
+func TestClean_RecordsOrphans(t *testing.T) {
+	state := writeState(t, map[string]time.Time{
+		"gone/cache":        now.Add(-800 * time.Hour),
+		"karakeep/data-pvc": now.Add(-800 * time.Hour),
+	})
+	c, _ := newCleaner(t, nil, Options{GracePeriod: 720 * time.Hour, StateFile: state}, nil)
+	if _, err := c.Clean(context.Background()); err != nil {
+		t.Fatalf("Clean() error = %v", err)
+	}
+
+	saved, err := loadState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Existing records keep their time, new orphans start now, and
+	// repositories with a PVC again are forgotten.
+	want := map[string]time.Time{
+		"gone/cache":  now.Add(-800 * time.Hour),
+		"gone/empty":  now,
+		"gone/notes":  now,
+		"gone/recent": now,
+		"keep/db":     now,
+	}
+	if len(saved) != len(want) {
+		t.Fatalf("state = %v, want %v", saved, want)
+	}
+	for key, ts := range want {
+		if !saved[key].Equal(ts) {
+			t.Errorf("state[%s] = %v, want %v", key, saved[key], ts)
+		}
+	}
+
+	// Nothing is deleted when the state cannot be saved.
+	deleter := &fakeDeleter{objects: map[string][]string{"gone/cache": {"gone/cache/config"}}}
+	opts := Options{Rules: []string{"*/*"}, Delete: true, StateFile: filepath.Join(t.TempDir(), "missing", "orphans.json")}
+	c, _ = newCleaner(t, deleter, opts, io.Discard)
+	if _, err := c.Clean(context.Background()); err == nil || len(deleter.batches) != 0 {
+		t.Errorf("Clean() error = %v, batches = %v, want an error and no deletions", err, deleter.batches)
+	}
+}
+
+func TestClean_DryRun(t *testing.T) {
+	deleter := &fakeDeleter{objects: map[string][]string{"gone/cache": {"gone/cache/config"}}}
+	var audit bytes.Buffer
+	c, _ := newCleaner(t, deleter, Options{GracePeriod: 720 * time.Hour, Rules: []string{"*/*"}}, &audit)
+
+	result, err := c.Clean(context.Background())
+	if err != nil {
+		t.Fatalf("Clean() error = %v", err)
+	}
+	if !result.DryRun || len(deleter.batches) != 0 || audit.Len() != 0 {
+		t.Errorf("dry run deleted: batches = %v, audit = %q", deleter.batches, audit.String())
+	}
+	if c.Last() != result {
+		t.Error("Last() did not return the latest result")
+	}
+}
+
+func TestClean_Delete(t *testing.T) {
+	keys := make([]string, BatchSize+5)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("gone/cache/data/%04d", i)
+	}
+	deleter := &fakeDeleter{objects: map[string][]string{"gone/cache": keys}}
+	var audit bytes.Buffer
+	opts := Options{
+		GracePeriod:     720 * time.Hour,
+		Rules:           []string{"gone/*", "keep/*"},
+		Delete:          true,
+		DeleteInterval:  time.Second,
+		MaxRepositories: 1,
+		StateFile:       filepath.Join(t.TempDir(), "orphans.json"),
+	}
+
+	// The first run only starts the grace period, however old the
+	// snapshots are.
+	c, _ := newCleaner(t, deleter, opts, &audit)
+	result, err := c.Clean(context.Background())
+	if err != nil {
+		t.Fatalf("Clean() error = %v", err)
+	}
+	for _, cand := range result.Candidates {
+		if cand.Eligible {
+			t.Errorf("first run: %s/%s is eligible", cand.Namespace, cand.PVC)
+		}
+	}
+	if len(deleter.batches) != 0 || audit.Len() != 0 {
+		t.Fatalf("first run deleted: batches = %d, audit = %q", len(deleter.batches), audit.String())
+	}
+
+	// After a restart past the grace period, the saved state applies.
+	c, sleeps := newCleaner(t, deleter, opts, &audit)
+	c.now = func() time.Time { return now.Add(721 * time.Hour) }
+	result, err = c.Clean(context.Background())
+	if err != nil {
+		t.Fatalf("Clean() error = %v", err)
+	}
+	if result.DryRun {
+		t.Error("DryRun = true, want false")
+	}
+	if len(deleter.batches) != 2 || len(deleter.batches[0]) != BatchSize || len(deleter.batches[1]) != 5 {
+		t.Errorf("batch sizes = %d, want [%d 5]", len(deleter.batches), BatchSize)
+	}
+	if len(*sleeps) != 2 {
+		t.Errorf("sleeps = %v, want one between batches and one after the repository", *sleeps)
+	}
+
+	deleted := 0
+	for _, cand := range result.Candidates {
+		if cand.Deleted {
+			deleted++
+			if cand.Namespace != "gone" || cand.PVC != "cache" || cand.Objects != len(keys) {
+				t.Errorf("deleted %+v, want gone/cache with %d objects", cand, len(keys))
+			}
+		}
+	}
+	if deleted != 1 {
+		t.Errorf("deleted %d repositories, want 1 (MaxRepositories)", deleted)
+	}
+
+	var record AuditRecord
+	if err := json.Unmarshal(audit.Bytes(), &record); err != nil {
+		t.Fatalf("audit log %q: %v", audit.String(), err)
+	}
+	if record.Action != "delete-repository" || record.Namespace != "gone" || record.PVC != "cache" || record.Objects != len(keys) || record.Error != "" {
+		t.Errorf("audit record = %+v", record)
+	}
+}
+
+func TestClean_DeleteError(t *testing.T) {
+	deleter := &fakeDeleter{objects: map[string][]string{"gone/cache": {"gone/cache/config"}}, fail: true}
+	var audit bytes.Buffer
+	state := writeState(t, map[string]time.Time{"gone/cache": now.Add(-800 * time.Hour)})
+	opts := Options{GracePeriod: 720 * time.Hour, Rules: []string{"gone/cache"}, Delete: true, StateFile: state}
+	c, _ := newCleaner(t, deleter, opts, &audit)
+
+	result, err := c.Clean(context.Background())
+	if err != nil {
+		t.Fatalf("Clean() error = %v", err)
+	}
+	for _, cand := range result.Candidates {
+		if cand.PVC == "cache" && (cand.Deleted || cand.Error == "") {
+			t.Errorf("candidate = %+v, want error", cand)
+		}
+	}
+	if !strings.Contains(audit.String(), `"error":"access denied"`) {
+		t.Errorf("audit log = %q, want error recorded", audit.String())
+	}
+}
+
+func TestClean_DeleteAbortsWhenPVCReturns(t *testing.T) {
+	keys := make([]string, 2*BatchSize)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("gone/cache/data/%04d", i)
+	}
+	server := kubetest.NewServer()
+	deleter := &fakeDeleter{objects: map[string][]string{"gone/cache": keys}}
+	// The claim is recreated while the first batch is being deleted.
+	deleter.deleted = func() {
+		server.AddPVC(kube.PersistentVolumeClaim{
+			Metadata: kube.ObjectMeta{Namespace: "gone", Name: "cache"},
+			Status:   kube.PersistentVolumeClaimStatus{Phase: "Pending"},
+		})
+	}
+	var audit bytes.Buffer
+	state := writeState(t, map[string]time.Time{"gone/cache": now.Add(-800 * time.Hour)})
+	opts := Options{GracePeriod: 720 * time.Hour, Rules: []string{"gone/cache"}, Delete: true, StateFile: state}
+	c, _ := newCleanerWithServer(t, server, deleter, opts, &audit)
+
+	result, err := c.Clean(context.Background())
+	if err != nil {
+		t.Fatalf("Clean() error = %v", err)
+	}
+	if len(deleter.batches) != 1 {
+		t.Errorf("batches = %d, want 1", len(deleter.batches))
+	}
+	for _, cand := range result.Candidates {
+		if cand.PVC == "cache" && (cand.Deleted || cand.Objects != BatchSize || !strings.Contains(cand.Error, "exists again")) {
+			t.Errorf("candidate = %+v, want aborted after one batch", cand)
+		}
+	}
+	if !strings.Contains(audit.String(), "exists again") {
+		t.Errorf("audit log = %q, want abort recorded", audit.String())
+	}
+}
@@ -0,0 +1,55 @@
+package orphans
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// loadState reads the first-seen times saved by saveState. A missing file
+// is an empty state.
+func loadState(name string) (map[string]time.Time, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read orphan state: %w", err)
+	}
+	var firstSeen map[string]time.Time
+	if err := json.Unmarshal(data, &firstSeen); err != nil {
+		return nil, fmt.Errorf("failed to decode orphan state %s: %w", name, err)
+	}
+	if firstSeen == nil {
+		firstSeen = map[string]time.Time{}
+	}
+	return firstSeen, nil
+}
+
+// saveState replaces the state file atomically, so that a crash never
+// leaves a truncated file that would restart every grace period.
+func saveState(name string, firstSeen map[string]time.Time) error {
+	data, err := json.MarshalIndent(firstSeen, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to save orphan state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save orphan state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save orphan state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to save orphan state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+// Package otlp exports spans to an OpenTelemetry collector using OTLP/HTTP
+// with the JSON encoding, which needs nothing beyond the standard library.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// Options configures an Exporter. Zero values select the defaults.
+type Options struct {
+	ServiceName string
+	// BatchSize is the number of spans that triggers an export.
+	BatchSize int
+	// Interval is the longest a span waits before it is exported.
+	Interval time.Duration
+	// QueueSize bounds the spans held in memory; further spans are dropped.
+	QueueSize int
+}
+
+// Exporter batches spans and posts them to {endpoint}/v1/traces.
+type Exporter struct {
+	url        string
+	opts       Options
+	httpClient *http.Client
+	logger     *slog.Logger
+
+	mu      sync.Mutex
+	queue   []trace.SpanData
+	full    chan struct{}
+	dropped atomic.Int64
+	sent    atomic.Int64
+}
+
+// New returns an Exporter for the OTLP/HTTP base endpoint, e.g.
+// http://tempo:4318.
+func New(endpoint string, opts Options, httpClient *http.Client, logger *slog.Logger) *Exporter {
+	if opts.ServiceName == "" {
+		opts.ServiceName = "pvc-plumber"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.QueueSize < opts.BatchSize {
+		opts.QueueSize = 4 * opts.BatchSize
+	}
+	return &Exporter{
+		url:        strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		opts:       opts,
+		httpClient: httpClient,
+		logger:     logger,
+		full:       make(chan struct{}, 1),
+	}
+}
+
+// Export queues a span without blocking.
+func (e *Exporter) Export(span trace.SpanData) {
+	e.mu.Lock()
+	if len(e.queue) >= e.opts.QueueSize {
+		e.mu.Unlock()
+		e.dropped.Add(1)
+		return
+	}
+	e.queue = append(e.queue, span)
+	n := len(e.queue)
+	e.mu.Unlock()
+
+	if n >= e.opts.BatchSize {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run exports queued spans every Interval, or sooner when a batch fills,
+// until ctx is canceled. Exports in flight are not interrupted by the
+// cancellation, and spans still queued then are flushed with a short
+// timeout.
+func (e *Exporter) Run(ctx context.Context) {
+	sendCtx := context.WithoutCancel(ctx)
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(sendCtx, 5*time.Second)
+			defer cancel()
+			if err := e.Flush(flushCtx); err != nil {
+				e.logger.Warn("failed to flush spans", "error", err)
+			}
+			return
+		case <-ticker.C:
+		case <-e.full:
+		}
+		if err := e.Flush(sendCtx); err != nil {
+			e.logger.Warn("failed to export spans", "error", err)
+		}
+	}
+}
+
+// Flush exports every queued span in batches of BatchSize. Spans of a
+// failed batch are dropped rather than retried.
+func (e *Exporter) Flush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		n := min(len(e.queue), e.opts.BatchSize)
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		e.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		if err := e.send(ctx, batch); err != nil {
+			e.dropped.Add(int64(n))
+			return err
+		}
+		e.sent.Add(int64(n))
+	}
+}
+
+// WriteMetrics writes the exporter counters in Prometheus text format.
+func (e *Exporter) WriteMetrics(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_trace_spans_exported_total Spans sent to the OTLP collector\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_trace_spans_exported_total counter\n")
+	_, _ = fmt.Fprintf(w, "pvc_plumber_trace_spans_exported_total %d\n", e.sent.Load())
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_trace_spans_dropped_total Spans dropped because the queue was full or export failed\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_trace_spans_dropped_total counter\n")
+	_, _ = fmt.Fprintf(w, "pvc_plumber_trace_spans_dropped_total %d\n", e.dropped.Load())
+}
+
+func (e *Exporter) send(ctx context.Context, batch []trace.SpanData) error {
+	payload, err := json.Marshal(e.request(batch))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// The types below are the subset of the OTLP ExportTraceServiceRequest
+// JSON mapping that pvc-plumber produces. IDs are hex and 64-bit integers
+// are strings, as the mapping requires.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+// Status codes of the OTLP Status message. Spans that did not fail are
+// left unset rather than OK, which would override the status a collector
+// derives for them.
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *Exporter) request(batch []trace.SpanData) exportRequest {
+	spans := make([]span, 0, len(batch))
+	for _, s := range batch {
+		out := span{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        attributes(s.Attributes),
+			Status:            status{Code: statusUnset},
+		}
+		if s.Error != "" {
+			out.Status = status{Code: statusError, Message: s.Error}
+		}
+		spans = append(spans, out)
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: attributes(map[string]any{"service.name": e.opts.ServiceName})},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "github.com/mitchross/pvc-plumber"}, Spans: spans}},
+	}}}
+}
+
+// attributes converts attrs, sorted by key for stable output.
+func attributes(attrs map[string]any) []keyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	kvs := make([]keyValue, 0, len(attrs))
+	for _, k := range keys {
+		var v anyValue
+		switch value := attrs[k].(type) {
+		case string:
+			v.StringValue = &value
+		case bool:
+			v.BoolValue = &value
+		case int:
+			i := strconv.Itoa(value)
+			v.IntValue = &i
+		case int64:
+			i := strconv.FormatInt(value, 10)
+			v.IntValue = &i
+		case float64:
+			v.DoubleValue = &value
+		default:
+			str := fmt.Sprint(value)
+			v.StringValue = &str
+		}
+		kvs = append(kvs, keyValue{Key: k, Value: v})
+	}
+	return kvs
+}
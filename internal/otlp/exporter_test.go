@@ -0,0 +1,181 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// collector is an httptest stand-in for an OTLP/HTTP receiver.
+type collector struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []map[string]any
+	status   int
+	received chan struct{}
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{status: http.StatusOK, received: make(chan struct{}, 16)}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s (%s)", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid JSON: %v", err)
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, body)
+		status := c.status
+		c.mu.Unlock()
+		w.WriteHeader(status)
+		c.received <- struct{}{}
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// spans returns the spans of request i.
+func (c *collector) spans(i int) []any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rs := c.requests[i]["resourceSpans"].([]any)[0].(map[string]any)
+	return rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+}
+
+func newExporter(c *collector, opts Options) *Exporter {
+	return New(c.URL+"/", opts, c.Client(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func spanData(name string) trace.SpanData {
+	start := time.Unix(1760788800, 5)
+	return trace.SpanData{
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:     "00f067aa0ba902b7",
+		ParentID:   "b7ad6b7169203331",
+		Name:       name,
+		Kind:       trace.KindClient,
+		Start:      start,
+		End:        start.Add(time.Millisecond),
+		Attributes: map[string]any{"pvc": "data-pvc", "s3.key_count": 4, "exists": true},
+	}
+}
+
+func TestFlush_Encoding(t *testing.T) {
+	c := newCollector(t)
+	e := newExporter(c, Options{ServiceName: "plumber-test"})
+
+	failed := spanData("s3.ListObjectsV2")
+	failed.Error = "S3 returned status 503"
+	e.Export(spanData("check-backup"))
+	e.Export(failed)
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	c.mu.Lock()
+	resource := c.requests[0]["resourceSpans"].([]any)[0].(map[string]any)["resource"].(map[string]any)
+	c.mu.Unlock()
+	attr := resource["attributes"].([]any)[0].(map[string]any)
+	if attr["key"] != "service.name" || attr["value"].(map[string]any)["stringValue"] != "plumber-test" {
+		t.Errorf("resource attributes = %v", resource)
+	}
+
+	spans := c.spans(0)
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+	s := spans[0].(map[string]any)
+	want := map[string]any{
+		"traceId":           "4bf92f3577b34da6a3ce929d0e0e4736",
+		"spanId":            "00f067aa0ba902b7",
+		"parentSpanId":      "b7ad6b7169203331",
+		"name":              "check-backup",
+		"kind":              float64(3),
+		"startTimeUnixNano": "1760788800000000005",
+		"endTimeUnixNano":   "1760788800001000005",
+	}
+	for k, v := range want {
+		if s[k] != v {
+			t.Errorf("span[%s] = %v, want %v", k, s[k], v)
+		}
+	}
+	attrs, _ := json.Marshal(s["attributes"])
+	if got := string(attrs); got != `[{"key":"exists","value":{"boolValue":true}},{"key":"pvc","value":{"stringValue":"data-pvc"}},{"key":"s3.key_count","value":{"intValue":"4"}}]` {
+		t.Errorf("attributes = %s", got)
+	}
+	if status := s["status"].(map[string]any); status["code"] != float64(statusUnset) {
+		t.Errorf("status = %v, want unset", status)
+	}
+	if status := spans[1].(map[string]any)["status"].(map[string]any); status["code"] != float64(statusError) || status["message"] != "S3 returned status 503" {
+		t.Errorf("status = %v, want error", status)
+	}
+}
+
+func TestRun_Batches(t *testing.T) {
+	c := newCollector(t)
+	e := newExporter(c, Options{BatchSize: 2, Interval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx)
+	}()
+
+	e.Export(spanData("a"))
+	e.Export(spanData("b"))
+	select {
+	case <-c.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("full batch was not exported")
+	}
+
+	// A partial batch waits for the interval or shutdown.
+	e.Export(spanData("c"))
+	cancel()
+	<-done
+
+	c.mu.Lock()
+	n := len(c.requests)
+	c.mu.Unlock()
+	if n != 2 || len(c.spans(0)) != 2 || len(c.spans(1)) != 1 {
+		t.Errorf("requests = %d, want batches of 2 and 1", n)
+	}
+
+	var metrics strings.Builder
+	e.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), "pvc_plumber_trace_spans_exported_total 3") {
+		t.Errorf("metrics = %s", metrics.String())
+	}
+}
+
+func TestExport_Drops(t *testing.T) {
+	c := newCollector(t)
+	c.status = http.StatusServiceUnavailable
+	e := newExporter(c, Options{BatchSize: 2, QueueSize: 3})
+
+	for i := 0; i < 5; i++ {
+		e.Export(spanData("span"))
+	}
+	if err := e.Flush(context.Background()); err == nil {
+		t.Error("Flush() error = nil, want collector error")
+	}
+
+	var metrics strings.Builder
+	e.WriteMetrics(&metrics)
+	// Two spans did not fit the queue and the first batch of two failed.
+	if !strings.Contains(metrics.String(), "pvc_plumber_trace_spans_dropped_total 4") {
+		t.Errorf("metrics = %s", metrics.String())
+	}
+}
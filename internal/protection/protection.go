@@ -0,0 +1,155 @@
+// Package protection cross-checks the PVCs in a cluster against the
+// repositories in the backup backend.
+package protection
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+)
+
+// Reasons a PVC and a backup are reported as a likely name mismatch.
+const (
+	MismatchNamespace = "same PVC name in another namespace"
+	MismatchName      = "similar PVC name in the same namespace"
+)
+
+// Report lists PVCs without backups and backups without PVCs.
+type Report struct {
+	GeneratedAt  time.Time            `json:"generatedAt"`
+	Namespace    string               `json:"namespace,omitempty"`
+	PVCs         int                  `json:"pvcs"`
+	Repositories int                  `json:"repositories"`
+	Unprotected  []backend.Repository `json:"unprotected"`
+	Orphans      []backend.Repository `json:"orphans"`
+	Mismatches   []Mismatch           `json:"mismatches"`
+}
+
+// Mismatch pairs an unprotected PVC with an orphaned backup that is
+// probably its repository under a different name, for example after the
+// claim or its namespace was renamed.
+type Mismatch struct {
+	PVC    backend.Repository `json:"pvc"`
+	Backup backend.Repository `json:"backup"`
+	Reason string             `json:"reason"`
+}
+
+// Reporter builds Reports from the Kubernetes API and a backend inventory.
+type Reporter struct {
+	kube      *kube.Client
+	inventory backend.Inventory
+	now       func() time.Time
+}
+
+func NewReporter(kubeClient *kube.Client, inventory backend.Inventory) *Reporter {
+	return &Reporter{kube: kubeClient, inventory: inventory, now: time.Now}
+}
+
+// PVCExists reports whether the PVC namespace/name exists.
+func (r *Reporter) PVCExists(ctx context.Context, namespace, name string) (bool, error) {
+	_, err := r.kube.GetPVC(ctx, namespace, name)
+	switch {
+	case err == nil:
+		return true, nil
+	case kube.IsNotFound(err):
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to read PVC %s/%s: %w", namespace, name, err)
+	}
+}
+
+// Report compares the PVCs in namespace, or in all namespaces when it is
+// empty, with the repositories in the backend. Unprotected PVCs and
+// orphans remain listed when they also appear in a mismatch.
+func (r *Reporter) Report(ctx context.Context, namespace string) (*Report, error) {
+	list, err := r.kube.ListPVCs(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVCs: %w", err)
+	}
+	repos, err := r.inventory.ListRepositories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+
+	pvcs := make(map[backend.Repository]bool, len(list.Items))
+	for _, pvc := range list.Items {
+		pvcs[backend.Repository{Namespace: pvc.Metadata.Namespace, PVC: pvc.Metadata.Name}] = true
+	}
+	backups := make(map[backend.Repository]bool, len(repos))
+	for _, repo := range repos {
+		if namespace == "" || repo.Namespace == namespace {
+			backups[repo] = true
+		}
+	}
+
+	report := &Report{
+		GeneratedAt:  r.now().UTC(),
+		Namespace:    namespace,
+		PVCs:         len(pvcs),
+		Repositories: len(backups),
+		Unprotected:  []backend.Repository{},
+		Orphans:      []backend.Repository{},
+		Mismatches:   []Mismatch{},
+	}
+	for pvc := range pvcs {
+		if !backups[pvc] {
+			report.Unprotected = append(report.Unprotected, pvc)
+		}
+	}
+	for repo := range backups {
+		if !pvcs[repo] {
+			report.Orphans = append(report.Orphans, repo)
+		}
+	}
+	sortRepositories(report.Unprotected)
+	sortRepositories(report.Orphans)
+
+	for _, pvc := range report.Unprotected {
+		for _, orphan := range report.Orphans {
+			if reason := mismatch(pvc, orphan); reason != "" {
+				report.Mismatches = append(report.Mismatches, Mismatch{PVC: pvc, Backup: orphan, Reason: reason})
+			}
+		}
+	}
+	return report, nil
+}
+
+// mismatch returns why pvc and backup look like the same volume, or "".
+func mismatch(pvc, backup backend.Repository) string {
+	if pvc.Namespace != backup.Namespace {
+		if pvc.PVC == backup.PVC {
+			return MismatchNamespace
+		}
+		return ""
+	}
+	a, b := normalize(pvc.PVC), normalize(backup.PVC)
+	if a == b || strings.HasPrefix(pvc.PVC, backup.PVC+"-") || strings.HasPrefix(backup.PVC, pvc.PVC+"-") {
+		return MismatchName
+	}
+	return ""
+}
+
+// normalize folds case and drops separators, so data_pvc matches data-pvc.
+func normalize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', '.':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+func sortRepositories(repos []backend.Repository) {
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].Namespace != repos[j].Namespace {
+			return repos[i].Namespace < repos[j].Namespace
+		}
+		return repos[i].PVC < repos[j].PVC
+	})
+}
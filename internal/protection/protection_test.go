@@ -0,0 +1,121 @@
+package protection
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/filesystem"
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+)
+
+func pvc(namespace, name string) kube.PersistentVolumeClaim {
+	return kube.PersistentVolumeClaim{
+		Metadata: kube.ObjectMeta{Namespace: namespace, Name: name},
+		Status:   kube.PersistentVolumeClaimStatus{Phase: "Bound"},
+	}
+}
+
+func repo(namespace, name string) backend.Repository {
+	return backend.Repository{Namespace: namespace, PVC: name}
+}
+
+func newReporter(t *testing.T) *Reporter {
+	t.Helper()
+	server := kubetest.NewServer()
+	t.Cleanup(server.Close)
+	for _, p := range []kube.PersistentVolumeClaim{
+		pvc("karakeep", "data-pvc"),
+		pvc("karakeep", "meili"),
+		pvc("paperless", "media"),
+		pvc("paperless", "consume"),
+		pvc("immich-new", "library"),
+		pvc("scratch", "tmp"),
+	} {
+		server.AddPVC(p)
+	}
+
+	root := t.TempDir()
+	for _, dir := range []string{
+		"karakeep/data-pvc",
+		"karakeep/meili-data",
+		"paperless/media",
+		"paperless/Consume_",
+		"immich/library",
+		"gone/cache",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewReporter(server.Client(), filesystem.New(root))
+	r.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+	return r
+}
+
+func TestReport(t *testing.T) {
+	report, err := newReporter(t).Report(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+
+	if report.PVCs != 6 || report.Repositories != 6 {
+		t.Errorf("PVCs/Repositories = %d/%d, want 6/6", report.PVCs, report.Repositories)
+	}
+	wantUnprotected := []backend.Repository{
+		repo("immich-new", "library"),
+		repo("karakeep", "meili"),
+		repo("paperless", "consume"),
+		repo("scratch", "tmp"),
+	}
+	if !reflect.DeepEqual(report.Unprotected, wantUnprotected) {
+		t.Errorf("Unprotected = %v, want %v", report.Unprotected, wantUnprotected)
+	}
+	wantOrphans := []backend.Repository{
+		repo("gone", "cache"),
+		repo("immich", "library"),
+		repo("karakeep", "meili-data"),
+		repo("paperless", "Consume_"),
+	}
+	if !reflect.DeepEqual(report.Orphans, wantOrphans) {
+		t.Errorf("Orphans = %v, want %v", report.Orphans, wantOrphans)
+	}
+	wantMismatches := []Mismatch{
+		{PVC: repo("immich-new", "library"), Backup: repo("immich", "library"), Reason: MismatchNamespace},
+		{PVC: repo("karakeep", "meili"), Backup: repo("karakeep", "meili-data"), Reason: MismatchName},
+		{PVC: repo("paperless", "consume"), Backup: repo("paperless", "Consume_"), Reason: MismatchName},
+	}
+	if !reflect.DeepEqual(report.Mismatches, wantMismatches) {
+		t.Errorf("Mismatches = %v, want %v", report.Mismatches, wantMismatches)
+	}
+}
+
+func TestReport_Namespace(t *testing.T) {
+	report, err := newReporter(t).Report(context.Background(), "karakeep")
+	if err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+	if report.PVCs != 2 || report.Repositories != 2 {
+		t.Errorf("PVCs/Repositories = %d/%d, want 2/2", report.PVCs, report.Repositories)
+	}
+	if !reflect.DeepEqual(report.Unprotected, []backend.Repository{repo("karakeep", "meili")}) {
+		t.Errorf("Unprotected = %v", report.Unprotected)
+	}
+	if !reflect.DeepEqual(report.Orphans, []backend.Repository{repo("karakeep", "meili-data")}) {
+		t.Errorf("Orphans = %v", report.Orphans)
+	}
+}
+
+func TestReport_KubeError(t *testing.T) {
+	r := NewReporter(kube.NewClient("http://127.0.0.1:1", "", &http.Client{Timeout: time.Second}), filesystem.New(t.TempDir()))
+	if _, err := r.Report(context.Background(), ""); err == nil {
+		t.Error("Report() error = nil, want error")
+	}
+}
@@ -0,0 +1,318 @@
+// Package ratelimit protects the backend from misbehaving clients with
+// per-client token buckets and a global cap on concurrent lookups.
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// Client identities for Options.Key.
+const (
+	KeyIP             = "ip"
+	KeyToken          = "token"
+	KeyServiceAccount = "serviceaccount"
+)
+
+// Reasons a request was throttled, used as the metrics label.
+const (
+	reasonRateLimit    = "rate_limit"
+	reasonQueueFull    = "queue_full"
+	reasonQueueTimeout = "queue_timeout"
+)
+
+// Options configures a Guard. A zero Rate disables rate limiting and a
+// zero MaxConcurrent disables the concurrency cap.
+type Options struct {
+	// Rate is the sustained requests per second allowed per client.
+	Rate float64
+	// Burst is how many requests a client may make at once.
+	Burst int
+	// Key selects how clients are identified: KeyIP, KeyToken or
+	// KeyServiceAccount. Clients without a token fall back to their IP.
+	// Tokens are not verified, so KeyToken and KeyServiceAccount are only
+	// safe behind a proxy that authenticates them.
+	Key string
+
+	// MaxConcurrent caps lookups in flight across all clients.
+	MaxConcurrent int
+	// MaxQueue is how many lookups may wait for a slot; more are shed.
+	MaxQueue int
+	// QueueTimeout is how long a lookup may wait for a slot.
+	QueueTimeout time.Duration
+}
+
+// Guard holds the rate limiting and concurrency state.
+type Guard struct {
+	opts Options
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	slots     chan struct{}
+	waiting   atomic.Int64
+	inFlight  atomic.Int64
+	throttled map[string]*atomic.Int64 // by reason; read-only after New
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func New(opts Options) *Guard {
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	g := &Guard{
+		opts:    opts,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		throttled: map[string]*atomic.Int64{
+			reasonRateLimit:    new(atomic.Int64),
+			reasonQueueFull:    new(atomic.Int64),
+			reasonQueueTimeout: new(atomic.Int64),
+		},
+	}
+	if opts.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, opts.MaxConcurrent)
+	}
+	return g
+}
+
+// Limit applies the per-client rate limit to next.
+func (g *Guard) Limit(next http.Handler) http.Handler {
+	if g.opts.Rate <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retry := g.allow(ClientKey(r, g.opts.Key)); !ok {
+			g.reject(w, reasonRateLimit, retry, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Gate caps the number of concurrent calls of next, queueing up to
+// MaxQueue callers for at most QueueTimeout.
+func (g *Guard) Gate(next http.Handler) http.Handler {
+	if g.slots == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := g.acquire(r.Context())
+		switch {
+		case errors.Is(err, errQueueFull):
+			g.reject(w, reasonQueueFull, time.Second, "too many lookups in progress")
+			return
+		case errors.Is(err, errQueueTimeout):
+			g.reject(w, reasonQueueTimeout, time.Second, "timed out waiting for a lookup slot")
+			return
+		case err != nil:
+			// The client went away while queued.
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), slotKey{}, true)))
+	})
+}
+
+// slotKey marks the context of a request that Gate let through.
+type slotKey struct{}
+
+// Middleware caps the concurrent checks of next that do not come from a
+// request Gate already let through, so that the controller and the
+// background scans share MaxConcurrent with HTTP lookups. Such checks wait
+// for a slot until their context is done; they are never shed.
+func (g *Guard) Middleware(next backend.Backend) backend.Backend {
+	if g.slots == nil {
+		return next
+	}
+	return &gated{next: next, guard: g}
+}
+
+type gated struct {
+	next  backend.Backend
+	guard *Guard
+}
+
+func (b *gated) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	if ctx.Value(slotKey{}) != nil {
+		return b.next.CheckBackupExists(ctx, namespace, pvc)
+	}
+	select {
+	case b.guard.slots <- struct{}{}:
+	case <-ctx.Done():
+		return backend.Failure(ctx.Err())
+	}
+	b.guard.inFlight.Add(1)
+	defer func() {
+		b.guard.inFlight.Add(-1)
+		<-b.guard.slots
+	}()
+	return b.next.CheckBackupExists(ctx, namespace, pvc)
+}
+
+func (b *gated) Unwrap() backend.Backend { return b.next }
+
+// allow takes a token from key's bucket, or reports how long until one is
+// available.
+func (g *Guard) allow(key string) (bool, time.Duration) {
+	now := g.now()
+	burst := float64(g.opts.Burst)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sweep(now)
+
+	b, ok := g.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		g.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*g.opts.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / g.opts.Rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled, so idle clients do not
+// accumulate. It runs at most once a minute.
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+	full := time.Duration(float64(g.opts.Burst) / g.opts.Rate * float64(time.Second))
+	for key, b := range g.buckets {
+		if now.Sub(b.last) > full {
+			delete(g.buckets, key)
+		}
+	}
+}
+
+var (
+	errQueueFull    = errors.New("queue full")
+	errQueueTimeout = errors.New("queue timeout")
+)
+
+func (g *Guard) acquire(ctx context.Context) (func(), error) {
+	release := func() {
+		g.inFlight.Add(-1)
+		<-g.slots
+	}
+	select {
+	case g.slots <- struct{}{}:
+		g.inFlight.Add(1)
+		return release, nil
+	default:
+	}
+
+	if g.waiting.Add(1) > int64(g.opts.MaxQueue) {
+		g.waiting.Add(-1)
+		return nil, errQueueFull
+	}
+	defer g.waiting.Add(-1)
+
+	timer := time.NewTimer(g.opts.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case g.slots <- struct{}{}:
+		g.inFlight.Add(1)
+		return release, nil
+	case <-timer.C:
+		return nil, errQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *Guard) reject(w http.ResponseWriter, reason string, retry time.Duration, message string) {
+	g.throttled[reason].Add(1)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": message})
+}
+
+// WriteMetrics writes the throttling counters and lookup gauges in
+// Prometheus text format.
+func (g *Guard) WriteMetrics(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_throttled_requests_total Requests rejected with 429 by reason\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_throttled_requests_total counter\n")
+	for _, reason := range []string{reasonRateLimit, reasonQueueFull, reasonQueueTimeout} {
+		_, _ = fmt.Fprintf(w, "pvc_plumber_throttled_requests_total{reason=%q} %d\n", reason, g.throttled[reason].Load())
+	}
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_lookups_in_flight Backend lookups in progress\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_lookups_in_flight gauge\n")
+	_, _ = fmt.Fprintf(w, "pvc_plumber_lookups_in_flight %d\n", g.inFlight.Load())
+	_, _ = fmt.Fprintf(w, "# HELP pvc_plumber_lookups_queued Backend lookups waiting for a slot\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pvc_plumber_lookups_queued gauge\n")
+	_, _ = fmt.Fprintf(w, "pvc_plumber_lookups_queued %d\n", g.waiting.Load())
+}
+
+// ClientKey identifies the client of r. Tokens are hashed so that they are
+// never held in memory; ServiceAccount names are read from the "sub" claim.
+// Neither is verified: a client can pick any identity, and so any number of
+// buckets, unless a proxy in front of the service authenticates tokens.
+func ClientKey(r *http.Request, mode string) string {
+	if mode == KeyToken || mode == KeyServiceAccount {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+			if mode == KeyServiceAccount {
+				if sa := serviceAccount(token); sa != "" {
+					return "sa:" + sa
+				}
+			}
+			sum := sha256.Sum256([]byte(token))
+			return "token:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// serviceAccount returns the "system:serviceaccount:{ns}:{name}" subject of
+// a Kubernetes ServiceAccount JWT, or "" for other tokens.
+func serviceAccount(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || !strings.HasPrefix(claims.Sub, "system:serviceaccount:") {
+		return ""
+	}
+	return claims.Sub
+}
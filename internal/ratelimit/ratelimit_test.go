@@ -0,0 +1,269 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func request(remoteAddr, token string) *http.Request {
+	r := httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil)
+	r.RemoteAddr = remoteAddr
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestLimit(t *testing.T) {
+	g := New(Options{Rate: 2, Burst: 3, Key: KeyIP})
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	h := g.Limit(ok)
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request(addr, ""))
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := serve("10.0.0.1:5000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within burst: status %d", i, w.Code)
+		}
+	}
+	w := serve("10.0.0.1:5001")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("over burst: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), "rate limit exceeded") {
+		t.Errorf("body = %s", w.Body.String())
+	}
+
+	// Other clients have their own bucket.
+	if w := serve("10.0.0.2:5000"); w.Code != http.StatusOK {
+		t.Errorf("other client: status %d", w.Code)
+	}
+
+	// Tokens refill at Rate per second.
+	now = now.Add(500 * time.Millisecond)
+	if w := serve("10.0.0.1:5000"); w.Code != http.StatusOK {
+		t.Errorf("after refill: status %d", w.Code)
+	}
+	if w := serve("10.0.0.1:5000"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("after refill spent: status %d", w.Code)
+	}
+
+	// Idle buckets are swept once they would have refilled.
+	now = now.Add(2 * time.Minute)
+	serve("10.0.0.3:5000")
+	if len(g.buckets) != 1 {
+		t.Errorf("buckets after sweep = %d, want 1", len(g.buckets))
+	}
+
+	var metrics strings.Builder
+	g.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `pvc_plumber_throttled_requests_total{reason="rate_limit"} 2`) {
+		t.Errorf("metrics = %s", metrics.String())
+	}
+}
+
+func TestLimit_Disabled(t *testing.T) {
+	g := New(Options{})
+	h := g.Limit(ok)
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request("10.0.0.1:5000", ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d with rate limiting disabled", w.Code)
+		}
+	}
+}
+
+func jwt(sub string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"RS256"}`)) + "." + enc([]byte(`{"sub":"`+sub+`"}`)) + ".sig"
+}
+
+func TestClientKey(t *testing.T) {
+	kyverno := jwt("system:serviceaccount:kyverno:kyverno-admission-controller")
+	tests := []struct {
+		name  string
+		mode  string
+		addr  string
+		token string
+		want  string
+	}{
+		{name: "ip", mode: KeyIP, addr: "10.0.0.1:5000", token: kyverno, want: "ip:10.0.0.1"},
+		{name: "ipv6", mode: KeyIP, addr: "[fd00::1]:5000", want: "ip:fd00::1"},
+		{name: "serviceaccount", mode: KeyServiceAccount, addr: "10.0.0.1:5000", token: kyverno, want: "sa:system:serviceaccount:kyverno:kyverno-admission-controller"},
+		{name: "serviceaccount from opaque token", mode: KeyServiceAccount, addr: "10.0.0.1:5000", token: "opaque", want: "token:"},
+		{name: "user token is not a serviceaccount", mode: KeyServiceAccount, addr: "10.0.0.1:5000", token: jwt("alice"), want: "token:"},
+		{name: "token", mode: KeyToken, addr: "10.0.0.1:5000", token: kyverno, want: "token:"},
+		{name: "no token falls back to ip", mode: KeyToken, addr: "10.0.0.1:5000", want: "ip:10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClientKey(request(tt.addr, tt.token), tt.mode)
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("ClientKey() = %q, want prefix %q", got, tt.want)
+			}
+			if tt.token != "" && strings.Contains(got, tt.token) {
+				t.Errorf("ClientKey() = %q contains the raw token", got)
+			}
+		})
+	}
+	if a, b := ClientKey(request("", "one"), KeyToken), ClientKey(request("", "two"), KeyToken); a == b {
+		t.Errorf("different tokens share key %q", a)
+	}
+}
+
+func TestGate(t *testing.T) {
+	g := New(Options{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 50 * time.Millisecond})
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	slow := g.Gate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+	}))
+
+	// The first request takes the only slot.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slow.ServeHTTP(httptest.NewRecorder(), request("10.0.0.1:5000", ""))
+	}()
+	<-started
+
+	// The second waits in the queue and times out; while it waits, a third
+	// finds the queue full.
+	queued := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		slow.ServeHTTP(w, request("10.0.0.2:5000", ""))
+		queued <- w
+	}()
+	for g.waiting.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	w := httptest.NewRecorder()
+	slow.ServeHTTP(w, request("10.0.0.3:5000", ""))
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "too many lookups") {
+		t.Errorf("queue full: status %d, body %s", w.Code, w.Body.String())
+	}
+	if w := <-queued; w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("queue timeout: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	var metrics strings.Builder
+	g.WriteMetrics(&metrics)
+	for _, want := range []string{
+		`pvc_plumber_throttled_requests_total{reason="queue_full"} 1`,
+		`pvc_plumber_throttled_requests_total{reason="queue_timeout"} 1`,
+		"pvc_plumber_lookups_in_flight 1",
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, metrics.String())
+		}
+	}
+
+	close(unblock)
+	wg.Wait()
+	if g.inFlight.Load() != 0 || len(g.slots) != 0 {
+		t.Errorf("slot not released: inFlight %d", g.inFlight.Load())
+	}
+}
+
+func TestGate_QueuedRequestProceeds(t *testing.T) {
+	g := New(Options{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 5 * time.Second})
+	release, err := g.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		r, err := g.acquire(context.Background())
+		if err == nil {
+			r()
+		}
+		done <- err
+	}()
+	for g.waiting.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Errorf("queued acquire error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hold, _ := g.acquire(context.Background())
+	defer hold()
+	if _, err := g.acquire(ctx); err != context.Canceled {
+		t.Errorf("acquire with canceled context error = %v", err)
+	}
+}
+
+// countingBackend reports a backup for every PVC and counts the checks.
+type countingBackend struct{ calls atomic.Int32 }
+
+func (b *countingBackend) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	b.calls.Add(1)
+	return backend.CheckResult{Exists: true}
+}
+
+func TestMiddleware(t *testing.T) {
+	g := New(Options{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: time.Millisecond})
+	fake := &countingBackend{}
+	b := g.Middleware(fake)
+
+	// A request holding the only slot checks without taking another.
+	g.Gate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if result := b.CheckBackupExists(r.Context(), "karakeep", "data-pvc"); !result.Exists {
+			t.Errorf("check inside Gate = %+v", result)
+		}
+	})).ServeHTTP(httptest.NewRecorder(), request("10.0.0.1:5000", ""))
+
+	hold, err := g.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Background checks wait for a slot, well past QueueTimeout.
+	done := make(chan bool)
+	go func() {
+		done <- b.CheckBackupExists(context.Background(), "karakeep", "data-pvc").Exists
+	}()
+	select {
+	case <-done:
+		t.Fatal("background check ran while the only slot was taken")
+	case <-time.After(20 * time.Millisecond):
+	}
+	hold()
+	if exists := <-done; !exists {
+		t.Error("background check did not proceed once the slot was free")
+	}
+	if calls := fake.calls.Load(); calls != 2 {
+		t.Errorf("backend calls = %d, want 2", calls)
+	}
+
+	hold, _ = g.acquire(context.Background())
+	defer hold()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := b.CheckBackupExists(ctx, "karakeep", "data-pvc"); result.Error == "" {
+		t.Errorf("check with a canceled context = %+v, want an error", result)
+	}
+}
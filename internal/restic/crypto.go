@@ -0,0 +1,83 @@
+package restic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+
+	"golang.org/x/crypto/poly1305"
+)
+
+const (
+	ivSize  = 16
+	macSize = 16
+)
+
+var ErrUnauthenticated = errors.New("ciphertext verification failed")
+
+// Key is a restic encryption key: AES-256-CTR for confidentiality and
+// Poly1305-AES for authentication.
+type Key struct {
+	MAC struct {
+		K []byte `json:"k"`
+		R []byte `json:"r"`
+	} `json:"mac"`
+	Encrypt []byte `json:"encrypt"`
+}
+
+// keyFromBytes splits 64 bytes of derived key material the way restic does:
+// 32 bytes of AES key, then the 16-byte AES and Poly1305 parts of the MAC key.
+func keyFromBytes(b []byte) *Key {
+	k := &Key{Encrypt: b[:32]}
+	k.MAC.K = b[32:48]
+	k.MAC.R = b[48:64]
+	return k
+}
+
+func (k *Key) valid() bool {
+	return len(k.Encrypt) == 32 && len(k.MAC.K) == 16 && len(k.MAC.R) == 16
+}
+
+// Open verifies and decrypts data laid out as IV || ciphertext || MAC.
+func (k *Key) Open(data []byte) ([]byte, error) {
+	if !k.valid() {
+		return nil, errors.New("invalid key")
+	}
+	if len(data) < ivSize+macSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	iv := data[:ivSize]
+	ciphertext := data[ivSize : len(data)-macSize]
+	mac := data[len(data)-macSize:]
+
+	ok, err := k.verifyMAC(ciphertext, iv, mac)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	block, err := aes.NewCipher(k.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
+
+// verifyMAC checks the Poly1305-AES tag of msg: the one-time key is r
+// from the MAC key and s = AES-128_k(nonce).
+func (k *Key) verifyMAC(msg, nonce, tag []byte) (bool, error) {
+	block, err := aes.NewCipher(k.MAC.K)
+	if err != nil {
+		return false, err
+	}
+	var key [32]byte
+	copy(key[:16], k.MAC.R)
+	block.Encrypt(key[16:], nonce)
+	var mac [macSize]byte
+	copy(mac[:], tag)
+	return poly1305.Verify(&mac, msg, &key), nil
+}
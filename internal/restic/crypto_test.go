@@ -0,0 +1,35 @@
+package restic
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestKeyOpen_Tampered(t *testing.T) {
+	key := keyFromBytes(bytes.Repeat([]byte{7}, 64))
+	data := make([]byte, ivSize+10+macSize)
+
+	if _, err := key.Open(data); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Open() error = %v, want ErrUnauthenticated", err)
+	}
+	if _, err := key.Open(data[:20]); err == nil {
+		t.Error("expected error for short ciphertext")
+	}
+}
+
+func TestUnlockKey_ScryptBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"N is not a power of two", `{"kdf":"scrypt","N":1000,"r":8,"p":1}`},
+		{"more than 256 MiB", `{"kdf":"scrypt","N":1048576,"r":8,"p":1}`},
+		{"too many passes", `{"kdf":"scrypt","N":1024,"r":8,"p":64}`},
+	}
+	for _, tt := range tests {
+		if _, err := unlockKey([]byte(tt.file), fixturePassword); err == nil {
+			t.Errorf("%s: unlockKey() error = nil", tt.name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package restic
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// Lister lists the snapshots of {namespace}/{pvc} repositories. The
+// password is read from a file, such as a mounted Secret, on every call so
+// that rotations are picked up; master keys are cached per repository and
+// password because scrypt is deliberately slow. Decrypted snapshots are
+// cached by ID, so each call only reads the snapshots added since the last
+// one, and forgotten snapshots leave the cache with the next listing.
+type Lister struct {
+	storage      Storage
+	passwordFile string
+
+	mu    sync.Mutex
+	repos map[string]cachedRepo
+}
+
+type cachedRepo struct {
+	password  [sha256.Size]byte
+	key       *Key
+	snapshots map[string]Snapshot
+}
+
+func NewLister(storage Storage, passwordFile string) *Lister {
+	return &Lister{
+		storage:      storage,
+		passwordFile: passwordFile,
+		repos:        make(map[string]cachedRepo),
+	}
+}
+
+// Snapshots returns the snapshots of the repository for namespace/pvc,
+// oldest first. It returns ErrNotFound if there is no repository.
+func (l *Lister) Snapshots(ctx context.Context, namespace, pvc string) (_ []Snapshot, err error) {
+	ctx, span := trace.Start(ctx, "restic.snapshots", trace.KindInternal)
+	defer func() {
+		if err != nil {
+			span.SetError(err.Error())
+		}
+		span.End()
+	}()
+
+	data, err := os.ReadFile(l.passwordFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository password: %w", err)
+	}
+	// Like restic's --password-file, surrounding whitespace is ignored.
+	password := strings.TrimSpace(string(data))
+	sum := sha256.Sum256([]byte(password))
+	id := namespace + "/" + pvc
+
+	l.mu.Lock()
+	cached, ok := l.repos[id]
+	l.mu.Unlock()
+
+	hit := ok && cached.password == sum
+	span.SetAttribute("restic.key_cache_hit", hit)
+	if hit {
+		repo := &Repository{storage: l.storage, namespace: namespace, pvc: pvc, key: cached.key}
+		snapshots, err := l.list(ctx, span, id, repo, cached)
+		if !errors.Is(err, ErrUnauthenticated) {
+			return snapshots, err
+		}
+		// The repository was probably re-initialized; unlock it again.
+	}
+
+	repo, err := Open(ctx, l.storage, namespace, pvc, password)
+	if err != nil {
+		return nil, err
+	}
+	return l.list(ctx, span, id, repo, cachedRepo{password: sum, key: repo.key})
+}
+
+// list lists the snapshots of repo, reusing and then replacing the
+// snapshots cached for id.
+func (l *Lister) list(ctx context.Context, span *trace.Active, id string, repo *Repository, cached cachedRepo) ([]Snapshot, error) {
+	snapshots, read, err := repo.snapshots(ctx, cached.snapshots)
+	span.SetAttribute("restic.snapshots_read", read)
+	if err != nil {
+		return nil, err
+	}
+
+	cached.snapshots = make(map[string]Snapshot, len(snapshots))
+	for _, sn := range snapshots {
+		cached.snapshots[sn.ID] = sn
+	}
+	l.mu.Lock()
+	l.repos[id] = cached
+	l.mu.Unlock()
+	return snapshots, nil
+}
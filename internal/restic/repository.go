@@ -0,0 +1,225 @@
+// Package restic reads metadata from restic repositories: it derives the
+// master key from the repository password and lists snapshots. Only the
+// files needed for that (keys/ and snapshots/) are read.
+package restic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// maxScryptMemory bounds the memory a key file's parameters may
+	// demand; restic's defaults (N=2^15, r=8) need 32 MiB.
+	maxScryptMemory = 256 << 20
+	// maxDecodedSize bounds the size of a decompressed metadata file so a
+	// corrupt or hostile frame cannot exhaust memory.
+	maxDecodedSize = 64 << 20
+)
+
+var (
+	ErrNotFound      = errors.New("repository not found")
+	ErrWrongPassword = errors.New("no key in the repository matches the password")
+)
+
+// zstdDecoder decodes repository v2 metadata. DecodeAll is safe for
+// concurrent use.
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecodedSize))
+
+// Storage reads the files of restic repositories. Backends implement it
+// over the same {namespace}/{pvc}/ layout they check for existence.
+type Storage interface {
+	// ListFiles returns the names of the files in dir ("keys" or
+	// "snapshots") of the repository. A missing repository yields no names.
+	ListFiles(ctx context.Context, namespace, pvc, dir string) ([]string, error)
+	// ReadFile returns the contents of dir/name in the repository.
+	ReadFile(ctx context.Context, namespace, pvc, dir, name string) ([]byte, error)
+}
+
+// Snapshot is the subset of restic's snapshot JSON shown to users.
+type Snapshot struct {
+	ID             string    `json:"id"`
+	Time           time.Time `json:"time"`
+	Hostname       string    `json:"hostname"`
+	Username       string    `json:"username,omitempty"`
+	Paths          []string  `json:"paths"`
+	Tags           []string  `json:"tags,omitempty"`
+	Tree           string    `json:"tree"`
+	Parent         string    `json:"parent,omitempty"`
+	ProgramVersion string    `json:"program_version,omitempty"`
+	// Summary is written by restic 0.17 and later.
+	Summary *SnapshotSummary `json:"summary,omitempty"`
+}
+
+// SnapshotSummary holds the totals of the backup run that took a snapshot.
+type SnapshotSummary struct {
+	TotalFilesProcessed int64 `json:"total_files_processed"`
+	TotalBytesProcessed int64 `json:"total_bytes_processed"`
+}
+
+// keyFile is the JSON stored under keys/.
+type keyFile struct {
+	KDF  string `json:"kdf"`
+	N    int    `json:"N"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+	Data []byte `json:"data"`
+}
+
+// Repository is an opened repository whose master key is known.
+type Repository struct {
+	storage   Storage
+	namespace string
+	pvc       string
+	key       *Key
+}
+
+// Open tries each key file in the repository with password and returns the
+// repository unlocked by the first that matches.
+func Open(ctx context.Context, storage Storage, namespace, pvc, password string) (*Repository, error) {
+	names, err := storage.ListFiles(ctx, namespace, pvc, "keys")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, ErrNotFound
+	}
+
+	for _, name := range names {
+		data, err := storage.ReadFile(ctx, namespace, pvc, "keys", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", name, err)
+		}
+		key, err := unlockKey(data, password)
+		if errors.Is(err, ErrUnauthenticated) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+		return &Repository{storage: storage, namespace: namespace, pvc: pvc, key: key}, nil
+	}
+	return nil, ErrWrongPassword
+}
+
+// unlockKey derives the user key from password and decrypts the master key
+// held in a key file.
+func unlockKey(data []byte, password string) (*Key, error) {
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("invalid key file: %w", err)
+	}
+	if kf.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation function %q", kf.KDF)
+	}
+
+	// scrypt allocates 128*r*N bytes, so hostile parameters are refused
+	// before it runs.
+	if kf.N <= 1 || kf.R <= 0 || kf.P <= 0 || kf.P > 16 || uint64(128*kf.R)*uint64(kf.N) > maxScryptMemory {
+		return nil, fmt.Errorf("scrypt parameters N=%d, r=%d, p=%d are out of range", kf.N, kf.R, kf.P)
+	}
+	derived, err := scrypt.Key([]byte(password), kf.Salt, kf.N, kf.R, kf.P, 64)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := keyFromBytes(derived).Open(kf.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var master Key
+	if err := json.Unmarshal(plaintext, &master); err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	if !master.valid() {
+		return nil, errors.New("invalid master key")
+	}
+	return &master, nil
+}
+
+// Snapshots returns every snapshot in the repository, oldest first.
+func (r *Repository) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	snapshots, _, err := r.snapshots(ctx, nil)
+	return snapshots, err
+}
+
+// snapshots is Snapshots reusing the snapshots in known by ID instead of
+// reading them again. Snapshot files are named after the hash of their
+// contents, so a name always stands for the same snapshot. It also
+// returns the number of files read.
+func (r *Repository) snapshots(ctx context.Context, known map[string]Snapshot) ([]Snapshot, int, error) {
+	names, err := r.storage.ListFiles(ctx, r.namespace, r.pvc, "snapshots")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := make([]Snapshot, 0, len(names))
+	read := 0
+	for _, name := range names {
+		if sn, ok := known[name]; ok {
+			snapshots = append(snapshots, sn)
+			continue
+		}
+		read++
+		data, err := r.storage.ReadFile(ctx, r.namespace, r.pvc, "snapshots", name)
+		if err != nil {
+			return nil, read, fmt.Errorf("failed to read snapshot %s: %w", name, err)
+		}
+		plaintext, err := r.decrypt(name, data)
+		if err != nil {
+			return nil, read, fmt.Errorf("snapshot %s: %w", name, err)
+		}
+
+		var sn Snapshot
+		if err := json.Unmarshal(plaintext, &sn); err != nil {
+			return nil, read, fmt.Errorf("snapshot %s: invalid JSON: %w", name, err)
+		}
+		sn.ID = name
+		snapshots = append(snapshots, sn)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, read, nil
+}
+
+// decrypt checks that a file's contents match its name, decrypts it and
+// undoes repository v2 compression.
+func (r *Repository) decrypt(name string, data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != name {
+		return nil, errors.New("contents do not match file name")
+	}
+	plaintext, err := r.key.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeUnpacked(plaintext)
+}
+
+// decodeUnpacked returns the JSON of a metadata file. Repository v1 stores
+// plain JSON; v2 prefixes a version byte of 2 and compresses with zstd.
+func decodeUnpacked(plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 {
+		return nil, errors.New("empty file")
+	}
+	switch plaintext[0] {
+	case '{', '[':
+		return plaintext, nil
+	case 2:
+		return zstdDecoder.DecodeAll(plaintext[1:], nil)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %#x", plaintext[0])
+	}
+}
@@ -0,0 +1,226 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const fixturePassword = "pvc-plumber-test"
+
+// dirStorage serves repositories from testdata/{pvc}, ignoring the namespace.
+type dirStorage struct {
+	root  string
+	reads atomic.Int32
+}
+
+func (s *dirStorage) ListFiles(ctx context.Context, namespace, pvc, dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, pvc, dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+func (s *dirStorage) ReadFile(ctx context.Context, namespace, pvc, dir, name string) ([]byte, error) {
+	s.reads.Add(1)
+	return os.ReadFile(filepath.Join(s.root, pvc, dir, name))
+}
+
+// copyFixture copies testdata/repo so a test can modify it.
+func copyFixture(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	err := filepath.Walk("testdata/repo", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel("testdata", path)
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(root, rel), 0o755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(root, rel), data, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestSnapshots(t *testing.T) {
+	repo, err := Open(context.Background(), &dirStorage{root: "testdata"}, "karakeep", "repo", fixturePassword)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	snapshots, err := repo.Snapshots(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshots() error = %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(snapshots))
+	}
+
+	// The first is stored as plain JSON (repository v1), the second is
+	// zstd-compressed (repository v2).
+	first, second := snapshots[0], snapshots[1]
+	if first.ID != "23af6eefcd18d8289e74c2ab7d26fa7f844106c631070ee8cd162bc97844ce13" {
+		t.Errorf("first ID = %s", first.ID)
+	}
+	if !first.Time.Equal(time.Date(2026, 10, 16, 2, 0, 5, 511111111, time.UTC)) {
+		t.Errorf("first Time = %v", first.Time)
+	}
+	if first.Hostname != "volsync" || len(first.Paths) != 1 || first.Paths[0] != "/data" {
+		t.Errorf("first = %+v", first)
+	}
+	if second.Parent != first.ID {
+		t.Errorf("second Parent = %s, want %s", second.Parent, first.ID)
+	}
+	if len(second.Tags) != 2 || second.Tags[0] != "daily" || second.ProgramVersion != "restic 0.17.3" {
+		t.Errorf("second = %+v", second)
+	}
+}
+
+// TestSnapshots_Restic reads repositories written by restic itself, one per
+// repository format. testdata/generate.sh creates them.
+func TestSnapshots_Restic(t *testing.T) {
+	for _, name := range []string{"restic-v1", "restic-v2"} {
+		t.Run(name, func(t *testing.T) {
+			repo, err := Open(context.Background(), &dirStorage{root: "testdata"}, "karakeep", name, fixturePassword)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			snapshots, err := repo.Snapshots(context.Background())
+			if err != nil {
+				t.Fatalf("Snapshots() error = %v", err)
+			}
+			if len(snapshots) != 1 {
+				t.Fatalf("got %d snapshots, want 1", len(snapshots))
+			}
+			s := snapshots[0]
+			if !s.Time.Equal(time.Date(2026, 10, 16, 2, 0, 5, 0, time.UTC)) {
+				t.Errorf("Time = %v", s.Time)
+			}
+			if s.Hostname != "volsync" || len(s.Tags) != 1 || s.Tags[0] != "fixture" {
+				t.Errorf("snapshot = %+v", s)
+			}
+		})
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	storage := &dirStorage{root: "testdata"}
+
+	if _, err := Open(context.Background(), storage, "karakeep", "repo", "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("wrong password: error = %v, want ErrWrongPassword", err)
+	}
+	if _, err := Open(context.Background(), storage, "karakeep", "missing", fixturePassword); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing repository: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSnapshots_Tampered(t *testing.T) {
+	root := copyFixture(t)
+	path := filepath.Join(root, "repo", "snapshots", "9aec13b06bdbd0539b9ce2bb535ea5da47118a36b1086cc7dc19791fd6e84e73")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[20] ^= 1
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := Open(context.Background(), &dirStorage{root: root}, "karakeep", "repo", fixturePassword)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := repo.Snapshots(context.Background()); err == nil {
+		t.Error("expected error for a snapshot that does not match its ID")
+	}
+}
+
+func TestLister_SnapshotCache(t *testing.T) {
+	root := copyFixture(t)
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte(fixturePassword), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	storage := &dirStorage{root: root}
+	lister := NewLister(storage, passwordFile)
+
+	if _, err := lister.Snapshots(context.Background(), "karakeep", "repo"); err != nil {
+		t.Fatalf("Snapshots() error = %v", err)
+	}
+	dir := filepath.Join(root, "repo", "snapshots")
+	if err := os.Remove(filepath.Join(dir, "9aec13b06bdbd0539b9ce2bb535ea5da47118a36b1086cc7dc19791fd6e84e73")); err != nil {
+		t.Fatal(err)
+	}
+
+	before := storage.reads.Load()
+	snapshots, err := lister.Snapshots(context.Background(), "karakeep", "repo")
+	if err != nil {
+		t.Fatalf("Snapshots() error = %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("got %d snapshots after forget, want 1", len(snapshots))
+	}
+	if got := storage.reads.Load() - before; got != 0 {
+		t.Errorf("file reads after forget = %d, want 0", got)
+	}
+	lister.mu.Lock()
+	cached := len(lister.repos["karakeep/repo"].snapshots)
+	lister.mu.Unlock()
+	if cached != 1 {
+		t.Errorf("cached snapshots = %d, want 1", cached)
+	}
+}
+
+func TestLister(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte(fixturePassword+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	storage := &dirStorage{root: "testdata"}
+	lister := NewLister(storage, passwordFile)
+
+	for i := 0; i < 2; i++ {
+		snapshots, err := lister.Snapshots(context.Background(), "karakeep", "repo")
+		if err != nil {
+			t.Fatalf("Snapshots() error = %v", err)
+		}
+		if len(snapshots) != 2 {
+			t.Fatalf("got %d snapshots, want 2", len(snapshots))
+		}
+	}
+	// The first call reads both key files and both snapshots; the second
+	// reuses the cached master key and snapshots and reads nothing.
+	if got := storage.reads.Load(); got != 4 {
+		t.Errorf("file reads = %d, want 4", got)
+	}
+
+	if err := os.WriteFile(passwordFile, []byte("rotated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lister.Snapshots(context.Background(), "karakeep", "repo"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("after rotation: error = %v, want ErrWrongPassword", err)
+	}
+
+	if _, err := NewLister(storage, filepath.Join(t.TempDir(), "missing")).Snapshots(context.Background(), "karakeep", "repo"); err == nil {
+		t.Error("expected error for a missing password file")
+	}
+}
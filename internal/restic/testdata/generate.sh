@@ -0,0 +1,23 @@
+#!/bin/sh
+# Regenerates restic-v1/ and restic-v2/ with the restic binary on PATH.
+# Only the files pvc-plumber reads (config, keys/ and snapshots/) are kept.
+set -eu
+
+cd "$(dirname "$0")"
+export RESTIC_PASSWORD=pvc-plumber-test TZ=UTC
+
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+mkdir "$work/data"
+echo "pvc-plumber fixture" >"$work/data/hello.txt"
+
+for version in 1 2; do
+	repo="$work/repo-v$version"
+	restic init --repository-version "$version" --repo "$repo"
+	(cd "$work/data" && restic backup --repo "$repo" --host volsync --tag fixture \
+		--time "2026-10-16 02:00:05" .)
+
+	rm -rf "restic-v$version"
+	mkdir "restic-v$version"
+	cp -R "$repo/config" "$repo/keys" "$repo/snapshots" "restic-v$version/"
+done
@@ -0,0 +1,165 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// mediaTypeV2 requests the v2 listing, which returns names with sizes
+// instead of bare names.
+const mediaTypeV2 = "application/vnd.x.restic.rest.v2"
+
+type FileInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Client queries a restic rest-server where each PVC has its own repository
+// at {baseURL}/{namespace}/{pvc}/.
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// NewClient returns a Client. Credentials in the URL's userinfo are used
+// for basic auth when username is empty.
+func NewClient(baseURL, username, password string, httpClient *http.Client) *Client {
+	if u, err := url.Parse(baseURL); err == nil && u.User != nil {
+		if username == "" {
+			username = u.User.Username()
+			password, _ = u.User.Password()
+		}
+		u.User = nil
+		baseURL = u.String()
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: httpClient,
+	}
+}
+
+func (c *Client) repoURL(namespace, pvc string) string {
+	return fmt.Sprintf("%s/%s/%s", c.baseURL, url.PathEscape(namespace), url.PathEscape(pvc))
+}
+
+func (c *Client) newRequest(ctx context.Context, method, reqURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	trace.Inject(ctx, req)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return req, nil
+}
+
+// repositoryExists reports whether the repository config file is present.
+func (c *Client) repositoryExists(ctx context.Context, repo string) (bool, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, repo+"/config")
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to query rest-server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	// HEAD responses have no body to report.
+	return false, &backend.HTTPError{Service: "rest-server", StatusCode: resp.StatusCode, Body: "HEAD config"}
+}
+
+// ListSnapshots returns the snapshot files of a repository.
+func (c *Client) ListSnapshots(ctx context.Context, namespace, pvc string) ([]FileInfo, error) {
+	return c.listDir(ctx, namespace, pvc, "snapshots")
+}
+
+// listDir returns the files in dir of a repository, accepting both the v2
+// and the legacy v1 listing formats.
+func (c *Client) listDir(ctx context.Context, namespace, pvc, dir string) ([]FileInfo, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.repoURL(namespace, pvc)+"/"+url.PathEscape(dir)+"/")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeV2)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rest-server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, backend.InvalidResponse(fmt.Errorf("failed to read response: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &backend.HTTPError{Service: "rest-server", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), mediaTypeV2) {
+		var files []FileInfo
+		if err := json.Unmarshal(body, &files); err != nil {
+			return nil, backend.InvalidResponse(fmt.Errorf("failed to parse %s listing: %w", dir, err))
+		}
+		return files, nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(body, &names); err != nil {
+		return nil, backend.InvalidResponse(fmt.Errorf("failed to parse %s listing: %w", dir, err))
+	}
+	files := make([]FileInfo, 0, len(names))
+	for _, name := range names {
+		files = append(files, FileInfo{Name: name})
+	}
+	return files, nil
+}
+
+// CheckBackupExists reports a backup when the repository exists and holds at
+// least one snapshot. KeyCount is the number of snapshots.
+func (c *Client) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
+	exists, err := c.repositoryExists(ctx, c.repoURL(namespace, pvc))
+	if err != nil {
+		return backend.Failure(err)
+	}
+	if !exists {
+		return backend.CheckResult{Exists: false, KeyCount: 0}
+	}
+
+	snapshots, err := c.ListSnapshots(ctx, namespace, pvc)
+	if err != nil {
+		return backend.Failure(err)
+	}
+
+	return backend.CheckResult{
+		Exists:   len(snapshots) > 0,
+		KeyCount: len(snapshots),
+		RepoType: backend.RepoTypeRestic,
+	}
+}
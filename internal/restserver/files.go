@@ -0,0 +1,46 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ListFiles returns the names of the files in dir of a repository.
+func (c *Client) ListFiles(ctx context.Context, namespace, pvc, dir string) ([]string, error) {
+	files, err := c.listDir(ctx, namespace, pvc, dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	return names, nil
+}
+
+// ReadFile returns the contents of dir/name in a repository.
+func (c *Client) ReadFile(ctx context.Context, namespace, pvc, dir, name string) ([]byte, error) {
+	reqURL := fmt.Sprintf("%s/%s/%s", c.repoURL(namespace, pvc), url.PathEscape(dir), url.PathEscape(name))
+	req, err := c.newRequest(ctx, http.MethodGet, reqURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rest-server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rest-server returned status %d for %s/%s", resp.StatusCode, dir, name)
+	}
+	return body, nil
+}
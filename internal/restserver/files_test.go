@@ -0,0 +1,49 @@
+package restserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListFiles(t *testing.T) {
+	server := httptest.NewServer(newStub())
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "", &http.Client{Timeout: 5 * time.Second})
+	names, err := client.ListFiles(context.Background(), "karakeep", "data-pvc", "snapshots")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if want := []string{"4f1e3b5c", "9a8b7c6d"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListFiles() = %v, want %v", names, want)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "volsync" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != "/karakeep/data-pvc/keys/abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("key"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "volsync", "secret", &http.Client{Timeout: 5 * time.Second})
+	data, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "abc")
+	if err != nil || string(data) != "key" {
+		t.Errorf("ReadFile() = %q, %v; want %q", data, err, "key")
+	}
+	if _, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "missing"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -4,75 +4,78 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
 )
 
 type Client struct {
 	endpoint   string
 	bucket     string
 	httpClient *http.Client
+	creds      *Credentials
+	now        func() time.Time
+
+	// listV1 is set once the store is found not to implement
+	// ListObjectsV2, so later listings go straight to ListObjects.
+	listV1 atomic.Bool
 }
 
+// ListBucketResult is a ListObjectsV2 or ListObjects (v1) response. KeyCount
+// is informational only: some S3-compatible stores omit it, so existence is
+// always derived from Contents and CommonPrefixes.
 type ListBucketResult struct {
-	XMLName  xml.Name `xml:"ListBucketResult"`
-	KeyCount int      `xml:"KeyCount"`
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	KeyCount       int      `xml:"KeyCount"`
+	Contents       []Object `xml:"Contents"`
+	CommonPrefixes []string `xml:"CommonPrefixes>Prefix"`
+
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	NextMarker            string `xml:"NextMarker"`
 }
 
-type CheckResult struct {
-	Exists   bool   `json:"exists"`
-	KeyCount int    `json:"keyCount"`
-	Error    string `json:"error,omitempty"`
+type Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
 }
 
-func NewClient(endpoint, bucket string, httpClient *http.Client) *Client {
-	return &Client{
+func NewClient(endpoint, bucket string, httpClient *http.Client, opts ...Option) *Client {
+	c := &Client{
 		endpoint:   endpoint,
 		bucket:     bucket,
 		httpClient: httpClient,
+		now:        time.Now,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-func (c *Client) CheckBackupExists(ctx context.Context, namespace, pvc string) CheckResult {
+// CheckBackupExists classifies {namespace}/{pvc}/ with backend.Detect,
+// probing with one-key listings and listing the top level with a "/"
+// delimiter.
+func (c *Client) CheckBackupExists(ctx context.Context, namespace, pvc string) backend.CheckResult {
 	prefix := fmt.Sprintf("%s/%s/", namespace, pvc)
-
-	reqURL := fmt.Sprintf("%s/%s?list-type=2&prefix=%s&max-keys=1",
-		c.endpoint,
-		c.bucket,
-		url.QueryEscape(prefix))
-
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
-	if err != nil {
-		return CheckResult{Exists: false, Error: fmt.Sprintf("failed to create request: %v", err)}
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return CheckResult{Exists: false, Error: fmt.Sprintf("failed to query S3: %v", err)}
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return CheckResult{
-			Exists: false,
-			Error:  fmt.Sprintf("S3 returned status %d: %s", resp.StatusCode, string(body)),
+	return backend.Detect(func(name string) (string, error) {
+		return c.probe(ctx, prefix, name)
+	}, func(limit int) ([]string, error) {
+		objects, prefixes, err := c.list(ctx, prefix, "/", limit)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return CheckResult{Exists: false, Error: fmt.Sprintf("failed to read response: %v", err)}
-	}
-
-	var result ListBucketResult
-	if err := xml.Unmarshal(body, &result); err != nil {
-		return CheckResult{Exists: false, Error: fmt.Sprintf("failed to parse XML: %v", err)}
-	}
-
-	return CheckResult{
-		Exists:   result.KeyCount > 0,
-		KeyCount: result.KeyCount,
-	}
+		entries := make([]string, 0, len(objects)+len(prefixes))
+		for _, obj := range objects {
+			entries = append(entries, strings.TrimPrefix(obj.Key, prefix))
+		}
+		for _, p := range prefixes {
+			entries = append(entries, strings.TrimPrefix(p, prefix))
+		}
+		return entries, nil
+	})
 }
@@ -2,10 +2,17 @@ package s3
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+	"github.com/mitchross/pvc-plumber/s3test"
 )
 
 func TestNewClient(t *testing.T) {
@@ -35,6 +42,7 @@ func TestCheckBackupExists(t *testing.T) {
 		responseBody   string
 		wantExists     bool
 		wantKeyCount   int
+		wantRepoType   string
 		wantError      bool
 	}{
 		{
@@ -46,19 +54,75 @@ func TestCheckBackupExists(t *testing.T) {
 <ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
   <Name>volsync-backup</Name>
   <Prefix>karakeep/data-pvc/</Prefix>
-  <KeyCount>1</KeyCount>
-  <MaxKeys>1</MaxKeys>
+  <KeyCount>4</KeyCount>
+  <MaxKeys>1000</MaxKeys>
+  <Delimiter>/</Delimiter>
   <IsTruncated>false</IsTruncated>
   <Contents>
     <Key>karakeep/data-pvc/config</Key>
     <LastModified>2026-01-10T01:46:03.000Z</LastModified>
     <Size>155</Size>
   </Contents>
+  <CommonPrefixes><Prefix>karakeep/data-pvc/data/</Prefix></CommonPrefixes>
+  <CommonPrefixes><Prefix>karakeep/data-pvc/keys/</Prefix></CommonPrefixes>
+  <CommonPrefixes><Prefix>karakeep/data-pvc/snapshots/</Prefix></CommonPrefixes>
 </ListBucketResult>`,
 			wantExists:   true,
-			wantKeyCount: 1,
+			wantKeyCount: 4,
+			wantRepoType: backend.RepoTypeRestic,
 			wantError:    false,
 		},
+		{
+			name:           "kopia repository",
+			namespace:      "paperless",
+			pvc:            "media",
+			responseStatus: http.StatusOK,
+			responseBody: `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Prefix>paperless/media/</Prefix>
+  <KeyCount>5</KeyCount>
+  <Delimiter>/</Delimiter>
+  <Contents><Key>paperless/media/kopia.blobcfg</Key></Contents>
+  <Contents><Key>paperless/media/kopia.repository</Key></Contents>
+  <Contents><Key>paperless/media/p0a1b2c3d4e5f6-s1a2b3c4-c1</Key></Contents>
+  <Contents><Key>paperless/media/q9f8e7d6c5b4a3-s1a2b3c4-c1</Key></Contents>
+  <Contents><Key>paperless/media/xn0_0a1b2c3d4e5f6-s1a2b3c4-c1</Key></Contents>
+</ListBucketResult>`,
+			wantExists:   true,
+			wantKeyCount: 3,
+			wantRepoType: backend.RepoTypeKopia,
+		},
+		{
+			name:           "restic repository without snapshots",
+			namespace:      "karakeep",
+			pvc:            "new-pvc",
+			responseStatus: http.StatusOK,
+			responseBody: `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Prefix>karakeep/new-pvc/</Prefix>
+  <KeyCount>2</KeyCount>
+  <Contents><Key>karakeep/new-pvc/config</Key></Contents>
+  <CommonPrefixes><Prefix>karakeep/new-pvc/keys/</Prefix></CommonPrefixes>
+</ListBucketResult>`,
+			wantExists:   false,
+			wantKeyCount: 2,
+			wantRepoType: backend.RepoTypeRestic,
+		},
+		{
+			name:           "unrecognised objects",
+			namespace:      "stray",
+			pvc:            "data-pvc",
+			responseStatus: http.StatusOK,
+			responseBody: `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Prefix>stray/data-pvc/</Prefix>
+  <KeyCount>1</KeyCount>
+  <Contents><Key>stray/data-pvc/backup.tar.gz</Key></Contents>
+</ListBucketResult>`,
+			wantExists:   false,
+			wantKeyCount: 1,
+			wantRepoType: backend.RepoTypeUnknown,
+		},
 		{
 			name:           "no backup",
 			namespace:      "test-ns",
@@ -101,6 +165,17 @@ func TestCheckBackupExists(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Probes for kopia.repository and its blobs list one key;
+				// the top level is listed with a delimiter.
+				query := r.URL.Query()
+				wantDelimiter, wantMaxKeys := "", "1"
+				if strings.HasSuffix(query.Get("prefix"), "/") {
+					wantDelimiter, wantMaxKeys = "/", "100"
+				}
+				if query.Get("delimiter") != wantDelimiter || query.Get("max-keys") != wantMaxKeys {
+					t.Errorf("prefix %q: delimiter = %q, max-keys = %q; want %q, %q",
+						query.Get("prefix"), query.Get("delimiter"), query.Get("max-keys"), wantDelimiter, wantMaxKeys)
+				}
 				w.WriteHeader(tt.responseStatus)
 				_, _ = w.Write([]byte(tt.responseBody))
 			}))
@@ -115,6 +190,9 @@ func TestCheckBackupExists(t *testing.T) {
 			if result.KeyCount != tt.wantKeyCount {
 				t.Errorf("KeyCount = %v, want %v", result.KeyCount, tt.wantKeyCount)
 			}
+			if result.RepoType != tt.wantRepoType {
+				t.Errorf("RepoType = %q, want %q", result.RepoType, tt.wantRepoType)
+			}
 			if tt.wantError && result.Error == "" {
 				t.Errorf("Expected error but got none")
 			}
@@ -142,6 +220,9 @@ func TestCheckBackupExists_Timeout(t *testing.T) {
 	if result.Error == "" {
 		t.Error("Expected error on timeout")
 	}
+	if result.ErrorCode != backend.CodeTimeout || !result.Retryable {
+		t.Errorf("ErrorCode = %q, Retryable = %v, want %q, true", result.ErrorCode, result.Retryable, backend.CodeTimeout)
+	}
 }
 
 func TestCheckBackupExists_ContextCanceled(t *testing.T) {
@@ -164,3 +245,161 @@ func TestCheckBackupExists_ContextCanceled(t *testing.T) {
 		t.Error("Expected error on canceled context")
 	}
 }
+
+func TestCheckBackupExists_PropagatesTrace(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte(`<ListBucketResult><KeyCount>0</KeyCount></ListBucketResult>`))
+	}))
+	defer server.Close()
+
+	span := trace.Span{RequestID: "req-1", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "01"}
+	ctx := trace.NewContext(context.Background(), span)
+	NewClient(server.URL, "test-bucket", server.Client()).CheckBackupExists(ctx, "test", "pvc")
+
+	if got.Get(trace.RequestIDHeader) != "req-1" {
+		t.Errorf("%s = %q, want req-1", trace.RequestIDHeader, got.Get(trace.RequestIDHeader))
+	}
+	if got.Get(trace.TraceparentHeader) != span.Traceparent() {
+		t.Errorf("traceparent = %q, want %q", got.Get(trace.TraceparentHeader), span.Traceparent())
+	}
+}
+
+func TestClient_Emulator(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+	snapshot := time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC)
+	server.PutResticRepository("volsync", "karakeep", "data-pvc", snapshot)
+	server.PutResticRepository("volsync", "karakeep", "meili")
+	server.PutResticRepository("volsync", "media", "photos")
+
+	client := NewClient(server.URL, "volsync", server.Client())
+	ctx := context.Background()
+
+	if result := client.CheckBackupExists(ctx, "karakeep", "data-pvc"); !result.Exists || result.RepoType != backend.RepoTypeRestic {
+		t.Errorf("CheckBackupExists() = %+v", result)
+	}
+
+	// Listings follow continuation tokens across pages.
+	server.SetPageLimit(1)
+
+	repos, err := client.ListRepositories(ctx)
+	want := []backend.Repository{{Namespace: "karakeep", PVC: "data-pvc"}, {Namespace: "karakeep", PVC: "meili"}, {Namespace: "media", PVC: "photos"}}
+	if err != nil || !reflect.DeepEqual(repos, want) {
+		t.Errorf("ListRepositories() = %v, %v; want %v", repos, err, want)
+	}
+
+	files, err := client.ListSnapshotFiles(ctx, "karakeep", "data-pvc")
+	if err != nil || len(files) != 1 || !files[0].ModTime.Equal(snapshot) {
+		t.Errorf("ListSnapshotFiles() = %v, %v", files, err)
+	}
+
+	keys, err := client.ListRepositoryObjects(ctx, "karakeep", "meili")
+	if err != nil || len(keys) != 4 {
+		t.Fatalf("ListRepositoryObjects() = %v, %v", keys, err)
+	}
+	if err := client.DeleteObjects(ctx, keys); err != nil {
+		t.Fatalf("DeleteObjects() error = %v", err)
+	}
+	if result := client.CheckBackupExists(ctx, "karakeep", "meili"); result.Exists || result.Error != "" {
+		t.Errorf("CheckBackupExists() after delete = %+v", result)
+	}
+
+	server.InjectFault(s3test.Fault{Op: s3test.OpListObjectsV2, Status: http.StatusServiceUnavailable, Code: "SlowDown", Count: 1})
+	if result := client.CheckBackupExists(ctx, "karakeep", "data-pvc"); result.ErrorCode != backend.CodeThrottled || !result.Retryable {
+		t.Errorf("CheckBackupExists() with SlowDown = %+v", result)
+	}
+
+	wrong := NewClient(server.URL, "missing", server.Client())
+	if result := wrong.CheckBackupExists(ctx, "karakeep", "data-pvc"); result.ErrorCode != backend.CodeNoSuchBucket {
+		t.Errorf("CheckBackupExists() on a missing bucket = %+v", result)
+	}
+}
+
+func TestCheckBackupExists_Dialects(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*s3test.Server)
+		wantV2    int
+		wantV1    int
+	}{
+		{name: "paginated", configure: func(s *s3test.Server) { s.SetPageLimit(2) }, wantV2: 8},
+		{name: "no KeyCount", configure: func(s *s3test.Server) { s.SetOmitKeyCount(true) }, wantV2: 4},
+		{name: "v2 rejected", configure: func(s *s3test.Server) { s.SetListV2(s3test.ListV2Rejected); s.SetPageLimit(2) }, wantV2: 1, wantV1: 8},
+		{name: "v2 ignored", configure: func(s *s3test.Server) { s.SetListV2(s3test.ListV2Ignored); s.SetPageLimit(2) }, wantV1: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := s3test.NewServer()
+			defer server.Close()
+			server.PutResticRepository("volsync", "karakeep", "data-pvc", time.Now(), time.Now())
+			tt.configure(server)
+
+			client := NewClient(server.URL, "volsync", server.Client())
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				result := client.CheckBackupExists(ctx, "karakeep", "data-pvc")
+				if !result.Exists || result.KeyCount != 5 || result.RepoType != backend.RepoTypeRestic {
+					t.Fatalf("CheckBackupExists() = %+v", result)
+				}
+			}
+			if v2, v1 := server.Calls(s3test.OpListObjectsV2), server.Calls(s3test.OpListObjects); v2 != tt.wantV2 || v1 != tt.wantV1 {
+				t.Errorf("requests: %d ListObjectsV2, %d ListObjects; want %d, %d", v2, v1, tt.wantV2, tt.wantV1)
+			}
+
+			// Without a delimiter v1 has no NextMarker, so pages continue
+			// from the last key.
+			files, err := client.ListSnapshotFiles(ctx, "karakeep", "data-pvc")
+			if err != nil || len(files) != 2 {
+				t.Errorf("ListSnapshotFiles() = %v, %v", files, err)
+			}
+		})
+	}
+}
+
+func TestCheckBackupExists_Bounded(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+	now := time.Now()
+	server.PutObject("volsync", "paperless/media/kopia.repository", []byte("{}"), now)
+	server.PutObject("volsync", "stray/data-pvc/config", []byte("config"), now)
+	for i := 0; i < 500; i++ {
+		for _, repo := range []string{"paperless/media", "stray/data-pvc"} {
+			for _, blob := range []string{"p", "q", "xn0_"} {
+				server.PutObject("volsync", fmt.Sprintf("%s/%s%04x", repo, blob, i), nil, now)
+			}
+		}
+	}
+	client := NewClient(server.URL, "volsync", server.Client())
+
+	result := client.CheckBackupExists(context.Background(), "paperless", "media")
+	if !result.Exists || result.RepoType != backend.RepoTypeKopia {
+		t.Errorf("CheckBackupExists() = %+v, want a Kopia backup", result)
+	}
+	if calls := server.Calls(s3test.OpListObjectsV2); calls != 3 {
+		t.Errorf("Kopia check made %d listings, want 3 probes", calls)
+	}
+
+	result = client.CheckBackupExists(context.Background(), "stray", "data-pvc")
+	if result.Exists || result.KeyCount != 100 {
+		t.Errorf("CheckBackupExists() = %+v, want 100 entries and no backup", result)
+	}
+	if calls := server.Calls(s3test.OpListObjectsV2); calls != 5 {
+		t.Errorf("check of a large top level made %d listings, want a probe and one page", calls-3)
+	}
+}
+
+func TestCheckBackupExists_TruncatedWithoutMarker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(`<ListBucketResult><IsTruncated>true</IsTruncated></ListBucketResult>`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "volsync", server.Client())
+	result := client.CheckBackupExists(context.Background(), "karakeep", "data-pvc")
+	if result.ErrorCode != backend.CodeInvalidResponse {
+		t.Errorf("CheckBackupExists() = %+v, want %s", result, backend.CodeInvalidResponse)
+	}
+}
@@ -0,0 +1,115 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// MaxDeleteObjects is the most keys one DeleteObjects request may carry.
+const MaxDeleteObjects = 1000
+
+type deleteRequest struct {
+	XMLName xml.Name       `xml:"Delete"`
+	Quiet   bool           `xml:"Quiet"`
+	Objects []deleteObject `xml:"Object"`
+}
+
+type deleteObject struct {
+	Key string `xml:"Key"`
+}
+
+// DeleteResult is the DeleteObjects response. In quiet mode it lists only
+// the keys that could not be deleted.
+type DeleteResult struct {
+	XMLName xml.Name      `xml:"DeleteResult"`
+	Errors  []DeleteError `xml:"Error"`
+}
+
+type DeleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// ListRepositoryObjects returns the keys of every object under
+// {namespace}/{pvc}/.
+func (c *Client) ListRepositoryObjects(ctx context.Context, namespace, pvc string) ([]string, error) {
+	objects, err := c.listObjects(ctx, fmt.Sprintf("%s/%s/", namespace, pvc))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+// DeleteObjects deletes up to MaxDeleteObjects keys with one quiet-mode
+// DeleteObjects request. Keys that S3 fails to delete are reported in the
+// returned error.
+func (c *Client) DeleteObjects(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if len(keys) > MaxDeleteObjects {
+		return fmt.Errorf("cannot delete %d objects in one request (max %d)", len(keys), MaxDeleteObjects)
+	}
+
+	body := deleteRequest{Quiet: true, Objects: make([]deleteObject, len(keys))}
+	for i, key := range keys {
+		body.Objects[i].Key = key
+	}
+	payload, err := xml.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode delete request: %w", err)
+	}
+	sum := md5.Sum(payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/%s?delete", c.endpoint, c.bucket), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	trace.Inject(ctx, req)
+	req.Header.Set("Content-Type", "application/xml")
+	// S3 requires Content-MD5 on DeleteObjects.
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	c.sign(req, payload)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query S3: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return backend.InvalidResponse(fmt.Errorf("failed to read response: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseError(resp.StatusCode, respBody)
+	}
+
+	var result DeleteResult
+	if err := xml.Unmarshal(respBody, &result); err != nil {
+		return backend.InvalidResponse(fmt.Errorf("failed to parse XML: %w", err))
+	}
+	if len(result.Errors) > 0 {
+		failed := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			failed = append(failed, fmt.Sprintf("%s (%s)", e.Key, e.Code))
+		}
+		return fmt.Errorf("failed to delete %d of %d objects: %s", len(result.Errors), len(keys), strings.Join(failed, ", "))
+	}
+	return nil
+}
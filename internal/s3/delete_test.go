@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/s3test"
+)
+
+func TestDeleteObjects(t *testing.T) {
+	var got deleteRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := md5.Sum(body)
+		if r.Method != http.MethodPost || r.URL.Path != "/volsync-backup" || !r.URL.Query().Has("delete") ||
+			r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got = deleteRequest{}
+		if err := xml.Unmarshal(body, &got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(got.Objects[0].Key, "locked") {
+			fmt.Fprintf(w, `<DeleteResult><Error><Key>%s</Key><Code>AccessDenied</Code><Message>denied</Message></Error></DeleteResult>`, got.Objects[0].Key)
+			return
+		}
+		fmt.Fprint(w, `<DeleteResult></DeleteResult>`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "volsync-backup", &http.Client{Timeout: 5 * time.Second})
+	keys := []string{"gone/cache/config", "gone/cache/keys/abc"}
+	if err := client.DeleteObjects(context.Background(), keys); err != nil {
+		t.Fatalf("DeleteObjects() error = %v", err)
+	}
+	if !got.Quiet || len(got.Objects) != 2 || got.Objects[1].Key != keys[1] {
+		t.Errorf("request = %+v", got)
+	}
+
+	err := client.DeleteObjects(context.Background(), []string{"gone/cache/locked"})
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("DeleteObjects() error = %v, want AccessDenied", err)
+	}
+
+	if err := client.DeleteObjects(context.Background(), make([]string, MaxDeleteObjects+1)); err == nil {
+		t.Error("expected error for too many keys")
+	}
+}
+
+func TestDeleteObjects_SigV4(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+	server.CreateBucket("volsync-backup")
+	server.PutResticRepository("volsync-backup", "gone", "cache", time.Now())
+	creds := s3test.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Region: "eu-west-1"}
+	server.RequireSigV4(creds)
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	anonymous := NewClient(server.URL, "volsync-backup", httpClient)
+	if err := anonymous.DeleteObjects(context.Background(), []string{"gone/cache/config"}); err == nil {
+		t.Fatal("unsigned DeleteObjects() succeeded")
+	}
+
+	client := NewClient(server.URL, "volsync-backup", httpClient, WithCredentials(Credentials(creds)))
+	keys, err := client.ListRepositoryObjects(context.Background(), "gone", "cache")
+	if err != nil || len(keys) == 0 {
+		t.Fatalf("ListRepositoryObjects() = %v, %v", keys, err)
+	}
+	if err := client.DeleteObjects(context.Background(), keys); err != nil {
+		t.Fatalf("DeleteObjects() error = %v", err)
+	}
+	if left := server.Keys("volsync-backup"); len(left) != 0 {
+		t.Errorf("keys left = %v", left)
+	}
+
+	wrong := NewClient(server.URL, "volsync-backup", httpClient, WithCredentials(Credentials{AccessKeyID: "AKID", SecretAccessKey: "wrong", Region: "eu-west-1"}))
+	if _, err := wrong.ListRepositoryObjects(context.Background(), "gone", "cache"); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("wrong secret: error = %v, want SignatureDoesNotMatch", err)
+	}
+}
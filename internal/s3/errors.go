@@ -0,0 +1,85 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// Error is an S3 error response. Code is the S3 error code, such as
+// AccessDenied or NoSuchBucket, and is empty when the body was not an S3
+// <Error> document.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Resource   string
+	RequestID  string
+
+	// body is the raw response, reported when it could not be parsed.
+	body string
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// parseError builds the Error for a non-200 response.
+func parseError(status int, body []byte) *Error {
+	e := &Error{StatusCode: status}
+	var resp errorResponse
+	if err := xml.Unmarshal(body, &resp); err != nil || resp.Code == "" {
+		e.body = string(body)
+		return e
+	}
+	e.Code, e.Message, e.Resource, e.RequestID = resp.Code, resp.Message, resp.Resource, resp.RequestID
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 returned status %d: %s", e.StatusCode, e.body)
+	}
+	msg := fmt.Sprintf("S3 returned status %d: %s", e.StatusCode, e.Code)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += " (request ID " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// ErrorCode maps the S3 error code, or failing that the HTTP status, to a
+// backend error code.
+func (e *Error) ErrorCode() string {
+	code, _ := e.classify()
+	return code
+}
+
+func (e *Error) Retryable() bool {
+	_, retryable := e.classify()
+	return retryable
+}
+
+func (e *Error) classify() (string, bool) {
+	switch e.Code {
+	case "AccessDenied", "AllAccessDisabled", "AccountProblem", "InvalidAccessKeyId",
+		"InvalidToken", "ExpiredToken", "SignatureDoesNotMatch", "InvalidSecurity":
+		return backend.CodeAccessDenied, false
+	case "NoSuchBucket":
+		return backend.CodeNoSuchBucket, false
+	case "SlowDown", "TooManyRequests", "RequestLimitExceeded":
+		return backend.CodeThrottled, true
+	case "RequestTimeout":
+		return backend.CodeTimeout, true
+	case "InternalError", "ServiceUnavailable":
+		return backend.CodeUnavailable, true
+	}
+	return backend.StatusCode(e.StatusCode)
+}
@@ -0,0 +1,133 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+func TestCheckBackupExists_ErrorCodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantCode      string
+		wantRetryable bool
+		wantError     string
+	}{
+		{
+			name:      "access denied",
+			status:    http.StatusForbidden,
+			body:      `<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Access Denied.</Message><Resource>/test-bucket</Resource><RequestId>17C0A4E3</RequestId></Error>`,
+			wantCode:  backend.CodeAccessDenied,
+			wantError: "S3 returned status 403: AccessDenied: Access Denied. (request ID 17C0A4E3)",
+		},
+		{
+			name:      "bad signature",
+			status:    http.StatusForbidden,
+			body:      `<Error><Code>SignatureDoesNotMatch</Code></Error>`,
+			wantCode:  backend.CodeAccessDenied,
+			wantError: "S3 returned status 403: SignatureDoesNotMatch",
+		},
+		{
+			name:     "no such bucket",
+			status:   http.StatusNotFound,
+			body:     `<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`,
+			wantCode: backend.CodeNoSuchBucket,
+		},
+		{
+			name:          "slow down",
+			status:        http.StatusServiceUnavailable,
+			body:          `<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`,
+			wantCode:      backend.CodeThrottled,
+			wantRetryable: true,
+		},
+		{
+			name:          "internal error",
+			status:        http.StatusInternalServerError,
+			body:          `<Error><Code>InternalError</Code></Error>`,
+			wantCode:      backend.CodeUnavailable,
+			wantRetryable: true,
+		},
+		{
+			name:          "unparseable error from a proxy",
+			status:        http.StatusBadGateway,
+			body:          "<html>bad gateway</html>",
+			wantCode:      backend.CodeUnavailable,
+			wantRetryable: true,
+			wantError:     "S3 returned status 502: <html>bad gateway</html>",
+		},
+		{
+			name:     "unknown S3 code falls back to the status",
+			status:   http.StatusForbidden,
+			body:     `<Error><Code>SomethingNew</Code></Error>`,
+			wantCode: backend.CodeAccessDenied,
+		},
+		{
+			name:     "unknown status",
+			status:   http.StatusConflict,
+			body:     `<Error><Code>OperationAborted</Code></Error>`,
+			wantCode: backend.CodeBackendError,
+		},
+		{
+			name:     "invalid listing",
+			status:   http.StatusOK,
+			body:     "not xml",
+			wantCode: backend.CodeInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "test-bucket", &http.Client{Timeout: 5 * time.Second})
+			result := client.CheckBackupExists(context.Background(), "test", "pvc")
+
+			if result.Exists {
+				t.Error("Exists = true, want false")
+			}
+			if result.ErrorCode != tt.wantCode || result.Retryable != tt.wantRetryable {
+				t.Errorf("ErrorCode = %q, Retryable = %v, want %q, %v", result.ErrorCode, result.Retryable, tt.wantCode, tt.wantRetryable)
+			}
+			if tt.wantError != "" && result.Error != tt.wantError {
+				t.Errorf("Error = %q, want %q", result.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestReadFile_TypedError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Key>test/pvc/config</Key></Error>`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-bucket", &http.Client{Timeout: 5 * time.Second})
+	_, err := client.ReadFile(context.Background(), "test", "pvc", "snapshots", "abc")
+
+	var s3Err *Error
+	if !errors.As(err, &s3Err) {
+		t.Fatalf("error = %v, want *s3.Error", err)
+	}
+	if s3Err.StatusCode != http.StatusNotFound || s3Err.Code != "NoSuchKey" {
+		t.Errorf("error = %+v", s3Err)
+	}
+	if code, _ := backend.Classify(err); code != backend.CodeBackendError {
+		t.Errorf("Classify() = %q, want %q", code, backend.CodeBackendError)
+	}
+	if !strings.Contains(err.Error(), "NoSuchKey") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
@@ -0,0 +1,273 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+	"github.com/mitchross/pvc-plumber/internal/trace"
+)
+
+// ListFiles returns the names of the objects under
+// {namespace}/{pvc}/{dir}/.
+func (c *Client) ListFiles(ctx context.Context, namespace, pvc, dir string) ([]string, error) {
+	prefix := fmt.Sprintf("%s/%s/%s/", namespace, pvc, dir)
+	objects, err := c.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, strings.TrimPrefix(obj.Key, prefix))
+	}
+	return names, nil
+}
+
+// ListSnapshotFiles returns the objects under {namespace}/{pvc}/snapshots/
+// with their LastModified times.
+func (c *Client) ListSnapshotFiles(ctx context.Context, namespace, pvc string) ([]backend.SnapshotFile, error) {
+	prefix := fmt.Sprintf("%s/%s/snapshots/", namespace, pvc)
+	objects, err := c.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]backend.SnapshotFile, 0, len(objects))
+	for _, obj := range objects {
+		files = append(files, backend.SnapshotFile{Name: strings.TrimPrefix(obj.Key, prefix), ModTime: obj.LastModified})
+	}
+	return files, nil
+}
+
+// ListRepositoryFiles returns every object under {namespace}/{pvc}/ with
+// its size.
+func (c *Client) ListRepositoryFiles(ctx context.Context, namespace, pvc string) ([]backend.RepositoryFile, error) {
+	prefix := fmt.Sprintf("%s/%s/", namespace, pvc)
+	objects, err := c.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]backend.RepositoryFile, 0, len(objects))
+	for _, obj := range objects {
+		files = append(files, backend.RepositoryFile{Path: strings.TrimPrefix(obj.Key, prefix), Size: obj.Size, ModTime: obj.LastModified})
+	}
+	return files, nil
+}
+
+// ListRepositories returns every {namespace}/{pvc}/ prefix in the bucket.
+func (c *Client) ListRepositories(ctx context.Context) ([]backend.Repository, error) {
+	_, namespaces, err := c.list(ctx, "", "/", 0)
+	if err != nil {
+		return nil, err
+	}
+	var repos []backend.Repository
+	for _, ns := range namespaces {
+		_, pvcs, err := c.list(ctx, ns, "/", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs {
+			repos = append(repos, backend.Repository{
+				Namespace: strings.TrimSuffix(ns, "/"),
+				PVC:       strings.TrimSuffix(strings.TrimPrefix(pvc, ns), "/"),
+			})
+		}
+	}
+	return repos, nil
+}
+
+// listObjects returns every object under prefix.
+func (c *Client) listObjects(ctx context.Context, prefix string) ([]Object, error) {
+	objects, _, err := c.list(ctx, prefix, "", 0)
+	return objects, err
+}
+
+// probe returns the name, relative to prefix, of the first object whose
+// key starts with prefix+name, or "" when there is none. It lists a single
+// key.
+func (c *Client) probe(ctx context.Context, prefix, name string) (string, error) {
+	v1 := c.listV1.Load()
+	result, err := c.listPage(ctx, prefix+name, "", 1, v1, "", "")
+	if err != nil && !v1 && listV2Unsupported(err) {
+		c.listV1.Store(true)
+		result, err = c.listPage(ctx, prefix+name, "", 1, true, "", "")
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, obj := range result.Contents {
+		if strings.HasPrefix(obj.Key, prefix+name) {
+			return strings.TrimPrefix(obj.Key, prefix), nil
+		}
+	}
+	return "", nil
+}
+
+// list returns the objects and, when delimiter is set, the common prefixes
+// under prefix, following continuation tokens or markers until the listing
+// is complete or, when limit is not 0, holds at least limit entries. Stores
+// that reject list-type=2, or ignore it and answer in the v1 format, are
+// listed with ListObjects from then on.
+func (c *Client) list(ctx context.Context, prefix, delimiter string, limit int) (objects []Object, prefixes []string, err error) {
+	v1 := c.listV1.Load()
+	token, marker := "", ""
+	for {
+		result, err := c.listPage(ctx, prefix, delimiter, limit, v1, token, marker)
+		if err != nil {
+			if !v1 && token == "" && listV2Unsupported(err) {
+				c.listV1.Store(true)
+				v1 = true
+				continue
+			}
+			return nil, nil, err
+		}
+		objects = append(objects, result.Contents...)
+		prefixes = append(prefixes, result.CommonPrefixes...)
+
+		if !result.IsTruncated || (limit > 0 && len(objects)+len(prefixes) >= limit) {
+			return objects, prefixes, nil
+		}
+		if !v1 && result.NextContinuationToken != "" {
+			token = result.NextContinuationToken
+			continue
+		}
+
+		// A truncated v2 request without a continuation token was answered
+		// in the v1 format. V1 returns NextMarker only with a delimiter;
+		// otherwise the listing continues after the last entry.
+		if !v1 {
+			c.listV1.Store(true)
+			v1 = true
+		}
+		next := result.NextMarker
+		if next == "" {
+			next = lastEntry(result)
+		}
+		if next <= marker {
+			return nil, nil, backend.InvalidResponse(fmt.Errorf("truncated listing of %q has no continuation token or marker", prefix))
+		}
+		marker = next
+	}
+}
+
+// listPage makes one ListObjectsV2 request, or ListObjects when v1 is set,
+// of at most maxKeys entries when maxKeys is not 0. The span is named
+// after the call made.
+func (c *Client) listPage(ctx context.Context, prefix, delimiter string, maxKeys int, v1 bool, token, marker string) (result ListBucketResult, err error) {
+	op := "s3.ListObjectsV2"
+	if v1 {
+		op = "s3.ListObjects"
+	}
+	ctx, span := trace.Start(ctx, op, trace.KindClient)
+	span.SetAttribute("s3.bucket", c.bucket)
+	span.SetAttribute("s3.prefix", prefix)
+	defer func() {
+		span.SetAttribute("s3.key_count", len(result.Contents)+len(result.CommonPrefixes))
+		if err != nil {
+			span.SetError(err.Error())
+		}
+		span.End()
+	}()
+
+	query := url.Values{}
+	query.Set("prefix", prefix)
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if maxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(maxKeys))
+	}
+	switch {
+	case v1 && marker != "":
+		query.Set("marker", marker)
+	case !v1:
+		query.Set("list-type", "2")
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+	}
+
+	body, err := c.fetch(ctx, span, fmt.Sprintf("%s/%s?%s", c.endpoint, c.bucket, query.Encode()))
+	if err != nil {
+		return ListBucketResult{}, err
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return ListBucketResult{}, backend.InvalidResponse(fmt.Errorf("failed to parse XML: %w", err))
+	}
+	return result, nil
+}
+
+// lastEntry returns the greatest key or common prefix in result.
+func lastEntry(result ListBucketResult) string {
+	var last string
+	if n := len(result.Contents); n > 0 {
+		last = result.Contents[n-1].Key
+	}
+	if n := len(result.CommonPrefixes); n > 0 {
+		last = max(last, result.CommonPrefixes[n-1])
+	}
+	return last
+}
+
+// listV2Unsupported reports whether err is a store rejecting list-type=2,
+// which those without ListObjectsV2 do with 501 or 400 InvalidArgument.
+func listV2Unsupported(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.StatusCode == http.StatusNotImplemented || e.Code == "NotImplemented" ||
+		(e.StatusCode == http.StatusBadRequest && e.Code == "InvalidArgument")
+}
+
+// ReadFile returns the object {namespace}/{pvc}/{dir}/{name}.
+func (c *Client) ReadFile(ctx context.Context, namespace, pvc, dir, name string) ([]byte, error) {
+	key := strings.Join([]string{namespace, pvc, dir, name}, "/")
+	return c.get(ctx, "s3.GetObject", fmt.Sprintf("%s/%s/%s", c.endpoint, c.bucket, (&url.URL{Path: key}).EscapedPath()))
+}
+
+// get performs a GET request, recorded as a client span named op.
+func (c *Client) get(ctx context.Context, op, reqURL string) (_ []byte, err error) {
+	ctx, span := trace.Start(ctx, op, trace.KindClient)
+	span.SetAttribute("s3.bucket", c.bucket)
+	defer func() {
+		if err != nil {
+			span.SetError(err.Error())
+		}
+		span.End()
+	}()
+	return c.fetch(ctx, span, reqURL)
+}
+
+// fetch performs a GET request and returns the body of a 200 response,
+// recording the status code on span.
+func (c *Client) fetch(ctx context.Context, span *trace.Active, reqURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	trace.Inject(ctx, req)
+	c.sign(req, nil)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query S3: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, backend.InvalidResponse(fmt.Errorf("failed to read response: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseError(resp.StatusCode, body)
+	}
+	return body, nil
+}
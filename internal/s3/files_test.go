@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+func TestListFiles_Paginates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/volsync-backup" || query.Get("prefix") != "karakeep/data-pvc/snapshots/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		if query.Get("continuation-token") == "" {
+			fmt.Fprint(w, `<ListBucketResult><KeyCount>1</KeyCount><Contents><Key>karakeep/data-pvc/snapshots/abc</Key></Contents>`+
+				`<IsTruncated>true</IsTruncated><NextContinuationToken>page2</NextContinuationToken></ListBucketResult>`)
+			return
+		}
+		fmt.Fprint(w, `<ListBucketResult><KeyCount>1</KeyCount><Contents><Key>karakeep/data-pvc/snapshots/def</Key></Contents>`+
+			`<IsTruncated>false</IsTruncated></ListBucketResult>`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "volsync-backup", &http.Client{Timeout: 5 * time.Second})
+	names, err := client.ListFiles(context.Background(), "karakeep", "data-pvc", "snapshots")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if want := []string{"abc", "def"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListFiles() = %v, want %v", names, want)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/volsync-backup/karakeep/data-pvc/keys/abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("key"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "volsync-backup", &http.Client{Timeout: 5 * time.Second})
+	data, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "abc")
+	if err != nil || string(data) != "key" {
+		t.Errorf("ReadFile() = %q, %v; want %q", data, err, "key")
+	}
+	if _, err := client.ReadFile(context.Background(), "karakeep", "data-pvc", "keys", "missing"); err == nil {
+		t.Error("expected error for missing object")
+	}
+}
+
+func TestListSnapshotFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("prefix") != "karakeep/data-pvc/snapshots/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `<ListBucketResult><KeyCount>1</KeyCount><Contents><Key>karakeep/data-pvc/snapshots/abc</Key>`+
+			`<LastModified>2026-10-16T02:01:07.000Z</LastModified></Contents></ListBucketResult>`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "volsync-backup", &http.Client{Timeout: 5 * time.Second})
+	files, err := client.ListSnapshotFiles(context.Background(), "karakeep", "data-pvc")
+	if err != nil {
+		t.Fatalf("ListSnapshotFiles() error = %v", err)
+	}
+	want := time.Date(2026, 10, 16, 2, 1, 7, 0, time.UTC)
+	if len(files) != 1 || files[0].Name != "abc" || !files[0].ModTime.Equal(want) {
+		t.Errorf("ListSnapshotFiles() = %+v", files)
+	}
+}
+
+func TestListRepositories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("delimiter") != "/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch query.Get("prefix") {
+		case "":
+			fmt.Fprint(w, `<ListBucketResult><CommonPrefixes><Prefix>karakeep/</Prefix></CommonPrefixes>`+
+				`<CommonPrefixes><Prefix>paperless/</Prefix></CommonPrefixes></ListBucketResult>`)
+		case "karakeep/":
+			fmt.Fprint(w, `<ListBucketResult><CommonPrefixes><Prefix>karakeep/data-pvc/</Prefix></CommonPrefixes></ListBucketResult>`)
+		default:
+			fmt.Fprint(w, `<ListBucketResult><CommonPrefixes><Prefix>paperless/media/</Prefix></CommonPrefixes></ListBucketResult>`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "volsync-backup", &http.Client{Timeout: 5 * time.Second})
+	repos, err := client.ListRepositories(context.Background())
+	if err != nil {
+		t.Fatalf("ListRepositories() error = %v", err)
+	}
+	want := []backend.Repository{{Namespace: "karakeep", PVC: "data-pvc"}, {Namespace: "paperless", PVC: "media"}}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("ListRepositories() = %v, want %v", repos, want)
+	}
+}
@@ -0,0 +1,189 @@
+// Package stats totals the size and contents of backup repositories, so that
+// a restore can be sized and timed before it starts.
+package stats
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+// ErrNotFound is returned when a repository has no files.
+var ErrNotFound = errors.New("repository not found")
+
+// Stats are the totals of one repository.
+type Stats struct {
+	Namespace  string `json:"namespace"`
+	PVC        string `json:"pvc"`
+	RepoType   string `json:"repoType"`
+	TotalBytes int64  `json:"totalBytes"`
+	Objects    int    `json:"objects"`
+	// Packs are restic data packs or Kopia p and q blobs, and hold the
+	// repository's contents.
+	Packs     int   `json:"packs"`
+	PackBytes int64 `json:"packBytes"`
+	Indexes   int   `json:"indexes"`
+	// Snapshots counts restic snapshot files. Kopia keeps snapshot
+	// manifests inside packs, so it is 0 for Kopia repositories.
+	Snapshots  int       `json:"snapshots"`
+	Growth     Growth    `json:"growth"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// Growth is the size of the packs written recently. Packs are never
+// modified, so their modification times show when data was added. A prune
+// rewrites packs and makes growth look larger until the window passes.
+type Growth struct {
+	LastDayBytes  int64 `json:"lastDayBytes"`
+	LastWeekBytes int64 `json:"lastWeekBytes"`
+}
+
+// Compute totals files, the complete listing of namespace/pvc, as of now.
+func Compute(namespace, pvc string, files []backend.RepositoryFile, now time.Time) Stats {
+	s := Stats{Namespace: namespace, PVC: pvc, ComputedAt: now}
+
+	// Classify the repository from its top level, as a check would.
+	seen := make(map[string]bool)
+	var entries []string
+	for _, f := range files {
+		entry := f.Path
+		if dir, _, ok := strings.Cut(f.Path, "/"); ok {
+			entry = dir + "/"
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	s.RepoType = backend.Inspect(entries).RepoType
+
+	for _, f := range files {
+		s.Objects++
+		s.TotalBytes += f.Size
+		switch kind(s.RepoType, f.Path) {
+		case "pack":
+			s.Packs++
+			s.PackBytes += f.Size
+			age := now.Sub(f.ModTime)
+			if age <= 24*time.Hour {
+				s.Growth.LastDayBytes += f.Size
+			}
+			if age <= 7*24*time.Hour {
+				s.Growth.LastWeekBytes += f.Size
+			}
+		case "index":
+			s.Indexes++
+		case "snapshot":
+			s.Snapshots++
+		}
+	}
+	return s
+}
+
+// kind classifies a file by repository layout: restic keeps each kind in
+// its own directory, and Kopia names blobs by prefix, optionally sharded
+// into directories and suffixed with ".f".
+func kind(repoType, path string) string {
+	switch repoType {
+	case backend.RepoTypeRestic:
+		dir, _, _ := strings.Cut(path, "/")
+		switch dir {
+		case "data":
+			return "pack"
+		case "index":
+			return "index"
+		case "snapshots":
+			return "snapshot"
+		}
+	case backend.RepoTypeKopia:
+		// Sharding splits the blob ID, so its prefix is in the first
+		// path element.
+		first, _, _ := strings.Cut(path, "/")
+		name := strings.TrimSuffix(first, ".f")
+		switch {
+		case strings.HasPrefix(name, "p"), strings.HasPrefix(name, "q"):
+			return "pack"
+		case strings.HasPrefix(name, "xn"):
+			return "index"
+		}
+	}
+	return ""
+}
+
+// Collector computes stats from complete repository listings and caches
+// them for ttl. Concurrent requests for the same repository share one
+// listing.
+type Collector struct {
+	source backend.RepositoryFileLister
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[backend.Repository]*entry
+}
+
+type entry struct {
+	done    chan struct{}
+	stats   Stats
+	err     error
+	expires time.Time
+}
+
+func New(source backend.RepositoryFileLister, ttl time.Duration) *Collector {
+	return &Collector{
+		source:  source,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[backend.Repository]*entry),
+	}
+}
+
+// Get returns the stats of namespace/pvc, listing the repository when no
+// cached stats are fresh. Failures and missing repositories are not cached.
+func (c *Collector) Get(ctx context.Context, namespace, pvc string) (Stats, error) {
+	repo := backend.Repository{Namespace: namespace, PVC: pvc}
+
+	c.mu.Lock()
+	if e, ok := c.entries[repo]; ok {
+		select {
+		case <-e.done:
+			if c.now().Before(e.expires) {
+				c.mu.Unlock()
+				return e.stats, nil
+			}
+		default:
+			c.mu.Unlock()
+			select {
+			case <-e.done:
+				return e.stats, e.err
+			case <-ctx.Done():
+				return Stats{}, ctx.Err()
+			}
+		}
+	}
+	e := &entry{done: make(chan struct{})}
+	c.entries[repo] = e
+	c.mu.Unlock()
+
+	files, err := c.source.ListRepositoryFiles(ctx, namespace, pvc)
+	if err == nil && len(files) == 0 {
+		err = ErrNotFound
+	}
+	now := c.now()
+	if err == nil {
+		e.stats = Compute(namespace, pvc, files, now)
+	}
+
+	c.mu.Lock()
+	e.err, e.expires = err, now.Add(c.ttl)
+	if err != nil {
+		delete(c.entries, repo)
+	}
+	close(e.done)
+	c.mu.Unlock()
+	return e.stats, e.err
+}
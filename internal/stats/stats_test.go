@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mitchross/pvc-plumber/backendtest"
+	"github.com/mitchross/pvc-plumber/internal/backend"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func TestCompute_Restic(t *testing.T) {
+	fake := backendtest.New()
+	fake.AddRepository("karakeep", "data-pvc", now.Add(-2*time.Hour), now.Add(-3*24*time.Hour), now.Add(-30*24*time.Hour))
+	files, _ := fake.ListRepositoryFiles(context.Background(), "karakeep", "data-pvc")
+
+	s := Compute("karakeep", "data-pvc", files, now)
+	want := Stats{
+		Namespace:  "karakeep",
+		PVC:        "data-pvc",
+		RepoType:   backend.RepoTypeRestic,
+		TotalBytes: 155 + 460 + 3*(1<<20+1024+256),
+		Objects:    11,
+		Packs:      3,
+		PackBytes:  3 << 20,
+		Indexes:    3,
+		Snapshots:  3,
+		Growth:     Growth{LastDayBytes: 1 << 20, LastWeekBytes: 2 << 20},
+		ComputedAt: now,
+	}
+	if s != want {
+		t.Errorf("Compute() = %+v\nwant %+v", s, want)
+	}
+}
+
+func TestCompute_Kopia(t *testing.T) {
+	files := []backend.RepositoryFile{
+		{Path: "kopia.repository.f", Size: 1000},
+		{Path: "kopia.blobcfg.f", Size: 30},
+		{Path: "p12/3456.f", Size: 20 << 20, ModTime: now.Add(-time.Hour)},
+		{Path: "q98/7654.f", Size: 1 << 20, ModTime: now.Add(-10 * 24 * time.Hour)},
+		{Path: "xn0_abc.f", Size: 4096},
+		{Path: "_log_123.f", Size: 100},
+	}
+
+	s := Compute("paperless", "media", files, now)
+	if s.RepoType != backend.RepoTypeKopia || s.Packs != 2 || s.PackBytes != 21<<20 || s.Indexes != 1 || s.Snapshots != 0 {
+		t.Errorf("Compute() = %+v", s)
+	}
+	if s.Growth != (Growth{LastDayBytes: 20 << 20, LastWeekBytes: 20 << 20}) {
+		t.Errorf("Growth = %+v", s.Growth)
+	}
+}
+
+// countingLister counts ListRepositoryFiles calls.
+type countingLister struct {
+	*backendtest.Backend
+	calls atomic.Int32
+}
+
+func (l *countingLister) ListRepositoryFiles(ctx context.Context, namespace, pvc string) ([]backend.RepositoryFile, error) {
+	l.calls.Add(1)
+	return l.Backend.ListRepositoryFiles(ctx, namespace, pvc)
+}
+
+func TestCollector(t *testing.T) {
+	lister := &countingLister{Backend: backendtest.New()}
+	lister.AddRepository("karakeep", "data-pvc", now)
+	lister.Fail("karakeep", "broken", &backend.HTTPError{Service: "S3", StatusCode: http.StatusServiceUnavailable})
+
+	c := New(lister, time.Minute)
+	clock := now
+	c.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		s, err := c.Get(ctx, "karakeep", "data-pvc")
+		if err != nil || s.Packs != 1 || !s.ComputedAt.Equal(now) {
+			t.Fatalf("Get() = %+v, %v", s, err)
+		}
+	}
+	if calls := lister.calls.Load(); calls != 1 {
+		t.Errorf("listings = %d, want 1", calls)
+	}
+
+	clock = clock.Add(time.Minute)
+	if s, _ := c.Get(ctx, "karakeep", "data-pvc"); !s.ComputedAt.Equal(clock) || lister.calls.Load() != 2 {
+		t.Errorf("expired stats were reused: %+v, listings = %d", s, lister.calls.Load())
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, "karakeep", "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() missing error = %v, want ErrNotFound", err)
+		}
+		if _, err := c.Get(ctx, "karakeep", "broken"); err == nil {
+			t.Error("Get() broken error = nil")
+		}
+	}
+	if calls := lister.calls.Load(); calls != 6 {
+		t.Errorf("listings = %d, want 6; failures must not be cached", calls)
+	}
+}
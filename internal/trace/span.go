@@ -0,0 +1,202 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SpanKind values match the OTLP SpanKind enum.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// SpanData is a finished span handed to an Exporter.
+type SpanData struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]any
+	// Error is the status message of a failed span; empty means OK.
+	Error string
+}
+
+// Exporter receives finished spans. Export must not block.
+type Exporter interface {
+	Export(SpanData)
+}
+
+// Tracer samples new traces and records spans of sampled requests to an
+// exporter.
+type Tracer struct {
+	exporter Exporter
+	ratio    float64
+}
+
+// NewTracer returns a Tracer that samples ratio (0 to 1) of the traces
+// started here. Traces continued from a caller follow the caller's sampled
+// flag. A nil exporter records nothing.
+func NewTracer(exporter Exporter, ratio float64) *Tracer {
+	return &Tracer{exporter: exporter, ratio: ratio}
+}
+
+// noopTracer propagates context without recording spans.
+var noopTracer = &Tracer{ratio: 1}
+
+// Middleware accepts or generates a request ID and trace context for every
+// request, stores them in the request context, echoes them in the response
+// headers and records a server span when the request is sampled.
+func (t *Tracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := FromRequest(r)
+		if s.ParentID == "" {
+			s.Flags = "00"
+			if t.sample(s.TraceID) {
+				s.Flags = "01"
+			}
+		}
+		s.exporter = t.exporter
+		w.Header().Set(RequestIDHeader, s.RequestID)
+		w.Header().Set(TraceparentHeader, s.Traceparent())
+
+		if s.exporter == nil || !s.Sampled() {
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), s)))
+			return
+		}
+
+		span := &Active{exporter: s.exporter, data: SpanData{
+			TraceID:  s.TraceID,
+			SpanID:   s.SpanID,
+			ParentID: s.ParentID,
+			Name:     r.Method,
+			Kind:     KindServer,
+			Start:    time.Now(),
+			Attributes: map[string]any{
+				"http.request.method": r.Method,
+				"url.path":            r.URL.Path,
+				"request.id":          s.RequestID,
+			},
+		}}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(NewContext(r.Context(), s)))
+		span.SetAttribute("http.response.status_code", sw.status)
+		if sw.status >= 500 {
+			span.SetError(http.StatusText(sw.status))
+		}
+		span.End()
+	})
+}
+
+// sample decides on a new trace from its ID, as the OpenTelemetry
+// TraceIdRatioBased sampler does, so that every service reaches the same
+// decision for a trace.
+func (t *Tracer) sample(traceID string) bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	if t.ratio <= 0 {
+		return false
+	}
+	b, err := hex.DecodeString(traceID[16:])
+	if err != nil {
+		return false
+	}
+	return binary.BigEndian.Uint64(b)>>1 < uint64(t.ratio*(1<<63))
+}
+
+// Sampled reports whether the sampled trace flag is set.
+func (s Span) Sampled() bool {
+	b, err := hex.DecodeString(s.Flags)
+	return err == nil && len(b) == 1 && b[0]&1 == 1
+}
+
+// Active is a span in progress. All methods are no-ops on a nil *Active,
+// which Start returns when the request is not being recorded.
+type Active struct {
+	exporter Exporter
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Start begins a child of the span in ctx and returns a context carrying
+// it, so that upstream requests made with that context name it as their
+// parent.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Active) {
+	parent, ok := FromContext(ctx)
+	if !ok || parent.exporter == nil || !parent.Sampled() {
+		return ctx, nil
+	}
+	child := parent
+	child.SpanID = randomHex(8)
+	child.ParentID = parent.SpanID
+	span := &Active{exporter: parent.exporter, data: SpanData{
+		TraceID:    parent.TraceID,
+		SpanID:     child.SpanID,
+		ParentID:   parent.SpanID,
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]any),
+	}}
+	return NewContext(ctx, child), span
+}
+
+// SetAttribute records a string, bool, integer or float attribute.
+func (a *Active) SetAttribute(key string, value any) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.data.Attributes[key] = value
+	a.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (a *Active) SetError(message string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.data.Error = message
+	a.mu.Unlock()
+}
+
+// End finishes the span and exports it. Only the first call has an effect.
+func (a *Active) End() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	if a.ended {
+		a.mu.Unlock()
+		return
+	}
+	a.ended = true
+	a.data.End = time.Now()
+	data := a.data
+	a.mu.Unlock()
+	a.exporter.Export(data)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
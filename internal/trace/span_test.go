@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(s SpanData) {
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+}
+
+func TestTracer_RecordsSpans(t *testing.T) {
+	rec := &recorder{}
+	var upstream *http.Request
+	h := NewTracer(rec, 1).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := Start(r.Context(), "check-backup", KindInternal)
+		span.SetAttribute("namespace", "karakeep")
+		upstream = httptest.NewRequest("GET", "http://minio:9000/volsync", nil)
+		Inject(ctx, upstream)
+		span.SetError("S3 returned status 503")
+		span.End()
+		span.End()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	req := httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil)
+	req.Header.Set(TraceparentHeader, parent)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(rec.spans))
+	}
+	child, server := rec.spans[0], rec.spans[1]
+	if server.Kind != KindServer || server.ParentID != "00f067aa0ba902b7" || server.Attributes["http.response.status_code"] != http.StatusBadGateway || server.Error == "" {
+		t.Errorf("server span = %+v", server)
+	}
+	if child.TraceID != server.TraceID || child.ParentID != server.SpanID || child.Attributes["namespace"] != "karakeep" || child.Error != "S3 returned status 503" {
+		t.Errorf("child span = %+v", child)
+	}
+	if want := "00-" + child.TraceID + "-" + child.SpanID + "-01"; upstream.Header.Get(TraceparentHeader) != want {
+		t.Errorf("upstream traceparent = %q, want %q", upstream.Header.Get(TraceparentHeader), want)
+	}
+	if child.End.Before(child.Start) {
+		t.Errorf("child span ends before it starts")
+	}
+}
+
+func TestTracer_Sampling(t *testing.T) {
+	tests := []struct {
+		name        string
+		ratio       float64
+		traceparent string
+		wantFlags   string
+		wantSpans   int
+	}{
+		{name: "ratio one", ratio: 1, wantFlags: "01", wantSpans: 1},
+		{name: "ratio zero", ratio: 0, wantFlags: "00"},
+		{name: "sampled parent wins over ratio", ratio: 0, traceparent: parent, wantFlags: "01", wantSpans: 1},
+		{name: "unsampled parent wins over ratio", ratio: 1, traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", wantFlags: "00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			var child *Active
+			h := NewTracer(rec, tt.ratio).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, child = Start(r.Context(), "child", KindInternal)
+			}))
+			req := httptest.NewRequest("GET", "/healthz", nil)
+			if tt.traceparent != "" {
+				req.Header.Set(TraceparentHeader, tt.traceparent)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got := w.Header().Get(TraceparentHeader); got[len(got)-2:] != tt.wantFlags {
+				t.Errorf("traceparent = %q, want flags %s", got, tt.wantFlags)
+			}
+			if len(rec.spans) != tt.wantSpans {
+				t.Errorf("exported %d spans, want %d", len(rec.spans), tt.wantSpans)
+			}
+			if (child != nil) != (tt.wantSpans > 0) {
+				t.Errorf("Start() span = %v", child)
+			}
+		})
+	}
+}
+
+func TestTracer_SampleRatio(t *testing.T) {
+	tracer := NewTracer(nil, 0.25)
+	sampled := 0
+	for i := 0; i < 4000; i++ {
+		if tracer.sample(randomHex(16)) {
+			sampled++
+		}
+	}
+	if sampled < 800 || sampled > 1200 {
+		t.Errorf("sampled %d of 4000 traces at ratio 0.25", sampled)
+	}
+}
+
+func TestStart_NotRecording(t *testing.T) {
+	ctx := context.Background()
+	got, span := Start(ctx, "check-backup", KindInternal)
+	if got != ctx || span != nil {
+		t.Errorf("Start() without a span = %v, %v", got, span)
+	}
+	// Methods are safe on the nil span.
+	span.SetAttribute("k", "v")
+	span.SetError("err")
+	span.End()
+}
@@ -0,0 +1,153 @@
+// Package trace propagates request IDs and W3C trace context
+// (https://www.w3.org/TR/trace-context/) from incoming requests to logs and
+// upstream calls.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	RequestIDHeader   = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// maxRequestIDLength bounds client-supplied request IDs.
+const maxRequestIDLength = 128
+
+// Span identifies the work done for one request.
+type Span struct {
+	RequestID string
+	TraceID   string
+	SpanID    string
+	// ParentID is the caller's span ID, empty when the trace started here.
+	ParentID   string
+	Flags      string
+	Tracestate string
+
+	exporter Exporter
+}
+
+// Traceparent formats s as a traceparent header value.
+func (s Span) Traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + s.Flags
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying s.
+func NewContext(ctx context.Context, s Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the span carried by ctx.
+func FromContext(ctx context.Context) (Span, bool) {
+	s, ok := ctx.Value(contextKey{}).(Span)
+	return s, ok
+}
+
+// Middleware propagates request IDs and trace context without recording
+// spans.
+func Middleware(next http.Handler) http.Handler {
+	return noopTracer.Middleware(next)
+}
+
+// FromRequest starts a span for r, continuing the caller's trace when r has
+// a valid traceparent header.
+func FromRequest(r *http.Request) Span {
+	s := Span{RequestID: r.Header.Get(RequestIDHeader), SpanID: randomHex(8), Flags: "01"}
+	if !validRequestID(s.RequestID) {
+		s.RequestID = randomHex(16)
+	}
+	if traceID, parentID, flags, ok := parseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+		s.TraceID, s.ParentID, s.Flags = traceID, parentID, flags
+		s.Tracestate = r.Header.Get(TracestateHeader)
+	} else {
+		s.TraceID = randomHex(16)
+	}
+	return s
+}
+
+// Inject copies the request ID and trace context in ctx to an outgoing
+// request, making the current span its parent.
+func Inject(ctx context.Context, req *http.Request) {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	req.Header.Set(RequestIDHeader, s.RequestID)
+	req.Header.Set(TraceparentHeader, s.Traceparent())
+	if s.Tracestate != "" {
+		req.Header.Set(TracestateHeader, s.Tracestate)
+	}
+}
+
+// Logger returns logger annotated with the request ID and trace context in
+// ctx, or logger unchanged when ctx has none.
+func Logger(ctx context.Context, logger *slog.Logger) *slog.Logger {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return logger
+	}
+	return logger.With("request_id", s.RequestID, "trace_id", s.TraceID, "span_id", s.SpanID)
+}
+
+// parseTraceparent validates a version 00 traceparent header. Later versions
+// are parsed by their version 00 prefix as the specification requires.
+func parseTraceparent(value string) (traceID, parentID, flags string, ok bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHex(parts[0]) {
+		return "", "", "", false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", "", false
+	}
+	traceID, parentID, flags = parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || !isHex(traceID) || allZero(traceID) ||
+		len(parentID) != 16 || !isHex(parentID) || allZero(parentID) ||
+		len(flags) != 2 || !isHex(flags) {
+		return "", "", "", false
+	}
+	return traceID, parentID, flags, true
+}
+
+// validRequestID accepts printable ASCII IDs of bounded length so that
+// client input cannot inject header or log syntax.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHex reports whether s is lowercase hexadecimal.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func allZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
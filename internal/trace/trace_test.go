@@ -0,0 +1,101 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddleware_Propagates(t *testing.T) {
+	var got Span
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/exists/karakeep/data-pvc", nil)
+	req.Header.Set(RequestIDHeader, "kyverno-123")
+	req.Header.Set(TraceparentHeader, parent)
+	req.Header.Set(TracestateHeader, "vendor=x")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got.RequestID != "kyverno-123" || got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("span = %+v", got)
+	}
+	if got.SpanID == got.ParentID || len(got.SpanID) != 16 {
+		t.Errorf("SpanID = %q, want a new span", got.SpanID)
+	}
+	if w.Header().Get(RequestIDHeader) != "kyverno-123" {
+		t.Errorf("response %s = %q", RequestIDHeader, w.Header().Get(RequestIDHeader))
+	}
+	if w.Header().Get(TraceparentHeader) != got.Traceparent() {
+		t.Errorf("response traceparent = %q, want %q", w.Header().Get(TraceparentHeader), got.Traceparent())
+	}
+
+	out := httptest.NewRequest("GET", "http://minio:9000/volsync", nil)
+	Inject(NewContext(context.Background(), got), out)
+	if out.Header.Get(RequestIDHeader) != "kyverno-123" || out.Header.Get(TraceparentHeader) != got.Traceparent() || out.Header.Get(TracestateHeader) != "vendor=x" {
+		t.Errorf("upstream headers = %v", out.Header)
+	}
+}
+
+func TestMiddleware_Generates(t *testing.T) {
+	for name, headers := range map[string][2]string{
+		"missing":               {"", ""},
+		"invalid traceparent":   {"", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+		"zero trace id":         {"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		"uppercase trace id":    {"", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		"invalid version":       {"", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"request id with space": {"a b", ""},
+		"request id too long":   {strings.Repeat("a", maxRequestIDLength+1), ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/healthz", nil)
+			if headers[0] != "" {
+				req.Header.Set(RequestIDHeader, headers[0])
+			}
+			if headers[1] != "" {
+				req.Header.Set(TraceparentHeader, headers[1])
+			}
+			s := FromRequest(req)
+			if len(s.RequestID) != 32 || len(s.TraceID) != 32 || s.ParentID != "" || s.Flags != "01" {
+				t.Errorf("span = %+v, want generated IDs", s)
+			}
+			if s.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Error("invalid traceparent was accepted")
+			}
+		})
+	}
+}
+
+func TestParseTraceparent_FutureVersion(t *testing.T) {
+	traceID, _, _, ok := parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	if !ok || traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("parseTraceparent() = %q, %v", traceID, ok)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	Logger(context.Background(), logger).Info("no span")
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("log without span = %q", buf.String())
+	}
+
+	buf.Reset()
+	ctx := NewContext(context.Background(), Span{RequestID: "req-1", TraceID: "t", SpanID: "s", Flags: "01"})
+	Logger(ctx, logger).Info("with span")
+	for _, want := range []string{"request_id=req-1", "trace_id=t", "span_id=s"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log = %q, want %s", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package volsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mitchross/pvc-plumber/internal/kube"
+)
+
+const (
+	Group      = "volsync.backube"
+	APIVersion = Group + "/v1alpha1"
+	Kind       = "ReplicationDestination"
+
+	fieldManager = "pvc-plumber"
+	managedBy    = "app.kubernetes.io/managed-by"
+	resource     = "replicationdestinations"
+)
+
+// Copy methods supported by the VolSync restic mover.
+const (
+	CopyMethodSnapshot = "Snapshot"
+	CopyMethodDirect   = "Direct"
+	CopyMethodClone    = "Clone"
+)
+
+var (
+	// ErrApplyDisabled is returned by Apply and Authorize when no
+	// Kubernetes client is set.
+	ErrApplyDisabled = errors.New("applying restore plans is not enabled")
+	// ErrUnmanaged is returned by Apply when an object pvc-plumber did not
+	// create already has the plan's name.
+	ErrUnmanaged = errors.New("object exists and is not managed by pvc-plumber")
+	// ErrUnauthenticated and ErrForbidden are returned by Authorize.
+	ErrUnauthenticated = errors.New("a valid bearer token is required")
+	ErrForbidden       = errors.New("not allowed to patch replicationdestinations")
+)
+
+type Trigger struct {
+	Manual string `json:"manual,omitempty"`
+}
+
+type ResticSpec struct {
+	Repository              string   `json:"repository"`
+	CopyMethod              string   `json:"copyMethod"`
+	DestinationPVC          string   `json:"destinationPVC,omitempty"`
+	Capacity                string   `json:"capacity,omitempty"`
+	AccessModes             []string `json:"accessModes,omitempty"`
+	StorageClassName        *string  `json:"storageClassName,omitempty"`
+	VolumeSnapshotClassName *string  `json:"volumeSnapshotClassName,omitempty"`
+	RestoreAsOf             string   `json:"restoreAsOf,omitempty"`
+}
+
+type ReplicationDestinationSpec struct {
+	Trigger *Trigger    `json:"trigger,omitempty"`
+	Restic  *ResticSpec `json:"restic"`
+}
+
+type ReplicationDestination struct {
+	APIVersion string                     `json:"apiVersion"`
+	Kind       string                     `json:"kind"`
+	Metadata   kube.ObjectMeta            `json:"metadata"`
+	Spec       ReplicationDestinationSpec `json:"spec"`
+}
+
+// Path returns the object's URL path on the Kubernetes API server.
+func (rd *ReplicationDestination) Path() string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/replicationdestinations/%s",
+		APIVersion, url.PathEscape(rd.Metadata.Namespace), url.PathEscape(rd.Metadata.Name))
+}
+
+type Options struct {
+	// NameTemplate and RepositorySecretTemplate accept {namespace} and {pvc}.
+	NameTemplate             string
+	RepositorySecretTemplate string
+	CopyMethod               string
+	StorageClassName         string
+	VolumeSnapshotClassName  string
+	Capacity                 string
+}
+
+// ExpandTemplate substitutes {namespace} and {pvc} in tmpl.
+func ExpandTemplate(tmpl, namespace, pvc string) string {
+	return strings.NewReplacer("{namespace}", namespace, "{pvc}", pvc).Replace(tmpl)
+}
+
+// Planner renders ReplicationDestination objects that restore a PVC from
+// its restic repository, and optionally applies them.
+type Planner struct {
+	opts Options
+	kube *kube.Client
+}
+
+// NewPlanner returns a Planner. kubeClient may be nil, in which case plans
+// are rendered from Options alone and Apply is disabled.
+func NewPlanner(opts Options, kubeClient *kube.Client) *Planner {
+	if opts.NameTemplate == "" {
+		opts.NameTemplate = "{pvc}-dst"
+	}
+	if opts.RepositorySecretTemplate == "" {
+		opts.RepositorySecretTemplate = "{pvc}-volsync-secret"
+	}
+	if opts.CopyMethod == "" {
+		opts.CopyMethod = CopyMethodSnapshot
+	}
+	return &Planner{opts: opts, kube: kubeClient}
+}
+
+func (p *Planner) CanApply() bool {
+	return p.kube != nil
+}
+
+// Plan renders the ReplicationDestination for namespace/pvc. capacity
+// overrides the size taken from the live PVC or the configured default.
+func (p *Planner) Plan(ctx context.Context, namespace, pvc, capacity string) (*ReplicationDestination, error) {
+	restic := &ResticSpec{
+		Repository: ExpandTemplate(p.opts.RepositorySecretTemplate, namespace, pvc),
+		CopyMethod: p.opts.CopyMethod,
+	}
+
+	if p.opts.CopyMethod == CopyMethodDirect {
+		// Direct restores straight into the existing claim, which supplies
+		// its own size, access modes and storage class.
+		restic.DestinationPVC = pvc
+	} else {
+		restic.Capacity = p.opts.Capacity
+		restic.AccessModes = []string{"ReadWriteOnce"}
+		storageClass := p.opts.StorageClassName
+
+		if p.kube != nil {
+			live, err := p.kube.GetPVC(ctx, namespace, pvc)
+			switch {
+			case err == nil:
+				if size := live.Spec.Resources.Requests["storage"]; size != "" {
+					restic.Capacity = size
+				}
+				if len(live.Spec.AccessModes) > 0 {
+					restic.AccessModes = live.Spec.AccessModes
+				}
+				if storageClass == "" && live.Spec.StorageClassName != nil {
+					storageClass = *live.Spec.StorageClassName
+				}
+			case kube.IsNotFound(err):
+				// The claim is usually created after its restore source.
+			default:
+				return nil, fmt.Errorf("failed to read PVC %s/%s: %w", namespace, pvc, err)
+			}
+		}
+
+		if capacity != "" {
+			restic.Capacity = capacity
+		}
+		if storageClass != "" {
+			restic.StorageClassName = &storageClass
+		}
+		if p.opts.VolumeSnapshotClassName != "" {
+			snapshotClass := p.opts.VolumeSnapshotClassName
+			restic.VolumeSnapshotClassName = &snapshotClass
+		}
+	}
+
+	return &ReplicationDestination{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Metadata: kube.ObjectMeta{
+			Name:      ExpandTemplate(p.opts.NameTemplate, namespace, pvc),
+			Namespace: namespace,
+			Labels: map[string]string{
+				managedBy: fieldManager,
+			},
+		},
+		Spec: ReplicationDestinationSpec{
+			Trigger: &Trigger{Manual: "restore-once"},
+			Restic:  restic,
+		},
+	}, nil
+}
+
+// Authorize checks that the caller presenting token may patch the
+// ReplicationDestination of namespace/pvc, so that applying a plan never
+// does more than the caller could do with kubectl.
+func (p *Planner) Authorize(ctx context.Context, token, namespace, pvc string) error {
+	if p.kube == nil {
+		return ErrApplyDisabled
+	}
+	if token == "" {
+		return ErrUnauthenticated
+	}
+	user, err := p.kube.ReviewToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUnauthenticated
+	}
+	allowed, err := p.kube.Authorize(ctx, user, kube.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      "patch",
+		Group:     Group,
+		Resource:  resource,
+		Name:      ExpandTemplate(p.opts.NameTemplate, namespace, pvc),
+	})
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w in namespace %s: user %s", ErrForbidden, namespace, user.Username)
+	}
+	return nil
+}
+
+// Apply creates or updates rd with server-side apply. It refuses to take
+// over an existing object that lacks pvc-plumber's managed-by label, and
+// does not force fields owned by other managers.
+func (p *Planner) Apply(ctx context.Context, rd *ReplicationDestination) error {
+	if p.kube == nil {
+		return ErrApplyDisabled
+	}
+	var existing ReplicationDestination
+	err := p.kube.Get(ctx, rd.Path(), &existing)
+	switch {
+	case err == nil:
+		if existing.Metadata.Labels[managedBy] != fieldManager {
+			return fmt.Errorf("%s %s/%s: %w", Kind, rd.Metadata.Namespace, rd.Metadata.Name, ErrUnmanaged)
+		}
+	case kube.IsNotFound(err):
+	default:
+		return fmt.Errorf("failed to read %s %s/%s: %w", Kind, rd.Metadata.Namespace, rd.Metadata.Name, err)
+	}
+	if err := p.kube.Apply(ctx, rd.Path(), fieldManager, rd, nil); err != nil {
+		return fmt.Errorf("failed to apply %s %s/%s: %w", Kind, rd.Metadata.Namespace, rd.Metadata.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package volsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mitchross/pvc-plumber/internal/kube"
+	"github.com/mitchross/pvc-plumber/internal/kube/kubetest"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestExpandTemplate(t *testing.T) {
+	got := ExpandTemplate("{namespace}-{pvc}-restic", "karakeep", "data-pvc")
+	if got != "karakeep-data-pvc-restic" {
+		t.Errorf("ExpandTemplate() = %q", got)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		livePVC  *kube.PersistentVolumeClaim
+		capacity string
+		wantName string
+		wantSpec ResticSpec
+		withKube bool
+	}{
+		{
+			name:     "defaults",
+			opts:     Options{},
+			wantName: "data-pvc-dst",
+			wantSpec: ResticSpec{
+				Repository:  "data-pvc-volsync-secret",
+				CopyMethod:  CopyMethodSnapshot,
+				AccessModes: []string{"ReadWriteOnce"},
+			},
+		},
+		{
+			name:     "direct restores into the PVC",
+			opts:     Options{CopyMethod: CopyMethodDirect, Capacity: "5Gi", StorageClassName: "longhorn"},
+			wantName: "data-pvc-dst",
+			wantSpec: ResticSpec{
+				Repository:     "data-pvc-volsync-secret",
+				CopyMethod:     CopyMethodDirect,
+				DestinationPVC: "data-pvc",
+			},
+		},
+		{
+			name: "configured templates and classes",
+			opts: Options{
+				NameTemplate:             "restore-{pvc}",
+				RepositorySecretTemplate: "volsync-{namespace}-{pvc}",
+				Capacity:                 "1Gi",
+				StorageClassName:         "longhorn",
+				VolumeSnapshotClassName:  "longhorn-snap",
+			},
+			capacity: "20Gi",
+			wantName: "restore-data-pvc",
+			wantSpec: ResticSpec{
+				Repository:              "volsync-karakeep-data-pvc",
+				CopyMethod:              CopyMethodSnapshot,
+				Capacity:                "20Gi",
+				AccessModes:             []string{"ReadWriteOnce"},
+				StorageClassName:        strPtr("longhorn"),
+				VolumeSnapshotClassName: strPtr("longhorn-snap"),
+			},
+		},
+		{
+			name:     "live PVC supplies size, access modes and class",
+			opts:     Options{Capacity: "1Gi"},
+			withKube: true,
+			livePVC: &kube.PersistentVolumeClaim{
+				Metadata: kube.ObjectMeta{Namespace: "karakeep", Name: "data-pvc"},
+				Spec: kube.PersistentVolumeClaimSpec{
+					AccessModes:      []string{"ReadWriteMany"},
+					StorageClassName: strPtr("nfs"),
+					Resources:        kube.ResourceRequirements{Requests: map[string]string{"storage": "8Gi"}},
+				},
+			},
+			wantName: "data-pvc-dst",
+			wantSpec: ResticSpec{
+				Repository:       "data-pvc-volsync-secret",
+				CopyMethod:       CopyMethodSnapshot,
+				Capacity:         "8Gi",
+				AccessModes:      []string{"ReadWriteMany"},
+				StorageClassName: strPtr("nfs"),
+			},
+		},
+		{
+			name:     "missing live PVC falls back to options",
+			opts:     Options{Capacity: "1Gi"},
+			withKube: true,
+			wantName: "data-pvc-dst",
+			wantSpec: ResticSpec{
+				Repository:  "data-pvc-volsync-secret",
+				CopyMethod:  CopyMethodSnapshot,
+				Capacity:    "1Gi",
+				AccessModes: []string{"ReadWriteOnce"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kubeClient *kube.Client
+			if tt.withKube {
+				server := kubetest.NewServer()
+				defer server.Close()
+				if tt.livePVC != nil {
+					server.AddPVC(*tt.livePVC)
+				}
+				kubeClient = server.Client()
+			}
+
+			rd, err := NewPlanner(tt.opts, kubeClient).Plan(context.Background(), "karakeep", "data-pvc", tt.capacity)
+			if err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+
+			if rd.APIVersion != APIVersion || rd.Kind != Kind {
+				t.Errorf("type = %s/%s", rd.APIVersion, rd.Kind)
+			}
+			if rd.Metadata.Name != tt.wantName || rd.Metadata.Namespace != "karakeep" {
+				t.Errorf("metadata = %s/%s, want karakeep/%s", rd.Metadata.Namespace, rd.Metadata.Name, tt.wantName)
+			}
+			if rd.Spec.Trigger == nil || rd.Spec.Trigger.Manual == "" {
+				t.Error("expected a manual trigger")
+			}
+			if !reflect.DeepEqual(*rd.Spec.Restic, tt.wantSpec) {
+				got, _ := json.Marshal(rd.Spec.Restic)
+				want, _ := json.Marshal(tt.wantSpec)
+				t.Errorf("restic spec = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+
+	planner := NewPlanner(Options{}, server.Client())
+	rd, err := planner.Plan(context.Background(), "karakeep", "data-pvc", "")
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if err := planner.Apply(context.Background(), rd); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	raw, ok := server.Object("/apis/volsync.backube/v1alpha1/namespaces/karakeep/replicationdestinations/data-pvc-dst")
+	if !ok {
+		t.Fatal("ReplicationDestination was not applied")
+	}
+	var applied ReplicationDestination
+	if err := json.Unmarshal(raw, &applied); err != nil {
+		t.Fatalf("failed to decode applied object: %v", err)
+	}
+	if applied.Spec.Restic.Repository != "data-pvc-volsync-secret" {
+		t.Errorf("applied repository = %q", applied.Spec.Restic.Repository)
+	}
+}
+
+func TestApply_Unmanaged(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+
+	planner := NewPlanner(Options{}, server.Client())
+	rd, err := planner.Plan(context.Background(), "karakeep", "data-pvc", "")
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	foreign := json.RawMessage(`{"kind":"ReplicationDestination","metadata":{"name":"data-pvc-dst"}}`)
+	server.SetObject(rd.Path(), foreign)
+
+	if err := planner.Apply(context.Background(), rd); !errors.Is(err, ErrUnmanaged) {
+		t.Fatalf("Apply() error = %v, want ErrUnmanaged", err)
+	}
+	if obj, _ := server.Object(rd.Path()); string(obj) != string(foreign) {
+		t.Errorf("object was overwritten: %s", obj)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	server := kubetest.NewServer()
+	defer server.Close()
+	server.AddToken("operator-token", kube.UserInfo{Username: "operator"})
+	server.Allow("operator", kube.ResourceAttributes{
+		Namespace: "karakeep", Verb: "patch", Group: Group, Resource: "replicationdestinations", Name: "data-pvc-dst",
+	})
+	planner := NewPlanner(Options{}, server.Client())
+
+	tests := []struct {
+		name      string
+		token     string
+		namespace string
+		want      error
+	}{
+		{name: "allowed", token: "operator-token", namespace: "karakeep"},
+		{name: "other namespace", token: "operator-token", namespace: "immich", want: ErrForbidden},
+		{name: "unknown token", token: "stolen-token", namespace: "karakeep", want: ErrUnauthenticated},
+		{name: "no token", namespace: "karakeep", want: ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := planner.Authorize(context.Background(), tt.token, tt.namespace, "data-pvc")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Authorize() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply_Disabled(t *testing.T) {
+	planner := NewPlanner(Options{}, nil)
+	if planner.CanApply() {
+		t.Error("CanApply() = true without a kube client")
+	}
+	err := planner.Apply(context.Background(), &ReplicationDestination{})
+	if !errors.Is(err, ErrApplyDisabled) {
+		t.Errorf("Apply() error = %v, want ErrApplyDisabled", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Package yaml renders values as block-style YAML. It goes through
+// encoding/json first, so struct tags, omitempty and field order follow the
+// JSON encoding of the value.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type field struct {
+	key   string
+	value any
+}
+
+// object preserves key order from the JSON encoding.
+type object []field
+
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decode(dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+
+	var buf bytes.Buffer
+	switch n := node.(type) {
+	case object:
+		if len(n) == 0 {
+			buf.WriteString("{}\n")
+		} else {
+			writeObject(&buf, n, 0, false)
+		}
+	case []any:
+		if len(n) == 0 {
+			buf.WriteString("[]\n")
+		} else {
+			writeArray(&buf, n, 0)
+		}
+	default:
+		buf.WriteString(scalar(n))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := object{}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decode(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, field{key: keyTok.(string), value: value})
+			}
+			_, err := dec.Token()
+			return obj, err
+		case '[':
+			arr := []any{}
+			for dec.More() {
+				value, err := decode(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, value)
+			}
+			_, err := dec.Token()
+			return arr, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	default:
+		return t, nil
+	}
+}
+
+func indent(w io.Writer, level int) {
+	_, _ = io.WriteString(w, strings.Repeat("  ", level))
+}
+
+func isEmptyCollection(v any) bool {
+	switch n := v.(type) {
+	case object:
+		return len(n) == 0
+	case []any:
+		return len(n) == 0
+	}
+	return false
+}
+
+// writeObject writes obj at level. When inline is set the first key
+// continues a "- " sequence line that has already been indented.
+func writeObject(w *bytes.Buffer, obj object, level int, inline bool) {
+	for i, f := range obj {
+		if i > 0 || !inline {
+			indent(w, level)
+		}
+		w.WriteString(scalar(f.key))
+		w.WriteByte(':')
+		writeValue(w, f.value, level+1)
+	}
+}
+
+func writeArray(w *bytes.Buffer, arr []any, level int) {
+	for _, item := range arr {
+		indent(w, level)
+		w.WriteString("- ")
+		switch n := item.(type) {
+		case object:
+			if len(n) == 0 {
+				w.WriteString("{}\n")
+				continue
+			}
+			writeObject(w, n, level+1, true)
+		case []any:
+			if len(n) == 0 {
+				w.WriteString("[]\n")
+				continue
+			}
+			w.WriteByte('\n')
+			writeArray(w, n, level+1)
+		default:
+			w.WriteString(scalar(n))
+			w.WriteByte('\n')
+		}
+	}
+}
+
+func writeValue(w *bytes.Buffer, v any, level int) {
+	switch n := v.(type) {
+	case object:
+		if isEmptyCollection(n) {
+			w.WriteString(" {}\n")
+			return
+		}
+		w.WriteByte('\n')
+		writeObject(w, n, level, false)
+	case []any:
+		if isEmptyCollection(n) {
+			w.WriteString(" []\n")
+			return
+		}
+		w.WriteByte('\n')
+		writeArray(w, n, level)
+	default:
+		w.WriteByte(' ')
+		w.WriteString(scalar(n))
+		w.WriteByte('\n')
+	}
+}
+
+func scalar(v any) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(n)
+	case json.Number:
+		return n.String()
+	case string:
+		if needsQuotes(n) {
+			return strconv.Quote(n)
+		}
+		return n
+	}
+	return fmt.Sprint(v)
+}
+
+// needsQuotes reports whether s would be read back as something other than
+// the same plain string.
+func needsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package yaml
+
+import (
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	type meta struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+	type item struct {
+		Name  string   `json:"name"`
+		Kinds []string `json:"kinds"`
+	}
+	type doc struct {
+		APIVersion string         `json:"apiVersion"`
+		Kind       string         `json:"kind"`
+		Metadata   meta           `json:"metadata"`
+		Items      []item         `json:"items"`
+		Empty      []string       `json:"empty"`
+		Extra      map[string]any `json:"extra"`
+	}
+
+	v := doc{
+		APIVersion: "volsync.backube/v1alpha1",
+		Kind:       "ReplicationDestination",
+		Metadata: meta{
+			Name:        "data-pvc-dst",
+			Annotations: map[string]string{"example.com/flag": "true"},
+		},
+		Items: []item{
+			{Name: "first", Kinds: []string{"PersistentVolumeClaim"}},
+		},
+		Empty: []string{},
+		Extra: map[string]any{"count": 3, "url": "http://svc:8080/exists/{{request.namespace}}", "tmpl": "{{ x }}"},
+	}
+
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `apiVersion: volsync.backube/v1alpha1
+kind: ReplicationDestination
+metadata:
+  name: data-pvc-dst
+  annotations:
+    example.com/flag: "true"
+items:
+  - name: first
+    kinds:
+      - PersistentVolumeClaim
+empty: []
+extra:
+  count: 3
+  tmpl: "{{ x }}"
+  url: http://svc:8080/exists/{{request.namespace}}
+`
+	if string(got) != want {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNeedsQuotes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"plain", false},
+		{"ReadWriteOnce", false},
+		{"10Gi", false},
+		{"", true},
+		{"true", true},
+		{"No", true},
+		{"123", true},
+		{"1.5", true},
+		{"- item", true},
+		{"key: value", true},
+		{"{{request.object}}", true},
+		{" padded", true},
+		{"a # comment", true},
+		{"line\nbreak", true},
+	}
+
+	for _, tt := range tests {
+		if got := needsQuotes(tt.in); got != tt.want {
+			t.Errorf("needsQuotes(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package plumber
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Error codes reported in CheckResult.ErrorCode. They are part of the API
+// and must not change.
+const (
+	CodeTimeout         = "BACKEND_TIMEOUT"
+	CodeUnavailable     = "BACKEND_UNAVAILABLE"
+	CodeThrottled       = "BACKEND_THROTTLED"
+	CodeAccessDenied    = "ACCESS_DENIED"
+	CodeNoSuchBucket    = "NO_SUCH_BUCKET"
+	CodeInvalidResponse = "INVALID_RESPONSE"
+	CodeBackendError    = "BACKEND_ERROR"
+)
+
+// CodedError is implemented by backend errors that know their error code,
+// such as parsed S3 error responses.
+type CodedError interface {
+	error
+	ErrorCode() string
+	Retryable() bool
+}
+
+// Classify returns the error code of err and whether retrying the request
+// may succeed. Errors that are not CodedErrors are classified as timeouts,
+// connection failures or BACKEND_ERROR.
+func Classify(err error) (code string, retryable bool) {
+	var coded CodedError
+	if errors.As(err, &coded) {
+		return coded.ErrorCode(), coded.Retryable()
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return CodeTimeout, true
+	case errors.As(err, new(*net.OpError)), errors.As(err, new(*net.DNSError)):
+		return CodeUnavailable, true
+	}
+	return CodeBackendError, false
+}
+
+// Failure returns the fail-open result for err.
+func Failure(err error) CheckResult {
+	code, retryable := Classify(err)
+	return CheckResult{Exists: false, Error: err.Error(), ErrorCode: code, Retryable: retryable}
+}
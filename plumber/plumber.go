@@ -0,0 +1,80 @@
+// Package plumber defines the backup check contract that pvc-plumber's
+// backends implement, with the result and repository types it uses.
+//
+// The package is not internal so that code outside this module can name
+// these types, for example to wrap the fake in backendtest or to write a
+// backend of its own.
+package plumber
+
+import (
+	"context"
+	"time"
+)
+
+// Repository formats reported in CheckResult.RepoType.
+const (
+	RepoTypeRestic  = "restic"
+	RepoTypeKopia   = "kopia"
+	RepoTypeUnknown = "unknown"
+)
+
+type CheckResult struct {
+	Exists bool `json:"exists"`
+	// KeyCount is the number of entries inspected to classify the
+	// repository, not its object count: top-level entries, capped for
+	// object stores; the blobs found by the Kopia probes; or the snapshots
+	// listed by a REST server.
+	KeyCount int    `json:"keyCount"`
+	RepoType string `json:"repoType,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	// ErrorCode classifies Error with one of the Code constants, and
+	// Retryable reports whether retrying the check may succeed.
+	ErrorCode string `json:"errorCode,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+
+	// Snapshot and RestoreAsOf are set when the request selected a
+	// snapshot; RestoreAsOf is the RFC 3339 value for a VolSync
+	// ReplicationDestination's spec.restic.restoreAsOf.
+	Snapshot    *SnapshotRef `json:"snapshot,omitempty"`
+	RestoreAsOf string       `json:"restoreAsOf,omitempty"`
+
+	// SizeBytes is the total size of the repository, when requested.
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+}
+
+// BackupChecker reports whether a backup repository exists for a PVC.
+// Failures are returned in CheckResult.Error with Exists false, so callers
+// fail open.
+type BackupChecker interface {
+	CheckBackupExists(ctx context.Context, namespace, pvc string) CheckResult
+}
+
+// SnapshotRef identifies the snapshot a check selected. Time is the
+// snapshot time from decrypted metadata, or the snapshot file's
+// modification time when only the object listing was used.
+type SnapshotRef struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+}
+
+// Repository identifies the backup repository of one PVC.
+type Repository struct {
+	Namespace string `json:"namespace"`
+	PVC       string `json:"pvc"`
+}
+
+// SnapshotFile is a file in a restic repository's snapshots/ directory.
+type SnapshotFile struct {
+	Name    string
+	ModTime time.Time
+}
+
+// RepositoryFile is a file in a repository. Path is relative to
+// {namespace}/{pvc}/, such as "data/00/{id}".
+type RepositoryFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
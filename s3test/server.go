@@ -0,0 +1,637 @@
+// Package s3test provides an in-memory S3-compatible server for tests,
+// served over httptest. It supports path-style ListObjectsV2 and ListObjects
+// (v1), HeadBucket, bucket creation, object reads and writes, DeleteObjects,
+// optional SigV4 verification, injected latency and injected error
+// responses.
+//
+// The package is not internal so that test suites outside this module, such
+// as policy integration tests, can run pvc-plumber against it.
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation names, as used by Fault and Calls.
+const (
+	OpListBuckets   = "ListBuckets"
+	OpListObjects   = "ListObjects"
+	OpListObjectsV2 = "ListObjectsV2"
+	OpHeadBucket    = "HeadBucket"
+	OpCreateBucket  = "CreateBucket"
+	OpGetObject     = "GetObject"
+	OpHeadObject    = "HeadObject"
+	OpPutObject     = "PutObject"
+	OpDeleteObject  = "DeleteObject"
+	OpDeleteObjects = "DeleteObjects"
+)
+
+// defaultMaxKeys is the page size when a listing does not set max-keys.
+const defaultMaxKeys = 1000
+
+// Object is a stored object.
+type Object struct {
+	Key          string
+	Body         []byte
+	LastModified time.Time
+}
+
+// ETag returns the quoted MD5 of the body, as S3 reports for single-part
+// uploads.
+func (o *Object) ETag() string {
+	sum := md5.Sum(o.Body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Fault is an error response served instead of performing an operation.
+type Fault struct {
+	// Op is the operation to fail, such as OpListObjectsV2. Empty matches
+	// every operation.
+	Op string
+	// Prefix limits the fault to requests whose key, or listing prefix,
+	// starts with it.
+	Prefix string
+
+	Status  int
+	Code    string
+	Message string
+	// Body, when set, is sent verbatim instead of an S3 <Error> document,
+	// like a proxy's error page.
+	Body string
+
+	// Count is how many requests fail; 0 means until ClearFaults.
+	Count int
+}
+
+// ListV2Mode is how the server answers ListObjectsV2, to emulate
+// S3-compatible stores that do not implement it.
+type ListV2Mode int
+
+const (
+	// ListV2Supported answers ListObjectsV2 requests.
+	ListV2Supported ListV2Mode = iota
+	// ListV2Rejected answers them with 501 NotImplemented.
+	ListV2Rejected
+	// ListV2Ignored ignores list-type=2 and answers with a ListObjects
+	// (v1) response, paginated by marker.
+	ListV2Ignored
+)
+
+// Server is a fake S3 service holding buckets of objects.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	buckets      map[string]map[string]*Object
+	faults       []*Fault
+	latency      time.Duration
+	pageLimit    int
+	listV2       ListV2Mode
+	omitKeyCount bool
+	creds        *Credentials
+	calls        map[string]int
+	requestID    int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		buckets: make(map[string]map[string]*Object),
+		calls:   make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// CreateBucket creates an empty bucket if it does not exist.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createBucket(name)
+}
+
+// createBucket must be called with mu held.
+func (s *Server) createBucket(name string) map[string]*Object {
+	if s.buckets[name] == nil {
+		s.buckets[name] = make(map[string]*Object)
+	}
+	return s.buckets[name]
+}
+
+// PutObject stores an object, creating the bucket if needed.
+func (s *Server) PutObject(bucket, key string, body []byte, modTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createBucket(bucket)[key] = &Object{Key: key, Body: body, LastModified: modTime.UTC()}
+}
+
+// PutResticRepository stores the layout of a restic repository at
+// {namespace}/{pvc}/ with one snapshot file per entry in snapshots.
+func (s *Server) PutResticRepository(bucket, namespace, pvc string, snapshots ...time.Time) {
+	prefix := namespace + "/" + pvc + "/"
+	created := time.Date(2026, 1, 10, 1, 46, 3, 0, time.UTC)
+	s.PutObject(bucket, prefix+"config", []byte("config"), created)
+	s.PutObject(bucket, prefix+"keys/"+objectID(0), []byte("key"), created)
+	s.PutObject(bucket, prefix+"data/00/"+objectID(1), []byte("data"), created)
+	s.PutObject(bucket, prefix+"index/"+objectID(2), []byte("index"), created)
+	for i, t := range snapshots {
+		s.PutObject(bucket, prefix+"snapshots/"+objectID(i+3), []byte("snapshot"), t)
+	}
+}
+
+// objectID returns a 64-character hex ID like restic's.
+func objectID(i int) string {
+	const hex = "0123456789abcdef"
+	id := make([]byte, 64)
+	for j := range id {
+		id[j] = hex[(i+j)%16]
+	}
+	return string(id)
+}
+
+// Keys returns the sorted keys in bucket.
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.buckets[bucket])
+}
+
+// Object returns a copy of the stored object.
+func (s *Server) Object(bucket, key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return Object{}, false
+	}
+	return *obj, true
+}
+
+// SetLatency delays every response by d, or until the request is
+// cancelled.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetPageLimit caps the keys per listing page below the requested max-keys,
+// to exercise pagination with few objects. 0 removes the cap.
+func (s *Server) SetPageLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageLimit = n
+}
+
+// SetListV2 sets how ListObjectsV2 requests are answered.
+func (s *Server) SetListV2(mode ListV2Mode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listV2 = mode
+}
+
+// SetOmitKeyCount leaves KeyCount out of ListObjectsV2 responses, as some
+// S3-compatible stores do.
+func (s *Server) SetOmitKeyCount(omit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.omitKeyCount = omit
+}
+
+// InjectFault adds a fault. Faults are matched in the order added.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Calls returns the number of requests for op, including failed ones.
+func (s *Server) Calls(op string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, errorResponse{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("x-amz-request-id"),
+	})
+}
+
+// route splits a path-style request into its operation, bucket and key.
+func route(r *http.Request) (op, bucket, key string) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		return OpListBuckets, "", ""
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		return OpListObjectsV2, bucket, ""
+	case key == "" && r.Method == http.MethodGet:
+		return OpListObjects, bucket, ""
+	case key == "" && r.Method == http.MethodHead:
+		return OpHeadBucket, bucket, ""
+	case key == "" && r.Method == http.MethodPut:
+		return OpCreateBucket, bucket, ""
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		return OpDeleteObjects, bucket, ""
+	case key != "" && r.Method == http.MethodGet:
+		return OpGetObject, bucket, key
+	case key != "" && r.Method == http.MethodHead:
+		return OpHeadObject, bucket, key
+	case key != "" && r.Method == http.MethodPut:
+		return OpPutObject, bucket, key
+	case key != "" && r.Method == http.MethodDelete:
+		return OpDeleteObject, bucket, key
+	}
+	return "", bucket, key
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	op, bucket, key := route(r)
+
+	s.mu.Lock()
+	listV2 := s.listV2
+	if op == OpListObjectsV2 && listV2 == ListV2Ignored {
+		op = OpListObjects
+	}
+	s.requestID++
+	s.calls[op]++
+	requestID, latency, creds := s.requestID, s.latency, s.creds
+	s.mu.Unlock()
+	w.Header().Set("x-amz-request-id", fmt.Sprintf("%016X", requestID))
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timer.C:
+		}
+	}
+
+	if creds != nil {
+		if status, code, message := creds.verify(r); status != 0 {
+			writeError(w, r, status, code, message)
+			return
+		}
+	}
+
+	target := key
+	if op == OpListObjectsV2 || op == OpListObjects {
+		target = r.URL.Query().Get("prefix")
+	}
+	if f := s.fault(op, target); f != nil {
+		if f.Body != "" {
+			w.WriteHeader(f.Status)
+			_, _ = io.WriteString(w, f.Body)
+			return
+		}
+		writeError(w, r, f.Status, f.Code, f.Message)
+		return
+	}
+
+	switch op {
+	case OpListObjectsV2:
+		if listV2 == ListV2Rejected {
+			writeError(w, r, http.StatusNotImplemented, "NotImplemented", "A header you provided implies functionality that is not implemented")
+			return
+		}
+	case "", OpListBuckets:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "A header you provided implies functionality that is not implemented")
+		return
+	case OpCreateBucket:
+		s.CreateBucket(bucket)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.mu.Lock()
+	_, ok := s.buckets[bucket]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch op {
+	case OpHeadBucket:
+		w.WriteHeader(http.StatusOK)
+	case OpListObjectsV2:
+		s.serveList(w, r, bucket, true)
+	case OpListObjects:
+		s.serveList(w, r, bucket, false)
+	case OpGetObject, OpHeadObject:
+		s.serveGetObject(w, r, bucket, key)
+	case OpPutObject:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.PutObject(bucket, key, body, time.Now())
+		obj, _ := s.Object(bucket, key)
+		w.Header().Set("ETag", obj.ETag())
+		w.WriteHeader(http.StatusOK)
+	case OpDeleteObject:
+		s.mu.Lock()
+		delete(s.buckets[bucket], key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case OpDeleteObjects:
+		s.serveDeleteObjects(w, r, bucket)
+	}
+}
+
+// fault returns the first fault matching op and target, consuming one of
+// its uses.
+func (s *Server) fault(op, target string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if (f.Op != "" && f.Op != op) || !strings.HasPrefix(target, f.Prefix) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func sortedKeys(objects map[string]*Object) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	Marker                *string        `xml:"Marker"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              *int           `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listing is one page of keys and common prefixes.
+type listing struct {
+	objects  []*Object
+	prefixes []string
+	// last is the final key or common prefix on the page; truncated is
+	// set when entries remain after it.
+	last      string
+	truncated bool
+}
+
+// list returns up to maxKeys entries after marker. Keys under prefix that
+// contain delimiter after it are rolled up into one common prefix, which
+// counts as a single entry.
+func (s *Server) list(bucket, prefix, delimiter, marker string, maxKeys int) listing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects := s.buckets[bucket]
+	var page listing
+	count := 0
+	for _, key := range sortedKeys(objects) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		// Entries are in key order, and every key under a common prefix
+		// maps to the same entry, so this also skips rolled-up keys.
+		if entry <= marker || entry == page.last && count > 0 {
+			continue
+		}
+		if count == maxKeys {
+			page.truncated = true
+			break
+		}
+		if entry == key {
+			obj := *objects[key]
+			page.objects = append(page.objects, &obj)
+		} else {
+			page.prefixes = append(page.prefixes, entry)
+		}
+		page.last = entry
+		count++
+	}
+	return page
+}
+
+// serveList answers ListObjectsV2 when v2 is set, and ListObjects (v1)
+// otherwise. V1 pages by marker and reports NextMarker only when a
+// delimiter is set, leaving clients to continue from the last key.
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request, bucket string, v2 bool) {
+	query := r.URL.Query()
+	maxKeys := defaultMaxKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", "max-keys must be a non-negative integer")
+			return
+		}
+		maxKeys = min(n, defaultMaxKeys)
+	}
+	s.mu.Lock()
+	if s.pageLimit > 0 {
+		maxKeys = min(maxKeys, s.pageLimit)
+	}
+	omitKeyCount := s.omitKeyCount
+	s.mu.Unlock()
+
+	marker := query.Get("marker")
+	token := query.Get("continuation-token")
+	if v2 {
+		marker = query.Get("start-after")
+		if token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+				return
+			}
+			marker = max(marker, string(decoded))
+		}
+	}
+
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	page := s.list(bucket, prefix, delimiter, marker, maxKeys)
+
+	result := listBucketResult{
+		Name:        bucket,
+		Prefix:      prefix,
+		Delimiter:   delimiter,
+		MaxKeys:     maxKeys,
+		IsTruncated: page.truncated,
+	}
+	if v2 {
+		if !omitKeyCount {
+			keyCount := len(page.objects) + len(page.prefixes)
+			result.KeyCount = &keyCount
+		}
+		result.ContinuationToken = token
+		result.StartAfter = query.Get("start-after")
+		if page.truncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(page.last))
+		}
+	} else {
+		result.Marker = &marker
+		if page.truncated && delimiter != "" {
+			result.NextMarker = page.last
+		}
+	}
+	for _, obj := range page.objects {
+		result.Contents = append(result.Contents, listObject{
+			Key:          obj.Key,
+			LastModified: obj.LastModified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         obj.ETag(),
+			Size:         len(obj.Body),
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, p := range page.prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: p})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) serveGetObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	obj, ok := s.Object(bucket, key)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(obj.Body)))
+	w.Header().Set("ETag", obj.ETag())
+	w.Header().Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(obj.Body)
+	}
+}
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []struct {
+		Key string `xml:"Key"`
+	} `xml:"Deleted"`
+}
+
+func (s *Server) serveDeleteObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	sum := md5.Sum(body)
+	if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		writeError(w, r, http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified was invalid.")
+		return
+	}
+	var req deleteRequest
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+		return
+	}
+	if len(req.Objects) > 1000 {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "The request may not delete more than 1000 objects.")
+		return
+	}
+
+	var result deleteResult
+	s.mu.Lock()
+	for _, obj := range req.Objects {
+		delete(s.buckets[bucket], obj.Key)
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, struct {
+				Key string `xml:"Key"`
+			}{obj.Key})
+		}
+	}
+	s.mu.Unlock()
+	writeXML(w, http.StatusOK, result)
+}
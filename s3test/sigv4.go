@@ -0,0 +1,164 @@
+package s3test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// Credentials are the keys that requests must be signed with. Region, when
+// set, must match the credential scope.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+}
+
+// RequireSigV4 makes the server reject requests that are not signed with
+// creds using AWS Signature Version 4 in the Authorization header.
+func (s *Server) RequireSigV4(creds Credentials) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creds = &creds
+}
+
+// verify checks the request's signature. It returns the S3 error to send,
+// or a zero status when the signature is valid.
+func (c *Credentials) verify(r *http.Request) (status int, code, message string) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return http.StatusForbidden, "AccessDenied", "Access Denied"
+	}
+	params, ok := parseAuthorization(auth)
+	if !ok {
+		return http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed"
+	}
+
+	// Credential is {access key}/{date}/{region}/{service}/aws4_request.
+	scope := strings.Split(params["Credential"], "/")
+	if len(scope) != 5 || scope[3] != "s3" || scope[4] != "aws4_request" {
+		return http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed"
+	}
+	if scope[0] != c.AccessKeyID {
+		return http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."
+	}
+	if c.Region != "" && scope[2] != c.Region {
+		return http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed; the region '" + scope[2] + "' is wrong; expecting '" + c.Region + "'"
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, scope[1]) {
+		return http.StatusForbidden, "SignatureDoesNotMatch", "X-Amz-Date does not match the credential scope"
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256"
+	}
+	if payloadHash != unsignedPayload {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return http.StatusBadRequest, "IncompleteBody", err.Error()
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != payloadHash {
+			return http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed."
+		}
+	}
+
+	signedHeaders := strings.Split(params["SignedHeaders"], ";")
+	canonical := canonicalRequest(r, signedHeaders, payloadHash)
+	digest := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		strings.Join(scope[1:], "/"),
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), scope[1])
+	for _, part := range scope[2:] {
+		key = hmacSHA256(key, part)
+	}
+	want := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(want), []byte(params["Signature"])) {
+		return http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+	return 0, "", ""
+}
+
+// parseAuthorization splits "AWS4-HMAC-SHA256 Credential=..., SignedHeaders=...,
+// Signature=..." into its parameters.
+func parseAuthorization(auth string) (map[string]string, bool) {
+	rest, ok := strings.CutPrefix(auth, sigV4Algorithm+" ")
+	if !ok {
+		return nil, false
+	}
+	params := make(map[string]string, 3)
+	for _, part := range strings.Split(rest, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, false
+		}
+		params[name] = value
+	}
+	for _, name := range []string{"Credential", "SignedHeaders", "Signature"} {
+		if params[name] == "" {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// canonicalRequest rebuilds the canonical request the client must have
+// signed. It is written independently of the client's signer, on top of
+// url.QueryEscape, so that a shared mistake would need two; the AWS
+// example requests in TestVerifySigV4 anchor it to the specification.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	segments := strings.Split(r.URL.Path, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+
+	var pairs []string
+	for name, values := range r.URL.Query() {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+
+	lines := []string{r.Method, strings.Join(segments, "/"), strings.Join(pairs, "&")}
+	for _, name := range signedHeaders {
+		value := strings.Join(r.Header.Values(name), ",")
+		if name == "host" {
+			value = r.Host
+		}
+		lines = append(lines, name+":"+strings.Join(strings.Fields(value), " "))
+	}
+	return strings.Join(append(lines, "", strings.Join(signedHeaders, ";"), payloadHash), "\n")
+}
+
+// awsEscape encodes s as SigV4 requires: everything but letters, digits and
+// "-._~" is percent-encoded, spaces included. url.QueryEscape already
+// leaves exactly those characters alone, but writes spaces as "+".
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}